@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"runtime"
 	"strings"
 	"sync"
@@ -13,11 +14,13 @@ import (
 	"github.com/cprobe/catpaw/digcore/config"
 	"github.com/cprobe/catpaw/digcore/diagnose"
 	"github.com/cprobe/catpaw/digcore/diagnose/aiclient"
+	"github.com/cprobe/catpaw/digcore/engine"
 	"github.com/cprobe/catpaw/digcore/logger"
 	"github.com/cprobe/catpaw/digcore/notify"
 	"github.com/cprobe/catpaw/digcore/pkg/choice"
 	"github.com/cprobe/catpaw/digcore/plugins"
 	"github.com/cprobe/catpaw/digcore/server"
+	"github.com/cprobe/catpaw/digcore/silence"
 	"github.com/toolkits/pkg/file"
 
 	// auto registry
@@ -35,8 +38,10 @@ import (
 	_ "github.com/cprobe/catpaw/plugins/http"
 	_ "github.com/cprobe/catpaw/plugins/journaltail"
 	_ "github.com/cprobe/catpaw/plugins/logfile"
+	_ "github.com/cprobe/catpaw/plugins/mailq"
 	_ "github.com/cprobe/catpaw/plugins/mem"
 	_ "github.com/cprobe/catpaw/plugins/mount"
+	_ "github.com/cprobe/catpaw/plugins/mysql"
 	_ "github.com/cprobe/catpaw/plugins/neigh"
 	_ "github.com/cprobe/catpaw/plugins/net"
 	_ "github.com/cprobe/catpaw/plugins/netif"
@@ -44,10 +49,13 @@ import (
 	_ "github.com/cprobe/catpaw/plugins/ping"
 	_ "github.com/cprobe/catpaw/plugins/procfd"
 	_ "github.com/cprobe/catpaw/plugins/procnum"
+	_ "github.com/cprobe/catpaw/plugins/psi"
+	_ "github.com/cprobe/catpaw/plugins/raid"
 	_ "github.com/cprobe/catpaw/plugins/redis"
 	_ "github.com/cprobe/catpaw/plugins/redis_sentinel"
 	_ "github.com/cprobe/catpaw/plugins/scriptfilter"
 	_ "github.com/cprobe/catpaw/plugins/secmod"
+	_ "github.com/cprobe/catpaw/plugins/smart"
 	_ "github.com/cprobe/catpaw/plugins/sockstat"
 	_ "github.com/cprobe/catpaw/plugins/sysctl"
 	_ "github.com/cprobe/catpaw/plugins/sysdiag"
@@ -168,7 +176,7 @@ func newRemoteProgressCallback(cb server.StreamCallback) diagnose.ProgressCallba
 }
 
 type PluginConfig struct {
-	Source      string // file || http
+	Source      string // file || remote
 	Digest      string
 	FileContent []byte
 }
@@ -181,6 +189,16 @@ type Agent struct {
 	startTime     time.Time
 	Version       string
 	sync.RWMutex
+
+	// skipped holds the digest of plugin dirs that did not start, so
+	// periodic reloads do not retry them until they change.
+	skipped     map[string]string
+	reloadMu    sync.Mutex
+	mainDigest  string
+	watchCancel context.CancelFunc
+
+	api     *http.Server
+	selfmon *selfMonitor
 }
 
 func New(version string) *Agent {
@@ -188,6 +206,7 @@ func New(version string) *Agent {
 		pluginFilters: parseFilter(config.Config.Plugins),
 		pluginConfigs: make(map[string]*PluginConfig),
 		pluginRunners: make(map[string]*PluginRunner),
+		skipped:       make(map[string]string),
 		startTime:     time.Now(),
 		Version:       version,
 	}
@@ -216,11 +235,37 @@ func (a *Agent) Start() {
 		return
 	}
 
+	silence.Init(config.Config.StateDir)
+	if err := engine.SetInhibitRules(config.Config.InhibitRules); err != nil {
+		logger.Logger.Errorw("invalid inhibit rules, inhibition disabled", "error", err)
+	}
+	engine.RestoreEvents()
+
+	// configs pushed by catpaw-server take precedence over conf.d, as long
+	// as the server may still push them
+	for name, pc := range loadRemoteConfigs() {
+		if !config.Config.Server.AllowConfigPush {
+			logger.Logger.Warnw("remote config ignored, [server] allow_config_push is off", "plugin", name)
+			continue
+		}
+		if err := checkPushedConfig(name, pc.FileContent); err != nil {
+			logger.Logger.Errorw("remote config ignored", "plugin", name, "error", err)
+			continue
+		}
+		pcs[name] = pc
+	}
+
 	for name, pc := range pcs {
 		a.LoadPlugin(name, pc)
 	}
 
+	engine.ReconcileRestored(a.restoreGraces())
+	engine.StartPersistence()
+	a.startSelfMonitor(nil)
+
 	a.startServerConn()
+	a.startConfigWatch()
+	a.startLocalAPI()
 
 	logger.Logger.Info("agent started")
 }
@@ -237,6 +282,9 @@ func (a *Agent) startServerConn() {
 		server.SetDiagnoseRunner(&diagnoseRunnerAdapter{engine: eng})
 		server.SetChatRunner(&chatRunnerAdapter{})
 	}
+	if config.Config.Server.AllowConfigPush {
+		server.SetConfigApplier(a)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	a.cancel = cancel
@@ -249,21 +297,69 @@ func (a *Agent) startServerConn() {
 	go server.RunForever(ctx, a.startTime, pluginNames, a.Version)
 }
 
-func initNotifiers() {
+// configuredNotifier is a notifier built from [notify], not yet registered.
+type configuredNotifier struct {
+	notifier notify.Notifier
+	durable  bool
+}
+
+// buildNotifiers creates the notifiers enabled in [notify]. Notifiers whose
+// config is invalid are left out and reported in errs.
+func buildNotifiers() (ret []configuredNotifier, errs []error) {
 	if cfg := config.Config.Notify.Console; cfg != nil && cfg.Enabled {
-		notify.Register(notify.NewConsoleNotifier())
+		ret = append(ret, configuredNotifier{notify.NewConsoleNotifier(), false})
 	}
 	if cfg := config.Config.Notify.Flashduty; cfg != nil && cfg.IntegrationKey != "" {
-		notify.Register(notify.NewFlashdutyNotifier(cfg))
+		ret = append(ret, configuredNotifier{notify.NewFlashdutyNotifier(cfg), true})
 	}
 	if cfg := config.Config.Notify.PagerDuty; cfg != nil && cfg.RoutingKey != "" {
-		notify.Register(notify.NewPagerDutyNotifier(cfg))
+		ret = append(ret, configuredNotifier{notify.NewPagerDutyNotifier(cfg), true})
+	}
+	for _, cfg := range config.Config.Notify.WebAPITargets() {
+		if cfg.URL == "" {
+			continue
+		}
+		n, err := notify.NewWebAPINotifier(cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webapi notifier disabled: %w", err))
+			continue
+		}
+		ret = append(ret, configuredNotifier{n, true})
+	}
+	if cfg := config.Config.Notify.Slack; cfg != nil && (cfg.WebhookURL != "" || cfg.UseAPI()) {
+		ret = append(ret, configuredNotifier{notify.NewSlackNotifier(cfg), true})
+	}
+	if cfg := config.Config.Notify.Mattermost; cfg != nil && (cfg.WebhookURL != "" || cfg.UseAPI()) {
+		ret = append(ret, configuredNotifier{notify.NewMattermostNotifier(cfg), true})
 	}
-	if cfg := config.Config.Notify.WebAPI; cfg != nil && cfg.URL != "" {
-		notify.Register(notify.NewWebAPINotifier(cfg))
+	if cfg := config.Config.Notify.Email; cfg != nil && cfg.Host != "" && len(cfg.To) > 0 {
+		if n, err := notify.NewEmailNotifier(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("email notifier disabled: %w", err))
+		} else {
+			ret = append(ret, configuredNotifier{n, !n.Digest()})
+		}
 	}
 	if config.Config.Server.Enabled {
-		notify.Register(server.NewServerNotifier())
+		ret = append(ret, configuredNotifier{server.NewServerNotifier(), false})
+	}
+	return ret, errs
+}
+
+func initNotifiers() {
+	ns, errs := buildNotifiers()
+	for _, err := range errs {
+		logger.Logger.Errorw("init notifier fail", "error", err)
+	}
+	for _, cn := range ns {
+		if cn.durable {
+			notify.RegisterDurable(cn.notifier)
+		} else {
+			notify.Register(cn.notifier)
+		}
+	}
+	notify.SetGrouping(config.Config.Notify.Group)
+	if err := notify.SetRoutes(config.Config.Notify.Routes); err != nil {
+		logger.Logger.Errorw("invalid notify routes, events go to all notifiers", "error", err)
 	}
 }
 
@@ -286,28 +382,37 @@ func (a *Agent) initDiagnoseEngine() {
 	diagnose.Init(registry)
 }
 
-func (a *Agent) LoadPlugin(name string, pc *PluginConfig) {
+// LoadPlugin starts a plugin from its config. A plugin whose Init fails is
+// still registered (the local API reports it) and the error returned.
+func (a *Agent) LoadPlugin(name string, pc *PluginConfig) error {
+	return a.loadPlugin(name, pc, false)
+}
+
+// loadPlugin starts the plugin. With strict, an instance that fails Init
+// fails the whole config: nothing is started and the error is returned.
+// Otherwise the other instances run and the failure shows in the status.
+func (a *Agent) loadPlugin(name string, pc *PluginConfig, strict bool) error {
 	if len(a.pluginFilters) > 0 {
 		// need filter by --plugins
 		_, has := a.pluginFilters[name]
 		if !has {
-			return
+			return fmt.Errorf("plugin %s filtered out by --plugins", name)
 		}
 	}
 
-	logger.Logger.Infow("loading plugin", "plugin", name)
+	logger.Logger.Infow("loading plugin", "plugin", name, "source", pc.Source)
 
 	creator, has := plugins.PluginCreators[name]
 	if !has {
 		logger.Logger.Infow("plugin not supported", "plugin", name)
-		return
+		return fmt.Errorf("plugin %s not supported", name)
 	}
 
 	pluginObject := creator()
 	err := toml.Unmarshal(pc.FileContent, pluginObject)
 	if err != nil {
 		logger.Logger.Errorw("unmarshal plugin config fail", "plugin", name, "error", err)
-		return
+		return fmt.Errorf("unmarshal plugin config: %w", err)
 	}
 
 	// structs will have value after toml.Unmarshal
@@ -315,16 +420,27 @@ func (a *Agent) LoadPlugin(name string, pc *PluginConfig) {
 	err = plugins.MayApplyPartials(pluginObject)
 	if err != nil {
 		logger.Logger.Errorw("apply partial config fail", "plugin", name, "error", err)
-		return
+		return fmt.Errorf("apply partial config: %w", err)
 	}
 
 	runner := newPluginRunner(name, pluginObject)
-	runner.start()
+	if runner.init() {
+		if err := runner.instanceInitErr(); err != nil && strict {
+			runner.stop()
+			return err
+		}
+		runner.run()
+	}
 
 	a.Lock()
 	a.pluginRunners[name] = runner
 	a.pluginConfigs[name] = pc
 	a.Unlock()
+
+	if runner.initErr != "" {
+		return fmt.Errorf("plugin init: %s", runner.initErr)
+	}
+	return nil
 }
 
 func (a *Agent) DelPlugin(name string) {
@@ -362,6 +478,11 @@ func (a *Agent) GetPluginConfig(name string) *PluginConfig {
 func (a *Agent) Stop() {
 	logger.Logger.Info("agent stopping")
 
+	a.stopLocalAPI()
+	a.stopSelfMonitor()
+	if a.watchCancel != nil {
+		a.watchCancel()
+	}
 	if a.cancel != nil {
 		a.cancel()
 	}
@@ -377,46 +498,44 @@ func (a *Agent) Stop() {
 		delete(a.pluginConfigs, name)
 	}
 
+	engine.StopPersistence()
+	notify.Shutdown()
+
 	logger.Logger.Info("agent stopped")
 }
 
-func (a *Agent) HandleChangedPlugin(names []string) {
-	for _, name := range names {
-		pc := a.GetPluginConfig(name)
-		if pc.Source != "file" {
-			continue
-		}
-
-		mtime, content, err := readPluginDir(name)
-		if err != nil {
-			logger.Logger.Errorw("read plugin dir fail", "plugin", name, "error", err)
-			continue
-		}
-
-		if mtime == -1 || len(content) == 0 {
-			a.DelPlugin(name)
-			continue
-		}
+// restoreGraces returns, per running plugin, how long a restored alert may
+// stay unrefreshed before it is considered orphaned: until the plugin's
+// slowest instance has gathered again inside its schedule. Agent-wide catpaw::* alerts get two rounds of
+// the self monitor, unless it is disabled.
+func (a *Agent) restoreGraces() map[string]time.Duration {
+	a.RLock()
+	defer a.RUnlock()
 
-		if pc.Digest == fmt.Sprint(mtime) {
-			continue
-		}
+	now := time.Now()
+	ret := make(map[string]time.Duration, len(a.pluginRunners)+1)
+	for name, runner := range a.pluginRunners {
+		ret[name] = runner.restoreGrace(now)
+	}
+	if !config.Config.SelfMonitor.Disabled {
+		ret[selfMonitorPlugin] = 2 * time.Duration(selfMonitorInterval())
+	}
+	return ret
+}
 
-		a.DelPlugin(name)
-		a.LoadPlugin(name, &PluginConfig{
-			Source:      "file",
-			Digest:      fmt.Sprint(mtime),
-			FileContent: content,
-		})
+func (a *Agent) HandleChangedPlugin(names []string) {
+	for _, name := range names {
+		a.reloadPlugin(name)
 	}
 }
 
+// Reload applies changes to the main config and to every plugin directory.
+// It runs on SIGHUP and, unless [reload] disabled = true, whenever conf.d
+// changes (see watchConfig).
 func (a *Agent) Reload() {
 	logger.Logger.Info("agent reloading")
 
-	names := a.RunningPlugins()
-	a.HandleChangedPlugin(names)
-	a.HandleNewPlugin(names)
+	a.reloadAll()
 
 	logger.Logger.Info("agent reloaded")
 }
@@ -439,20 +558,57 @@ func (a *Agent) HandleNewPlugin(names []string) {
 			continue
 		}
 
-		mtime, content, err := readPluginDir(name)
-		if err != nil {
-			logger.Logger.Errorw("read plugin dir fail", "plugin", name, "error", err)
-			continue
-		}
+		a.reloadPlugin(name)
+	}
+}
 
-		if mtime == -1 || len(content) == 0 {
-			continue
+// reloadPlugin (re)starts, stops or leaves alone one plugin depending on
+// whether the content digest of conf.d/p.{name}/ changed.
+func (a *Agent) reloadPlugin(name string) {
+	pc := a.GetPluginConfig(name)
+	if pc != nil && pc.Source != "file" {
+		return
+	}
+
+	digest, content, err := readPluginDir(name)
+	if err != nil {
+		logger.Logger.Errorw("read plugin dir fail", "plugin", name, "error", err)
+		return
+	}
+
+	if len(content) == 0 {
+		if pc != nil {
+			a.DelPlugin(name)
 		}
+		return
+	}
 
-		a.LoadPlugin(name, &PluginConfig{
-			Source:      "file",
-			Digest:      fmt.Sprint(mtime),
-			FileContent: content,
-		})
+	if pc != nil && pc.Digest == digest {
+		return
 	}
+	if pc == nil && a.skippedDigest(name) == digest {
+		// filtered out, unsupported or invalid: retry only after an edit
+		return
+	}
+
+	a.DelPlugin(name)
+	a.LoadPlugin(name, &PluginConfig{
+		Source:      "file",
+		Digest:      digest,
+		FileContent: content,
+	})
+
+	a.Lock()
+	if _, running := a.pluginRunners[name]; running {
+		delete(a.skipped, name)
+	} else {
+		a.skipped[name] = digest
+	}
+	a.Unlock()
+}
+
+func (a *Agent) skippedDigest(name string) string {
+	a.RLock()
+	defer a.RUnlock()
+	return a.skipped[name]
 }
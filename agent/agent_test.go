@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/plugins"
+)
+
+func TestRestoreGracesSelfMonitor(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(30 * time.Second)})
+
+	a := &Agent{pluginRunners: map[string]*PluginRunner{
+		"fake": {pluginName: "fake", pluginObject: &fakePlugin{}, Instances: []plugins.Instance{&slowInstance{}}},
+	}}
+	graces := a.restoreGraces()
+	if graces["fake"] != time.Minute {
+		t.Fatalf("fake grace = %s, want 1m", graces["fake"])
+	}
+	if graces[selfMonitorPlugin] != time.Minute {
+		t.Fatalf("catpaw grace = %s, want 1m (two self monitor rounds)", graces[selfMonitorPlugin])
+	}
+
+	config.Config.SelfMonitor.Interval = config.Duration(2 * time.Minute)
+	if got := a.restoreGraces()[selfMonitorPlugin]; got != 4*time.Minute {
+		t.Fatalf("catpaw grace = %s, want 4m", got)
+	}
+
+	config.Config.SelfMonitor.Disabled = true
+	if _, ok := a.restoreGraces()[selfMonitorPlugin]; ok {
+		t.Fatal("catpaw alerts should be orphaned when the self monitor is disabled")
+	}
+}
+
+func TestRestoreGraceFollowsSchedule(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(30 * time.Second)})
+
+	hourly := &slowInstance{}
+	hourly.Schedule = "0 * * * *"
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, Instances: []plugins.Instance{&slowInstance{}, hourly}}
+
+	now := time.Date(2026, 10, 12, 10, 20, 0, 0, time.Local)
+	if got, want := r.restoreGrace(now), 40*time.Minute+30*time.Second; got != want {
+		t.Fatalf("hourly cron grace = %s, want %s", got, want)
+	}
+
+	windowed := &slowInstance{}
+	windowed.ActiveWindows = []config.ActiveWindow{{Start: "09:00", End: "10:00"}}
+	r.Instances = []plugins.Instance{windowed}
+	if got, want := r.restoreGrace(now), 22*time.Hour+40*time.Minute+time.Minute; got != want {
+		t.Fatalf("windowed grace = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,391 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/engine"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// startLocalAPI serves [local_api]: read-only views of the running agent and
+// a few actions (reload, inspect, diagnose). Errors are logged; the agent
+// runs without the API.
+func (a *Agent) startLocalAPI() {
+	cfg := config.Config.LocalAPI
+	if !cfg.Enabled {
+		return
+	}
+
+	ln, err := listenLocalAPI(cfg)
+	if err != nil {
+		logger.Logger.Errorw("local api: listen fail", "listen", cfg.Listen, "error", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/status", a.apiStatus)
+	mux.HandleFunc("GET /api/v1/plugins", a.apiPlugins)
+	mux.HandleFunc("GET /api/v1/alerts", apiAlerts)
+	mux.HandleFunc("GET /api/v1/diagnose", apiDiagnoseState)
+	mux.HandleFunc("GET /api/v1/notifiers", apiNotifiers)
+	mux.HandleFunc("POST /api/v1/reload", a.apiReload)
+	mux.HandleFunc("POST /api/v1/inspect", apiSession("inspect"))
+	mux.HandleFunc("POST /api/v1/diagnose", apiSession("diagnose"))
+
+	a.api = &http.Server{
+		Handler:           apiGuard(cfg, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := a.api.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Logger.Errorw("local api: serve fail", "error", err)
+		}
+	}()
+	logger.Logger.Infow("local api listening", "listen", cfg.Listen)
+}
+
+func (a *Agent) stopLocalAPI() {
+	if a.api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.api.Shutdown(ctx); err != nil {
+		a.api.Close()
+	}
+	a.api = nil
+}
+
+func listenLocalAPI(cfg config.LocalAPIConfig) (net.Listener, error) {
+	if path, ok := cfg.UnixSocket(); ok {
+		// a socket left behind by a crashed agent blocks the listen
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0o600); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+
+	host, _, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	// reload, inspect and diagnose must not be open to the network
+	if !isLoopbackHost(host) && cfg.Token == "" {
+		return nil, fmt.Errorf("listen address %s is not loopback, [local_api] token is required", cfg.Listen)
+	}
+	return net.Listen("tcp", cfg.Listen)
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiGuard keeps web pages out of the API. A page open in a local browser
+// can send requests to 127.0.0.1, or reach it through DNS rebinding, but its
+// requests carry an Origin header and a foreign Host, and it cannot set the
+// token or a JSON content type without a CORS preflight the API never
+// answers. The token is checked on every request when set, and POST
+// endpoints need one whatever the listen address.
+func apiGuard(cfg config.LocalAPIConfig, next http.Handler) http.Handler {
+	want := []byte("Bearer " + cfg.Token)
+	_, unix := cfg.UnixSocket()
+	checkHost := false
+	if host, _, err := net.SplitHostPort(cfg.Listen); err == nil && !unix {
+		checkHost = isLoopbackHost(host)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeAPIError(w, http.StatusForbidden, "browser requests are not allowed")
+			return
+		}
+		if checkHost {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+			if !isLoopbackHost(strings.Trim(host, "[]")) {
+				writeAPIError(w, http.StatusForbidden, fmt.Sprintf("host %q is not loopback", r.Host))
+				return
+			}
+		}
+		if r.Method == http.MethodPost && cfg.Token == "" {
+			writeAPIError(w, http.StatusForbidden, "POST endpoints need [local_api] token")
+			return
+		}
+		if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+				writeAPIError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	writeAPIJSON(w, code, map[string]string{"error": msg})
+}
+
+func (a *Agent) apiStatus(w http.ResponseWriter, r *http.Request) {
+	a.RLock()
+	pluginCount := len(a.pluginRunners)
+	a.RUnlock()
+
+	writeAPIJSON(w, http.StatusOK, map[string]any{
+		"version":        a.Version,
+		"hostname":       config.AgentHostname(),
+		"ip":             config.AgentIP(),
+		"start_time":     a.startTime.Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(a.startTime).Seconds()),
+		"config_dir":     config.Config.ConfigDir,
+		"plugins":        pluginCount,
+		"active_alerts":  engine.Events.Len(),
+		"ai_enabled":     diagnose.GlobalEngine() != nil,
+		"server_enabled": config.Config.Server.Enabled,
+		"goroutines":     runtime.NumGoroutine(),
+	})
+}
+
+type apiInstance struct {
+	Index      int               `json:"index"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Interval   string            `json:"interval"`
+	LastGather *time.Time        `json:"last_gather,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	Events     int               `json:"events"`
+	Skipped    int               `json:"skipped,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	InitError  string            `json:"init_error,omitempty"`
+}
+
+type apiPlugin struct {
+	Name      string        `json:"name"`
+	Source    string        `json:"source"`
+	InitError string        `json:"init_error,omitempty"`
+	Instances []apiInstance `json:"instances"`
+}
+
+func (a *Agent) apiPlugins(w http.ResponseWriter, r *http.Request) {
+	a.RLock()
+	ret := make([]apiPlugin, 0, len(a.pluginRunners))
+	for name, runner := range a.pluginRunners {
+		p := apiPlugin{
+			Name:      name,
+			InitError: runner.initErr,
+			Instances: make([]apiInstance, len(runner.Instances)),
+		}
+		if pc := a.pluginConfigs[name]; pc != nil {
+			p.Source = pc.Source
+		}
+		for i, ins := range runner.Instances {
+			p.Instances[i] = runner.apiInstance(i, ins)
+		}
+		ret = append(ret, p)
+	}
+	a.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	writeAPIJSON(w, http.StatusOK, ret)
+}
+
+func (r *PluginRunner) apiInstance(i int, ins plugins.Instance) apiInstance {
+	ai := apiInstance{
+		Index:    i,
+		Labels:   ins.GetLabels(),
+		Interval: time.Duration(r.instanceInterval(ins)).String(),
+	}
+	if i >= len(r.statuses) {
+		return ai
+	}
+
+	st := r.statuses[i]
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.lastGather.IsZero() {
+		t := st.lastGather
+		ai.LastGather = &t
+	}
+	ai.DurationMs = st.duration.Milliseconds()
+	ai.Events = st.events
+	ai.Skipped = st.skipped
+	ai.Error = st.lastErr
+	ai.InitError = st.initErr
+	return ai
+}
+
+type apiAlert struct {
+	*types.Event
+	FirstFireTime int64  `json:"first_fire_time"`
+	NotifyCount   int64  `json:"notify_count"`
+	LastSent      int64  `json:"last_sent"`
+	InhibitedBy   string `json:"inhibited_by,omitempty"`
+}
+
+func apiAlerts(w http.ResponseWriter, r *http.Request) {
+	events := engine.Events.List()
+	sort.Slice(events, func(i, j int) bool { return events[i].FirstFireTime < events[j].FirstFireTime })
+
+	ret := make([]apiAlert, len(events))
+	for i, event := range events {
+		ret[i] = apiAlert{
+			Event:         event,
+			FirstFireTime: event.FirstFireTime,
+			NotifyCount:   event.NotifyCount,
+			LastSent:      event.LastSent,
+			InhibitedBy:   engine.Events.InhibitedBy(event.AlertKey),
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, ret)
+}
+
+func apiDiagnoseState(w http.ResponseWriter, r *http.Request) {
+	eng := diagnose.GlobalEngine()
+	if eng == nil {
+		writeAPIJSON(w, http.StatusOK, map[string]any{"enabled": false})
+		return
+	}
+
+	running, limit := eng.Running()
+	pending := 0
+	if agg := diagnose.GlobalAggregator(); agg != nil {
+		pending = agg.Pending()
+	}
+	date, input, output := eng.State().Usage()
+	writeAPIJSON(w, http.StatusOK, map[string]any{
+		"enabled":           true,
+		"running":           running,
+		"max_concurrent":    limit,
+		"pending":           pending,
+		"date":              date,
+		"input_tokens":      input,
+		"output_tokens":     output,
+		"total_tokens":      input + output,
+		"daily_token_limit": config.Config.AI.DailyTokenLimit,
+	})
+}
+
+func apiNotifiers(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, notify.Names())
+}
+
+func (a *Agent) apiReload(w http.ResponseWriter, r *http.Request) {
+	a.Reload()
+	writeAPIJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+// apiSession runs an inspect or diagnose session like the server's
+// session_start does, streaming its output as JSON lines. The body holds the
+// session params: plugin, target and, for diagnose, descriptions.
+func apiSession(sessionType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eng := diagnose.GlobalEngine()
+		if eng == nil {
+			writeAPIError(w, http.StatusServiceUnavailable, "diagnose engine not available")
+			return
+		}
+
+		params := make(map[string]any)
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				writeAPIError(w, http.StatusBadRequest, "invalid params: "+err.Error())
+				return
+			}
+		}
+		plugin, _ := params["plugin"].(string)
+		target, _ := params["target"].(string)
+		if sessionType == "inspect" && plugin == "" {
+			writeAPIError(w, http.StatusBadRequest, "plugin is required for inspect")
+			return
+		}
+		if plugin == "" {
+			plugin = "system"
+		}
+		if target == "" {
+			target = "localhost"
+		}
+		mode := "inspect"
+		if sessionType == "diagnose" {
+			mode = "alert"
+		}
+
+		if !eng.TrySem() {
+			writeAPIError(w, http.StatusTooManyRequests, "max concurrent sessions reached")
+			return
+		}
+		defer eng.ReleaseSem()
+
+		logger.Logger.Infow("local api session started",
+			"session_type", sessionType, "plugin", plugin, "target", target)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+
+		var mu sync.Mutex
+		enc := json.NewEncoder(w)
+		emit := func(v map[string]any) {
+			mu.Lock()
+			defer mu.Unlock()
+			enc.Encode(v)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		runner := &diagnoseRunnerAdapter{engine: eng}
+		report, err := runner.RunStreaming(r.Context(), mode, plugin, target, params,
+			func(delta, stage string, done bool, metadata map[string]any) {
+				emit(map[string]any{"stage": stage, "delta": delta})
+			})
+		if err != nil {
+			if r.Context().Err() == nil {
+				emit(map[string]any{"done": true, "error": err.Error()})
+			}
+			return
+		}
+		emit(map[string]any{"done": true, "report": strings.TrimSpace(report)})
+	}
+}
@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/config"
+)
+
+func TestListenLocalAPIRequiresTokenBeyondLoopback(t *testing.T) {
+	for _, listen := range []string{"0.0.0.0:0", ":0", "[::]:0"} {
+		_, err := listenLocalAPI(config.LocalAPIConfig{Listen: listen})
+		if err == nil || !strings.Contains(err.Error(), "token is required") {
+			t.Fatalf("%s without token: err = %v, want token is required", listen, err)
+		}
+	}
+
+	for _, cfg := range []config.LocalAPIConfig{
+		{Listen: "127.0.0.1:0"},
+		{Listen: "localhost:0"},
+		{Listen: "0.0.0.0:0", Token: "s3cret"},
+	} {
+		ln, err := listenLocalAPI(cfg)
+		if err != nil {
+			t.Fatalf("%s (token %q): %v", cfg.Listen, cfg.Token, err)
+		}
+		ln.Close()
+	}
+}
+
+func TestAPIGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	loopback := config.LocalAPIConfig{Listen: "127.0.0.1:9099"}
+	withToken := config.LocalAPIConfig{Listen: "127.0.0.1:9099", Token: "s3cret"}
+	network := config.LocalAPIConfig{Listen: "0.0.0.0:9099", Token: "s3cret"}
+	unix := config.LocalAPIConfig{Listen: "unix:/run/catpaw/api.sock", Token: "s3cret"}
+
+	tests := []struct {
+		name   string
+		cfg    config.LocalAPIConfig
+		method string
+		host   string
+		header map[string]string
+		want   int
+	}{
+		{"loopback get", loopback, "GET", "127.0.0.1:9099", nil, http.StatusOK},
+		{"localhost get", loopback, "GET", "localhost:9099", nil, http.StatusOK},
+		{"ipv6 loopback get", loopback, "GET", "[::1]:9099", nil, http.StatusOK},
+		{"rebound host", loopback, "GET", "evil.example.com:9099", nil, http.StatusForbidden},
+		{"browser origin", loopback, "GET", "127.0.0.1:9099", map[string]string{"Origin": "http://evil.example.com"}, http.StatusForbidden},
+		{"post without configured token", loopback, "POST", "127.0.0.1:9099",
+			map[string]string{"Content-Type": "application/json"}, http.StatusForbidden},
+		{"post without token", withToken, "POST", "127.0.0.1:9099",
+			map[string]string{"Content-Type": "application/json"}, http.StatusUnauthorized},
+		{"post with token", withToken, "POST", "127.0.0.1:9099",
+			map[string]string{"Content-Type": "application/json", "Authorization": "Bearer s3cret"}, http.StatusOK},
+		{"post form", withToken, "POST", "127.0.0.1:9099",
+			map[string]string{"Content-Type": "text/plain", "Authorization": "Bearer s3cret"}, http.StatusUnsupportedMediaType},
+		{"post json with charset", withToken, "POST", "127.0.0.1:9099",
+			map[string]string{"Content-Type": "application/json; charset=utf-8", "Authorization": "Bearer s3cret"}, http.StatusOK},
+		{"get without token", withToken, "GET", "127.0.0.1:9099", nil, http.StatusUnauthorized},
+		{"network host with token", network, "GET", "10.0.0.8:9099", map[string]string{"Authorization": "Bearer s3cret"}, http.StatusOK},
+		{"unix socket post", unix, "POST", "catpaw",
+			map[string]string{"Content-Type": "application/json", "Authorization": "Bearer s3cret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/reload", nil)
+			req.Host = tt.host
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			apiGuard(tt.cfg, ok).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
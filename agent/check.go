@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/engine"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/toolkits/pkg/file"
+)
+
+// checkResult collects the problems found in one config scope: the main
+// config or one plugin directory.
+type checkResult struct {
+	scope    string
+	summary  string
+	problems []string
+}
+
+func (r *checkResult) addf(format string, args ...any) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// RunCheckConfig validates config.toml and every conf.d/p.* directory the
+// way the agent would load them, without starting any gather loop or
+// notifier. It prints a report and returns an error when anything is wrong.
+func RunCheckConfig() error {
+	results := []*checkResult{checkMainConfig()}
+
+	pluginResults, err := checkPluginConfigs()
+	if err != nil {
+		return err
+	}
+	results = append(results, pluginResults...)
+
+	var failed int
+	for _, r := range results {
+		if len(r.problems) == 0 {
+			if r.summary != "" {
+				fmt.Printf("[OK]   %s: %s\n", r.scope, r.summary)
+			} else {
+				fmt.Printf("[OK]   %s\n", r.scope)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("[FAIL] %s\n", r.scope)
+		for _, p := range r.problems {
+			fmt.Printf("       - %s\n", p)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d config scopes have problems", failed, len(results))
+	}
+	fmt.Printf("\nconfig ok: %s\n", config.Config.ConfigDir)
+	return nil
+}
+
+func checkMainConfig() *checkResult {
+	r := &checkResult{scope: "main config"}
+	dir := config.Config.ConfigDir
+
+	files, err := file.FilesUnder(dir)
+	if err != nil {
+		r.addf("list %s: %v", dir, err)
+		return r
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".toml") {
+			continue
+		}
+		md, err := toml.DecodeFile(path.Join(dir, f), &config.ConfigType{})
+		if err != nil {
+			r.addf("%s: %v", f, err)
+			continue
+		}
+		for _, key := range md.Undecoded() {
+			r.addf("%s: unknown key %s", f, key)
+		}
+	}
+
+	if config.Config.AI.Enabled {
+		if err := config.Config.AI.Validate(); err != nil {
+			r.addf("ai: %v", err)
+		}
+	}
+
+	ns, errs := buildNotifiers()
+	for _, err := range errs {
+		r.addf("notify: %v", err)
+	}
+	names := make([]string, 0, len(ns))
+	for _, cn := range ns {
+		names = append(names, cn.notifier.Name())
+	}
+	if err := notify.ValidateRoutes(config.Config.Notify.Routes, names); err != nil {
+		r.addf("notify: %v", err)
+	}
+	for _, name := range config.Config.Notify.Group.Notifiers {
+		if !containsString(names, name) {
+			r.addf("notify.group: notifier %q is not configured", name)
+		}
+	}
+
+	if err := engine.ValidateInhibitRules(config.Config.InhibitRules); err != nil {
+		r.addf("%v", err)
+	}
+
+	r.summary = fmt.Sprintf("notifiers: %s", strings.Join(names, ", "))
+	if len(names) == 0 {
+		r.summary = "no notifiers enabled"
+	}
+	return r
+}
+
+func checkPluginConfigs() ([]*checkResult, error) {
+	dirs, err := file.DirsUnder(config.Config.ConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config dirs: %v", err)
+	}
+	sort.Strings(dirs)
+
+	var ret []*checkResult
+	for _, dir := range dirs {
+		if !strings.HasPrefix(dir, "p.") {
+			continue
+		}
+		ret = append(ret, checkPluginConfig(dir[len("p."):]))
+	}
+	return ret, nil
+}
+
+// checkPluginConfig unmarshals one plugin directory, runs ApplyPartials and
+// Init on every instance and compiles its schedule. Drop is not called: a
+// Dropper may persist state owned by a running agent, and the process exits
+// right after.
+func checkPluginConfig(name string) *checkResult {
+	r := &checkResult{scope: "p." + name}
+
+	creator, ok := plugins.PluginCreators[name]
+	if !ok {
+		r.addf("unknown plugin %q", name)
+		return r
+	}
+
+	_, content, err := readPluginDir(name)
+	if err != nil {
+		r.addf("%v", err)
+		return r
+	}
+	if len(content) == 0 {
+		r.summary = "no .toml files, skipped"
+		return r
+	}
+
+	pluginObject := creator()
+	md, err := toml.Decode(string(content), pluginObject)
+	if err != nil {
+		r.addf("unmarshal: %v", err)
+		return r
+	}
+	for _, key := range md.Undecoded() {
+		r.addf("unknown key %s", key)
+	}
+
+	if err := plugins.MayApplyPartials(pluginObject); err != nil {
+		r.addf("apply partials: %v", err)
+		return r
+	}
+	if err := plugins.MayPluginInit(pluginObject); err != nil {
+		r.addf("plugin init: %v", err)
+		return r
+	}
+
+	runner := newPluginRunner(name, pluginObject)
+	instances := plugins.MayGetInstances(pluginObject)
+	for i, ins := range instances {
+		if err := plugins.MayInit(ins); err != nil {
+			r.addf("instances[%d]: %v", i, err)
+		}
+		if _, err := runner.instanceSchedule(ins); err != nil {
+			r.addf("instances[%d]: %v", i, err)
+		}
+	}
+	r.summary = fmt.Sprintf("%d instances", len(instances))
+	return r
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"path"
 	"sort"
@@ -25,17 +27,17 @@ func loadFileConfigs() (map[string]*PluginConfig, error) {
 
 		name := dir[len("p."):]
 
-		mtime, content, err := readPluginDir(name)
+		digest, content, err := readPluginDir(name)
 		if err != nil {
 			return nil, err
 		}
 
-		if mtime == -1 || len(content) == 0 {
+		if len(content) == 0 {
 			continue
 		}
 
 		ret[name] = &PluginConfig{
-			Digest:      fmt.Sprint(mtime),
+			Digest:      digest,
 			FileContent: content,
 			Source:      "file",
 		}
@@ -44,19 +46,22 @@ func loadFileConfigs() (map[string]*PluginConfig, error) {
 	return ret, nil
 }
 
-// readPluginDir reads all .toml files under conf.d/p.{name}/, returning
-// the max mtime and concatenated content. mtime == -1 means no .toml files found.
-func readPluginDir(name string) (int64, []byte, error) {
+// readPluginDir reads all .toml files under conf.d/p.{name}/, returning a
+// sha256 digest and the concatenated content. Empty content means no .toml
+// files were found (or the directory is gone).
+func readPluginDir(name string) (string, []byte, error) {
 	pluginDir := path.Join(config.Config.ConfigDir, "p."+name)
+	if !file.IsExist(pluginDir) {
+		return "", nil, nil
+	}
 
 	files, err := file.FilesUnder(pluginDir)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to list files under %s: %v", pluginDir, err)
+		return "", nil, fmt.Errorf("failed to list files under %s: %v", pluginDir, err)
 	}
 
 	sort.Strings(files)
 
-	var maxmt int64 = -1
 	var content []byte
 	var tomlCount int
 
@@ -66,14 +71,6 @@ func readPluginDir(name string) (int64, []byte, error) {
 		}
 
 		fp := path.Join(pluginDir, f)
-		mtime, err := file.FileMTime(fp)
-		if err != nil {
-			return 0, nil, fmt.Errorf("failed to get mtime of %s: %v", fp, err)
-		}
-
-		if mtime > maxmt {
-			maxmt = mtime
-		}
 
 		if tomlCount > 0 {
 			content = append(content, '\n', '\n')
@@ -81,14 +78,15 @@ func readPluginDir(name string) (int64, []byte, error) {
 
 		bs, err := file.ReadBytes(fp)
 		if err != nil {
-			return 0, nil, fmt.Errorf("failed to read %s: %v", fp, err)
+			return "", nil, fmt.Errorf("failed to read %s: %v", fp, err)
 		}
 
 		content = append(content, bs...)
 		tomlCount++
 	}
 
-	return maxmt, content, nil
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), content, nil
 }
 
 func parseFilter(filterStr string) map[string]struct{} {
@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/engine"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// Exit codes of 'catpaw test', following the Nagios plugin convention.
+const (
+	oneShotExitOk       = 0
+	oneShotExitWarning  = 1
+	oneShotExitCritical = 2
+	oneShotExitError    = 3
+)
+
+// RunOneShot loads conf.d/p.<pluginName>, gathers every instance once and
+// prints the resulting events (format "table", "text" or "json"). Each gather is given
+// the instance's gather timeout. Events go nowhere
+// else: no event cache, notifiers or AI diagnosis are involved. The returned
+// exit code reflects the worst event status, or oneShotExitError when an
+// instance failed to initialize (Nagios style: 0 ok, 1 warning, 2 critical,
+// 3 error).
+func RunOneShot(pluginName, format string) (int, error) {
+	if format != "table" && format != "text" && format != "json" {
+		return oneShotExitError, fmt.Errorf("unknown format %q, want table, text or json", format)
+	}
+
+	creator, ok := plugins.PluginCreators[pluginName]
+	if !ok {
+		return oneShotExitError, fmt.Errorf("unknown plugin: %q\nAvailable: %s", pluginName, availablePluginNames())
+	}
+
+	_, content, err := readPluginDir(pluginName)
+	if err != nil {
+		return oneShotExitError, err
+	}
+	if len(content) == 0 {
+		return oneShotExitError, fmt.Errorf("no .toml config files found in %s/p.%s", config.Config.ConfigDir, pluginName)
+	}
+
+	pluginObject := creator()
+	if err := toml.Unmarshal(content, pluginObject); err != nil {
+		return oneShotExitError, fmt.Errorf("unmarshal plugin config: %w", err)
+	}
+	if err := plugins.MayApplyPartials(pluginObject); err != nil {
+		return oneShotExitError, fmt.Errorf("apply partial config: %w", err)
+	}
+	if err := plugins.MayPluginInit(pluginObject); err != nil {
+		return oneShotExitError, fmt.Errorf("plugin init: %w", err)
+	}
+	defer plugins.MayPluginDrop(pluginObject)
+
+	var (
+		mu     sync.Mutex
+		events []*types.Event
+	)
+	runner := newPluginRunner(pluginName, pluginObject)
+	runner.push = func(name string, p plugins.Plugin, ins plugins.Instance, queue *safe.Queue[*types.Event]) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, engine.CleanRawEvents(name, p, ins, queue)...)
+	}
+
+	// Instances are not dropped afterwards: a Dropper may persist state
+	// (e.g. logfile offsets) owned by a running agent.
+	code := oneShotExitOk
+	instances := plugins.MayGetInstances(pluginObject)
+	for i, ins := range instances {
+		if err := plugins.MayInit(ins); err != nil {
+			fmt.Fprintf(os.Stderr, "instances[%d]: init fail: %v\n", i, err)
+			code = oneShotExitError
+			continue
+		}
+		runner.gatherOnce(ins)
+	}
+
+	// a gather that timed out may still push its events late
+	mu.Lock()
+	events = append([]*types.Event(nil), events...)
+	mu.Unlock()
+
+	switch format {
+	case "json":
+		if events == nil {
+			events = []*types.Event{}
+		}
+		bs, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			return oneShotExitError, err
+		}
+		fmt.Println(string(bs))
+	case "text":
+		printOneShotEvents(os.Stdout, events, len(instances))
+	default:
+		printOneShotTable(os.Stdout, events, len(instances))
+	}
+
+	if code == oneShotExitError {
+		return code, nil
+	}
+	for _, event := range events {
+		switch event.EventStatus {
+		case types.EventStatusCritical:
+			code = oneShotExitCritical
+		case types.EventStatusWarning:
+			if code < oneShotExitWarning {
+				code = oneShotExitWarning
+			}
+		}
+	}
+	return code, nil
+}
+
+// gatherOnce gathers ins and waits for it at most the instance's gather
+// timeout. A gather that does not return in time is left behind and reported
+// as catpaw::gather_timeout, like the running agent does.
+func (r *PluginRunner) gatherOnce(ins plugins.Instance) {
+	timeout := r.instanceGatherTimeout(ins)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.gatherInstancePlugin(ctx, ins, false)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		select {
+		case <-done:
+		case <-time.After(cancelGrace):
+			queue := safe.NewQueue[*types.Event]()
+			queue.PushFront(r.selfEvent("catpaw::gather_timeout", types.EventStatusCritical,
+				fmt.Sprintf("gather did not finish within %s", timeout)))
+			r.push(r.pluginName, r.pluginObject, ins, queue)
+		}
+	}
+}
+
+// printOneShotTable prints one aligned row per event.
+func printOneShotTable(out io.Writer, events []*types.Event, instances int) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tTARGET\tVALUE\tDESCRIPTION")
+	for _, event := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", event.EventStatus, tableCell(event.Labels["check"]),
+			tableCell(event.Labels["target"]), tableCell(event.Attrs[types.AttrCurrentValue]), tableCell(event.Description))
+	}
+	tw.Flush()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, oneShotSummary(events, instances))
+}
+
+// tableCell keeps a value on one line and out of the column separators.
+func tableCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printOneShotEvents prints one block per event, with its alert key, labels
+// and attrs.
+func printOneShotEvents(out io.Writer, events []*types.Event, instances int) {
+	for _, event := range events {
+		fmt.Fprintf(out, "[%s] %s  target=%s\n", event.EventStatus, event.Labels["check"], event.Labels["target"])
+		fmt.Fprintf(out, "  alert_key:   %s\n", event.AlertKey)
+		if event.Description != "" {
+			desc := strings.ReplaceAll(strings.TrimSpace(event.Description), "\n", "\n               ")
+			fmt.Fprintf(out, "  description: %s\n", desc)
+		}
+		fmt.Fprintf(out, "  labels:      %s\n", joinKV(event.Labels))
+		if len(event.Attrs) > 0 {
+			// attr values are free text, one per line keeps them readable
+			fmt.Fprintln(out, "  attrs:")
+			for _, k := range sortedKeys(event.Attrs) {
+				fmt.Fprintf(out, "    %s: %s\n", k, event.Attrs[k])
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintln(out, oneShotSummary(events, instances))
+}
+
+func oneShotSummary(events []*types.Event, instances int) string {
+	counts := make(map[string]int)
+	for _, event := range events {
+		counts[event.EventStatus]++
+	}
+
+	var parts []string
+	for _, status := range []string{types.EventStatusCritical, types.EventStatusWarning, types.EventStatusInfo, types.EventStatusOk} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	summary := fmt.Sprintf("%d events from %d instances", len(events), instances)
+	if len(parts) > 0 {
+		summary += ": " + strings.Join(parts, ", ")
+	}
+	return summary
+}
+
+func joinKV(m map[string]string) string {
+	keys := sortedKeys(m)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + m[k]
+	}
+	return strings.Join(pairs, " ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func TestGatherOnce(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(30 * time.Second)})
+
+	rec := &eventRecorder{}
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, push: rec.push}
+	r.gatherOnce(&slowInstance{})
+	if rec.find("fake::ok", types.EventStatusOk) == nil {
+		t.Fatal("gatherOnce should return the events of the gather")
+	}
+	if rec.find("catpaw::gather_timeout", types.EventStatusCritical) != nil {
+		t.Fatal("a gather within the timeout should not be reported as timed out")
+	}
+}
+
+func TestGatherOnceTimeout(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(30 * time.Second)})
+
+	release := make(chan struct{})
+	defer close(release)
+	ins := &slowInstance{block: release}
+	ins.GatherTimeout = config.Duration(20 * time.Millisecond)
+
+	rec := &eventRecorder{}
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, push: rec.push}
+	start := time.Now()
+	r.gatherOnce(ins)
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("gatherOnce should give up after the gather timeout, took %s", took)
+	}
+	if rec.find("catpaw::gather_timeout", types.EventStatusCritical) == nil {
+		t.Fatal("a gather past its timeout should be reported")
+	}
+}
+
+func TestPrintOneShotTable(t *testing.T) {
+	events := []*types.Event{
+		types.BuildEvent(map[string]string{"check": "disk::space_usage", "target": "/"}).
+			SetEventStatus(types.EventStatusCritical).SetCurrentValue("93.1%").
+			SetDescription("usage 93.1%\nabove critical threshold 90%"),
+		types.BuildEvent(map[string]string{"check": "disk::inode_usage"}),
+	}
+
+	var buf bytes.Buffer
+	printOneShotTable(&buf, events, 1)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{
+		"STATUS    CHECK              TARGET  VALUE  DESCRIPTION",
+		"Critical  disk::space_usage  /       93.1%  usage 93.1% above critical threshold 90%",
+		"Ok        disk::inode_usage  -       -      -",
+		"",
+		"2 events from 1 instances: 1 Critical, 1 Ok",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i := range want {
+		if strings.TrimRight(lines[i], " ") != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
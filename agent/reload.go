@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/engine"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/pkg/cfg"
+	"github.com/cprobe/catpaw/digcore/server"
+)
+
+// mainConfigChange is the name watchConfigDir reports for files directly
+// under conf.d; plugin directories are reported by plugin name.
+const mainConfigChange = ""
+
+func (a *Agent) startConfigWatch() {
+	digest, err := cfg.DigestDir(config.Config.ConfigDir)
+	if err != nil {
+		logger.Logger.Warnw("digest main config fail", "error", err)
+	}
+	a.mainDigest = digest
+
+	if config.Config.Reload.Disabled {
+		logger.Logger.Infow("config auto reload disabled, reload with SIGHUP")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.watchCancel = cancel
+	go a.watchConfig(ctx)
+}
+
+// watchConfig reloads what changed under conf.d. Bursts of file events (an
+// editor saving, a config management run) are debounced into one reload.
+// Where inotify is not available conf.d is polled instead.
+func (a *Agent) watchConfig(ctx context.Context) {
+	rc := config.Config.Reload
+
+	changes := make(chan string, 64)
+	if err := watchConfigDir(ctx, config.Config.ConfigDir, changes); err != nil {
+		logger.Logger.Warnw("config watch unavailable, polling conf.d",
+			"error", err, "interval", time.Duration(rc.PollInterval))
+		a.pollConfig(ctx, time.Duration(rc.PollInterval))
+		return
+	}
+	logger.Logger.Infow("watching config dir", "dir", config.Config.ConfigDir)
+
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	pending := make(map[string]struct{})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case name := <-changes:
+			pending[name] = struct{}{}
+			debounce.Reset(time.Duration(rc.Debounce))
+		case <-debounce.C:
+			a.reloadChanged(pending)
+			pending = make(map[string]struct{})
+		}
+	}
+}
+
+func (a *Agent) pollConfig(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.reloadAll()
+		}
+	}
+}
+
+func (a *Agent) reloadAll() {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.reloadMainConfig()
+	names := a.RunningPlugins()
+	a.HandleChangedPlugin(names)
+	a.HandleNewPlugin(names)
+}
+
+func (a *Agent) reloadChanged(names map[string]struct{}) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if _, ok := names[mainConfigChange]; ok {
+		a.reloadMainConfig()
+	}
+	for name := range names {
+		if name != mainConfigChange {
+			a.reloadPlugin(name)
+		}
+	}
+}
+
+// reloadMainConfig re-reads config.toml (and the other files directly under
+// conf.d) when their content changed, and re-initializes only the parts
+// whose settings differ. [server], [log] and [local_api] changes need a
+// restart.
+func (a *Agent) reloadMainConfig() {
+	digest, err := cfg.DigestDir(config.Config.ConfigDir)
+	if err != nil {
+		logger.Logger.Errorw("digest main config fail", "error", err)
+		return
+	}
+	if digest == a.mainDigest {
+		return
+	}
+	a.mainDigest = digest
+
+	old, err := config.ReloadConfig()
+	if err != nil {
+		logger.Logger.Errorw("reload main config fail, keeping the running config", "error", err)
+		return
+	}
+	cur := config.Config
+	logger.Logger.Infow("main config changed, reloading")
+
+	if !reflect.DeepEqual(old.Notify, cur.Notify) {
+		notify.Reload(initNotifiers)
+		logger.Logger.Infow("notifiers reloaded")
+	}
+
+	if !reflect.DeepEqual(old.InhibitRules, cur.InhibitRules) {
+		if err := engine.SetInhibitRules(cur.InhibitRules); err != nil {
+			logger.Logger.Errorw("invalid inhibit rules, inhibition disabled", "error", err)
+		}
+	}
+
+	if !reflect.DeepEqual(old.AI, cur.AI) {
+		diagnose.Shutdown()
+		a.initDiagnoseEngine()
+		if eng := diagnose.GlobalEngine(); eng != nil && cur.Server.Enabled {
+			server.SetConcurrencyLimiter(eng)
+			server.SetDiagnoseRunner(&diagnoseRunnerAdapter{engine: eng})
+		}
+		logger.Logger.Infow("AI config reloaded")
+	}
+
+	if old.Global.Interval != cur.Global.Interval || old.Global.IntervalJitter != cur.Global.IntervalJitter ||
+		old.Global.IntervalSpread != cur.Global.IntervalSpread {
+		// runners read the default interval and schedule when they start
+		for _, name := range a.RunningPlugins() {
+			if pc := a.GetPluginConfig(name); pc != nil {
+				a.DelPlugin(name)
+				a.LoadPlugin(name, pc)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(old.SelfMonitor, cur.SelfMonitor) || old.Global.Interval != cur.Global.Interval {
+		a.startSelfMonitor(a.stopSelfMonitor())
+	}
+
+	if !reflect.DeepEqual(old.Server, cur.Server) || !reflect.DeepEqual(old.LogConfig, cur.LogConfig) ||
+		!reflect.DeepEqual(old.LocalAPI, cur.LocalAPI) {
+		logger.Logger.Warnw("changes to [server], [log] or [local_api] take effect after a restart")
+	}
+}
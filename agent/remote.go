@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/secret"
+	"github.com/cprobe/catpaw/digcore/server"
+)
+
+// Plugin configs pushed by catpaw-server are kept in state.d/remote_conf.d,
+// one <plugin>.toml per plugin, so the agent runs them again after a restart
+// without waiting for the server. A remote config replaces conf.d/p.<plugin>/
+// until the server deletes it.
+//
+// Config push is off unless [server] allow_config_push is set. Even then a
+// pushed config may not resolve exec: secrets, and the plugins that run
+// commands named in their config only when listed in
+// [server] config_push_exec_plugins.
+
+// execPlugins run commands or binaries their config names.
+var execPlugins = map[string]bool{
+	"exec":         true,
+	"scriptfilter": true,
+	"smart":        true,
+}
+
+// checkPushedConfig rejects pushed content that would let the server run
+// commands on the agent.
+func checkPushedConfig(name string, content []byte) error {
+	if execPlugins[name] && !containsString(config.Config.Server.ConfigPushExecPlugins, name) {
+		return fmt.Errorf("plugin %s runs commands, not in [server] config_push_exec_plugins", name)
+	}
+	var doc map[string]any
+	if err := toml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("unmarshal plugin config: %w", err)
+	}
+	if key := findExecRef("", doc); key != "" {
+		return fmt.Errorf("%s: exec: secret references are not allowed in pushed configs", key)
+	}
+	return nil
+}
+
+// findExecRef returns the key of the first string value in v that is an
+// exec: reference.
+func findExecRef(key string, v any) string {
+	switch v := v.(type) {
+	case string:
+		if secret.IsExecRef(v) {
+			return key
+		}
+	case map[string]any:
+		for k, child := range v {
+			name := k
+			if key != "" {
+				name = key + "." + k
+			}
+			if found := findExecRef(name, child); found != "" {
+				return found
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if found := findExecRef(fmt.Sprintf("%s[%d]", key, i), child); found != "" {
+				return found
+			}
+		}
+	case []map[string]any:
+		for i, child := range v {
+			if found := findExecRef(fmt.Sprintf("%s[%d]", key, i), child); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+func remoteConfDir() string {
+	return filepath.Join(config.Config.StateDir, "remote_conf.d")
+}
+
+func remoteConfPath(name string) string {
+	return filepath.Join(remoteConfDir(), name+".toml")
+}
+
+// loadRemoteConfigs reads the persisted remote configs.
+func loadRemoteConfigs() map[string]*PluginConfig {
+	ret := make(map[string]*PluginConfig)
+
+	entries, err := os.ReadDir(remoteConfDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Logger.Errorw("read remote config dir fail", "error", err)
+		}
+		return ret
+	}
+
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".toml")
+		if !ok || e.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(remoteConfPath(name))
+		if err != nil {
+			logger.Logger.Errorw("read remote config fail", "plugin", name, "error", err)
+			continue
+		}
+		ret[name] = &PluginConfig{
+			Source:      "remote",
+			Digest:      contentDigest(content),
+			FileContent: content,
+		}
+	}
+	return ret
+}
+
+func saveRemoteConfig(name string, content []byte) error {
+	if err := os.MkdirAll(remoteConfDir(), 0700); err != nil {
+		return fmt.Errorf("create remote config dir: %w", err)
+	}
+	path := remoteConfPath(name)
+	tmp := path + ".tmp"
+	// may hold credentials
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("write remote config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename remote config: %w", err)
+	}
+	return nil
+}
+
+func contentDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ApplyRemoteConfigs implements server.ConfigApplier.
+func (a *Agent) ApplyRemoteConfigs(configs []server.RemotePluginConfig, full bool) []server.RemoteConfigResult {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	results := make([]server.RemoteConfigResult, 0, len(configs))
+	listed := make(map[string]struct{}, len(configs))
+	for _, rc := range configs {
+		listed[rc.Name] = struct{}{}
+		res := a.applyRemoteConfig(rc)
+		if res.OK {
+			logger.Logger.Infow("remote config applied", "plugin", rc.Name, "digest", res.Digest, "delete", rc.Delete)
+		} else {
+			logger.Logger.Errorw("remote config rejected", "plugin", rc.Name, "error", res.Error)
+		}
+		results = append(results, res)
+	}
+
+	if !full {
+		return results
+	}
+	for name := range a.remoteConfigNames() {
+		if _, ok := listed[name]; ok {
+			continue
+		}
+		res := server.RemoteConfigResult{Name: name, OK: true}
+		if err := a.deleteRemoteConfig(name); err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+		logger.Logger.Infow("remote config removed, not in full push", "plugin", name, "error", res.Error)
+		results = append(results, res)
+	}
+	return results
+}
+
+func (a *Agent) applyRemoteConfig(rc server.RemotePluginConfig) server.RemoteConfigResult {
+	res := server.RemoteConfigResult{Name: rc.Name, Digest: rc.Digest}
+
+	if rc.Name == "" || strings.ContainsAny(rc.Name, `/\`) || strings.HasPrefix(rc.Name, ".") {
+		res.Error = "invalid plugin name"
+		return res
+	}
+
+	if rc.Delete {
+		if err := a.deleteRemoteConfig(rc.Name); err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.OK = true
+		return res
+	}
+
+	if _, has := plugins.PluginCreators[rc.Name]; !has {
+		res.Error = fmt.Sprintf("plugin %s not supported", rc.Name)
+		return res
+	}
+
+	content := []byte(rc.Content)
+	digest := contentDigest(content)
+	if rc.Digest != "" && rc.Digest != digest {
+		res.Error = fmt.Sprintf("digest mismatch: content has %s", digest)
+		return res
+	}
+	res.Digest = digest
+
+	if err := checkPushedConfig(rc.Name, content); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	prev := a.GetPluginConfig(rc.Name)
+	if prev != nil && prev.Source == "remote" && prev.Digest == digest {
+		res.OK = true
+		return res
+	}
+
+	// every instance must pass Init before the config is acked and saved
+	a.DelPlugin(rc.Name)
+	err := a.loadPlugin(rc.Name, &PluginConfig{
+		Source:      "remote",
+		Digest:      digest,
+		FileContent: content,
+	}, true)
+	if err != nil {
+		// keep running what ran before
+		a.DelPlugin(rc.Name)
+		if prev != nil {
+			a.LoadPlugin(rc.Name, prev)
+		}
+		res.Error = err.Error()
+		return res
+	}
+
+	if err := saveRemoteConfig(rc.Name, content); err != nil {
+		res.Error = fmt.Sprintf("applied, but lost on restart: %v", err)
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+// deleteRemoteConfig drops the remote config of a plugin and falls back to
+// conf.d/p.<name>/ if there is one.
+func (a *Agent) deleteRemoteConfig(name string) error {
+	if err := os.Remove(remoteConfPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove remote config: %w", err)
+	}
+	if pc := a.GetPluginConfig(name); pc != nil && pc.Source == "remote" {
+		a.DelPlugin(name)
+		a.reloadPlugin(name)
+	}
+	return nil
+}
+
+// remoteConfigNames returns the plugins with a remote config, running or
+// only persisted.
+func (a *Agent) remoteConfigNames() map[string]struct{} {
+	ret := make(map[string]struct{})
+	for name := range loadRemoteConfigs() {
+		ret[name] = struct{}{}
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+	for name, pc := range a.pluginConfigs {
+		if pc.Source == "remote" {
+			ret[name] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// RemoteConfigDigests implements server.ConfigApplier.
+func (a *Agent) RemoteConfigDigests() map[string]string {
+	a.RLock()
+	defer a.RUnlock()
+
+	ret := make(map[string]string)
+	for name, pc := range a.pluginConfigs {
+		if pc.Source == "remote" {
+			ret[name] = pc.Digest
+		}
+	}
+	return ret
+}
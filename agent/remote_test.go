@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/server"
+)
+
+type remoteFakePlugin struct {
+	config.InternalConfig
+	Instances []*remoteFakeInstance `toml:"instances"`
+}
+
+func (p *remoteFakePlugin) GetInstances() []plugins.Instance {
+	ret := make([]plugins.Instance, len(p.Instances))
+	for i := range p.Instances {
+		ret[i] = p.Instances[i]
+	}
+	return ret
+}
+
+type remoteFakeInstance struct {
+	config.InternalConfig
+	WarnGe int `toml:"warn_ge"`
+}
+
+func (ins *remoteFakeInstance) Init() error {
+	if ins.WarnGe < 0 {
+		return fmt.Errorf("warn_ge must be non-negative")
+	}
+	return nil
+}
+
+func TestApplyRemoteConfigRunsInstanceInit(t *testing.T) {
+	prev := config.Config
+	config.Config = &config.ConfigType{
+		StateDir: t.TempDir(),
+		Global:   config.Global{Interval: config.Duration(time.Hour)},
+	}
+	t.Cleanup(func() { config.Config = prev })
+	plugins.Add("remotefake", func() plugins.Plugin { return &remoteFakePlugin{} })
+	t.Cleanup(func() { delete(plugins.PluginCreators, "remotefake") })
+
+	a := New("test")
+	t.Cleanup(func() { a.DelPlugin("remotefake") })
+
+	good := "[[instances]]\nwarn_ge = 1\n"
+	res := a.applyRemoteConfig(server.RemotePluginConfig{Name: "remotefake", Content: good})
+	if !res.OK {
+		t.Fatalf("valid config rejected: %s", res.Error)
+	}
+
+	bad := "[[instances]]\nwarn_ge = 1\n[[instances]]\nwarn_ge = -1\n"
+	res = a.applyRemoteConfig(server.RemotePluginConfig{Name: "remotefake", Content: bad})
+	if res.OK || !strings.Contains(res.Error, "instances[1]: warn_ge must be non-negative") {
+		t.Fatalf("config with a failing instance Init = %+v, want rejected", res)
+	}
+
+	saved, err := os.ReadFile(remoteConfPath("remotefake"))
+	if err != nil || string(saved) != good {
+		t.Fatalf("rejected config must not be saved, have %q, %v", saved, err)
+	}
+	if pc := a.GetPluginConfig("remotefake"); pc == nil || string(pc.FileContent) != good {
+		t.Fatal("the previous config should run again after a rejected push")
+	}
+}
+
+func TestCheckPushedConfig(t *testing.T) {
+	prev := config.Config
+	t.Cleanup(func() { config.Config = prev })
+
+	tests := []struct {
+		name      string
+		plugin    string
+		content   string
+		allowExec []string
+		wantErr   string
+	}{
+		{"plain config", "redis", "[[instances]]\ntargets = [\"127.0.0.1:6379\"]\npassword = \"keystore:redis\"\n", nil, ""},
+		{"exec secret", "redis", "[[instances]]\ntargets = [\"127.0.0.1:6379\"]\npassword = \"exec:/bin/sh -c id\"\n", nil,
+			"instances[0].password: exec: secret references are not allowed"},
+		{"exec secret in partial", "mysql", "[[partials]]\nid = \"a\"\npassword = \"exec:vault\"\n", nil, "partials[0].password"},
+		{"exec secret in array", "http", "[[instances]]\nheaders = [\"Authorization\", \"exec:token\"]\n", nil, "instances[0].headers[1]"},
+		{"exec plugin", "exec", "[[instances]]\ncommands = [\"id\"]\n", nil, "plugin exec runs commands"},
+		{"scriptfilter plugin", "scriptfilter", "[[instances]]\ncommand = \"id\"\n", []string{"exec"}, "plugin scriptfilter runs commands"},
+		{"allowed exec plugin", "exec", "[[instances]]\ncommands = [\"id\"]\n", []string{"exec"}, ""},
+		{"invalid toml", "redis", "[[instances]\n", nil, "unmarshal plugin config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config = &config.ConfigType{Server: config.ServerConfig{ConfigPushExecPlugins: tt.allowExec}}
+			err := checkPushedConfig(tt.plugin, []byte(tt.content))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkPushedConfig() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkPushedConfig() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package agent
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -18,18 +21,57 @@ func init() {
 	engine.FromAgent = "catpaw"
 }
 
+// pushFunc receives the events of one gather; the agent hands them to the
+// alert engine.
+type pushFunc func(pluginName string, p plugins.Plugin, ins plugins.Instance, queue *safe.Queue[*types.Event])
+
 type PluginRunner struct {
 	pluginName   string
 	pluginObject plugins.Plugin
+	push         pushFunc
 	quitChan     []chan struct{}
 	wg           sync.WaitGroup
 	Instances    []plugins.Instance
+	statuses     []*instanceStatus
+	initErr      string
+}
+
+// instanceStatus records how the latest gather of one instance went; the
+// local API reports it.
+type instanceStatus struct {
+	mu         sync.Mutex
+	initErr    string
+	lastGather time.Time
+	duration   time.Duration
+	events     int
+	lastErr    string
+
+	// gathers skipped because a timed-out one was still running
+	skipped int
+
+	// alerting self-monitoring checks, so their recovery is reported once
+	panicked bool
+	overrun  bool
+	timedOut bool
+}
+
+func (s *instanceStatus) record(start time.Time, events int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastGather = start
+	s.duration = time.Since(start)
+	s.events = events
+	s.lastErr = ""
+	if err != nil {
+		s.lastErr = err.Error()
+	}
 }
 
 func newPluginRunner(pluginName string, p plugins.Plugin) *PluginRunner {
 	return &PluginRunner{
 		pluginName:   pluginName,
 		pluginObject: p,
+		push:         engine.PushRawEvents,
 	}
 }
 
@@ -45,81 +87,403 @@ func (r *PluginRunner) stop() {
 }
 
 func (r *PluginRunner) start() {
+	if r.init() {
+		r.run()
+	}
+}
+
+// init initializes the plugin and every instance, and compiles the instance
+// schedules. It runs before any gather starts, so a caller can see a broken
+// config (initErr, instanceInitErr) before anything runs. It returns false
+// when the plugin itself failed to initialize.
+func (r *PluginRunner) init() bool {
 	if err := plugins.MayPluginInit(r.pluginObject); err != nil {
 		logger.Logger.Errorw("plugin init fail", "plugin", r.pluginName, "error", err)
-		return
+		r.initErr = err.Error()
+		return false
 	}
 
 	r.Instances = plugins.MayGetInstances(r.pluginObject)
 	r.quitChan = make([]chan struct{}, len(r.Instances))
-	for i := 0; i < len(r.Instances); i++ {
+	r.statuses = make([]*instanceStatus, len(r.Instances))
+	for i, ins := range r.Instances {
 		r.quitChan[i] = make(chan struct{})
+		r.statuses[i] = &instanceStatus{}
+		err := plugins.MayInit(ins)
+		if err == nil {
+			_, err = r.instanceSchedule(ins)
+		}
+		if err != nil {
+			logger.Logger.Errorw("init plugin instance fail", "plugin", r.pluginName, "index", i, "error", err)
+			r.statuses[i].initErr = err.Error()
+		}
+	}
+	return true
+}
+
+// instanceInitErr returns the error of the first instance that failed to
+// initialize.
+func (r *PluginRunner) instanceInitErr() error {
+	for i, st := range r.statuses {
+		st.mu.Lock()
+		msg := st.initErr
+		st.mu.Unlock()
+		if msg != "" {
+			return fmt.Errorf("instances[%d]: %s", i, msg)
+		}
+	}
+	return nil
+}
+
+// run starts the gather loop of every instance that initialized.
+func (r *PluginRunner) run() {
+	for i := 0; i < len(r.Instances); i++ {
 		ins := r.Instances[i]
+		st := r.statuses[i]
 		ch := r.quitChan[i]
+		if st.initErr != "" {
+			continue
+		}
 		r.wg.Add(1)
-		go r.startInstancePlugin(ins, ch)
-		time.Sleep(50 * time.Millisecond)
+		go r.startInstancePlugin(i, ins, st, ch)
+		// the stagger keeps instances of one plugin from gathering in
+		// lockstep; with interval_spread their first gathers are already
+		// spread over the interval, and sleeping here would only hold up
+		// the start and reload of plugins with many instances
+		if !config.Config.Global.IntervalSpread {
+			time.Sleep(50 * time.Millisecond)
+		}
 	}
 }
 
-func (r *PluginRunner) startInstancePlugin(instance plugins.Instance, ch chan struct{}) {
+func (r *PluginRunner) startInstancePlugin(index int, instance plugins.Instance, st *instanceStatus, ch chan struct{}) {
 	defer r.wg.Done()
 
-	interval := instance.GetInterval()
-	if interval == 0 {
-		interval = r.pluginObject.GetInterval()
-		if interval == 0 {
-			interval = config.Config.Global.Interval
-		}
-	}
+	interval := r.instanceInterval(instance)
 
-	if err := plugins.MayInit(instance); err != nil {
-		logger.Logger.Errorw("init plugin instance fail", "plugin", r.pluginName, "error", err)
+	sched, err := r.instanceSchedule(instance)
+	if err != nil {
+		logger.Logger.Errorw("invalid schedule of plugin instance", "plugin", r.pluginName, "error", err)
+		st.mu.Lock()
+		st.initErr = err.Error()
+		st.mu.Unlock()
 		return
 	}
 
-	timer := time.NewTimer(0)
+	timeout := r.instanceGatherTimeout(instance)
+	jitter := time.Duration(config.Config.Global.IntervalJitter)
+
+	// nextDelay returns the wait for the gather after one started at start:
+	// the next cron fire time, or the rest of the interval plus jitter.
+	nextDelay := func(start time.Time) time.Duration {
+		if sched.HasCron() {
+			next := sched.Next(time.Now())
+			if next.IsZero() {
+				return 24 * time.Hour
+			}
+			return time.Until(next)
+		}
+		next := time.Duration(interval) - time.Since(start)
+		if next < 0 {
+			next = 0
+		}
+		return next + randomJitter(jitter)
+	}
+
+	first := r.spreadOffset(index, time.Duration(interval)) + randomJitter(jitter)
+	if sched.HasCron() {
+		first = nextDelay(time.Now())
+	}
+	timer := time.NewTimer(first)
 	defer timer.Stop()
 
-	var start time.Time
+	var (
+		start time.Time
+		// running is the done channel of a timed-out gather that has not
+		// returned yet; no new gather starts until it does
+		running chan struct{}
+	)
 
 	for {
 		select {
 		case <-ch:
 			return
 		case <-timer.C:
-			start = time.Now()
-			r.gatherInstancePlugin(instance)
+		}
+
+		if running != nil {
 			select {
-			case <-ch:
-				return
+			case <-running:
+				running = nil
 			default:
+				logger.Logger.Warnw("previous gather still running, skipped",
+					"plugin", r.pluginName, "started", start)
+				st.mu.Lock()
+				st.skipped++
+				st.mu.Unlock()
+				timer.Reset(nextDelay(time.Now()))
+				continue
 			}
-			next := time.Duration(interval) - time.Since(start)
-			if next < 0 {
-				next = 0
+		}
+
+		mute := false
+		if !sched.Active(time.Now()) {
+			if !sched.Mute() {
+				timer.Reset(nextDelay(time.Now()))
+				continue
 			}
-			timer.Reset(next)
+			mute = true
 		}
+
+		start = time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		done := make(chan struct{})
+		go func(start time.Time) {
+			defer cancel()
+			defer close(done)
+			events, err := r.gatherInstancePlugin(ctx, instance, mute)
+			st.record(start, events, err)
+			r.checkGatherHealth(instance, st, err != nil, ctx.Err() == context.DeadlineExceeded,
+				time.Since(start), time.Duration(interval))
+		}(start)
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			select {
+			case <-done:
+			case <-time.After(cancelGrace):
+				r.reportTimeout(instance, st, timeout)
+				running = done
+			}
+		case <-ch:
+			// the gather is abandoned; a ContextGatherer returns promptly
+			cancel()
+			return
+		}
+
+		select {
+		case <-ch:
+			return
+		default:
+		}
+		timer.Reset(nextDelay(start))
 	}
 }
 
-func (r *PluginRunner) gatherInstancePlugin(ins plugins.Instance) {
+// instanceInterval resolves the effective gather interval of an instance:
+// instance setting, then plugin setting, then the global default.
+func (r *PluginRunner) instanceInterval(instance plugins.Instance) config.Duration {
+	interval := instance.GetInterval()
+	if interval == 0 {
+		interval = r.pluginObject.GetInterval()
+		if interval == 0 {
+			interval = config.Config.Global.Interval
+		}
+	}
+	return interval
+}
+
+// spreadOffset returns when the first gather of an instance runs, as an
+// offset into its interval. With global.interval_spread it is a hash of the
+// agent ID, plugin name and instance index: stable across restarts of one
+// host and evenly distributed across a fleet. Otherwise it is 0.
+func (r *PluginRunner) spreadOffset(index int, interval time.Duration) time.Duration {
+	if !config.Config.Global.IntervalSpread || interval <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%d", spreadSeed(), r.pluginName, index)
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+var (
+	spreadSeedOnce sync.Once
+	spreadSeedVal  string
+)
+
+// spreadSeed is the agent ID, or the hostname when it cannot be loaded.
+func spreadSeed() string {
+	spreadSeedOnce.Do(func() {
+		if id, err := config.LoadOrCreateAgentID(); err == nil {
+			spreadSeedVal = id.String()
+			return
+		}
+		spreadSeedVal = config.AgentHostname()
+	})
+	return spreadSeedVal
+}
+
+// randomJitter returns a random delay in [0, max).
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// instanceSchedule compiles the schedule and active_windows of the instance,
+// or of the plugin when the instance sets neither. nil means the instance
+// gathers on its interval at all times.
+func (r *PluginRunner) instanceSchedule(instance plugins.Instance) (*config.GatherSchedule, error) {
+	type compiler interface {
+		CompileSchedule() (*config.GatherSchedule, error)
+	}
+	for _, v := range []any{instance, r.pluginObject} {
+		c, ok := v.(compiler)
+		if !ok {
+			continue
+		}
+		sched, err := c.CompileSchedule()
+		if err != nil || sched != nil {
+			return sched, err
+		}
+	}
+	return nil, nil
+}
+
+// defaultGatherTimeoutFactor sets the gather timeout, when none is
+// configured, to a multiple of the interval. It leaves room between the
+// interval and the timeout for catpaw::gather_overrun to fire before a slow
+// gather is reported as catpaw::gather_timeout.
+const defaultGatherTimeoutFactor = 3
+
+// cancelGrace is how long a gather may take to return once its ctx is
+// done before it is reported as timed out. A ContextGatherer returns within
+// it and reports what it could not finish itself (e.g. disk::hung).
+const cancelGrace = 200 * time.Millisecond
+
+// instanceGatherTimeout resolves how long one gather may run: instance
+// gather_timeout, then plugin gather_timeout, then three times the gather
+// interval.
+func (r *PluginRunner) instanceGatherTimeout(instance plugins.Instance) time.Duration {
+	for _, v := range []any{instance, r.pluginObject} {
+		if g, ok := v.(interface{ GetGatherTimeout() config.Duration }); ok && g.GetGatherTimeout() > 0 {
+			return time.Duration(g.GetGatherTimeout())
+		}
+	}
+	return defaultGatherTimeoutFactor * time.Duration(r.instanceInterval(instance))
+}
+
+// restoreGrace returns how long a restored alert of this plugin may stay
+// unrefreshed after now: until the slowest instance's next gather inside
+// its active windows (or cron fire time), plus one more interval for that
+// gather to finish. On a plain interval that is two gather rounds.
+func (r *PluginRunner) restoreGrace(now time.Time) time.Duration {
+	grace := 2 * time.Duration(config.Config.Global.Interval)
+	jitter := time.Duration(config.Config.Global.IntervalJitter)
+	for _, ins := range r.Instances {
+		interval := time.Duration(r.instanceInterval(ins))
+		sched, err := r.instanceSchedule(ins)
+		if err != nil {
+			continue
+		}
+		next := sched.NextActive(now, interval+jitter)
+		if next.IsZero() {
+			continue
+		}
+		if d := next.Sub(now) + interval; d > grace {
+			grace = d
+		}
+	}
+	return grace
+}
+
+// gatherInstancePlugin runs one gather and pushes its events; with mute,
+// only Ok events and catpaw::plugin_panic are pushed so alerts can recover
+// but not fire. catpaw::plugin_panic is left out when self-monitoring is
+// disabled. It returns
+// the number of events and, when the plugin panicked, the panic as an error.
+func (r *PluginRunner) gatherInstancePlugin(ctx context.Context, ins plugins.Instance, mute bool) (events int, err error) {
 	queue := safe.NewQueue[*types.Event]()
 	defer func() {
+		var panicEvent *types.Event
 		if rc := recover(); rc != nil {
 			logger.Logger.Errorw("gather instance plugin panic", "plugin", r.pluginName, "stack", string(runtimex.Stack(3)))
-			queue.PushFront(types.BuildEvent(map[string]string{
-				"check":  r.pluginName + "::panic",
-				"target": r.pluginName,
-			}).
-				SetEventStatus(types.EventStatusCritical).
-				SetDescription(fmt.Sprintf("plugin panic: %v", rc)))
+			err = fmt.Errorf("plugin panic: %v", rc)
+			if !config.Config.SelfMonitor.Disabled {
+				panicEvent = r.selfEvent("catpaw::plugin_panic", types.EventStatusCritical, err.Error())
+				queue.PushFront(panicEvent)
+			}
+		}
+		events = queue.Len()
+		if mute {
+			// a panic is a fault of the agent, not an alert of the muted check
+			for _, event := range queue.PopBackAll() {
+				if event != nil && (event.EventStatus == types.EventStatusOk || event == panicEvent) {
+					queue.PushFront(event)
+				}
+			}
 		}
 		if queue.Len() > 0 {
-			engine.PushRawEvents(r.pluginName, r.pluginObject, ins, queue)
+			r.push(r.pluginName, r.pluginObject, ins, queue)
 		}
 	}()
 
-	plugins.MayGather(ins, queue)
+	plugins.MayGatherContext(ctx, ins, queue)
+	return
+}
+
+// checkGatherHealth reports catpaw::gather_overrun when a gather took longer
+// than the interval, and the recovery of that check, of
+// catpaw::plugin_panic and of catpaw::gather_timeout once a gather is back
+// to normal. A gather that timed out was reported by reportTimeout already.
+// The events carry the instance labels and go through the engine like the
+// plugin's own.
+func (r *PluginRunner) checkGatherHealth(ins plugins.Instance, st *instanceStatus, panicked, timedOut bool, took, interval time.Duration) {
+	queue := safe.NewQueue[*types.Event]()
+
+	st.mu.Lock()
+	if !panicked && st.panicked {
+		queue.PushFront(r.selfEvent("catpaw::plugin_panic", types.EventStatusOk, "gather no longer panics"))
+	}
+	// a panic is only reported, and so only recovers, with self-monitoring
+	st.panicked = panicked && !config.Config.SelfMonitor.Disabled
+
+	if !timedOut {
+		if st.timedOut {
+			queue.PushFront(r.selfEvent("catpaw::gather_timeout", types.EventStatusOk,
+				fmt.Sprintf("gather finished in %s", took.Round(time.Millisecond))))
+			st.timedOut = false
+		}
+
+		if took > interval && !config.Config.SelfMonitor.Disabled {
+			queue.PushFront(r.selfEvent("catpaw::gather_overrun", types.EventStatusWarning,
+				fmt.Sprintf("gather took %s, longer than the %s interval", took.Round(time.Millisecond), interval)))
+			st.overrun = true
+		} else if st.overrun {
+			queue.PushFront(r.selfEvent("catpaw::gather_overrun", types.EventStatusOk,
+				fmt.Sprintf("gather took %s, within the %s interval", took.Round(time.Millisecond), interval)))
+			st.overrun = false
+		}
+	}
+	st.mu.Unlock()
+
+	if queue.Len() > 0 {
+		r.push(r.pluginName, r.pluginObject, ins, queue)
+	}
+}
+
+// reportTimeout raises catpaw::gather_timeout for a gather still running
+// after its timeout. Until it returns, the instance skips its gathers.
+func (r *PluginRunner) reportTimeout(ins plugins.Instance, st *instanceStatus, timeout time.Duration) {
+	logger.Logger.Errorw("gather timeout", "plugin", r.pluginName, "timeout", timeout)
+
+	st.mu.Lock()
+	st.timedOut = true
+	st.mu.Unlock()
+
+	queue := safe.NewQueue[*types.Event]()
+	queue.PushFront(r.selfEvent("catpaw::gather_timeout", types.EventStatusCritical,
+		fmt.Sprintf("gather did not finish within %s, later gathers are skipped until it returns", timeout)))
+	r.push(r.pluginName, r.pluginObject, ins, queue)
+}
+
+func (r *PluginRunner) selfEvent(check, status, description string) *types.Event {
+	return types.BuildEvent(map[string]string{
+		"check":  check,
+		"target": r.pluginName,
+	}).
+		SetEventStatus(status).
+		SetDescription(description)
 }
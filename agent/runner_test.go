@@ -0,0 +1,383 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.Logger = zap.NewNop().Sugar()
+}
+
+type fakePlugin struct {
+	config.InternalConfig
+}
+
+// slowInstance sleeps for delay on every gather and then, when block is set,
+// waits until it is closed.
+type slowInstance struct {
+	config.InternalConfig
+
+	mu      sync.Mutex
+	delay   time.Duration
+	block   chan struct{}
+	gathers int
+}
+
+func (ins *slowInstance) Gather(q *safe.Queue[*types.Event]) {
+	ins.mu.Lock()
+	ins.gathers++
+	delay, block := ins.delay, ins.block
+	ins.mu.Unlock()
+
+	time.Sleep(delay)
+	if block != nil {
+		<-block
+	}
+	q.PushFront(types.BuildEvent(map[string]string{"check": "fake::ok"}))
+}
+
+func (ins *slowInstance) set(delay time.Duration, block chan struct{}) {
+	ins.mu.Lock()
+	ins.delay, ins.block = delay, block
+	ins.mu.Unlock()
+}
+
+// eventRecorder collects what the runner pushes to the engine.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []*types.Event
+}
+
+func (rec *eventRecorder) push(_ string, _ plugins.Plugin, _ plugins.Instance, queue *safe.Queue[*types.Event]) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.events = append(rec.events, queue.PopBackAll()...)
+}
+
+// find returns the last event with the check label and status.
+func (rec *eventRecorder) find(check, status string) *types.Event {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i := len(rec.events) - 1; i >= 0; i-- {
+		e := rec.events[i]
+		if e.Labels["check"] == check && e.EventStatus == status {
+			return e
+		}
+	}
+	return nil
+}
+
+func setTestConfig(t *testing.T, global config.Global) {
+	t.Helper()
+	prev := config.Config
+	config.Config = &config.ConfigType{Global: global}
+	t.Cleanup(func() { config.Config = prev })
+}
+
+// startTestRunner runs one instance until the test ends.
+func startTestRunner(t *testing.T, ins *slowInstance) (*eventRecorder, *instanceStatus) {
+	t.Helper()
+	rec := &eventRecorder{}
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, push: rec.push}
+	st := &instanceStatus{}
+	quit := make(chan struct{})
+	r.wg.Add(1)
+	go r.startInstancePlugin(0, ins, st, quit)
+	t.Cleanup(func() {
+		close(quit)
+		r.wg.Wait()
+	})
+	return rec, st
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunnerGatherOverrunWithDefaultTimeout(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(40 * time.Millisecond)})
+
+	ins := &slowInstance{delay: 70 * time.Millisecond}
+	rec, _ := startTestRunner(t, ins)
+
+	waitFor(t, "gather_overrun", func() bool {
+		return rec.find("catpaw::gather_overrun", types.EventStatusWarning) != nil
+	})
+	if rec.find("catpaw::gather_timeout", types.EventStatusCritical) != nil {
+		t.Fatal("a gather within the default timeout should not be reported as timed out")
+	}
+
+	ins.set(0, nil)
+	waitFor(t, "gather_overrun recovery", func() bool {
+		return rec.find("catpaw::gather_overrun", types.EventStatusOk) != nil
+	})
+}
+
+func TestRunnerGatherTimeoutSkipsUntilReturn(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(20 * time.Millisecond)})
+
+	release := make(chan struct{})
+	ins := &slowInstance{block: release}
+	ins.GatherTimeout = config.Duration(30 * time.Millisecond)
+	rec, st := startTestRunner(t, ins)
+
+	waitFor(t, "gather_timeout", func() bool {
+		return rec.find("catpaw::gather_timeout", types.EventStatusCritical) != nil
+	})
+	waitFor(t, "skipped gathers", func() bool {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return st.skipped >= 2
+	})
+	ins.mu.Lock()
+	gathers := ins.gathers
+	ins.mu.Unlock()
+	if gathers != 1 {
+		t.Fatalf("no gather should start while the timed-out one runs, got %d", gathers)
+	}
+
+	ins.set(0, nil)
+	close(release)
+	waitFor(t, "gather_timeout recovery", func() bool {
+		return rec.find("catpaw::gather_timeout", types.EventStatusOk) != nil
+	})
+}
+
+// ctxInstance gives up as soon as the gather ctx is done.
+type ctxInstance struct {
+	config.InternalConfig
+}
+
+func (ins *ctxInstance) Gather(q *safe.Queue[*types.Event]) {
+	ins.GatherContext(context.Background(), q)
+}
+
+func (ins *ctxInstance) GatherContext(ctx context.Context, q *safe.Queue[*types.Event]) {
+	<-ctx.Done()
+	q.PushFront(types.BuildEvent(map[string]string{"check": "fake::hung"}).SetEventStatus(types.EventStatusCritical))
+}
+
+func TestRunnerContextGathererNotReportedAsTimeout(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(time.Second)})
+
+	ins := &ctxInstance{}
+	ins.GatherTimeout = config.Duration(30 * time.Millisecond)
+	rec := &eventRecorder{}
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, push: rec.push}
+	quit := make(chan struct{})
+	r.wg.Add(1)
+	go r.startInstancePlugin(0, ins, &instanceStatus{}, quit)
+	defer func() {
+		close(quit)
+		r.wg.Wait()
+	}()
+
+	waitFor(t, "fake::hung", func() bool {
+		return rec.find("fake::hung", types.EventStatusCritical) != nil
+	})
+	if rec.find("catpaw::gather_timeout", types.EventStatusCritical) != nil {
+		t.Fatal("a gather that returns on ctx.Done should not be reported as timed out")
+	}
+}
+
+func TestInstanceGatherTimeout(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(30 * time.Second)})
+
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}}
+	if got := r.instanceGatherTimeout(&slowInstance{}); got != 90*time.Second {
+		t.Fatalf("default timeout should be 3x the interval, got %s", got)
+	}
+
+	ins := &slowInstance{}
+	ins.GatherTimeout = config.Duration(5 * time.Second)
+	if got := r.instanceGatherTimeout(ins); got != 5*time.Second {
+		t.Fatalf("instance gather_timeout should win, got %s", got)
+	}
+
+	r.pluginObject = &fakePlugin{InternalConfig: config.InternalConfig{GatherTimeout: config.Duration(7 * time.Second)}}
+	if got := r.instanceGatherTimeout(&slowInstance{}); got != 7*time.Second {
+		t.Fatalf("plugin gather_timeout should apply, got %s", got)
+	}
+}
+
+type panicInstance struct {
+	config.InternalConfig
+}
+
+func (ins *panicInstance) Gather(q *safe.Queue[*types.Event]) {
+	q.PushFront(types.BuildEvent(map[string]string{"check": "fake::usage"}).SetEventStatus(types.EventStatusCritical))
+	panic("boom")
+}
+
+func TestMutedGatherKeepsPluginPanic(t *testing.T) {
+	setTestConfig(t, config.Global{Interval: config.Duration(30 * time.Second)})
+
+	rec := &eventRecorder{}
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, push: rec.push}
+	events, err := r.gatherInstancePlugin(context.Background(), &panicInstance{}, true)
+	if err == nil || events != 2 {
+		t.Fatalf("gather = %d events, %v; want 2 events and the panic", events, err)
+	}
+	if rec.find("catpaw::plugin_panic", types.EventStatusCritical) == nil {
+		t.Fatal("a muted gather should still report the panic")
+	}
+	if rec.find("fake::usage", types.EventStatusCritical) != nil {
+		t.Fatal("a muted gather should drop the plugin's alerts")
+	}
+}
+
+// setSpreadSeed makes spreadSeed load again on its next call.
+func setSpreadSeed(t *testing.T) {
+	t.Helper()
+	spreadSeedOnce, spreadSeedVal = sync.Once{}, ""
+	t.Cleanup(func() { spreadSeedOnce, spreadSeedVal = sync.Once{}, "" })
+}
+
+func TestSpreadSeed(t *testing.T) {
+	dir := t.TempDir()
+	const id = "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+	if err := os.WriteFile(filepath.Join(dir, "agent_id"), []byte(id+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stateDir string
+		want     func() string
+	}{
+		{"agent id", dir, func() string { return id }},
+		{"hostname without state dir", "", config.AgentHostname},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := config.Config
+			config.Config = &config.ConfigType{StateDir: tt.stateDir}
+			t.Cleanup(func() { config.Config = prev })
+			setSpreadSeed(t)
+
+			got := spreadSeed()
+			if want := tt.want(); got != want || got == "" {
+				t.Fatalf("spreadSeed() = %q, want %q", got, want)
+			}
+			if again := spreadSeed(); again != got {
+				t.Fatalf("spreadSeed() changed from %q to %q", got, again)
+			}
+		})
+	}
+}
+
+func TestSpreadOffset(t *testing.T) {
+	setTestConfig(t, config.Global{IntervalSpread: true})
+	setSpreadSeed(t)
+	spreadSeedOnce.Do(func() { spreadSeedVal = "agent-a" })
+
+	tests := []struct {
+		plugin   string
+		index    int
+		interval time.Duration
+	}{
+		{"cpu", 0, 30 * time.Second},
+		{"cpu", 1, 30 * time.Second},
+		{"disk", 0, 30 * time.Second},
+		{"http", 7, time.Minute},
+		{"ping", 0, time.Second},
+		{"ping", 0, time.Nanosecond},
+	}
+	seen := map[time.Duration]bool{}
+	for _, tt := range tests {
+		r := &PluginRunner{pluginName: tt.plugin}
+		got := r.spreadOffset(tt.index, tt.interval)
+		if got < 0 || got >= tt.interval {
+			t.Errorf("spreadOffset(%s, %d, %s) = %s, want within [0, %s)", tt.plugin, tt.index, tt.interval, got, tt.interval)
+		}
+		if again := r.spreadOffset(tt.index, tt.interval); again != got {
+			t.Errorf("spreadOffset(%s, %d, %s) is not stable: %s then %s", tt.plugin, tt.index, tt.interval, got, again)
+		}
+		if tt.interval == 30*time.Second {
+			if seen[got] {
+				t.Errorf("spreadOffset(%s, %d) = %s collides with another instance", tt.plugin, tt.index, got)
+			}
+			seen[got] = true
+		}
+	}
+
+	r := &PluginRunner{pluginName: "cpu"}
+	if got := r.spreadOffset(0, 0); got != 0 {
+		t.Errorf("spreadOffset with a zero interval = %s, want 0", got)
+	}
+	config.Config.Global.IntervalSpread = false
+	if got := r.spreadOffset(0, 30*time.Second); got != 0 {
+		t.Errorf("spreadOffset without interval_spread = %s, want 0", got)
+	}
+}
+
+func TestRandomJitter(t *testing.T) {
+	tests := []struct {
+		max time.Duration
+	}{
+		{-time.Second},
+		{0},
+		{time.Nanosecond},
+		{time.Millisecond},
+		{10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 1000; i++ {
+			got := randomJitter(tt.max)
+			if tt.max <= 0 {
+				if got != 0 {
+					t.Fatalf("randomJitter(%s) = %s, want 0", tt.max, got)
+				}
+				continue
+			}
+			if got < 0 || got >= tt.max {
+				t.Fatalf("randomJitter(%s) = %s, want within [0, %s)", tt.max, got, tt.max)
+			}
+		}
+	}
+}
+
+func TestPluginPanicFollowsSelfMonitor(t *testing.T) {
+	prev := config.Config
+	config.Config = &config.ConfigType{
+		Global:      config.Global{Interval: config.Duration(30 * time.Second)},
+		SelfMonitor: config.SelfMonitorConfig{Disabled: true},
+	}
+	t.Cleanup(func() { config.Config = prev })
+
+	rec := &eventRecorder{}
+	r := &PluginRunner{pluginName: "fake", pluginObject: &fakePlugin{}, push: rec.push}
+	_, err := r.gatherInstancePlugin(context.Background(), &panicInstance{}, false)
+	if err == nil {
+		t.Fatal("the panic should still be returned")
+	}
+	if rec.find("catpaw::plugin_panic", types.EventStatusCritical) != nil {
+		t.Fatal("plugin_panic should not be reported with self-monitoring disabled")
+	}
+
+	st := &instanceStatus{}
+	r.checkGatherHealth(&panicInstance{}, st, true, false, time.Millisecond, time.Second)
+	r.checkGatherHealth(&panicInstance{}, st, false, false, time.Millisecond, time.Second)
+	if rec.find("catpaw::plugin_panic", types.EventStatusOk) != nil {
+		t.Fatal("no recovery for a panic that was never reported")
+	}
+}
@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/engine"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/server"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// selfMonitorPlugin is the from_plugin label of agent-wide catpaw::* events.
+const selfMonitorPlugin = "catpaw"
+
+type selfCheck struct {
+	check  string
+	target string
+}
+
+// selfMonitor runs the agent-wide checks of [self_monitor] on a ticker:
+// notifier failure streaks, the diagnose queue, the catpaw-server link and
+// the daily AI token limit. Failing checks are reported every round, and a
+// check that stops failing is reported Ok once, so the engine raises and
+// recovers the alerts like any plugin's.
+type selfMonitor struct {
+	cfg  config.SelfMonitorConfig
+	stop chan struct{}
+	done chan struct{}
+
+	alerting      map[selfCheck]bool
+	diagDropped   int64
+	diagSaturated bool
+}
+
+// startSelfMonitor starts the agent-wide self checks. prev is the monitor
+// being replaced on reload, whose alerting checks are carried over so they
+// still recover.
+func (a *Agent) startSelfMonitor(prev *selfMonitor) {
+	m := &selfMonitor{
+		cfg:      config.Config.SelfMonitor,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		alerting: make(map[selfCheck]bool),
+	}
+	if prev != nil {
+		m.alerting = prev.alerting
+		m.diagDropped = prev.diagDropped
+	}
+	m.cfg.Interval = selfMonitorInterval()
+
+	if m.cfg.Disabled {
+		// nothing runs any more, resolve what is still alerting
+		m.push(nil)
+		close(m.done)
+		a.selfmon = m
+		return
+	}
+
+	a.selfmon = m
+	go m.run()
+	logger.Logger.Infow("self monitor started", "interval", time.Duration(m.cfg.Interval))
+}
+
+// selfMonitorInterval is [self_monitor] interval, or global.interval when
+// unset.
+func selfMonitorInterval() config.Duration {
+	if iv := config.Config.SelfMonitor.Interval; iv > 0 {
+		return iv
+	}
+	return config.Config.Global.Interval
+}
+
+func (a *Agent) stopSelfMonitor() *selfMonitor {
+	m := a.selfmon
+	if m == nil {
+		return nil
+	}
+	select {
+	case <-m.done:
+	default:
+		close(m.stop)
+		<-m.done
+	}
+	a.selfmon = nil
+	return m
+}
+
+func (m *selfMonitor) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(time.Duration(m.cfg.Interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.push(m.collect())
+		}
+	}
+}
+
+// collect returns an event for every self check that is failing right now.
+func (m *selfMonitor) collect() []*types.Event {
+	var events []*types.Event
+	add := func(check, target, status, description string) {
+		events = append(events, types.BuildEvent(map[string]string{
+			"check":  check,
+			"target": target,
+		}).
+			SetEventStatus(status).
+			SetDescription(description))
+	}
+
+	streaks := notify.FailureStreaks()
+	names := make([]string, 0, len(streaks))
+	for name := range streaks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if n := streaks[name]; n >= m.cfg.NotifierFailureStreak {
+			add("catpaw::notifier_failure", name, types.EventStatusWarning,
+				fmt.Sprintf("the last %d deliveries of notifier %s failed", n, name))
+		}
+	}
+
+	if eng := diagnose.GlobalEngine(); eng != nil {
+		running, limit := eng.Running()
+		pending := 0
+		if agg := diagnose.GlobalAggregator(); agg != nil {
+			pending = agg.Pending()
+		}
+
+		dropped := eng.Dropped()
+		if dropped < m.diagDropped {
+			// the engine was re-created by a reload
+			m.diagDropped = 0
+		}
+		newDrops := dropped - m.diagDropped
+		m.diagDropped = dropped
+
+		saturated := limit > 0 && running >= limit
+		switch {
+		case newDrops > 0:
+			add("catpaw::diagnose_queue", "diagnose", types.EventStatusWarning,
+				fmt.Sprintf("%d diagnoses dropped since the last check: all %d slots busy, %d pending", newDrops, limit, pending))
+		case saturated && m.diagSaturated:
+			add("catpaw::diagnose_queue", "diagnose", types.EventStatusWarning,
+				fmt.Sprintf("all %d diagnose slots busy for over %s, %d pending", limit, time.Duration(m.cfg.Interval), pending))
+		}
+		m.diagSaturated = saturated
+
+		if eng.State().IsDailyLimitReached(config.Config.AI.DailyTokenLimit) {
+			add("catpaw::ai_token_limit", "ai", types.EventStatusWarning,
+				fmt.Sprintf("daily AI token limit reached (%s, limit %d), diagnoses are skipped until tomorrow",
+					eng.State().FormatUsage(), config.Config.AI.DailyTokenLimit))
+		}
+	} else {
+		m.diagDropped = 0
+		m.diagSaturated = false
+	}
+
+	if since, ok := server.DisconnectedSince(); ok {
+		if down := time.Since(since); down >= time.Duration(m.cfg.ServerDisconnectFor) {
+			add("catpaw::server_disconnected", config.Config.Server.Address, types.EventStatusWarning,
+				fmt.Sprintf("not connected to catpaw-server for %s", down.Truncate(time.Second)))
+		}
+	}
+
+	return events
+}
+
+// push hands the failing checks to the engine, plus an Ok event for every
+// check that was failing in the previous round and no longer is.
+func (m *selfMonitor) push(failing []*types.Event) {
+	queue := safe.NewQueue[*types.Event]()
+	current := make(map[selfCheck]bool, len(failing))
+	for _, event := range failing {
+		current[selfCheck{event.Labels["check"], event.Labels["target"]}] = true
+		queue.PushFront(event)
+	}
+	for c := range m.alerting {
+		if current[c] {
+			continue
+		}
+		queue.PushFront(types.BuildEvent(map[string]string{
+			"check":  c.check,
+			"target": c.target,
+		}).
+			SetEventStatus(types.EventStatusOk).
+			SetDescription("back to normal"))
+	}
+	m.alerting = current
+
+	if queue.Len() > 0 {
+		engine.PushRawEvents(selfMonitorPlugin, &m.cfg, &m.cfg, queue)
+	}
+}
@@ -0,0 +1,139 @@
+//go:build linux
+
+package agent
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/cprobe/catpaw/digcore/logger"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ATTRIB
+
+// inotifyWatcher watches conf.d and every conf.d/p.* directory (inotify is
+// not recursive, so plugin directories are added as they appear).
+type inotifyWatcher struct {
+	fd   int
+	f    *os.File
+	dir  string
+	dirs map[int32]string // watch descriptor → plugin name, mainConfigChange for conf.d
+}
+
+// watchConfigDir reports changed plugin names (or mainConfigChange) on
+// changes until ctx is done.
+func watchConfigDir(ctx context.Context, dir string, changes chan<- string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify_init1: %w", err)
+	}
+	w := &inotifyWatcher{
+		fd:   fd,
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		dir:  dir,
+		dirs: make(map[int32]string),
+	}
+
+	if err := w.add(dir, mainConfigChange); err != nil {
+		w.f.Close()
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.f.Close()
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), "p.") {
+			if err := w.add(filepath.Join(dir, e.Name()), e.Name()[len("p."):]); err != nil {
+				logger.Logger.Warnw("watch plugin dir fail", "dir", e.Name(), "error", err)
+			}
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		w.f.Close()
+	}()
+	go w.run(ctx, changes)
+	return nil
+}
+
+func (w *inotifyWatcher) add(path, name string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("inotify_add_watch %s: %w", path, err)
+	}
+	w.dirs[int32(wd)] = name
+	return nil
+}
+
+func (w *inotifyWatcher) run(ctx context.Context, changes chan<- string) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			// closed on ctx.Done
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			if start+nameLen > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:start+nameLen]), "\x00")
+			off = start + nameLen
+
+			changed, ok := w.handle(wd, mask, name)
+			if !ok {
+				continue
+			}
+			select {
+			case changes <- changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// handle maps one inotify event to the plugin (or main config) it affects.
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) (string, bool) {
+	plugin, ok := w.dirs[wd]
+	if !ok {
+		return "", false
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return "", false
+	}
+	if plugin != mainConfigChange {
+		return plugin, true
+	}
+
+	// an event in conf.d itself
+	if mask&syscall.IN_ISDIR == 0 {
+		return mainConfigChange, true
+	}
+	if !strings.HasPrefix(name, "p.") {
+		return "", false
+	}
+	plugin = name[len("p."):]
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if err := w.add(filepath.Join(w.dir, name), plugin); err != nil {
+			logger.Logger.Warnw("watch plugin dir fail", "dir", name, "error", err)
+		}
+	}
+	return plugin, true
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// watchConfigDir is only implemented with inotify; elsewhere the caller
+// falls back to polling conf.d.
+func watchConfigDir(ctx context.Context, dir string, changes chan<- string) error {
+	return fmt.Errorf("inotify not available on %s", runtime.GOOS)
+}
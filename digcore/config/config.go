@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/cprobe/catpaw/digcore/pkg/cfg"
+	"github.com/cprobe/catpaw/digcore/pkg/tls"
+	"github.com/cprobe/catpaw/digcore/secret"
 	"github.com/jackpal/gateway"
 	"github.com/toolkits/pkg/file"
 )
@@ -18,6 +20,13 @@ import (
 type Global struct {
 	Interval Duration          `toml:"interval"`
 	Labels   map[string]string `toml:"labels"`
+
+	// random delay of up to this much added before every gather
+	IntervalJitter Duration `toml:"interval_jitter"`
+
+	// start each instance at a fixed point of its interval derived from the
+	// agent ID, so hosts hitting a shared target spread across the interval
+	IntervalSpread bool `toml:"interval_spread"`
 }
 
 type LogConfig struct {
@@ -42,23 +51,128 @@ type PagerDutyConfig struct {
 	MaxRetries  int               `toml:"max_retries"`
 }
 
+// WebAPIConfig is [notify.webapi] or one [[notify.webapis]] entry. Without a
+// template the raw Event JSON is sent; otherwise the body is rendered from
+// the Go text/template in template (inline) or template_file.
 type WebAPIConfig struct {
-	URL        string            `toml:"url"`
-	Method     string            `toml:"method"`
-	Headers    map[string]string `toml:"headers"`
-	Timeout    Duration          `toml:"timeout"`
-	MaxRetries int               `toml:"max_retries"`
+	Name         string            `toml:"name"`
+	URL          string            `toml:"url"`
+	Method       string            `toml:"method"`
+	Headers      map[string]string `toml:"headers"`
+	ContentType  string            `toml:"content_type"`
+	Template     string            `toml:"template"`
+	TemplateFile string            `toml:"template_file"`
+
+	// BatchTemplate renders the body for a group of events when
+	// [notify.group] is enabled; without it a grouped batch is sent as a
+	// JSON array of events (or one request per event if template is set).
+	BatchTemplate     string `toml:"batch_template"`
+	BatchTemplateFile string `toml:"batch_template_file"`
+
+	Timeout    Duration `toml:"timeout"`
+	MaxRetries int      `toml:"max_retries"`
+}
+
+// ChatConfig configures a Slack or Mattermost notifier ([notify.slack] /
+// [notify.mattermost]). With only webhook_url, messages go to an incoming
+// webhook (any Slack-compatible endpoint works). With token and channel the
+// chat API is used instead, so AI diagnosis reports are threaded under the
+// alert message.
+type ChatConfig struct {
+	WebhookURL string   `toml:"webhook_url"`
+	Token      string   `toml:"token"`
+	Channel    string   `toml:"channel"`
+	APIURL     string   `toml:"api_url"`
+	Username   string   `toml:"username"`
+	IconEmoji  string   `toml:"icon_emoji"`
+	IconURL    string   `toml:"icon_url"`
+	Labels     []string `toml:"labels"`
+	Timeout    Duration `toml:"timeout"`
+	MaxRetries int      `toml:"max_retries"`
+}
+
+// EmailConfig configures the SMTP notifier ([notify.email]). security is
+// "auto" (STARTTLS when the server offers it), "starttls" (required), "tls"
+// (implicit TLS, usually port 465) or "none". With digest_interval > 0 events
+// are batched and sent as one mail per interval.
+type EmailConfig struct {
+	Host            string   `toml:"host"`
+	Port            int      `toml:"port"`
+	Username        string   `toml:"username"`
+	Password        string   `toml:"password"`
+	From            string   `toml:"from"`
+	To              []string `toml:"to"`
+	SubjectPrefix   string   `toml:"subject_prefix"`
+	Security        string   `toml:"security"`
+	DigestInterval  Duration `toml:"digest_interval"`
+	DigestMaxEvents int      `toml:"digest_max_events"`
+	Timeout         Duration `toml:"timeout"`
+	MaxRetries      int      `toml:"max_retries"`
+	tls.ClientConfig
 }
 
 type ConsoleConfig struct {
 	Enabled bool `toml:"enabled"`
 }
 
+// OutboxConfig controls the persistent per-notifier delivery queue kept under
+// state.d/notify_outbox/. It is on by default for remote notifiers.
+type OutboxConfig struct {
+	Disabled       bool     `toml:"disabled"`
+	MaxSize        int      `toml:"max_size"`
+	MaxAttempts    int      `toml:"max_attempts"`
+	InitialBackoff Duration `toml:"initial_backoff"`
+	MaxBackoff     Duration `toml:"max_backoff"`
+	MaxAge         Duration `toml:"max_age"`
+	DeadLetterMax  int      `toml:"dead_letter_max"`
+}
+
+// GroupConfig is [notify.group]. With group_by set, events for notifiers that
+// accept batches are buffered per distinct group_by label values: the first
+// event of a group waits group_wait, later ones are sent at most once per
+// group_interval. notifiers limits grouping to the named notifiers.
+type GroupConfig struct {
+	GroupBy       []string `toml:"group_by"`
+	GroupWait     Duration `toml:"group_wait"`
+	GroupInterval Duration `toml:"group_interval"`
+	MaxSize       int      `toml:"max_size"`
+	Notifiers     []string `toml:"notifiers"`
+}
+
+// RouteConfig is one [[notify.routes]] rule. All configured matchers must
+// match; each matcher takes pkg/filter patterns (glob, or /regex/).
+// Routes are evaluated in order and the first match wins unless continue=true.
+type RouteConfig struct {
+	Name        string              `toml:"name"`
+	Labels      map[string][]string `toml:"labels"`
+	FromPlugins []string            `toml:"from_plugins"`
+	Statuses    []string            `toml:"statuses"`
+	Notifiers   []string            `toml:"notifiers"`
+	Continue    bool                `toml:"continue"`
+}
+
+// InhibitRuleConfig is one [[inhibit_rules]] entry. While an alert matching
+// SourceMatchers is firing, alerts matching TargetMatchers whose Equal labels
+// have the same values are suppressed. Matchers take pkg/filter patterns.
+type InhibitRuleConfig struct {
+	Name           string              `toml:"name"`
+	SourceMatchers map[string][]string `toml:"source_matchers"`
+	TargetMatchers map[string][]string `toml:"target_matchers"`
+	Equal          []string            `toml:"equal"`
+}
+
 type NotifyConfig struct {
-	Console   *ConsoleConfig   `toml:"console"`
-	Flashduty *FlashdutyConfig `toml:"flashduty"`
-	PagerDuty *PagerDutyConfig `toml:"pagerduty"`
-	WebAPI    *WebAPIConfig    `toml:"webapi"`
+	Console    *ConsoleConfig   `toml:"console"`
+	Flashduty  *FlashdutyConfig `toml:"flashduty"`
+	PagerDuty  *PagerDutyConfig `toml:"pagerduty"`
+	WebAPI     *WebAPIConfig    `toml:"webapi"`
+	WebAPIs    []*WebAPIConfig  `toml:"webapis"`
+	Slack      *ChatConfig      `toml:"slack"`
+	Mattermost *ChatConfig      `toml:"mattermost"`
+	Email      *EmailConfig     `toml:"email"`
+	Outbox     OutboxConfig     `toml:"outbox"`
+	Group      GroupConfig      `toml:"group"`
+	Routes     []RouteConfig    `toml:"routes"`
 }
 
 // ModelConfig defines connection and model-specific parameters for one AI model.
@@ -161,94 +275,243 @@ func (c *AIConfig) ContextWindowLimit() int {
 	return cw * 80 / 100
 }
 
+// AutoReloadConfig is [reload]: conf.d is watched and changed plugin
+// directories or main config files are applied without a restart.
+type AutoReloadConfig struct {
+	Disabled     bool     `toml:"disabled"`
+	Debounce     Duration `toml:"debounce"`
+	PollInterval Duration `toml:"poll_interval"`
+}
+
 type ConfigType struct {
 	ConfigDir string `toml:"-"`
 	StateDir  string `toml:"-"`
 	Plugins   string `toml:"-"`
 	Loglevel  string `toml:"-"`
 
-	Global    Global       `toml:"global"`
-	LogConfig LogConfig    `toml:"log"`
-	Notify    NotifyConfig `toml:"notify"`
-	AI        AIConfig     `toml:"ai"`
-	Server    ServerConfig `toml:"server"`
+	// interval is the --interval flag, kept so reloads apply it again.
+	interval int64
+
+	Global    Global           `toml:"global"`
+	LogConfig LogConfig        `toml:"log"`
+	Notify    NotifyConfig     `toml:"notify"`
+	AI        AIConfig         `toml:"ai"`
+	Server    ServerConfig     `toml:"server"`
+	Reload    AutoReloadConfig `toml:"reload"`
+	LocalAPI  LocalAPIConfig   `toml:"local_api"`
+
+	SelfMonitor SelfMonitorConfig `toml:"self_monitor"`
+
+	InhibitRules []InhibitRuleConfig `toml:"inhibit_rules"`
 }
 
 var Config *ConfigType
 
 func InitConfig(configDir string, interval int64, plugins, loglevel string) error {
+	c, err := loadConfig(configDir, interval, plugins, loglevel)
+	if err != nil {
+		return err
+	}
+	Config = c
+	return nil
+}
+
+// ReloadConfig parses the main config files again, with the same command
+// line overrides, and installs the result. It returns the previous config so
+// callers can tell which sections changed; on error Config is left as is.
+func ReloadConfig() (*ConfigType, error) {
+	old := Config
+	c, err := loadConfig(old.ConfigDir, old.interval, old.Plugins, old.Loglevel)
+	if err != nil {
+		return nil, err
+	}
+	Config = c
+	return old, nil
+}
+
+func loadConfig(configDir string, interval int64, plugins, loglevel string) (*ConfigType, error) {
 	configFile := path.Join(configDir, cfg.DefaultConfigFile)
 	if !file.IsExist(configFile) {
-		return fmt.Errorf("configuration file(%s) not found", configFile)
+		return nil, fmt.Errorf("configuration file(%s) not found", configFile)
 	}
 
-	Config = &ConfigType{
+	c := &ConfigType{
 		ConfigDir: configDir,
 		StateDir:  filepath.Join(filepath.Dir(configDir), "state.d"),
 		Plugins:   plugins,
 		Loglevel:  loglevel,
+		interval:  interval,
 	}
 
-	if err := cfg.LoadConfigByDir(configDir, Config); err != nil {
-		return fmt.Errorf("failed to load configs of directory: %s error:%s", configDir, err)
+	if err := cfg.LoadConfigByDir(configDir, c); err != nil {
+		return nil, fmt.Errorf("failed to load configs of directory: %s error:%s", configDir, err)
 	}
 
 	if interval > 0 {
-		Config.Global.Interval = Duration(time.Second * time.Duration(interval))
+		c.Global.Interval = Duration(time.Second * time.Duration(interval))
+	}
+
+	if c.Global.Interval == 0 {
+		c.Global.Interval = Duration(30 * time.Second)
 	}
 
-	if Config.Global.Interval == 0 {
-		Config.Global.Interval = Duration(30 * time.Second)
+	if c.Loglevel != "" {
+		c.LogConfig.Level = c.Loglevel
 	}
 
-	if Config.Loglevel != "" {
-		Config.LogConfig.Level = Config.Loglevel
+	if c.LogConfig.Level == "" {
+		c.LogConfig.Level = "info"
 	}
 
-	if Config.LogConfig.Level == "" {
-		Config.LogConfig.Level = "info"
+	if c.LogConfig.Format == "" {
+		c.LogConfig.Format = "json"
 	}
 
-	if Config.LogConfig.Format == "" {
-		Config.LogConfig.Format = "json"
+	if len(c.LogConfig.Output) == 0 {
+		c.LogConfig.Output = "stdout"
 	}
 
-	if len(Config.LogConfig.Output) == 0 {
-		Config.LogConfig.Output = "stdout"
+	if c.LogConfig.Fields == nil {
+		c.LogConfig.Fields = make(map[string]interface{})
 	}
 
-	if Config.LogConfig.Fields == nil {
-		Config.LogConfig.Fields = make(map[string]interface{})
+	if c.Reload.Debounce == 0 {
+		c.Reload.Debounce = Duration(2 * time.Second)
 	}
+	if c.Reload.PollInterval == 0 {
+		c.Reload.PollInterval = Duration(10 * time.Second)
+	}
+
+	c.LocalAPI.applyDefaults()
+	c.SelfMonitor.applyDefaults()
 
-	Config.Notify.applyDefaults()
+	c.Notify.applyDefaults()
+	if err := c.Notify.resolveWebAPIs(configDir); err != nil {
+		return nil, err
+	}
 
-	Config.AI.applyDefaults()
-	Config.AI.resolveAPIKeys()
+	c.AI.applyDefaults()
+	c.AI.resolveAPIKeys()
 
-	if Config.Global.Labels == nil {
-		Config.Global.Labels = make(map[string]string)
+	if c.Global.Labels == nil {
+		c.Global.Labels = make(map[string]string)
 	}
 
 	builtins := HostBuiltinsWithoutIP()
-	Config.Global.Labels = resolveGlobalLabels(Config.Global.Labels, builtins)
+	c.Global.Labels = resolveGlobalLabels(c.Global.Labels, builtins)
+
+	c.Server.resolve()
 
-	Config.Server.resolve()
-	if Config.Server.Enabled && Config.Server.Address == "" {
-		return fmt.Errorf("[server] address is required when enabled=true")
+	secret.SetKeystore(secret.KeystorePath(c.StateDir))
+	if err := c.resolveSecrets(); err != nil {
+		return nil, err
 	}
-	if err := Config.resolveGatewayConfig(); err != nil {
-		return err
+
+	if c.Server.Enabled && c.Server.Address == "" {
+		return nil, fmt.Errorf("[server] address is required when enabled=true")
+	}
+	if err := c.resolveGatewayConfig(); err != nil {
+		return nil, err
 	}
 
 	// When server is enabled, alert events are sent to server and need these labels.
 	// When server is disabled, do not require them so catpaw can run in pure local mode.
-	if Config.Server.Enabled {
-		if err := validateRequiredLabels(Config.Global.Labels); err != nil {
+	if c.Server.Enabled {
+		if err := validateRequiredLabels(c.Global.Labels); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// resolveSecrets resolves secret references (file:, exec:, keystore:, see
+// package secret) in the credentials of the main config. Map values
+// (headers, extra_body, MCP env) are only resolved, and masked, when they
+// are references.
+func (c *ConfigType) resolveSecrets() error {
+	n := &c.Notify
+	if n.Flashduty != nil {
+		if err := resolveSecret("[notify.flashduty] integration_key", &n.Flashduty.IntegrationKey); err != nil {
+			return err
+		}
+	}
+	if n.PagerDuty != nil {
+		if err := resolveSecret("[notify.pagerduty] routing_key", &n.PagerDuty.RoutingKey); err != nil {
+			return err
+		}
+	}
+	for _, w := range n.WebAPITargets() {
+		if err := resolveSecretMap(fmt.Sprintf("webapi %s headers", w.Name), w.Headers); err != nil {
+			return err
+		}
+	}
+	for name, cc := range map[string]*ChatConfig{"slack": n.Slack, "mattermost": n.Mattermost} {
+		if cc == nil {
+			continue
+		}
+		if err := resolveSecret("[notify."+name+"] token", &cc.Token); err != nil {
+			return err
+		}
+		if err := resolveSecret("[notify."+name+"] webhook_url", &cc.WebhookURL); err != nil {
+			return err
+		}
+	}
+	if n.Email != nil {
+		if err := resolveSecret("[notify.email] password", &n.Email.Password); err != nil {
 			return err
 		}
 	}
 
+	if err := resolveSecret("[ai.gateway] agent_token", &c.AI.Gateway.AgentToken); err != nil {
+		return err
+	}
+	for name, m := range c.AI.Models {
+		if err := resolveSecret("[ai.models."+name+"] api_key", &m.APIKey); err != nil {
+			return err
+		}
+		for k, v := range m.ExtraBody {
+			if s, ok := v.(string); ok && secret.IsRef(s) {
+				if err := resolveSecret("[ai.models."+name+"] extra_body."+k, &s); err != nil {
+					return err
+				}
+				m.ExtraBody[k] = s
+			}
+		}
+		c.AI.Models[name] = m
+	}
+	for i := range c.AI.MCP.Servers {
+		srv := &c.AI.MCP.Servers[i]
+		if err := resolveSecretMap("[ai.mcp] server "+srv.Name+" env", srv.Env); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveSecret("[server] agent_token", &c.Server.AgentToken); err != nil {
+		return err
+	}
+	return resolveSecret("[local_api] token", &c.LocalAPI.Token)
+}
+
+func resolveSecret(field string, val *string) error {
+	v, err := secret.Resolve(*val)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	*val = v
+	return nil
+}
+
+func resolveSecretMap(field string, m map[string]string) error {
+	for k, v := range m {
+		if !secret.IsRef(v) {
+			continue
+		}
+		if err := resolveSecret(field+"."+k, &v); err != nil {
+			return err
+		}
+		m[k] = v
+	}
 	return nil
 }
 
@@ -541,7 +804,7 @@ func (c *AIConfig) Validate() error {
 					return fmt.Errorf("[ai.models.%s] base_url is required", name)
 				}
 				if m.APIKey == "" {
-					return fmt.Errorf("[ai.models.%s] api_key is required (supports ${ENV_VAR} syntax)", name)
+					return fmt.Errorf("[ai.models.%s] api_key is required (supports ${ENV_VAR}, file:, exec: and keystore: references)", name)
 				}
 			}
 		}
@@ -553,6 +816,33 @@ func (c *AIConfig) Validate() error {
 }
 
 func (c *NotifyConfig) applyDefaults() {
+	if c.Group.GroupWait == 0 {
+		c.Group.GroupWait = Duration(10 * time.Second)
+	}
+	if c.Group.GroupInterval == 0 {
+		c.Group.GroupInterval = Duration(time.Minute)
+	}
+	if c.Group.MaxSize <= 0 {
+		c.Group.MaxSize = 100
+	}
+	if c.Outbox.MaxSize <= 0 {
+		c.Outbox.MaxSize = 1000
+	}
+	if c.Outbox.MaxAttempts <= 0 {
+		c.Outbox.MaxAttempts = 20
+	}
+	if c.Outbox.InitialBackoff == 0 {
+		c.Outbox.InitialBackoff = Duration(2 * time.Second)
+	}
+	if c.Outbox.MaxBackoff == 0 {
+		c.Outbox.MaxBackoff = Duration(5 * time.Minute)
+	}
+	if c.Outbox.MaxAge == 0 {
+		c.Outbox.MaxAge = Duration(24 * time.Hour)
+	}
+	if c.Outbox.DeadLetterMax <= 0 {
+		c.Outbox.DeadLetterMax = 1000
+	}
 	if c.Flashduty != nil {
 		if c.Flashduty.BaseUrl == "" {
 			c.Flashduty.BaseUrl = "https://api.flashcat.cloud/event/push/alert/standard"
@@ -583,23 +873,149 @@ func (c *NotifyConfig) applyDefaults() {
 		}
 	}
 	if c.WebAPI != nil {
-		method := strings.ToUpper(c.WebAPI.Method)
-		if method != "PUT" {
-			method = "POST"
+		c.WebAPI.applyDefaults()
+	}
+	for _, w := range c.WebAPIs {
+		if w != nil {
+			w.applyDefaults()
+		}
+	}
+	if c.Slack != nil {
+		c.Slack.applyDefaults("https://slack.com/api")
+	}
+	if c.Mattermost != nil {
+		c.Mattermost.applyDefaults("")
+	}
+	if c.Email != nil {
+		c.Email.applyDefaults()
+	}
+}
+
+func (w *WebAPIConfig) applyDefaults() {
+	method := strings.ToUpper(w.Method)
+	if method != "PUT" {
+		method = "POST"
+	}
+	w.Method = method
+	if w.ContentType == "" {
+		w.ContentType = "application/json"
+	}
+	if w.Timeout == 0 {
+		w.Timeout = Duration(10 * time.Second)
+	}
+	if w.MaxRetries <= 0 {
+		w.MaxRetries = 1
+	}
+	for k, v := range w.Headers {
+		w.Headers[k] = os.Expand(v, func(key string) string {
+			return os.Getenv(key)
+		})
+	}
+	w.URL = os.ExpandEnv(w.URL)
+}
+
+// resolveWebAPIs names the webapi targets, checks names are unique and makes
+// relative template_file / batch_template_file paths relative to the config
+// directory.
+func (c *NotifyConfig) resolveWebAPIs(configDir string) error {
+	seen := map[string]struct{}{}
+	for _, w := range c.WebAPITargets() {
+		if w == c.WebAPI && w.Name == "" {
+			w.Name = "webapi"
+		}
+		if w.Name == "" {
+			return fmt.Errorf("[[notify.webapis]] url=%q: name is required", w.URL)
+		}
+		if _, dup := seen[w.Name]; dup {
+			return fmt.Errorf("duplicate webapi notifier name %q", w.Name)
+		}
+		seen[w.Name] = struct{}{}
+		if w.Template != "" && w.TemplateFile != "" {
+			return fmt.Errorf("webapi %s: template and template_file are mutually exclusive", w.Name)
+		}
+		if w.TemplateFile != "" && !filepath.IsAbs(w.TemplateFile) {
+			w.TemplateFile = filepath.Join(configDir, w.TemplateFile)
 		}
-		c.WebAPI.Method = method
-		if c.WebAPI.Timeout == 0 {
-			c.WebAPI.Timeout = Duration(10 * time.Second)
+		if w.BatchTemplate != "" && w.BatchTemplateFile != "" {
+			return fmt.Errorf("webapi %s: batch_template and batch_template_file are mutually exclusive", w.Name)
 		}
-		if c.WebAPI.MaxRetries <= 0 {
-			c.WebAPI.MaxRetries = 1
+		if w.BatchTemplateFile != "" && !filepath.IsAbs(w.BatchTemplateFile) {
+			w.BatchTemplateFile = filepath.Join(configDir, w.BatchTemplateFile)
 		}
-		for k, v := range c.WebAPI.Headers {
-			c.WebAPI.Headers[k] = os.Expand(v, func(key string) string {
-				return os.Getenv(key)
-			})
+	}
+	return nil
+}
+
+// WebAPITargets returns [notify.webapi] (if set) followed by [[notify.webapis]].
+func (c *NotifyConfig) WebAPITargets() []*WebAPIConfig {
+	ret := make([]*WebAPIConfig, 0, len(c.WebAPIs)+1)
+	if c.WebAPI != nil {
+		ret = append(ret, c.WebAPI)
+	}
+	for _, w := range c.WebAPIs {
+		if w != nil {
+			ret = append(ret, w)
+		}
+	}
+	return ret
+}
+
+func (c *ChatConfig) applyDefaults(apiURL string) {
+	if c.APIURL == "" {
+		c.APIURL = apiURL
+	}
+	c.APIURL = strings.TrimRight(c.APIURL, "/")
+	c.Token = os.ExpandEnv(c.Token)
+	c.WebhookURL = os.ExpandEnv(c.WebhookURL)
+	if c.Username == "" {
+		c.Username = "catpaw"
+	}
+	if len(c.Labels) == 0 {
+		c.Labels = []string{"check", "target", "from_hostname", "from_hostip"}
+	}
+	if c.Timeout == 0 {
+		c.Timeout = Duration(10 * time.Second)
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 1
+	}
+}
+
+func (c *EmailConfig) applyDefaults() {
+	c.Security = strings.ToLower(c.Security)
+	if c.Security == "" {
+		c.Security = "auto"
+	}
+	if c.Port == 0 {
+		c.Port = 25
+		if c.Security == "tls" {
+			c.Port = 465
 		}
 	}
+	c.Username = os.ExpandEnv(c.Username)
+	c.Password = os.ExpandEnv(c.Password)
+	if c.From == "" {
+		host, _ := os.Hostname()
+		c.From = "catpaw@" + host
+	}
+	if c.SubjectPrefix == "" {
+		c.SubjectPrefix = "[catpaw]"
+	}
+	if c.DigestMaxEvents <= 0 {
+		c.DigestMaxEvents = 100
+	}
+	if c.Timeout == 0 {
+		c.Timeout = Duration(30 * time.Second)
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 1
+	}
+}
+
+// UseAPI reports whether messages go through the chat API (threaded
+// comments) rather than the incoming webhook.
+func (c *ChatConfig) UseAPI() bool {
+	return c.Token != "" && c.Channel != "" && c.APIURL != ""
 }
 
 // expandLabels resolves ${HOSTNAME}, ${SHORT_HOSTNAME}, ${IP} and any
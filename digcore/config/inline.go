@@ -14,6 +14,17 @@ type Alerting struct {
 
 	// set to true to suppress recovery notifications
 	DisableRecoveryNotification bool `toml:"disable_recovery_notification"`
+
+	// hold back recovery until the check has stayed Ok this long
+	RecoveryForDuration Duration `toml:"recovery_for_duration"`
+
+	// flap detection: FlapThreshold Ok<->alert transitions within FlapWindow
+	// mark the check as flapping; 0 window disables it
+	FlapWindow    Duration `toml:"flap_window"`
+	FlapThreshold int      `toml:"flap_threshold"`
+
+	// status of the single flapping notice: Warning (default) or Info
+	FlapStatus string `toml:"flap_status"`
 }
 
 type DiagnoseConfig struct {
@@ -30,6 +41,22 @@ type InternalConfig struct {
 	// gather interval
 	Interval Duration `toml:"interval"`
 
+	// cron expression (5 fields or @hourly-style macro) that replaces the
+	// interval, evaluated in Timezone
+	Schedule string `toml:"schedule"`
+
+	// IANA timezone of Schedule and ActiveWindows; default local time
+	Timezone string `toml:"timezone"`
+
+	// when set, gather only inside these windows ("skip", default) or
+	// gather always but alert only inside them ("mute")
+	ActiveWindows  []ActiveWindow `toml:"active_windows"`
+	OutsideWindows string         `toml:"outside_windows"`
+
+	// how long one gather may run before the agent reports a timeout;
+	// defaults to three times the interval.
+	GatherTimeout Duration `toml:"gather_timeout"`
+
 	// alerting rule
 	Alerting Alerting `toml:"alerting"`
 
@@ -49,6 +76,10 @@ func (ic *InternalConfig) GetInterval() Duration {
 	return ic.Interval
 }
 
+func (ic *InternalConfig) GetGatherTimeout() Duration {
+	return ic.GatherTimeout
+}
+
 func (ic *InternalConfig) GetAlerting() Alerting {
 	return ic.Alerting
 }
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// LocalAPIConfig defines the optional HTTP API of the running agent
+// ([local_api]). It is meant for local tooling, so it listens on loopback or
+// a unix socket ("unix:/run/catpaw/api.sock").
+type LocalAPIConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Listen  string `toml:"listen"`
+	Token   string `toml:"token"`
+}
+
+func (c *LocalAPIConfig) applyDefaults() {
+	if c.Listen == "" {
+		c.Listen = "127.0.0.1:9099"
+	}
+	c.Token = os.ExpandEnv(c.Token)
+}
+
+// UnixSocket returns the socket path when Listen is "unix:<path>".
+func (c LocalAPIConfig) UnixSocket() (string, bool) {
+	return strings.CutPrefix(c.Listen, "unix:")
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveWebAPIs(t *testing.T) {
+	c := NotifyConfig{
+		WebAPI: &WebAPIConfig{URL: "https://a"},
+		WebAPIs: []*WebAPIConfig{
+			{Name: "dingtalk", URL: "https://b", TemplateFile: "templates/dingtalk.tmpl"},
+			{Name: "lark", URL: "https://c", TemplateFile: "/etc/catpaw/lark.tmpl"},
+		},
+	}
+	c.applyDefaults()
+	if err := c.resolveWebAPIs("/opt/catpaw/conf.d"); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := c.WebAPITargets()
+	if len(targets) != 3 || targets[0].Name != "webapi" {
+		t.Fatalf("unexpected targets: %+v", targets)
+	}
+	if got := targets[1].TemplateFile; got != filepath.Join("/opt/catpaw/conf.d", "templates/dingtalk.tmpl") {
+		t.Fatalf("relative template_file = %q", got)
+	}
+	if got := targets[2].TemplateFile; got != "/etc/catpaw/lark.tmpl" {
+		t.Fatalf("absolute template_file = %q", got)
+	}
+	if targets[1].Method != "POST" || targets[1].ContentType != "application/json" {
+		t.Fatalf("defaults not applied: %+v", targets[1])
+	}
+}
+
+func TestResolveWebAPIsErrors(t *testing.T) {
+	for name, c := range map[string]NotifyConfig{
+		"missing name": {WebAPIs: []*WebAPIConfig{{URL: "https://b"}}},
+		"duplicate name": {
+			WebAPI:  &WebAPIConfig{URL: "https://a"},
+			WebAPIs: []*WebAPIConfig{{Name: "webapi", URL: "https://b"}},
+		},
+		"template and file": {WebAPIs: []*WebAPIConfig{{Name: "x", Template: "{}", TemplateFile: "x.tmpl"}}},
+	} {
+		if err := c.resolveWebAPIs("/tmp"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "flashduty.key")
+	if err := os.WriteFile(keyFile, []byte("fd-integration-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &ConfigType{
+		Notify: NotifyConfig{
+			Flashduty: &FlashdutyConfig{IntegrationKey: "file:" + keyFile},
+			WebAPIs: []*WebAPIConfig{{
+				Name:    "ops",
+				Headers: map[string]string{"Authorization": "file:" + keyFile, "X-Team": "sre"},
+			}},
+		},
+		AI: AIConfig{
+			Models: map[string]ModelConfig{"m": {APIKey: "file:" + keyFile, ExtraBody: map[string]interface{}{"region": "us-east-1"}}},
+			MCP:    MCPConfig{Servers: []MCPServerConfig{{Name: "gh", Env: map[string]string{"TOKEN": "file:" + keyFile}}}},
+		},
+	}
+	if err := c.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Notify.Flashduty.IntegrationKey; got != "fd-integration-key" {
+		t.Fatalf("integration_key = %q", got)
+	}
+	if h := c.Notify.WebAPIs[0].Headers; h["Authorization"] != "fd-integration-key" || h["X-Team"] != "sre" {
+		t.Fatalf("headers = %v", h)
+	}
+	if m := c.AI.Models["m"]; m.APIKey != "fd-integration-key" || m.ExtraBody["region"] != "us-east-1" {
+		t.Fatalf("model = %+v", m)
+	}
+	if got := c.AI.MCP.Servers[0].Env["TOKEN"]; got != "fd-integration-key" {
+		t.Fatalf("mcp env = %q", got)
+	}
+
+	c = &ConfigType{Server: ServerConfig{AgentToken: "file:" + filepath.Join(dir, "missing")}}
+	if err := c.resolveSecrets(); err == nil {
+		t.Fatal("expected error for missing secret file")
+	}
+}
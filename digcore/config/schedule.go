@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/pkg/cron"
+)
+
+// What happens outside every active window (InternalConfig.OutsideWindows).
+const (
+	OutsideWindowsSkip = "skip" // do not gather
+	OutsideWindowsMute = "mute" // gather, but only Ok events reach the engine
+)
+
+// ActiveWindow is one [[active_windows]] entry: a daily time range on some
+// weekdays. Empty weekdays means every day, empty start/end the whole day.
+// An end at or before start crosses midnight; the window then belongs to
+// the weekday it starts on.
+type ActiveWindow struct {
+	Weekdays []string `toml:"weekdays"` // "mon", "sat-sun", "mon-fri"
+	Start    string   `toml:"start"`    // "HH:MM"
+	End      string   `toml:"end"`      // "HH:MM"
+	Timezone string   `toml:"timezone"` // default: the instance timezone
+}
+
+// GatherSchedule is the compiled schedule, timezone and active_windows of
+// an instance.
+type GatherSchedule struct {
+	cron    *cron.Schedule
+	loc     *time.Location
+	windows []activeWindow
+	mute    bool
+}
+
+type activeWindow struct {
+	days       [7]bool
+	start, end time.Duration // offsets from midnight
+	loc        *time.Location
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// CompileSchedule parses schedule, timezone and active_windows. It returns
+// nil when none of them is set, so the instance runs on its interval.
+func (ic *InternalConfig) CompileSchedule() (*GatherSchedule, error) {
+	if ic.Schedule == "" && len(ic.ActiveWindows) == 0 {
+		return nil, nil
+	}
+
+	s := &GatherSchedule{loc: time.Local}
+	if ic.Timezone != "" {
+		loc, err := time.LoadLocation(ic.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+		s.loc = loc
+	}
+
+	if ic.Schedule != "" {
+		c, err := cron.Parse(ic.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: %w", err)
+		}
+		s.cron = c
+	}
+
+	switch ic.OutsideWindows {
+	case "", OutsideWindowsSkip:
+	case OutsideWindowsMute:
+		s.mute = true
+	default:
+		return nil, fmt.Errorf("outside_windows: want %q or %q, got %q", OutsideWindowsSkip, OutsideWindowsMute, ic.OutsideWindows)
+	}
+
+	for i, w := range ic.ActiveWindows {
+		cw, err := compileWindow(w, s.loc)
+		if err != nil {
+			return nil, fmt.Errorf("active_windows[%d]: %w", i, err)
+		}
+		s.windows = append(s.windows, cw)
+	}
+	return s, nil
+}
+
+func compileWindow(w ActiveWindow, loc *time.Location) (activeWindow, error) {
+	cw := activeWindow{loc: loc, end: 24 * time.Hour}
+	if w.Timezone != "" {
+		l, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return cw, fmt.Errorf("timezone: %w", err)
+		}
+		cw.loc = l
+	}
+
+	if len(w.Weekdays) == 0 {
+		for d := range cw.days {
+			cw.days[d] = true
+		}
+	}
+	for _, spec := range w.Weekdays {
+		from, to, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), "-")
+		if !isRange {
+			to = from
+		}
+		a, ok1 := weekdayNames[from]
+		b, ok2 := weekdayNames[to]
+		if !ok1 || !ok2 {
+			return cw, fmt.Errorf("invalid weekday %q", spec)
+		}
+		for d := a; ; d = (d + 1) % 7 {
+			cw.days[d] = true
+			if d == b {
+				break
+			}
+		}
+	}
+
+	var err error
+	if w.Start != "" {
+		if cw.start, err = parseClock(w.Start); err != nil {
+			return cw, fmt.Errorf("start: %w", err)
+		}
+	}
+	if w.End != "" {
+		if cw.end, err = parseClock(w.End); err != nil {
+			return cw, fmt.Errorf("end: %w", err)
+		}
+		if cw.end <= cw.start {
+			cw.end += 24 * time.Hour
+		}
+	}
+	return cw, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// HasCron reports whether gathers follow the cron schedule instead of the
+// interval.
+func (s *GatherSchedule) HasCron() bool {
+	return s != nil && s.cron != nil
+}
+
+// Next returns the first cron fire time after t, or the zero time when
+// there is none within five years.
+func (s *GatherSchedule) Next(t time.Time) time.Time {
+	return s.cron.Next(t.In(s.loc))
+}
+
+// Mute reports whether gathers outside the windows still run with their
+// alerts suppressed, rather than being skipped.
+func (s *GatherSchedule) Mute() bool {
+	return s != nil && s.mute
+}
+
+// Active reports whether t falls into an active window. Without windows
+// every time is active.
+func (s *GatherSchedule) Active(t time.Time) bool {
+	if s == nil || len(s.windows) == 0 {
+		return true
+	}
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextActive returns when the first gather after t that runs inside an
+// active window starts: the next such cron fire time or, on an interval,
+// one interval after t or after the next window opens. Gathers muted
+// outside the windows do not count, as they cannot raise an alert. It
+// returns the zero time when there is none.
+func (s *GatherSchedule) NextActive(t time.Time, interval time.Duration) time.Time {
+	if !s.HasCron() {
+		from := s.activeFrom(t)
+		if from.IsZero() {
+			return from
+		}
+		return from.Add(interval)
+	}
+
+	next := t
+	for i := 0; i < 1000; i++ {
+		if !s.Active(next) {
+			start := s.activeFrom(next)
+			if start.IsZero() {
+				return start
+			}
+			// a fire time right at the window start counts
+			next = start.Add(-time.Nanosecond)
+		}
+		next = s.Next(next)
+		if next.IsZero() || s.Active(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// activeFrom returns t when it falls into an active window, otherwise the
+// start of the next window, or the zero time when no window opens within a
+// week.
+func (s *GatherSchedule) activeFrom(t time.Time) time.Time {
+	if s.Active(t) {
+		return t
+	}
+	var next time.Time
+	for _, w := range s.windows {
+		if start := w.nextStart(t); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
+
+func (w activeWindow) nextStart(t time.Time) time.Time {
+	t = t.In(w.loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.loc)
+	for i := 0; i <= 7; i++ {
+		day := midnight.AddDate(0, 0, i)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		if start := day.Add(w.start); start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+func (w activeWindow) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.loc)
+	// a window that crosses midnight may have started yesterday
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		since := t.Sub(day)
+		if since >= w.start && since < w.end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompileScheduleNone(t *testing.T) {
+	s, err := (&InternalConfig{}).CompileSchedule()
+	if err != nil || s != nil {
+		t.Fatalf("CompileSchedule() = %v, %v; want nil, nil", s, err)
+	}
+	if !s.Active(time.Now()) || s.HasCron() || s.Mute() {
+		t.Fatal("nil schedule should always be active, without cron or mute")
+	}
+}
+
+func TestActiveWindows(t *testing.T) {
+	ic := &InternalConfig{
+		Timezone: "UTC",
+		ActiveWindows: []ActiveWindow{
+			{Weekdays: []string{"mon-fri"}, Start: "09:00", End: "18:00"},
+			{Weekdays: []string{"sat"}, Start: "22:00", End: "02:00"},
+		},
+	}
+	s, err := ic.CompileSchedule()
+	if err != nil {
+		t.Fatalf("CompileSchedule: %v", err)
+	}
+
+	cases := []struct {
+		at   string
+		want bool
+	}{
+		{"2026-10-12T09:00:00Z", true},  // Monday
+		{"2026-10-12T17:59:00Z", true},  // Monday
+		{"2026-10-12T18:00:00Z", false}, // Monday, end is exclusive
+		{"2026-10-12T08:59:00Z", false},
+		{"2026-10-16T12:00:00Z", true},  // Friday
+		{"2026-10-17T12:00:00Z", false}, // Saturday
+		{"2026-10-17T23:00:00Z", true},  // Saturday night
+		{"2026-10-18T01:30:00Z", true},  // continues into Sunday
+		{"2026-10-18T02:00:00Z", false},
+		{"2026-10-18T23:00:00Z", false}, // Sunday night is not in the window
+	}
+	for _, c := range cases {
+		at, _ := time.Parse(time.RFC3339, c.at)
+		if got := s.Active(at); got != c.want {
+			t.Errorf("Active(%s) = %v, want %v", c.at, got, c.want)
+		}
+	}
+}
+
+func TestActiveWindowTimezone(t *testing.T) {
+	ic := &InternalConfig{
+		ActiveWindows: []ActiveWindow{{Start: "09:00", End: "10:00", Timezone: "Asia/Shanghai"}},
+	}
+	s, err := ic.CompileSchedule()
+	if err != nil {
+		t.Fatalf("CompileSchedule: %v", err)
+	}
+	at, _ := time.Parse(time.RFC3339, "2026-10-12T01:30:00Z") // 09:30 in Shanghai
+	if !s.Active(at) {
+		t.Fatal("09:30 Asia/Shanghai should be active")
+	}
+	if s.Active(at.Add(time.Hour)) {
+		t.Fatal("10:30 Asia/Shanghai should not be active")
+	}
+}
+
+func TestScheduleCronNext(t *testing.T) {
+	ic := &InternalConfig{Schedule: "5 3 * * *", Timezone: "Asia/Shanghai", OutsideWindows: "mute"}
+	s, err := ic.CompileSchedule()
+	if err != nil {
+		t.Fatalf("CompileSchedule: %v", err)
+	}
+	if !s.HasCron() || !s.Mute() {
+		t.Fatal("expected cron schedule in mute mode")
+	}
+	from, _ := time.Parse(time.RFC3339, "2026-10-12T00:00:00Z") // 08:00 in Shanghai
+	want, _ := time.Parse(time.RFC3339, "2026-10-12T19:05:00Z") // 03:05 next day
+	if got := s.Next(from); !got.Equal(want) {
+		t.Fatalf("Next = %s, want %s", got.UTC(), want)
+	}
+}
+
+func TestCompileScheduleErrors(t *testing.T) {
+	for name, ic := range map[string]*InternalConfig{
+		"cron":     {Schedule: "61 * * * *"},
+		"timezone": {Schedule: "@hourly", Timezone: "Mars/Olympus"},
+		"weekday":  {ActiveWindows: []ActiveWindow{{Weekdays: []string{"funday"}}}},
+		"clock":    {ActiveWindows: []ActiveWindow{{Start: "9am"}}},
+		"mode":     {ActiveWindows: []ActiveWindow{{Start: "09:00"}}, OutsideWindows: "drop"},
+	} {
+		if _, err := ic.CompileSchedule(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNextActive(t *testing.T) {
+	parse := func(s string) time.Time {
+		at, _ := time.Parse(time.RFC3339, s)
+		return at
+	}
+	windows := []ActiveWindow{{Weekdays: []string{"mon-fri"}, Start: "09:00", End: "18:00"}}
+
+	var none *GatherSchedule
+	if got := none.NextActive(parse("2026-10-12T10:00:00Z"), time.Minute); !got.Equal(parse("2026-10-12T10:01:00Z")) {
+		t.Fatalf("no schedule: NextActive = %s, want one interval later", got.UTC())
+	}
+
+	cases := []struct {
+		name string
+		ic   *InternalConfig
+		at   string
+		want string
+	}{
+		{"interval inside window", &InternalConfig{Timezone: "UTC", ActiveWindows: windows},
+			"2026-10-12T10:00:00Z", "2026-10-12T10:01:00Z"},
+		{"interval after window", &InternalConfig{Timezone: "UTC", ActiveWindows: windows},
+			"2026-10-16T19:00:00Z", "2026-10-19T09:01:00Z"}, // Friday evening → Monday
+		{"muted interval waits for window", &InternalConfig{Timezone: "UTC", ActiveWindows: windows, OutsideWindows: "mute"},
+			"2026-10-12T07:00:00Z", "2026-10-12T09:01:00Z"},
+		{"cron", &InternalConfig{Timezone: "UTC", Schedule: "0 * * * *"},
+			"2026-10-12T10:30:00Z", "2026-10-12T11:00:00Z"},
+		{"cron at window start", &InternalConfig{Timezone: "UTC", Schedule: "0 * * * *", ActiveWindows: windows},
+			"2026-10-17T10:30:00Z", "2026-10-19T09:00:00Z"}, // Saturday → Monday
+		{"daily cron outside window", &InternalConfig{Timezone: "UTC", Schedule: "0 3 * * *", ActiveWindows: windows},
+			"2026-10-12T10:00:00Z", ""},
+	}
+	for _, c := range cases {
+		s, err := c.ic.CompileSchedule()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := s.NextActive(parse(c.at), time.Minute)
+		if c.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%s: NextActive = %s, want none", c.name, got.UTC())
+			}
+			continue
+		}
+		if !got.Equal(parse(c.want)) {
+			t.Errorf("%s: NextActive = %s, want %s", c.name, got.UTC(), c.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+// SelfMonitorConfig is [self_monitor]: catpaw::* events about the agent's
+// own health. labels and alerting work as in a plugin config; interval is
+// how often the agent-wide checks run (gather overruns and plugin panics
+// are reported by each plugin instance as they happen).
+type SelfMonitorConfig struct {
+	InternalConfig
+
+	Disabled bool `toml:"disabled"`
+
+	// consecutive failed deliveries before catpaw::notifier_failure fires
+	NotifierFailureStreak int `toml:"notifier_failure_streak"`
+
+	// how long the catpaw-server connection may stay down before
+	// catpaw::server_disconnected fires
+	ServerDisconnectFor Duration `toml:"server_disconnect_for"`
+}
+
+func (c *SelfMonitorConfig) applyDefaults() {
+	if c.NotifierFailureStreak <= 0 {
+		c.NotifierFailureStreak = 3
+	}
+	if c.ServerDisconnectFor == 0 {
+		c.ServerDisconnectFor = Duration(5 * time.Minute)
+	}
+	// a failing agent-wide check would otherwise notify every interval
+	if c.Alerting.RepeatInterval == 0 {
+		c.Alerting.RepeatInterval = Duration(time.Hour)
+	}
+}
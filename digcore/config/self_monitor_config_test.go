@@ -0,0 +1,24 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelfMonitorDefaults(t *testing.T) {
+	c := SelfMonitorConfig{}
+	c.applyDefaults()
+	if c.NotifierFailureStreak != 3 || c.ServerDisconnectFor != Duration(5*time.Minute) {
+		t.Fatalf("defaults = %+v", c)
+	}
+	if c.Alerting.RepeatInterval != Duration(time.Hour) {
+		t.Fatalf("repeat_interval default = %s, want 1h", time.Duration(c.Alerting.RepeatInterval))
+	}
+
+	c = SelfMonitorConfig{}
+	c.Alerting.RepeatInterval = Duration(10 * time.Minute)
+	c.applyDefaults()
+	if c.Alerting.RepeatInterval != Duration(10*time.Minute) {
+		t.Fatalf("configured repeat_interval overridden: %s", time.Duration(c.Alerting.RepeatInterval))
+	}
+}
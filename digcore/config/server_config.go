@@ -16,6 +16,13 @@ type ServerConfig struct {
 	CAFile          string `toml:"ca_file"`
 	TLSSkipVerify   bool   `toml:"tls_skip_verify"`
 	AlertBufferSize int    `toml:"alert_buffer_size"`
+
+	// AllowConfigPush lets the server push plugin configs (config_push).
+	// Off by default: a pushed config runs on the agent.
+	AllowConfigPush bool `toml:"allow_config_push"`
+	// ConfigPushExecPlugins lists the plugins that run commands named in
+	// their config (exec, scriptfilter, smart) the server may still push.
+	ConfigPushExecPlugins []string `toml:"config_push_exec_plugins"`
 }
 
 func (c *ServerConfig) GetAlertBufferSize() int {
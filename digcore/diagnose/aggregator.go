@@ -102,6 +102,13 @@ func (a *DiagnoseAggregator) Submit(event *types.Event, snapshot CheckSnapshot,
 	})
 }
 
+// Pending returns the number of targets whose aggregation window is open.
+func (a *DiagnoseAggregator) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
 // Shutdown cancels all pending aggregation timers.
 func (a *DiagnoseAggregator) Shutdown() {
 	a.mu.Lock()
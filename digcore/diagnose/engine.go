@@ -32,6 +32,7 @@ type DiagnoseEngine struct {
 	inFlight map[string]context.CancelFunc // "plugin::target" → cancel
 	sem      chan struct{}                 // concurrency limiter
 	stopped  atomic.Bool
+	dropped  atomic.Int64 // submissions skipped because every slot was busy
 }
 
 // NewDiagnoseEngine creates a new engine from global config.
@@ -90,6 +91,7 @@ func (e *DiagnoseEngine) Submit(req *DiagnoseRequest) {
 			e.RunDiagnose(req)
 		}()
 	default:
+		e.dropped.Add(1)
 		logger.Logger.Warnw("diagnose skipped: concurrency limit reached",
 			"key", key, "limit", e.cfg.MaxConcurrentDiagnoses)
 	}
@@ -486,6 +488,18 @@ func (e *DiagnoseEngine) State() *DiagnoseState {
 	return e.state
 }
 
+// Running returns how many diagnoses hold a concurrency slot, and how many
+// slots there are.
+func (e *DiagnoseEngine) Running() (running, limit int) {
+	return len(e.sem), cap(e.sem)
+}
+
+// Dropped returns how many submissions were skipped so far because the
+// concurrency limit was reached.
+func (e *DiagnoseEngine) Dropped() int64 {
+	return e.dropped.Load()
+}
+
 // Registry returns the engine's tool registry.
 func (e *DiagnoseEngine) Registry() *ToolRegistry {
 	return e.registry
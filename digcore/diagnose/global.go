@@ -16,7 +16,8 @@ var (
 )
 
 // Init initializes the global diagnose engine and aggregator.
-// Called once at startup from the agent package.
+// Called at startup from the agent package, and again after Shutdown when
+// the [ai] config is reloaded.
 func Init(registry *ToolRegistry) {
 	cfg := config.Config.AI
 	if !cfg.Enabled {
@@ -68,9 +69,11 @@ func Shutdown() {
 	}
 	if globalAggregator != nil {
 		globalAggregator.Shutdown()
+		globalAggregator = nil
 	}
 	if globalEngine != nil {
 		globalEngine.Shutdown()
+		globalEngine = nil
 	}
 
 	logger.Logger.Infow("AI diagnose engine shutdown complete")
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/secret"
 )
 
 // NewDiagnoseRecord creates a DiagnoseRecord from a DiagnoseRequest,
@@ -44,6 +45,8 @@ func (r *DiagnoseRecord) Save() error {
 	if err != nil {
 		return fmt.Errorf("marshal record: %w", err)
 	}
+	// tool output may echo credentials, e.g. a config dump
+	data = secret.MaskJSON(data)
 
 	target := filepath.Join(dir, r.ID+".json")
 	tmp := target + ".tmp"
@@ -151,6 +151,14 @@ func (s *DiagnoseState) IsDailyLimitReached(limit int) bool {
 	return s.TotalTokens() >= limit
 }
 
+// Usage returns today's date and token counts.
+func (s *DiagnoseState) Usage() (date string, input, output int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetIfNewDay()
+	return s.Date, s.InputTokens, s.OutputTokens
+}
+
 // FormatUsage returns a human-readable summary of daily token usage.
 func (s *DiagnoseState) FormatUsage() string {
 	s.mu.Lock()
@@ -12,24 +12,108 @@ import (
 type EventCache struct {
 	sync.RWMutex
 	records map[string]*types.Event
+
+	// restored tracks keys loaded from the on-disk snapshot that have not yet
+	// been refreshed by a live gather. Used to detect orphaned alerts.
+	restored map[string]struct{}
+	dirty    bool
+
+	// inhibitedBy maps a suppressed alert to the AlertKey of the firing alert
+	// that inhibits it.
+	inhibitedBy map[string]string
 }
 
-var Events = &EventCache{records: make(map[string]*types.Event)}
+var Events = newEventCache()
+
+func newEventCache() *EventCache {
+	return &EventCache{
+		records:     make(map[string]*types.Event),
+		restored:    make(map[string]struct{}),
+		inhibitedBy: make(map[string]string),
+	}
+}
 
+// Get returns the cached event itself; treat it as read-only.
 func (c *EventCache) Get(key string) *types.Event {
 	c.RLock()
 	defer c.RUnlock()
 	return c.records[key]
 }
 
+// Set caches a copy of val, so the caller may keep updating val (LastSent,
+// NotifyCount) while the snapshot loop reads the cache.
 func (c *EventCache) Set(val *types.Event) {
+	cp := *val
 	c.Lock()
 	defer c.Unlock()
-	c.records[val.AlertKey] = val
+	c.records[val.AlertKey] = &cp
+	delete(c.restored, val.AlertKey)
+	c.dirty = true
 }
 
 func (c *EventCache) Del(key string) {
 	c.Lock()
 	defer c.Unlock()
 	delete(c.records, key)
+	delete(c.restored, key)
+	delete(c.inhibitedBy, key)
+	c.dirty = true
+}
+
+// Len returns the number of cached (active) alert events.
+func (c *EventCache) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.records)
+}
+
+// List returns copies of all cached events.
+func (c *EventCache) List() []*types.Event {
+	c.RLock()
+	defer c.RUnlock()
+	ret := make([]*types.Event, 0, len(c.records))
+	for _, e := range c.records {
+		cp := *e
+		ret = append(ret, &cp)
+	}
+	return ret
+}
+
+// touch marks a restored key as still alive without replacing its record.
+func (c *EventCache) touch(key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.restored, key)
+}
+
+// isRestored reports whether key was loaded from the snapshot and has not
+// been refreshed by a gather since.
+func (c *EventCache) isRestored(key string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	_, ok := c.restored[key]
+	return ok
+}
+
+// InhibitedBy returns the AlertKey of the alert inhibiting key, or "".
+func (c *EventCache) InhibitedBy(key string) string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.inhibitedBy[key]
+}
+
+// setInhibitedBy records (or clears, with an empty source) the inhibition
+// mark of key. It reports whether the mark changed to a new source.
+func (c *EventCache) setInhibitedBy(key, source string) bool {
+	c.Lock()
+	defer c.Unlock()
+	if source == "" {
+		delete(c.inhibitedBy, key)
+		return false
+	}
+	if c.inhibitedBy[key] == source {
+		return false
+	}
+	c.inhibitedBy[key] = source
+	return true
 }
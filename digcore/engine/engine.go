@@ -13,6 +13,7 @@ import (
 	"github.com/cprobe/catpaw/digcore/notify"
 	"github.com/cprobe/catpaw/digcore/pkg/safe"
 	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/silence"
 	"github.com/cprobe/catpaw/digcore/types"
 	"github.com/toolkits/pkg/str"
 )
@@ -23,13 +24,44 @@ var (
 )
 
 func PushRawEvents(pluginName string, pluginObj plugins.Plugin, ins plugins.Instance, queue *safe.Queue[*types.Event]) {
+	events := CleanRawEvents(pluginName, pluginObj, ins, queue)
+
+	for i := range events {
+		logger.Logger.Debugw("raw data received",
+			"event_key", events[i].AlertKey,
+			"event", events[i],
+		)
+
+		if ins.GetAlerting().Disabled {
+			continue
+		}
+
+		if handleFlapping(ins, events[i]) {
+			continue
+		}
+
+		if events[i].EventStatus == types.EventStatusOk {
+			handleRecoveryEvent(ins, events[i])
+		} else {
+			if handleAlertEvent(ins, events[i]) {
+				mayTriggerDiagnose(events[i], pluginName, ins)
+			}
+		}
+	}
+}
+
+// CleanRawEvents drains queue and fills in the labels, AlertKey and event
+// time of each event, without evaluating or notifying anything. Invalid
+// events are logged and dropped.
+func CleanRawEvents(pluginName string, pluginObj plugins.Plugin, ins plugins.Instance, queue *safe.Queue[*types.Event]) []*types.Event {
 	if queue.Len() == 0 {
-		return
+		return nil
 	}
 
 	now := time.Now().Unix()
 	events := queue.PopBackAll()
 
+	ret := make([]*types.Event, 0, len(events))
 	for i := range events {
 		if events[i] == nil {
 			continue
@@ -43,24 +75,9 @@ func PushRawEvents(pluginName string, pluginObj plugins.Plugin, ins plugins.Inst
 			)
 			continue
 		}
-
-		logger.Logger.Debugw("raw data received",
-			"event_key", events[i].AlertKey,
-			"event", events[i],
-		)
-
-		if ins.GetAlerting().Disabled {
-			continue
-		}
-
-		if events[i].EventStatus == types.EventStatusOk {
-			handleRecoveryEvent(ins, events[i])
-		} else {
-			if handleAlertEvent(ins, events[i]) {
-				mayTriggerDiagnose(events[i], pluginName, ins)
-			}
-		}
+		ret = append(ret, events[i])
 	}
+	return ret
 }
 
 func mayTriggerDiagnose(event *types.Event, pluginName string, ins plugins.Instance) {
@@ -79,14 +96,22 @@ func mayTriggerDiagnose(event *types.Event, pluginName string, ins plugins.Insta
 
 // 处理恢复事件
 func handleRecoveryEvent(ins plugins.Instance, event *types.Event) {
-	diagnosedKeys.Delete(event.AlertKey)
-
 	old := Events.Get(event.AlertKey)
 	if old == nil {
 		// 之前没有产生Event，当下的情况也是正常的，这是大多数场景，忽略即可，无需做任何处理
+		diagnosedKeys.Delete(event.AlertKey)
+		return
+	}
+
+	// 配置了 recovery_for_duration 时，需要持续正常足够久才算恢复
+	hold := ins.GetAlerting().RecoveryForDuration
+	if hold > 0 && stableFor(event.AlertKey, event.EventTime) < int64(hold/config.Duration(time.Second)) {
+		Events.touch(event.AlertKey)
 		return
 	}
 
+	diagnosedKeys.Delete(event.AlertKey)
+
 	// 之前产生了告警，现在恢复了，事件就可以从缓存删除了
 	Events.Del(old.AlertKey)
 
@@ -94,6 +119,7 @@ func handleRecoveryEvent(ins plugins.Instance, event *types.Event) {
 	if !ins.GetAlerting().DisableRecoveryNotification && old.LastSent > 0 {
 		notify.Forward(event)
 	}
+	notify.Forget(old.AlertKey)
 }
 
 // 处理告警事件，返回 true 表示告警已实际发送到 notify 后端。
@@ -109,9 +135,13 @@ func handleAlertEvent(ins plugins.Instance, event *types.Event) bool {
 
 		// 要不要发？分两种情况。ForDuration 是 0 则立马发，否则等待 ForDuration 时间后再发
 		if alerting.ForDuration == 0 {
+			if isSilenced(event) || isInhibited(event) {
+				return false
+			}
 			if notify.Forward(event) {
 				event.LastSent = event.EventTime
 				event.NotifyCount++
+				Events.Set(event)
 				return true
 			}
 		}
@@ -120,6 +150,9 @@ func handleAlertEvent(ins plugins.Instance, event *types.Event) bool {
 	}
 
 	// old != nil 这已经不是第一次产生告警事件了
+	// 重启后从快照恢复的告警，此时已被采集刷新，不再视为孤儿
+	Events.touch(event.AlertKey)
+
 	// 如果 ForDuration 没有满足，则不能继续发送
 	if alerting.ForDuration > 0 && event.EventTime-old.FirstFireTime < int64(alerting.ForDuration/config.Duration(time.Second)) {
 		return false
@@ -136,6 +169,16 @@ func handleAlertEvent(ins plugins.Instance, event *types.Event) bool {
 		return false
 	}
 
+	// 维护窗口内静默，静默结束后仍在告警则按正常流程发送
+	if isSilenced(event) {
+		return false
+	}
+
+	// 被抑制的告警不通知也不诊断，抑制源恢复后按正常流程发送
+	if isInhibited(event) {
+		return false
+	}
+
 	// 最后，可以发了
 	event.FirstFireTime = old.FirstFireTime
 	event.NotifyCount = old.NotifyCount + 1
@@ -147,6 +190,18 @@ func handleAlertEvent(ins plugins.Instance, event *types.Event) bool {
 	return false
 }
 
+func isSilenced(event *types.Event) bool {
+	s := silence.IsSilenced(event.Labels)
+	if s == nil {
+		return false
+	}
+	logger.Logger.Debugw("alert silenced",
+		"event_key", event.AlertKey,
+		"silence_id", s.ID,
+	)
+	return true
+}
+
 func clean(event *types.Event, now int64, pluginName string, pluginObj plugins.Plugin, ins plugins.Instance) error {
 	if event.EventTime == 0 {
 		event.EventTime = now
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func TestCleanRawEventsLeavesCacheAlone(t *testing.T) {
+	initEngineTest(t)
+	old := config.Config
+	config.Config = &config.ConfigType{Global: config.Global{Labels: map[string]string{"env": "prod"}}}
+	t.Cleanup(func() { config.Config = old })
+
+	ins := &config.InternalConfig{Labels: map[string]string{"team": "db"}}
+	queue := safe.NewQueue[*types.Event]()
+	queue.PushFront(types.BuildEvent(map[string]string{"check": "redis::ping", "target": "a"}).
+		SetEventStatus(types.EventStatusCritical))
+	queue.PushFront(&types.Event{EventStatus: "Bogus"})
+
+	events := CleanRawEvents("redis", ins, ins, queue)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want the invalid one dropped", len(events))
+	}
+	ev := events[0]
+	if ev.AlertKey == "" || ev.EventTime == 0 {
+		t.Fatalf("alert key / event time not filled: %+v", ev)
+	}
+	for k, want := range map[string]string{"from_plugin": "redis", "team": "db", "env": "prod"} {
+		if ev.Labels[k] != want {
+			t.Fatalf("label %s = %q, want %q", k, ev.Labels[k], want)
+		}
+	}
+	if Events.Get(ev.AlertKey) != nil {
+		t.Fatal("CleanRawEvents must not touch the event cache")
+	}
+}
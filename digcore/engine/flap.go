@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const (
+	// AttrFlapping is set to "true" on the notice sent when a check starts flapping.
+	AttrFlapping = "flapping"
+
+	defaultFlapThreshold = 6
+)
+
+type flapTransition int
+
+const (
+	flapNone flapTransition = iota
+	flapStarted
+	flapOngoing
+	flapEnded
+)
+
+// alertHistory is the per-AlertKey state-transition history used for flap
+// detection and for holding back recoveries.
+type alertHistory struct {
+	status      string  // last observed status
+	since       int64   // time of the last Ok<->alert transition
+	transitions []int64 // transition times within the flap window
+	flapping    bool
+}
+
+var (
+	historyMu sync.Mutex
+	histories = map[string]*alertHistory{}
+)
+
+func historyEnabled(alerting config.Alerting) bool {
+	return alerting.FlapWindow > 0 || alerting.RecoveryForDuration > 0
+}
+
+func isProblem(status string) bool {
+	return status != types.EventStatusOk
+}
+
+// observe records event in its history and reports how flap state changed.
+func observe(alerting config.Alerting, event *types.Event) (flapTransition, int) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	now := event.EventTime
+	h := histories[event.AlertKey]
+	if h == nil {
+		// unseen keys are treated as having been Ok since now
+		h = &alertHistory{status: types.EventStatusOk, since: now}
+		histories[event.AlertKey] = h
+	}
+
+	changed := isProblem(h.status) != isProblem(event.EventStatus)
+	h.status = event.EventStatus
+	if changed {
+		h.since = now
+	}
+
+	window := int64(alerting.FlapWindow / config.Duration(time.Second))
+	if window <= 0 {
+		h.transitions, h.flapping = nil, false
+	} else {
+		if changed {
+			h.transitions = append(h.transitions, now)
+		}
+		kept := h.transitions[:0]
+		for _, t := range h.transitions {
+			if now-t < window {
+				kept = append(kept, t)
+			}
+		}
+		h.transitions = kept
+	}
+
+	count := len(h.transitions)
+	switch {
+	case h.flapping && now-h.since >= window:
+		h.flapping, h.transitions = false, nil
+		return flapEnded, count
+	case h.flapping:
+		return flapOngoing, count
+	case window > 0 && changed && count >= flapThreshold(alerting):
+		h.flapping = true
+		return flapStarted, count
+	}
+
+	if !isProblem(h.status) && len(h.transitions) == 0 && Events.Get(event.AlertKey) == nil {
+		delete(histories, event.AlertKey)
+	}
+	return flapNone, count
+}
+
+func flapThreshold(alerting config.Alerting) int {
+	if alerting.FlapThreshold > 0 {
+		return alerting.FlapThreshold
+	}
+	return defaultFlapThreshold
+}
+
+// stableFor returns how long (seconds) key has held its current Ok/alert
+// state as of now, or -1 when there is no history.
+func stableFor(key string, now int64) int64 {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	h := histories[key]
+	if h == nil {
+		return -1
+	}
+	return now - h.since
+}
+
+// handleFlapping runs flap detection for event. It returns true when the
+// event was consumed and must not go through the normal alert/recovery path.
+func handleFlapping(ins plugins.Instance, event *types.Event) bool {
+	alerting := ins.GetAlerting()
+	if !historyEnabled(alerting) {
+		return false
+	}
+
+	state, count := observe(alerting, event)
+	switch state {
+	case flapStarted:
+		sendFlapNotice(alerting, event, count)
+		return true
+	case flapOngoing:
+		Events.touch(event.AlertKey)
+		return true
+	case flapEnded:
+		logger.Logger.Infow("check stopped flapping",
+			"event_key", event.AlertKey,
+			"check", event.Labels["check"],
+			"status", event.EventStatus,
+		)
+		// 稳定在告警状态：清掉发送记录，让当前状态按正常流程立即通知
+		if old := Events.Get(event.AlertKey); old != nil && isProblem(event.EventStatus) {
+			cp := *old
+			cp.LastSent, cp.NotifyCount = 0, 0
+			Events.Set(&cp)
+		}
+	}
+	return false
+}
+
+// sendFlapNotice replaces the alert/recovery storm with a single notice
+// cached under the same AlertKey, so that the eventual recovery closes it.
+func sendFlapNotice(alerting config.Alerting, event *types.Event, count int) {
+	notice := *event
+	notice.Labels = make(map[string]string, len(event.Labels))
+	for k, v := range event.Labels {
+		notice.Labels[k] = v
+	}
+	notice.Attrs = make(map[string]string, len(event.Attrs)+1)
+	for k, v := range event.Attrs {
+		notice.Attrs[k] = v
+	}
+	notice.Attrs[AttrFlapping] = "true"
+
+	notice.EventStatus = types.EventStatusWarning
+	if alerting.FlapStatus == types.EventStatusInfo {
+		notice.EventStatus = types.EventStatusInfo
+	}
+	notice.Description = fmt.Sprintf(
+		"check is flapping: %d state changes within %s, last status %s. "+
+			"Notifications are paused until it stays stable for %s.\n\n%s",
+		count, time.Duration(alerting.FlapWindow), event.EventStatus,
+		time.Duration(alerting.FlapWindow), event.Description)
+	notice.DescriptionFormat = types.DescFormatText
+
+	notice.FirstFireTime = notice.EventTime
+	if old := Events.Get(event.AlertKey); old != nil {
+		notice.FirstFireTime = old.FirstFireTime
+		notice.NotifyCount = old.NotifyCount
+		notice.LastSent = old.LastSent
+	}
+
+	logger.Logger.Warnw("check is flapping",
+		"event_key", event.AlertKey,
+		"check", event.Labels["check"],
+		"transitions", count,
+	)
+
+	if !isSilenced(&notice) && notify.Forward(&notice) {
+		notice.LastSent = notice.EventTime
+		notice.NotifyCount++
+	}
+	Events.Set(&notice)
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// process mirrors the per-event part of PushRawEvents.
+func process(ins *config.InternalConfig, ev *types.Event) {
+	if handleFlapping(ins, ev) {
+		return
+	}
+	if ev.EventStatus == types.EventStatusOk {
+		handleRecoveryEvent(ins, ev)
+	} else {
+		handleAlertEvent(ins, ev)
+	}
+}
+
+func statusEvent(status string, at int64) *types.Event {
+	return &types.Event{
+		EventTime:   at,
+		EventStatus: status,
+		AlertKey:    "flappy",
+		Labels:      map[string]string{"check": "http::status"},
+	}
+}
+
+func resetHistories() {
+	historyMu.Lock()
+	histories = map[string]*alertHistory{}
+	historyMu.Unlock()
+}
+
+func TestFlappingSendsSingleNotice(t *testing.T) {
+	initEngineTest(t)
+	resetHistories()
+
+	ins := &config.InternalConfig{Alerting: config.Alerting{
+		FlapWindow:    config.Duration(10 * time.Minute),
+		FlapThreshold: 4,
+	}}
+	before := len(testNotifier.received())
+
+	// Critical/Ok every 30s: the 4th transition starts flapping
+	at := int64(1700000000)
+	for i := 0; i < 20; i++ {
+		status := types.EventStatusCritical
+		if i%2 == 1 {
+			status = types.EventStatusOk
+		}
+		process(ins, statusEvent(status, at))
+		at += 30
+	}
+
+	got := testNotifier.received()[before:]
+	// Critical, Ok, Critical, then the flapping notice
+	if len(got) != 4 {
+		t.Fatalf("notifications = %d, want 4", len(got))
+	}
+	notice := got[3]
+	if notice.Attrs[AttrFlapping] != "true" || notice.EventStatus != types.EventStatusWarning {
+		t.Fatalf("unexpected flapping notice: %+v", notice)
+	}
+
+	// stable Ok for a whole window ends flapping and recovers the notice
+	process(ins, statusEvent(types.EventStatusOk, at))
+	at += int64(10 * time.Minute / time.Second)
+	process(ins, statusEvent(types.EventStatusOk, at))
+
+	got = testNotifier.received()[before:]
+	if len(got) != 5 || got[4].EventStatus != types.EventStatusOk {
+		t.Fatalf("expected a final recovery, got %d notifications", len(got))
+	}
+	if Events.Get("flappy") != nil {
+		t.Fatal("alert should be cleared after recovery")
+	}
+}
+
+func TestFlappingEndsInAlertState(t *testing.T) {
+	initEngineTest(t)
+	resetHistories()
+
+	ins := &config.InternalConfig{Alerting: config.Alerting{
+		FlapWindow:     config.Duration(5 * time.Minute),
+		FlapThreshold:  3,
+		FlapStatus:     types.EventStatusInfo,
+		RepeatInterval: config.Duration(time.Hour),
+	}}
+	before := len(testNotifier.received())
+
+	at := int64(1700000000)
+	for _, s := range []string{"Critical", "Ok", "Critical"} {
+		process(ins, statusEvent(s, at))
+		at += 30
+	}
+	got := testNotifier.received()[before:]
+	if len(got) != 3 || got[2].EventStatus != types.EventStatusInfo {
+		t.Fatalf("expected Critical, Ok, Info notice; got %d notifications", len(got))
+	}
+
+	// stays Critical: after the window the real status is notified again,
+	// despite repeat_interval
+	process(ins, statusEvent(types.EventStatusCritical, at+int64(5*time.Minute/time.Second)))
+	got = testNotifier.received()[before:]
+	if len(got) != 4 || got[3].EventStatus != types.EventStatusCritical {
+		t.Fatalf("expected Critical after flapping ended; got %d notifications", len(got))
+	}
+}
+
+func TestRecoveryForDuration(t *testing.T) {
+	initEngineTest(t)
+	resetHistories()
+
+	ins := &config.InternalConfig{Alerting: config.Alerting{
+		RecoveryForDuration: config.Duration(2 * time.Minute),
+		RepeatInterval:      config.Duration(time.Hour),
+	}}
+	before := len(testNotifier.received())
+
+	base := int64(1700000000)
+	process(ins, statusEvent(types.EventStatusCritical, base))
+	process(ins, statusEvent(types.EventStatusOk, base+30))
+	process(ins, statusEvent(types.EventStatusOk, base+90))
+	if Events.Get("flappy") == nil {
+		t.Fatal("recovery should be held back")
+	}
+
+	// alert again during the hold: no new notification, hold restarts
+	process(ins, statusEvent(types.EventStatusCritical, base+120))
+	process(ins, statusEvent(types.EventStatusOk, base+150))
+	process(ins, statusEvent(types.EventStatusOk, base+240))
+	if Events.Get("flappy") == nil {
+		t.Fatal("hold should restart after the alert came back")
+	}
+
+	process(ins, statusEvent(types.EventStatusOk, base+270))
+	if Events.Get("flappy") != nil {
+		t.Fatal("alert should recover after staying Ok for 2m")
+	}
+
+	got := testNotifier.received()[before:]
+	if len(got) != 2 || got[1].EventStatus != types.EventStatusOk {
+		t.Fatalf("expected one alert and one recovery, got %d notifications", len(got))
+	}
+}
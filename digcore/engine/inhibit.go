@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/filter"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// inhibitRule is the compiled form of one [[inhibit_rules]] entry.
+type inhibitRule struct {
+	name   string
+	source map[string]filter.Filter
+	target map[string]filter.Filter
+	equal  []string
+}
+
+var (
+	inhibitMu    sync.RWMutex
+	inhibitRules []*inhibitRule
+)
+
+// SetInhibitRules compiles and installs inhibition rules.
+func SetInhibitRules(cfgs []config.InhibitRuleConfig) error {
+	compiled, err := compileInhibitRules(cfgs)
+	if err != nil {
+		return err
+	}
+
+	inhibitMu.Lock()
+	inhibitRules = compiled
+	inhibitMu.Unlock()
+	return nil
+}
+
+// ValidateInhibitRules reports the first invalid rule without installing
+// anything.
+func ValidateInhibitRules(cfgs []config.InhibitRuleConfig) error {
+	_, err := compileInhibitRules(cfgs)
+	return err
+}
+
+func compileInhibitRules(cfgs []config.InhibitRuleConfig) ([]*inhibitRule, error) {
+	compiled := make([]*inhibitRule, 0, len(cfgs))
+	for i, c := range cfgs {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		r, err := compileInhibitRule(name, c)
+		if err != nil {
+			return nil, fmt.Errorf("inhibit rule %s: %w", name, err)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+func compileInhibitRule(name string, c config.InhibitRuleConfig) (*inhibitRule, error) {
+	if len(c.SourceMatchers) == 0 {
+		return nil, fmt.Errorf("source_matchers is required")
+	}
+	if len(c.TargetMatchers) == 0 {
+		return nil, fmt.Errorf("target_matchers is required")
+	}
+	source, err := compileMatchers(c.SourceMatchers)
+	if err != nil {
+		return nil, fmt.Errorf("source_matchers.%w", err)
+	}
+	target, err := compileMatchers(c.TargetMatchers)
+	if err != nil {
+		return nil, fmt.Errorf("target_matchers.%w", err)
+	}
+	return &inhibitRule{name: name, source: source, target: target, equal: c.Equal}, nil
+}
+
+func compileMatchers(m map[string][]string) (map[string]filter.Filter, error) {
+	ret := make(map[string]filter.Filter, len(m))
+	for k, patterns := range m {
+		f, err := filter.Compile(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if f != nil {
+			ret[k] = f
+		}
+	}
+	return ret, nil
+}
+
+func matchAll(matchers map[string]filter.Filter, labels map[string]string) bool {
+	for k, f := range matchers {
+		if !f.Match(labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalLabels reports whether a and b agree on every label in names; a label
+// missing on both sides counts as equal.
+func equalLabels(names []string, a, b map[string]string) bool {
+	for _, n := range names {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// findInhibitor returns the cached firing alert that inhibits event, if any.
+// Only alerts that were actually notified can inhibit: not those still
+// waiting out for_duration or silenced so far, and not those inhibited
+// themselves. An alert never inhibits itself.
+func findInhibitor(event *types.Event) (*types.Event, string) {
+	inhibitMu.RLock()
+	rules := inhibitRules
+	inhibitMu.RUnlock()
+	if len(rules) == 0 {
+		return nil, ""
+	}
+
+	var candidates []*inhibitRule
+	for _, r := range rules {
+		if matchAll(r.target, event.Labels) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ""
+	}
+
+	Events.RLock()
+	defer Events.RUnlock()
+	for _, r := range candidates {
+		for key, src := range Events.records {
+			if key == event.AlertKey || src.LastSent == 0 || Events.inhibitedBy[key] != "" {
+				continue
+			}
+			if matchAll(r.source, src.Labels) && equalLabels(r.equal, src.Labels, event.Labels) {
+				return src, r.name
+			}
+		}
+	}
+	return nil, ""
+}
+
+// isInhibited checks inhibition rules and records the result in the cache.
+// Inhibited alerts stay cached but are neither notified nor diagnosed; once
+// the source recovers the next check of the target goes through normally.
+func isInhibited(event *types.Event) bool {
+	src, rule := findInhibitor(event)
+	if src == nil {
+		Events.setInhibitedBy(event.AlertKey, "")
+		return false
+	}
+	if Events.setInhibitedBy(event.AlertKey, src.AlertKey) {
+		logger.Logger.Infow("alert inhibited",
+			"event_key", event.AlertKey,
+			"check", event.Labels["check"],
+			"source_key", src.AlertKey,
+			"source_check", src.Labels["check"],
+			"rule", rule,
+		)
+	}
+	return true
+}
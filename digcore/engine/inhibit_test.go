@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func alertEvent(key, check, host string, at int64) *types.Event {
+	return &types.Event{
+		EventTime:   at,
+		EventStatus: types.EventStatusCritical,
+		AlertKey:    key,
+		Labels:      map[string]string{"check": check, "host": host},
+	}
+}
+
+func TestInhibitUntilSourceRecovers(t *testing.T) {
+	initEngineTest(t)
+	err := SetInhibitRules([]config.InhibitRuleConfig{{
+		Name:           "host-down",
+		SourceMatchers: map[string][]string{"check": {"ping::connectivity"}},
+		TargetMatchers: map[string][]string{"check": {"net::*", "redis::*"}},
+		Equal:          []string{"host"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetInhibitRules(nil)
+
+	ins := &config.InternalConfig{}
+	if !handleAlertEvent(ins, alertEvent("ping", "ping::connectivity", "db1", 100)) {
+		t.Fatal("source alert should be sent")
+	}
+	before := len(testNotifier.received())
+
+	if handleAlertEvent(ins, alertEvent("redis", "redis::connectivity", "db1", 110)) {
+		t.Fatal("target alert should be inhibited")
+	}
+	if got := Events.InhibitedBy("redis"); got != "ping" {
+		t.Fatalf("InhibitedBy = %q, want ping", got)
+	}
+	if Events.Get("redis") == nil {
+		t.Fatal("inhibited alert should stay cached")
+	}
+
+	// different host: not inhibited
+	if !handleAlertEvent(ins, alertEvent("redis2", "redis::connectivity", "db2", 110)) {
+		t.Fatal("alert on another host should be sent")
+	}
+
+	// later checks stay inhibited while the source is firing
+	if handleAlertEvent(ins, alertEvent("redis", "redis::connectivity", "db1", 140)) {
+		t.Fatal("target alert should still be inhibited")
+	}
+
+	recovered := alertEvent("ping", "ping::connectivity", "db1", 150)
+	recovered.EventStatus = types.EventStatusOk
+	handleRecoveryEvent(ins, recovered)
+
+	if !handleAlertEvent(ins, alertEvent("redis", "redis::connectivity", "db1", 160)) {
+		t.Fatal("target alert should be sent after source recovered")
+	}
+	if got := Events.InhibitedBy("redis"); got != "" {
+		t.Fatalf("InhibitedBy = %q after source recovered, want empty", got)
+	}
+
+	// redis2 + ping recovery + redis
+	if got := len(testNotifier.received()) - before; got != 3 {
+		t.Fatalf("notifications = %d, want 3", got)
+	}
+}
+
+func TestInhibitNotSelf(t *testing.T) {
+	initEngineTest(t)
+	err := SetInhibitRules([]config.InhibitRuleConfig{{
+		SourceMatchers: map[string][]string{"check": {"*"}},
+		TargetMatchers: map[string][]string{"check": {"*"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetInhibitRules(nil)
+
+	if !handleAlertEvent(&config.InternalConfig{}, alertEvent("a", "cpu::usage", "h", 100)) {
+		t.Fatal("an alert must not inhibit itself")
+	}
+}
+
+func TestSetInhibitRulesErrors(t *testing.T) {
+	for name, c := range map[string]config.InhibitRuleConfig{
+		"no source": {TargetMatchers: map[string][]string{"check": {"a"}}},
+		"no target": {SourceMatchers: map[string][]string{"check": {"a"}}},
+		"bad regex": {
+			SourceMatchers: map[string][]string{"check": {"/(/"}},
+			TargetMatchers: map[string][]string{"check": {"a"}},
+		},
+	} {
+		if err := SetInhibitRules([]config.InhibitRuleConfig{c}); err == nil {
+			t.Errorf("%s: SetInhibitRules should fail", name)
+		}
+	}
+}
+
+func TestInhibitOnlyBySentSources(t *testing.T) {
+	initEngineTest(t)
+	err := SetInhibitRules([]config.InhibitRuleConfig{{
+		SourceMatchers: map[string][]string{"check": {"ping::connectivity"}},
+		TargetMatchers: map[string][]string{"check": {"redis::*"}},
+		Equal:          []string{"host"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetInhibitRules(nil)
+
+	// the source is still pending for_duration, nobody was told about it
+	pending := &config.InternalConfig{Alerting: config.Alerting{ForDuration: config.Duration(time.Minute)}}
+	if handleAlertEvent(pending, alertEvent("ping", "ping::connectivity", "db1", 100)) {
+		t.Fatal("source alert should wait for for_duration")
+	}
+	ins := &config.InternalConfig{}
+	if !handleAlertEvent(ins, alertEvent("redis", "redis::connectivity", "db1", 110)) {
+		t.Fatal("a pending source must not inhibit")
+	}
+
+	// once the source fires it inhibits
+	if !handleAlertEvent(pending, alertEvent("ping", "ping::connectivity", "db1", 170)) {
+		t.Fatal("source alert should be sent after for_duration")
+	}
+	if handleAlertEvent(ins, alertEvent("redis2", "redis::connectivity", "db1", 180)) {
+		t.Fatal("a sent source should inhibit")
+	}
+}
+
+func TestInhibitNotByInhibitedSource(t *testing.T) {
+	initEngineTest(t)
+	err := SetInhibitRules([]config.InhibitRuleConfig{
+		{
+			SourceMatchers: map[string][]string{"check": {"ping::connectivity"}},
+			TargetMatchers: map[string][]string{"check": {"net::*"}},
+			Equal:          []string{"host"},
+		},
+		{
+			SourceMatchers: map[string][]string{"check": {"net::*"}},
+			TargetMatchers: map[string][]string{"check": {"redis::*"}},
+			Equal:          []string{"host"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetInhibitRules(nil)
+
+	ins := &config.InternalConfig{}
+	if !handleAlertEvent(ins, alertEvent("net", "net::response", "db1", 100)) {
+		t.Fatal("net alert should be sent")
+	}
+	if !handleAlertEvent(ins, alertEvent("ping", "ping::connectivity", "db1", 110)) {
+		t.Fatal("ping alert should be sent")
+	}
+	if handleAlertEvent(ins, alertEvent("net", "net::response", "db1", 400)) {
+		t.Fatal("net alert should now be inhibited by ping")
+	}
+	if Events.InhibitedBy("net") != "ping" {
+		t.Fatalf("net InhibitedBy = %q, want ping", Events.InhibitedBy("net"))
+	}
+
+	// net was sent before, but it is inhibited now and must not chain on
+	if !handleAlertEvent(ins, alertEvent("redis", "redis::connectivity", "db1", 410)) {
+		t.Fatal("an inhibited source must not inhibit")
+	}
+}
@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const (
+	eventsStateFile      = "alert_events.json"
+	eventsSnapshotPeriod = 10 * time.Second
+
+	// AttrOrphanedReason is set on recovery events synthesized for cached
+	// alerts whose plugin or instance disappeared across a restart.
+	AttrOrphanedReason = "orphaned_reason"
+)
+
+// cachedEvent is the on-disk form of a cached alert. types.Event hides its
+// bookkeeping fields from JSON, so they are carried explicitly here.
+type cachedEvent struct {
+	Event         *types.Event `json:"event"`
+	FirstFireTime int64        `json:"first_fire_time"`
+	NotifyCount   int64        `json:"notify_count"`
+	LastSent      int64        `json:"last_sent"`
+}
+
+type eventsSnapshot struct {
+	SavedAt int64         `json:"saved_at"`
+	Events  []cachedEvent `json:"events"`
+}
+
+var (
+	persistMu   sync.Mutex
+	persistStop chan struct{}
+	persistWg   sync.WaitGroup
+)
+
+// EventsStatePath returns state.d/alert_events.json.
+func EventsStatePath() string {
+	return filepath.Join(config.Config.StateDir, eventsStateFile)
+}
+
+// SaveEvents atomically writes the current EventCache to path.
+func (c *EventCache) SaveEvents(path string) error {
+	c.Lock()
+	snap := eventsSnapshot{
+		SavedAt: time.Now().Unix(),
+		Events:  make([]cachedEvent, 0, len(c.records)),
+	}
+	for _, e := range c.records {
+		cp := *e
+		snap.Events = append(snap.Events, cachedEvent{
+			Event:         &cp,
+			FirstFireTime: e.FirstFireTime,
+			NotifyCount:   e.NotifyCount,
+			LastSent:      e.LastSent,
+		})
+	}
+	c.dirty = false
+	c.Unlock()
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal alert events: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write alert events: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename alert events: %w", err)
+	}
+	return nil
+}
+
+// LoadEvents restores cached alerts from path and returns how many were
+// loaded. A missing file is not an error. Restored entries are marked so that
+// ReconcileRestored can detect the ones no gather ever refreshes.
+func (c *EventCache) LoadEvents(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var snap eventsSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	n := 0
+	for _, ce := range snap.Events {
+		if ce.Event == nil || ce.Event.AlertKey == "" {
+			continue
+		}
+		e := ce.Event
+		e.FirstFireTime = ce.FirstFireTime
+		e.NotifyCount = ce.NotifyCount
+		e.LastSent = ce.LastSent
+		c.records[e.AlertKey] = e
+		c.restored[e.AlertKey] = struct{}{}
+		n++
+	}
+	return n, nil
+}
+
+// RestoreEvents loads the snapshot from state.d into the global cache.
+// Restored alerts are treated as already diagnosed so a restart does not
+// re-run AI diagnosis for every alert that was firing before.
+func RestoreEvents() {
+	n, err := Events.LoadEvents(EventsStatePath())
+	if err != nil {
+		logger.Logger.Warnw("restore alert events fail", "error", err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	for _, e := range Events.List() {
+		diagnosedKeys.Store(e.AlertKey, struct{}{})
+	}
+	logger.Logger.Infow("alert events restored", "count", n)
+}
+
+// ReconcileRestored settles restored alerts once plugins are loaded.
+// graces maps each running plugin to how long to wait for its instances to
+// refresh a restored alert. Alerts from plugins not in graces are orphaned
+// immediately; the others are orphaned if still untouched after their grace.
+func ReconcileRestored(graces map[string]time.Duration) {
+	var pending []*types.Event
+	for _, e := range Events.List() {
+		if !Events.isRestored(e.AlertKey) {
+			continue
+		}
+		plugin := e.Labels["from_plugin"]
+		grace, running := graces[plugin]
+		if !running {
+			orphanEvent(e.AlertKey, fmt.Sprintf("plugin %s is no longer loaded", plugin))
+			continue
+		}
+		key := e.AlertKey
+		time.AfterFunc(grace, func() {
+			if Events.isRestored(key) {
+				orphanEvent(key, fmt.Sprintf("no instance of plugin %s reported this alert within %s after restart", plugin, grace))
+			}
+		})
+		pending = append(pending, e)
+	}
+	if len(pending) > 0 {
+		logger.Logger.Infow("restored alerts awaiting refresh", "count", len(pending))
+	}
+}
+
+// orphanEvent drops a restored alert and, if it had been notified, sends an
+// explicit recovery so downstream incidents do not stay open forever.
+func orphanEvent(key, reason string) {
+	old := Events.Get(key)
+	if old == nil {
+		return
+	}
+	Events.Del(key)
+	diagnosedKeys.Delete(key)
+	defer notify.Forget(key)
+
+	logger.Logger.Infow("orphaned alert cleared", "event_key", key, "reason", reason)
+
+	if old.LastSent == 0 {
+		return
+	}
+
+	recovery := *old
+	recovery.EventStatus = types.EventStatusOk
+	recovery.EventTime = time.Now().Unix()
+	recovery.Description = "alert orphaned after restart: " + reason
+	recovery.Attrs = make(map[string]string, len(old.Attrs)+1)
+	for k, v := range old.Attrs {
+		recovery.Attrs[k] = v
+	}
+	recovery.Attrs[AttrOrphanedReason] = reason
+	notify.Forward(&recovery)
+}
+
+// StartPersistence periodically snapshots the cache when it has changed.
+func StartPersistence() {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+	if persistStop != nil {
+		return
+	}
+	persistStop = make(chan struct{})
+	persistWg.Add(1)
+	go runPersistLoop(persistStop)
+}
+
+// StopPersistence stops the snapshot loop and writes a final snapshot.
+func StopPersistence() {
+	persistMu.Lock()
+	if persistStop != nil {
+		close(persistStop)
+		persistStop = nil
+	}
+	persistMu.Unlock()
+	persistWg.Wait()
+
+	if err := Events.SaveEvents(EventsStatePath()); err != nil {
+		logger.Logger.Warnw("save alert events fail", "error", err)
+	}
+}
+
+func runPersistLoop(stop chan struct{}) {
+	defer persistWg.Done()
+	ticker := time.NewTicker(eventsSnapshotPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			Events.RLock()
+			dirty := Events.dirty
+			Events.RUnlock()
+			if !dirty {
+				continue
+			}
+			if err := Events.SaveEvents(EventsStatePath()); err != nil {
+				logger.Logger.Warnw("save alert events fail", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/notify"
+	"github.com/cprobe/catpaw/digcore/types"
+	"go.uber.org/zap"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []*types.Event
+	delay  time.Duration
+}
+
+func (n *recordingNotifier) Name() string { return "recording" }
+
+func (n *recordingNotifier) Forward(event *types.Event) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	time.Sleep(n.delay)
+	n.events = append(n.events, event)
+	return true
+}
+
+func (n *recordingNotifier) received() []*types.Event {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*types.Event(nil), n.events...)
+}
+
+var (
+	testNotifierOnce sync.Once
+	testNotifier     = &recordingNotifier{}
+)
+
+func initEngineTest(t *testing.T) {
+	t.Helper()
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop().Sugar()
+	}
+	testNotifierOnce.Do(func() { notify.Register(testNotifier) })
+	Events = newEventCache()
+}
+
+func TestSaveLoadEventsRoundTrip(t *testing.T) {
+	initEngineTest(t)
+
+	ev := &types.Event{
+		EventTime:     200,
+		EventStatus:   types.EventStatusCritical,
+		AlertKey:      "k1",
+		Labels:        map[string]string{"from_plugin": "cpu", "check": "cpu::usage"},
+		FirstFireTime: 100,
+		NotifyCount:   3,
+		LastSent:      180,
+	}
+	Events.Set(ev)
+
+	path := filepath.Join(t.TempDir(), "alert_events.json")
+	if err := Events.SaveEvents(path); err != nil {
+		t.Fatalf("SaveEvents: %v", err)
+	}
+
+	restored := newEventCache()
+	n, err := restored.LoadEvents(path)
+	if err != nil {
+		t.Fatalf("LoadEvents: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("loaded %d events, want 1", n)
+	}
+	got := restored.Get("k1")
+	if got == nil {
+		t.Fatal("event k1 not restored")
+	}
+	if got.FirstFireTime != 100 || got.NotifyCount != 3 || got.LastSent != 180 {
+		t.Fatalf("bookkeeping lost: first=%d count=%d last=%d", got.FirstFireTime, got.NotifyCount, got.LastSent)
+	}
+	if !restored.isRestored("k1") {
+		t.Fatal("restored key should be marked as restored")
+	}
+
+	restored.touch("k1")
+	if restored.isRestored("k1") {
+		t.Fatal("touch should clear restored mark")
+	}
+}
+
+func TestLoadEventsMissingFile(t *testing.T) {
+	initEngineTest(t)
+	n, err := Events.LoadEvents(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || n != 0 {
+		t.Fatalf("LoadEvents(missing) = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestReconcileRestoredOrphansMissingPlugin(t *testing.T) {
+	initEngineTest(t)
+
+	path := filepath.Join(t.TempDir(), "alert_events.json")
+	src := newEventCache()
+	src.Set(&types.Event{
+		EventStatus: types.EventStatusCritical,
+		AlertKey:    "gone",
+		Labels:      map[string]string{"from_plugin": "removed"},
+		LastSent:    10,
+	})
+	src.Set(&types.Event{
+		EventStatus: types.EventStatusCritical,
+		AlertKey:    "kept",
+		Labels:      map[string]string{"from_plugin": "cpu"},
+		LastSent:    10,
+	})
+	if err := src.SaveEvents(path); err != nil {
+		t.Fatalf("SaveEvents: %v", err)
+	}
+	if _, err := Events.LoadEvents(path); err != nil {
+		t.Fatalf("LoadEvents: %v", err)
+	}
+
+	before := len(testNotifier.received())
+	ReconcileRestored(map[string]time.Duration{"cpu": time.Hour})
+
+	if Events.Get("gone") != nil {
+		t.Fatal("alert of unloaded plugin should be removed")
+	}
+	if Events.Get("kept") == nil {
+		t.Fatal("alert of running plugin should stay until its grace expires")
+	}
+
+	sent := testNotifier.received()[before:]
+	if len(sent) != 1 {
+		t.Fatalf("sent %d events, want 1 orphan recovery", len(sent))
+	}
+	if sent[0].EventStatus != types.EventStatusOk || sent[0].Attrs[AttrOrphanedReason] == "" {
+		t.Fatalf("unexpected orphan event: %+v", sent[0])
+	}
+}
+
+func TestSnapshotConcurrentWithAlerts(t *testing.T) {
+	initEngineTest(t)
+
+	path := filepath.Join(t.TempDir(), "alert_events.json")
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := Events.SaveEvents(path); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	// every alert is new, so it is cached before its send is recorded; a slow
+	// notifier widens that window
+	testNotifier.delay = time.Millisecond
+	defer func() { testNotifier.delay = 0 }()
+	ins := &config.InternalConfig{}
+	for i := 0; i < 50; i++ {
+		handleAlertEvent(ins, alertEvent(fmt.Sprintf("race-%d", i), "cpu::usage", "h", int64(100+i)))
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := Events.Get("race-49"); got == nil || got.NotifyCount != 1 || got.LastSent != 149 {
+		t.Fatalf("cached alert = %+v, want one notification at 149", got)
+	}
+}
@@ -1,9 +1,11 @@
 package logger
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/secret"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -37,7 +39,9 @@ func Build() func() {
 	loggerConfig.OutputPaths = []string{c.Output}
 	loggerConfig.InitialFields = c.Fields
 
-	logger, err := loggerConfig.Build()
+	logger, err := loggerConfig.Build(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return maskCore{c}
+	}))
 	if err != nil {
 		panic(err)
 	}
@@ -46,3 +50,45 @@ func Build() func() {
 
 	return func() { Logger.Sync() }
 }
+
+// maskCore redacts resolved secrets (see package secret) from messages and
+// string, error and Stringer fields before they are written.
+type maskCore struct {
+	zapcore.Core
+}
+
+func (c maskCore) With(fields []zapcore.Field) zapcore.Core {
+	return maskCore{c.Core.With(maskFields(fields))}
+}
+
+func (c maskCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c maskCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = secret.Mask(ent.Message)
+	return c.Core.Write(ent, maskFields(fields))
+}
+
+func maskFields(in []zapcore.Field) []zapcore.Field {
+	// the caller may reuse its slice
+	fields := append([]zapcore.Field(nil), in...)
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			fields[i].String = secret.Mask(f.String)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				fields[i] = zap.String(f.Key, secret.Mask(err.Error()))
+			}
+		case zapcore.StringerType:
+			if s, ok := f.Interface.(fmt.Stringer); ok && s != nil {
+				fields[i] = zap.String(f.Key, secret.Mask(s.String()))
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,411 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const (
+	// maxChatText keeps messages below Mattermost's 16383 character post limit
+	// (Slack allows more).
+	maxChatText = 15000
+
+	// maxChatThreads bounds the alertKey → message map used for threading.
+	maxChatThreads = 1000
+)
+
+var chatColors = map[string]string{
+	types.EventStatusCritical: "#d63232",
+	types.EventStatusWarning:  "#f2a900",
+	types.EventStatusInfo:     "#2f7fe0",
+	types.EventStatusOk:       "#2eb67d",
+}
+
+// ChatNotifier posts events to Slack or Mattermost, either through an
+// incoming webhook or through the chat API. In API mode recoveries, repeat
+// notifications and AI diagnosis comments are threaded under the first alert
+// message.
+type ChatNotifier struct {
+	name       string
+	mattermost bool
+	cfg        *config.ChatConfig
+	client     *http.Client
+
+	mu      sync.Mutex
+	threads map[string]*chatThread
+	order   []string
+}
+
+type chatThread struct {
+	root   string // message ts (Slack) or post id (Mattermost); empty for webhooks
+	title  string
+	closed bool // the alert recovered; the next alert starts a new thread
+}
+
+func NewSlackNotifier(cfg *config.ChatConfig) *ChatNotifier {
+	return newChatNotifier("slack", false, cfg)
+}
+
+func NewMattermostNotifier(cfg *config.ChatConfig) *ChatNotifier {
+	return newChatNotifier("mattermost", true, cfg)
+}
+
+func newChatNotifier(name string, mattermost bool, cfg *config.ChatConfig) *ChatNotifier {
+	return &ChatNotifier{
+		name:       name,
+		mattermost: mattermost,
+		cfg:        cfg,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.Timeout),
+		},
+		threads: make(map[string]*chatThread),
+	}
+}
+
+func (c *ChatNotifier) Name() string { return c.name }
+
+func (c *ChatNotifier) Forward(event *types.Event) bool {
+	title := chatTitle(event)
+	thread := c.thread(event.AlertKey)
+
+	var root string
+	if thread != nil && !thread.closed {
+		root = thread.root
+	}
+
+	text := c.renderText(event.Description, event.DescriptionFormat == types.DescFormatMarkdown)
+	att := chatAttachment{
+		Fallback: title,
+		Color:    chatColors[event.EventStatus],
+		Title:    title,
+		Text:     text,
+		Fields:   c.fields(event),
+		Footer:   "catpaw",
+		Ts:       event.EventTime,
+		MrkdwnIn: []string{"text"},
+	}
+
+	id, ok := c.send(event.AlertKey, title, []chatAttachment{att}, root,
+		event.EventStatus == types.EventStatusOk)
+	if !ok {
+		return false
+	}
+
+	c.remember(event.AlertKey, func(t *chatThread) {
+		if root == "" {
+			t.root = id
+		}
+		t.title = title
+		t.closed = event.EventStatus == types.EventStatusOk
+	})
+	return true
+}
+
+func (c *ChatNotifier) Comment(alertKey, comment string) bool {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		logger.Logger.Warnw(c.name+": empty comment skipped", "alert_key", alertKey)
+		return false
+	}
+
+	var root, title string
+	if t := c.thread(alertKey); t != nil {
+		root, title = t.root, t.title
+	}
+
+	text := c.renderText(comment, true)
+	if root == "" && title != "" {
+		// no thread to reply to: say which alert the report belongs to
+		text = c.renderText("**AI diagnosis: "+title+"**\n\n", true) + text
+	}
+
+	_, ok := c.send(alertKey, text, nil, root, false)
+	return ok
+}
+
+func (c *ChatNotifier) thread(alertKey string) *chatThread {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.threads[alertKey]; ok {
+		cp := *t
+		return &cp
+	}
+	return nil
+}
+
+func (c *ChatNotifier) remember(alertKey string, update func(*chatThread)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.threads[alertKey]
+	if !ok {
+		t = &chatThread{}
+		c.threads[alertKey] = t
+		c.order = append(c.order, alertKey)
+		if len(c.order) > maxChatThreads {
+			delete(c.threads, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	update(t)
+}
+
+func chatTitle(event *types.Event) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s %s", event.EventStatus, event.Labels["check"], event.Labels["from_hostip"])
+	if target := event.Labels["target"]; target != "" {
+		sb.WriteString(" ")
+		sb.WriteString(target)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func (c *ChatNotifier) fields(event *types.Event) []chatField {
+	fields := make([]chatField, 0, len(c.cfg.Labels)+2)
+	for _, k := range c.cfg.Labels {
+		if v := event.Labels[k]; v != "" {
+			fields = append(fields, chatField{Title: k, Value: v, Short: true})
+		}
+	}
+	if v := event.Attrs[types.AttrCurrentValue]; v != "" {
+		fields = append(fields, chatField{Title: "current value", Value: v, Short: true})
+	}
+	if v := event.Attrs[types.AttrThresholdDesc]; v != "" {
+		fields = append(fields, chatField{Title: "threshold", Value: v, Short: true})
+	}
+	return fields
+}
+
+// renderText converts markdown to the target dialect and truncates it.
+// Mattermost renders standard markdown; Slack needs mrkdwn.
+func (c *ChatNotifier) renderText(s string, markdown bool) string {
+	if markdown && !c.mattermost {
+		s = markdownToMrkdwn(s)
+	}
+	return truncateText(s, maxChatText)
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^#{1,6}\s+(.+)$`)
+	mdBold    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// markdownToMrkdwn rewrites the common markdown constructs Slack does not
+// understand: headings, **bold** and [text](url) links. Code blocks are kept.
+func markdownToMrkdwn(s string) string {
+	lines := strings.Split(s, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			line = "*" + strings.TrimSpace(m[1]) + "*"
+		}
+		line = mdBold.ReplaceAllStringFunc(line, func(b string) string {
+			return "*" + b[2:len(b)-2] + "*"
+		})
+		line = mdLink.ReplaceAllString(line, "<$2|$1>")
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n…(truncated)"
+}
+
+type chatField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type chatAttachment struct {
+	Fallback string      `json:"fallback"`
+	Color    string      `json:"color,omitempty"`
+	Title    string      `json:"title,omitempty"`
+	Text     string      `json:"text,omitempty"`
+	Fields   []chatField `json:"fields,omitempty"`
+	Footer   string      `json:"footer,omitempty"`
+	Ts       int64       `json:"ts,omitempty"`
+	MrkdwnIn []string    `json:"mrkdwn_in,omitempty"`
+}
+
+// slackMessage is accepted by Slack chat.postMessage and by Slack and
+// Mattermost incoming webhooks.
+type slackMessage struct {
+	Channel        string           `json:"channel,omitempty"`
+	Text           string           `json:"text"`
+	Username       string           `json:"username,omitempty"`
+	IconEmoji      string           `json:"icon_emoji,omitempty"`
+	IconURL        string           `json:"icon_url,omitempty"`
+	Attachments    []chatAttachment `json:"attachments,omitempty"`
+	ThreadTS       string           `json:"thread_ts,omitempty"`
+	ReplyBroadcast bool             `json:"reply_broadcast,omitempty"`
+}
+
+type mattermostPost struct {
+	ChannelID string         `json:"channel_id"`
+	Message   string         `json:"message"`
+	RootID    string         `json:"root_id,omitempty"`
+	Props     map[string]any `json:"props,omitempty"`
+}
+
+// send posts one message and returns the new message id when the API
+// reports one. broadcast asks Slack to also show a thread reply in the channel.
+func (c *ChatNotifier) send(alertKey, text string, atts []chatAttachment, root string, broadcast bool) (string, bool) {
+	requestURL := c.cfg.WebhookURL
+	var payload any
+	switch {
+	case c.cfg.UseAPI() && c.mattermost:
+		requestURL = c.cfg.APIURL + "/posts"
+		post := mattermostPost{ChannelID: c.cfg.Channel, Message: text, RootID: root}
+		if len(atts) > 0 {
+			post.Message = ""
+			post.Props = map[string]any{"attachments": atts}
+		}
+		payload = post
+	case c.cfg.UseAPI():
+		requestURL = c.cfg.APIURL + "/chat.postMessage"
+		payload = slackMessage{
+			Channel:        c.cfg.Channel,
+			Text:           text,
+			Username:       c.cfg.Username,
+			IconEmoji:      c.cfg.IconEmoji,
+			IconURL:        c.cfg.IconURL,
+			Attachments:    atts,
+			ThreadTS:       root,
+			ReplyBroadcast: broadcast && root != "",
+		}
+	default:
+		payload = slackMessage{
+			Channel:     c.cfg.Channel,
+			Text:        text,
+			Username:    c.cfg.Username,
+			IconEmoji:   c.cfg.IconEmoji,
+			IconURL:     c.cfg.IconURL,
+			Attachments: atts,
+		}
+	}
+
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		logger.Logger.Errorw(c.name+": marshal fail",
+			"event_key", alertKey, "error", err.Error())
+		return "", false
+	}
+
+	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+			logger.Logger.Infow(c.name+": retrying",
+				"event_key", alertKey, "attempt", attempt+1)
+		}
+
+		id, ok, retryable := c.doPost(alertKey, requestURL, bs)
+		if ok {
+			return id, true
+		}
+		if !retryable {
+			return "", false
+		}
+	}
+
+	logger.Logger.Errorw(c.name+": all retries exhausted",
+		"event_key", alertKey, "max_retries", c.cfg.MaxRetries)
+	return "", false
+}
+
+func (c *ChatNotifier) doPost(alertKey, requestURL string, payload []byte) (id string, ok bool, retryable bool) {
+	req, err := http.NewRequest("POST", requestURL, bytes.NewReader(payload))
+	if err != nil {
+		logger.Logger.Errorw(c.name+": new request fail",
+			"event_key", alertKey, "error", err.Error())
+		return "", false, false
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if c.cfg.UseAPI() {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		logger.Logger.Errorw(c.name+": do request fail",
+			"event_key", alertKey, "error", err.Error())
+		return "", false, true
+	}
+
+	var body []byte
+	if res.Body != nil {
+		defer res.Body.Close()
+		body, _ = io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	}
+
+	if res.StatusCode == 429 || res.StatusCode >= 500 {
+		logger.Logger.Errorw(c.name+": retryable error",
+			"event_key", alertKey,
+			"response_status", res.StatusCode,
+			"response_body", string(body))
+		return "", false, true
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		logger.Logger.Errorw(c.name+": non-retryable error",
+			"event_key", alertKey,
+			"response_status", res.StatusCode,
+			"response_body", string(body))
+		return "", false, false
+	}
+
+	if c.cfg.UseAPI() {
+		var resp struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+			TS    string `json:"ts"`
+			ID    string `json:"id"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			logger.Logger.Errorw(c.name+": decode response fail",
+				"event_key", alertKey, "error", err.Error())
+			return "", false, false
+		}
+		if c.mattermost {
+			id = resp.ID
+		} else {
+			// Slack reports API errors with HTTP 200 and ok=false
+			if !resp.OK {
+				logger.Logger.Errorw(c.name+": api error",
+					"event_key", alertKey, "error", resp.Error)
+				return "", false, resp.Error == "ratelimited"
+			}
+			id = resp.TS
+		}
+	}
+
+	logger.Logger.Infow(c.name+": forward completed",
+		"event_key", alertKey, "response_status", res.StatusCode)
+	return id, true, false
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func TestMarkdownToMrkdwn(t *testing.T) {
+	in := "## Root cause\n**disk full** on /var, see [runbook](https://wiki/x)\n```\n**kept**\n```"
+	want := "*Root cause*\n*disk full* on /var, see <https://wiki/x|runbook>\n```\n**kept**\n```"
+	if got := markdownToMrkdwn(in); got != want {
+		t.Fatalf("markdownToMrkdwn() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	s := strings.Repeat("磁盘", 10)
+	got := truncateText(s, 7)
+	if !strings.HasPrefix(got, "磁盘") || !strings.HasSuffix(got, "(truncated)") {
+		t.Fatalf("truncateText() = %q", got)
+	}
+}
+
+func TestSlackAPIThreadsCommentsAndRecovery(t *testing.T) {
+	initNotifyTestLogger()
+
+	var mu sync.Mutex
+	var msgs []slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("unexpected request %s auth=%q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var m slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		msgs = append(msgs, m)
+		n := len(msgs)
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true,"ts":"1700000000.00000` + string(rune('0'+n)) + `"}`))
+	}))
+	defer srv.Close()
+
+	n := NewSlackNotifier(&config.ChatConfig{
+		Token:   "xoxb-test",
+		Channel: "C123",
+		APIURL:  srv.URL,
+		Labels:  []string{"check", "target"},
+		Timeout: config.Duration(2 * time.Second),
+	})
+
+	ev := &types.Event{
+		EventTime:         1700000000,
+		EventStatus:       types.EventStatusCritical,
+		AlertKey:          "k1",
+		Labels:            map[string]string{"check": "disk::space", "target": "/var", "from_hostip": "10.0.0.1"},
+		Description:       "**usage** 97%",
+		DescriptionFormat: types.DescFormatMarkdown,
+	}
+	if !n.Forward(ev) {
+		t.Fatal("Forward failed")
+	}
+	if !n.Comment("k1", "## Diagnosis\nclean /var/log") {
+		t.Fatal("Comment failed")
+	}
+	ok := *ev
+	ok.EventStatus = types.EventStatusOk
+	if !n.Forward(&ok) {
+		t.Fatal("Forward recovery failed")
+	}
+	// a new alert after recovery starts a new thread
+	if !n.Forward(ev) {
+		t.Fatal("Forward failed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4", len(msgs))
+	}
+	first := msgs[0]
+	if first.ThreadTS != "" || first.Channel != "C123" {
+		t.Fatalf("first message should be top-level in C123: %+v", first)
+	}
+	att := first.Attachments[0]
+	if att.Color != chatColors[types.EventStatusCritical] || att.Text != "*usage* 97%" {
+		t.Fatalf("unexpected attachment: %+v", att)
+	}
+	if len(att.Fields) != 2 || att.Fields[0].Value != "disk::space" {
+		t.Fatalf("label whitelist not applied: %+v", att.Fields)
+	}
+	if msgs[1].ThreadTS != "1700000000.000001" || !strings.HasPrefix(msgs[1].Text, "*Diagnosis*") {
+		t.Fatalf("comment should be threaded: %+v", msgs[1])
+	}
+	if msgs[2].ThreadTS != "1700000000.000001" || !msgs[2].ReplyBroadcast {
+		t.Fatalf("recovery should be a broadcast thread reply: %+v", msgs[2])
+	}
+	if msgs[3].ThreadTS != "" {
+		t.Fatalf("new alert should start a new thread: %+v", msgs[3])
+	}
+}
+
+func TestMattermostWebhook(t *testing.T) {
+	initNotifyTestLogger()
+
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	n := NewMattermostNotifier(&config.ChatConfig{
+		WebhookURL: srv.URL,
+		Username:   "catpaw",
+		Timeout:    config.Duration(2 * time.Second),
+	})
+	ev := &types.Event{
+		EventStatus:       types.EventStatusWarning,
+		AlertKey:          "k2",
+		Labels:            map[string]string{"check": "cpu::usage"},
+		Description:       "**high** load",
+		DescriptionFormat: types.DescFormatMarkdown,
+	}
+	if !n.Forward(ev) {
+		t.Fatal("Forward failed")
+	}
+	if got.Username != "catpaw" || got.Attachments[0].Text != "**high** load" {
+		t.Fatalf("mattermost should keep markdown: %+v", got)
+	}
+	if got.Attachments[0].Color != chatColors[types.EventStatusWarning] {
+		t.Fatalf("unexpected color %q", got.Attachments[0].Color)
+	}
+}
@@ -0,0 +1,484 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// maxEmailThreads bounds the alertKey → Message-ID map used for threading.
+const maxEmailThreads = 1000
+
+// EmailNotifier sends events as multipart (plain text + HTML) mails over
+// SMTP. In digest mode events are buffered and sent as one mail per
+// digest_interval; AI diagnosis comments are always sent right away, as a
+// reply to the alert mail when it is known.
+type EmailNotifier struct {
+	cfg       *config.EmailConfig
+	tlsConfig *tls.Config
+	from      string
+	to        []string
+
+	mu      sync.Mutex
+	threads map[string]emailThread
+	order   []string
+	digest  []*types.Event
+	timer   *time.Timer
+	wg      sync.WaitGroup
+}
+
+type emailThread struct {
+	messageID string // of the first alert mail
+	title     string
+	closed    bool // the alert recovered; the next alert starts a new thread
+}
+
+type emailMessage struct {
+	subject   string
+	text      string
+	html      string
+	messageID string
+	inReplyTo string
+}
+
+// NewEmailNotifier fails when the TLS settings or the from / to addresses
+// are invalid.
+func NewEmailNotifier(cfg *config.EmailConfig) (*EmailNotifier, error) {
+	switch cfg.Security {
+	case "auto", "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("email: unknown security %q, want auto, starttls, tls or none", cfg.Security)
+	}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("email: %w", err)
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("email: invalid from %q: %w", cfg.From, err)
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("email: to is empty")
+	}
+	to := make([]string, 0, len(cfg.To))
+	for _, s := range cfg.To {
+		addr, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("email: invalid to %q: %w", s, err)
+		}
+		to = append(to, addr.Address)
+	}
+
+	return &EmailNotifier{
+		cfg:       cfg,
+		tlsConfig: tlsConfig,
+		from:      from.Address,
+		to:        to,
+		threads:   make(map[string]emailThread),
+	}, nil
+}
+
+func (e *EmailNotifier) Name() string { return "email" }
+
+// Digest reports whether events are batched. Digest mode acknowledges events
+// before they are mailed, so a persistent outbox in front adds nothing.
+func (e *EmailNotifier) Digest() bool { return e.cfg.DigestInterval > 0 }
+
+func (e *EmailNotifier) Forward(event *types.Event) bool {
+	if e.Digest() {
+		e.addToDigest(event)
+		return true
+	}
+
+	title := chatTitle(event)
+	msg := &emailMessage{
+		subject:   e.cfg.SubjectPrefix + " " + title,
+		text:      emailEventText(event),
+		html:      renderEmailHTML(title, []*types.Event{event}),
+		messageID: e.newMessageID(),
+	}
+	if t, ok := e.thread(event.AlertKey); ok && !t.closed {
+		msg.inReplyTo = t.messageID
+	}
+	if !e.send(event.AlertKey, msg) {
+		return false
+	}
+
+	e.mu.Lock()
+	t, ok := e.threads[event.AlertKey]
+	if !ok {
+		e.order = append(e.order, event.AlertKey)
+		if len(e.order) > maxEmailThreads {
+			delete(e.threads, e.order[0])
+			e.order = e.order[1:]
+		}
+	}
+	if msg.inReplyTo == "" {
+		t.messageID = msg.messageID
+	}
+	t.title = title
+	t.closed = event.EventStatus == types.EventStatusOk
+	e.threads[event.AlertKey] = t
+	e.mu.Unlock()
+	return true
+}
+
+func (e *EmailNotifier) Comment(alertKey, comment string) bool {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		logger.Logger.Warnw("email: empty comment skipped", "alert_key", alertKey)
+		return false
+	}
+
+	subject := "AI diagnosis: " + alertKey
+	msg := &emailMessage{
+		text:      comment + "\n",
+		html:      `<pre style="white-space:pre-wrap;font-family:monospace">` + htmltemplate.HTMLEscapeString(comment) + "</pre>",
+		messageID: e.newMessageID(),
+	}
+	if t, ok := e.thread(alertKey); ok {
+		subject = "Re: " + e.cfg.SubjectPrefix + " " + t.title
+		msg.inReplyTo = t.messageID
+	} else {
+		subject = e.cfg.SubjectPrefix + " " + subject
+	}
+	msg.subject = subject
+	return e.send(alertKey, msg)
+}
+
+// Close sends the pending digest, if any.
+func (e *EmailNotifier) Close() {
+	e.flushDigest()
+	e.wg.Wait()
+}
+
+func (e *EmailNotifier) thread(alertKey string) (emailThread, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.threads[alertKey]
+	return t, ok
+}
+
+func (e *EmailNotifier) addToDigest(event *types.Event) {
+	cp := *event
+
+	e.mu.Lock()
+	e.digest = append(e.digest, &cp)
+	if len(e.digest) < e.cfg.DigestMaxEvents {
+		if e.timer == nil {
+			e.timer = time.AfterFunc(time.Duration(e.cfg.DigestInterval), e.flushDigest)
+		}
+		e.mu.Unlock()
+		return
+	}
+	events := e.takeDigestLocked()
+	e.wg.Add(1)
+	e.mu.Unlock()
+
+	go func() {
+		defer e.wg.Done()
+		e.sendDigest(events)
+	}()
+}
+
+func (e *EmailNotifier) flushDigest() {
+	e.mu.Lock()
+	events := e.takeDigestLocked()
+	e.mu.Unlock()
+	e.sendDigest(events)
+}
+
+func (e *EmailNotifier) takeDigestLocked() []*types.Event {
+	events := e.digest
+	e.digest = nil
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	return events
+}
+
+func (e *EmailNotifier) sendDigest(events []*types.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	title := digestTitle(events)
+	var text strings.Builder
+	for i, event := range events {
+		if i > 0 {
+			text.WriteString("\n----------------------------------------\n\n")
+		}
+		text.WriteString(emailEventText(event))
+	}
+	msg := &emailMessage{
+		subject:   e.cfg.SubjectPrefix + " " + title,
+		text:      text.String(),
+		html:      renderEmailHTML(title, events),
+		messageID: e.newMessageID(),
+	}
+	if !e.send("digest", msg) {
+		logger.Logger.Errorw("email: digest dropped", "events", len(events))
+	}
+}
+
+// digestTitle summarizes a batch, e.g. "5 events: 2 Critical, 1 Warning, 2 Ok".
+func digestTitle(events []*types.Event) string {
+	counts := map[string]int{}
+	for _, event := range events {
+		counts[event.EventStatus]++
+	}
+	parts := make([]string, 0, len(counts))
+	for _, status := range []string{types.EventStatusCritical, types.EventStatusWarning, types.EventStatusInfo, types.EventStatusOk} {
+		if n := counts[status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	return fmt.Sprintf("%d events: %s", len(events), strings.Join(parts, ", "))
+}
+
+func emailEventText(event *types.Event) string {
+	var sb strings.Builder
+	sb.WriteString(chatTitle(event))
+	sb.WriteString("\n")
+	sb.WriteString(time.Unix(event.EventTime, 0).Format("2006-01-02 15:04:05"))
+	sb.WriteString("\n\n")
+	for _, k := range sortedKeys(event.Labels) {
+		fmt.Fprintf(&sb, "%s: %s\n", k, event.Labels[k])
+	}
+	for _, k := range sortedKeys(event.Attrs) {
+		fmt.Fprintf(&sb, "%s: %s\n", k, event.Attrs[k])
+	}
+	if desc := strings.TrimSpace(event.Description); desc != "" {
+		sb.WriteString("\n")
+		sb.WriteString(desc)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+type emailHTMLEvent struct {
+	Title       string
+	Color       string
+	Time        string
+	Fields      [][2]string
+	Description string
+}
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family:Helvetica,Arial,sans-serif;font-size:14px;color:#1d1c1d">
+<h2 style="font-size:18px">{{ .Title }}</h2>
+{{- range .Events }}
+<div style="border-left:4px solid {{ .Color }};padding:4px 12px;margin:12px 0">
+<div style="font-weight:bold;color:{{ .Color }}">{{ .Title }}</div>
+<div style="color:#616061;font-size:12px">{{ .Time }}</div>
+<table style="border-collapse:collapse;margin:8px 0;font-size:13px">
+{{- range .Fields }}
+<tr><td style="padding:2px 12px 2px 0;color:#616061">{{ index . 0 }}</td><td style="padding:2px 0">{{ index . 1 }}</td></tr>
+{{- end }}
+</table>
+{{- if .Description }}
+<pre style="white-space:pre-wrap;font-family:monospace;font-size:12px;background:#f8f8f8;padding:8px">{{ .Description }}</pre>
+{{- end }}
+</div>
+{{- end }}
+<div style="color:#616061;font-size:12px">catpaw</div>
+</body></html>
+`))
+
+func renderEmailHTML(title string, events []*types.Event) string {
+	data := struct {
+		Title  string
+		Events []emailHTMLEvent
+	}{Title: title}
+	for _, event := range events {
+		ev := emailHTMLEvent{
+			Title:       chatTitle(event),
+			Color:       chatColors[event.EventStatus],
+			Time:        time.Unix(event.EventTime, 0).Format("2006-01-02 15:04:05"),
+			Description: strings.TrimSpace(event.Description),
+		}
+		for _, k := range sortedKeys(event.Labels) {
+			ev.Fields = append(ev.Fields, [2]string{k, event.Labels[k]})
+		}
+		for _, k := range sortedKeys(event.Attrs) {
+			ev.Fields = append(ev.Fields, [2]string{k, event.Attrs[k]})
+		}
+		data.Events = append(data.Events, ev)
+	}
+
+	var buf bytes.Buffer
+	if err := emailHTMLTemplate.Execute(&buf, data); err != nil {
+		return "<pre>" + htmltemplate.HTMLEscapeString(err.Error()) + "</pre>"
+	}
+	return buf.String()
+}
+
+func (e *EmailNotifier) newMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	domain := "catpaw"
+	if i := strings.LastIndexByte(e.from, '@'); i >= 0 && i < len(e.from)-1 {
+		domain = e.from[i+1:]
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// compose builds a multipart/alternative RFC 5322 message.
+func (e *EmailNotifier) compose(m *emailMessage) []byte {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.text},
+		{"text/html; charset=utf-8", m.html},
+	} {
+		pw, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		qw := quotedprintable.NewWriter(pw)
+		qw.Write([]byte(part.content))
+		qw.Close()
+	}
+	mw.Close()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&sb, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&sb, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.subject))
+	fmt.Fprintf(&sb, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&sb, "Message-ID: %s\r\n", m.messageID)
+	if m.inReplyTo != "" {
+		fmt.Fprintf(&sb, "In-Reply-To: %s\r\n", m.inReplyTo)
+		fmt.Fprintf(&sb, "References: %s\r\n", m.inReplyTo)
+	}
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&sb, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	sb.WriteString("X-Mailer: catpaw\r\n\r\n")
+	sb.Write(body.Bytes())
+	return []byte(sb.String())
+}
+
+func (e *EmailNotifier) send(key string, m *emailMessage) bool {
+	msg := e.compose(m)
+
+	for attempt := 0; attempt <= e.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+			logger.Logger.Infow("email: retrying",
+				"event_key", key, "attempt", attempt+1)
+		}
+
+		err := e.deliver(msg)
+		if err == nil {
+			logger.Logger.Infow("email: forward completed",
+				"event_key", key, "recipients", len(e.to))
+			return true
+		}
+
+		// 5xx replies are permanent failures
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+			logger.Logger.Errorw("email: non-retryable error",
+				"event_key", key, "error", err.Error())
+			return false
+		}
+		logger.Logger.Errorw("email: retryable error",
+			"event_key", key, "error", err.Error())
+	}
+
+	logger.Logger.Errorw("email: all retries exhausted",
+		"event_key", key, "max_retries", e.cfg.MaxRetries)
+	return false
+}
+
+func (e *EmailNotifier) deliver(msg []byte) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	timeout := time.Duration(e.cfg.Timeout)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	if e.cfg.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, e.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if e.cfg.Security == "auto" || e.cfg.Security == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(e.tlsConfig); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		} else if e.cfg.Security == "starttls" {
+			return errors.New("server does not support STARTTLS")
+		}
+	}
+
+	if e.cfg.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("server does not support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	for _, rcpt := range e.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,284 @@
+package notify
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+type fakeSMTPMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer is a minimal plaintext SMTP stand-in that records mails.
+type fakeSMTPServer struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	mails []fakeSMTPMail
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 fake ESMTP")
+	var cur fakeSMTPMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			cur = fakeSMTPMail{from: strings.Trim(cmd[10:], "<>")}
+			reply("250 ok")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			rcpt := strings.Trim(cmd[8:], "<>")
+			if strings.HasPrefix(rcpt, "reject") {
+				reply("550 no such user")
+				continue
+			}
+			cur.to = append(cur.to, rcpt)
+			reply("250 ok")
+		case upper == "DATA":
+			reply("354 go ahead")
+			var sb strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				sb.WriteString(strings.TrimPrefix(l, "."))
+			}
+			cur.data = sb.String()
+			s.mu.Lock()
+			s.mails = append(s.mails, cur)
+			s.mu.Unlock()
+			reply("250 queued")
+		case upper == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() []fakeSMTPMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSMTPMail(nil), s.mails...)
+}
+
+func (s *fakeSMTPServer) config() *config.EmailConfig {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return &config.EmailConfig{
+		Host:            "127.0.0.1",
+		Port:            addr.Port,
+		From:            "catpaw <catpaw@example.com>",
+		To:              []string{"ops@example.com"},
+		SubjectPrefix:   "[catpaw]",
+		Security:        "auto",
+		DigestMaxEvents: 100,
+		Timeout:         config.Duration(2 * time.Second),
+	}
+}
+
+// parseMail returns the decoded subject, headers and text/html parts.
+func parseMail(t *testing.T, data string) (*mail.Message, string, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		bs, _ := io.ReadAll(p) // quoted-printable is decoded by NextPart
+		parts[mediaType] = string(bs)
+	}
+	return msg, subject, parts
+}
+
+func emailTestEvent(status string) *types.Event {
+	return &types.Event{
+		EventTime:   1700000000,
+		EventStatus: status,
+		AlertKey:    "k1",
+		Labels: map[string]string{
+			"check":       "disk::space_usage",
+			"from_hostip": "10.0.0.1",
+			"target":      "/var",
+		},
+		Attrs:       map[string]string{"current_value": "95%"},
+		Description: "磁盘使用率 95% <above> threshold",
+	}
+}
+
+func TestEmailForwardAndThreadedComment(t *testing.T) {
+	initNotifyTestLogger()
+	srv := newFakeSMTPServer(t)
+
+	n, err := NewEmailNotifier(srv.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Forward(emailTestEvent(types.EventStatusCritical)) {
+		t.Fatal("Forward failed")
+	}
+	if !n.Comment("k1", "root cause: **logs** filled /var") {
+		t.Fatal("Comment failed")
+	}
+
+	mails := srv.received()
+	if len(mails) != 2 {
+		t.Fatalf("got %d mails, want 2", len(mails))
+	}
+	if mails[0].from != "catpaw@example.com" || len(mails[0].to) != 1 || mails[0].to[0] != "ops@example.com" {
+		t.Fatalf("unexpected envelope: %+v", mails[0])
+	}
+
+	alert, subject, parts := parseMail(t, mails[0].data)
+	if subject != "[catpaw] [Critical] disk::space_usage 10.0.0.1 /var" {
+		t.Fatalf("subject = %q", subject)
+	}
+	if !strings.Contains(parts["text/plain"], "磁盘使用率 95% <above> threshold") ||
+		!strings.Contains(parts["text/plain"], "current_value: 95%") {
+		t.Fatalf("text part = %q", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], "磁盘使用率 95% &lt;above&gt; threshold") {
+		t.Fatalf("html part not escaped: %q", parts["text/html"])
+	}
+
+	reply, subject, _ := parseMail(t, mails[1].data)
+	if !strings.HasPrefix(subject, "Re: [catpaw] [Critical]") {
+		t.Fatalf("comment subject = %q", subject)
+	}
+	if reply.Header.Get("In-Reply-To") != alert.Header.Get("Message-ID") {
+		t.Fatalf("comment not threaded: In-Reply-To=%q Message-ID=%q",
+			reply.Header.Get("In-Reply-To"), alert.Header.Get("Message-ID"))
+	}
+}
+
+func TestEmailRejectedRecipientIsPermanent(t *testing.T) {
+	initNotifyTestLogger()
+	srv := newFakeSMTPServer(t)
+
+	cfg := srv.config()
+	cfg.To = []string{"reject@example.com"}
+	cfg.MaxRetries = 3
+	n, err := NewEmailNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if n.Forward(emailTestEvent(types.EventStatusCritical)) {
+		t.Fatal("Forward should fail for a rejected recipient")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("5xx reply should not be retried")
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	initNotifyTestLogger()
+	srv := newFakeSMTPServer(t)
+
+	cfg := srv.config()
+	cfg.DigestInterval = config.Duration(time.Hour)
+	cfg.DigestMaxEvents = 3
+	n, err := NewEmailNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Digest() {
+		t.Fatal("Digest() = false")
+	}
+
+	for _, status := range []string{types.EventStatusCritical, types.EventStatusWarning, types.EventStatusOk, types.EventStatusCritical} {
+		if !n.Forward(emailTestEvent(status)) {
+			t.Fatal("Forward failed")
+		}
+	}
+	n.Close()
+
+	mails := srv.received()
+	if len(mails) != 2 {
+		t.Fatalf("got %d mails, want 2 (one full batch, one flushed on Close)", len(mails))
+	}
+	subjects := map[string]bool{}
+	for _, m := range mails {
+		_, subject, _ := parseMail(t, m.data)
+		subjects[subject] = true
+	}
+	if !subjects["[catpaw] 3 events: 1 Critical, 1 Warning, 1 Ok"] || !subjects["[catpaw] 1 events: 1 Critical"] {
+		t.Fatalf("unexpected digest subjects: %v", subjects)
+	}
+}
+
+func TestNewEmailNotifierValidation(t *testing.T) {
+	for name, cfg := range map[string]*config.EmailConfig{
+		"bad security": {Host: "h", Security: "ssl", From: "a@b", To: []string{"c@d"}},
+		"bad from":     {Host: "h", Security: "auto", From: "not an address", To: []string{"c@d"}},
+		"no to":        {Host: "h", Security: "auto", From: "a@b"},
+	} {
+		if _, err := NewEmailNotifier(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// groupNotifier sits in front of a notifier that accepts batches. Events are
+// buffered per group (distinct values of the group_by labels): a new group is
+// sent after group_wait, events arriving later are sent at most once per
+// group_interval, and a group that stays quiet for a whole group_interval is
+// dropped so the next event starts a fresh group_wait.
+type groupNotifier struct {
+	inner Notifier
+	batch BatchNotifier
+	cfg   config.GroupConfig
+
+	mu     sync.Mutex
+	groups map[string]*eventGroup
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type eventGroup struct {
+	events []*types.Event
+	timer  *time.Timer
+}
+
+// commentGroupNotifier keeps CommentNotifier working for grouped notifiers;
+// comments are never delayed.
+type commentGroupNotifier struct {
+	*groupNotifier
+}
+
+func (g *commentGroupNotifier) Comment(alertKey, comment string) bool {
+	return g.inner.(CommentNotifier).Comment(alertKey, comment)
+}
+
+// SetGrouping puts a grouping layer in front of the registered notifiers that
+// accept batches ([notify.group]). Calling it again replaces the previous
+// layer after flushing its pending groups; an empty group_by disables
+// grouping.
+func SetGrouping(cfg config.GroupConfig) {
+	only := make(map[string]struct{}, len(cfg.Notifiers))
+	for _, name := range cfg.Notifiers {
+		only[name] = struct{}{}
+	}
+
+	for i, n := range notifiers {
+		if g := asGroupNotifier(n); g != nil {
+			g.flushAll()
+			n = g.inner
+			notifiers[i] = n
+		}
+		if len(cfg.GroupBy) == 0 {
+			continue
+		}
+		if _, ok := only[n.Name()]; len(only) > 0 && !ok {
+			continue
+		}
+
+		bn, ok := batchTarget(n)
+		if !ok {
+			if len(only) > 0 {
+				logger.Logger.Warnw("notify group: notifier does not accept batches, not grouped",
+					"notifier", n.Name())
+			}
+			continue
+		}
+
+		g := &groupNotifier{
+			inner:  n,
+			batch:  bn,
+			cfg:    cfg,
+			groups: make(map[string]*eventGroup),
+		}
+		if _, ok := n.(CommentNotifier); ok {
+			notifiers[i] = &commentGroupNotifier{groupNotifier: g}
+		} else {
+			notifiers[i] = g
+		}
+		logger.Logger.Infow("notify group enabled",
+			"notifier", n.Name(), "group_by", cfg.GroupBy,
+			"group_wait", time.Duration(cfg.GroupWait), "group_interval", time.Duration(cfg.GroupInterval))
+	}
+}
+
+func asGroupNotifier(n Notifier) *groupNotifier {
+	switch g := n.(type) {
+	case *groupNotifier:
+		return g
+	case *commentGroupNotifier:
+		return g.groupNotifier
+	}
+	return nil
+}
+
+// batchTarget returns what delivers groups for n: n itself, or its outbox
+// when the notifier behind the outbox accepts batches.
+func batchTarget(n Notifier) (BatchNotifier, bool) {
+	switch o := n.(type) {
+	case *Outbox:
+		_, ok := o.inner.(BatchNotifier)
+		return o, ok
+	case *commentOutbox:
+		_, ok := o.inner.(BatchNotifier)
+		return o.Outbox, ok
+	}
+	bn, ok := n.(BatchNotifier)
+	return bn, ok
+}
+
+func (g *groupNotifier) Name() string { return g.inner.Name() }
+
+func (g *groupNotifier) Forward(event *types.Event) bool {
+	cp := *event
+	key := g.groupKey(&cp)
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return g.batch.ForwardBatch([]*types.Event{&cp})
+	}
+	grp, ok := g.groups[key]
+	if !ok {
+		grp = &eventGroup{}
+		g.groups[key] = grp
+		grp.timer = time.AfterFunc(time.Duration(g.cfg.GroupWait), func() { g.flush(key) })
+	}
+	grp.events = append(grp.events, &cp)
+	var full []*types.Event
+	if len(grp.events) >= g.cfg.MaxSize {
+		full = grp.events
+		grp.events = nil
+	}
+	g.mu.Unlock()
+
+	if full != nil {
+		return g.batch.ForwardBatch(full)
+	}
+	return true
+}
+
+// Close sends all pending groups, then closes the wrapped notifier.
+func (g *groupNotifier) Close() {
+	g.flushAll()
+	if c, ok := g.inner.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+func (g *groupNotifier) groupKey(event *types.Event) string {
+	var sb strings.Builder
+	for _, k := range g.cfg.GroupBy {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(event.Labels[k])
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+func (g *groupNotifier) flush(key string) {
+	g.mu.Lock()
+	grp, ok := g.groups[key]
+	if !ok {
+		g.mu.Unlock()
+		return
+	}
+	events := grp.events
+	grp.events = nil
+	if len(events) == 0 {
+		// quiet for a whole group_interval: the group is done
+		delete(g.groups, key)
+		g.mu.Unlock()
+		return
+	}
+	grp.timer = time.AfterFunc(time.Duration(g.cfg.GroupInterval), func() { g.flush(key) })
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	defer g.wg.Done()
+	g.send(events)
+}
+
+// flushAll sends every pending group now; later events bypass grouping.
+func (g *groupNotifier) flushAll() {
+	g.mu.Lock()
+	g.closed = true
+	pending := make([][]*types.Event, 0, len(g.groups))
+	for key, grp := range g.groups {
+		grp.timer.Stop()
+		if len(grp.events) > 0 {
+			pending = append(pending, grp.events)
+		}
+		delete(g.groups, key)
+	}
+	g.mu.Unlock()
+
+	g.wg.Wait()
+	for _, events := range pending {
+		g.send(events)
+	}
+}
+
+func (g *groupNotifier) send(events []*types.Event) {
+	ok := g.batch.ForwardBatch(events)
+	if _, viaOutbox := g.batch.(*Outbox); !viaOutbox {
+		recordDelivery(g.Name(), ok)
+	}
+	if !ok {
+		logger.Logger.Warnw("notify group: batch delivery failed",
+			"notifier", g.Name(), "events", len(events), "event_key", events[0].AlertKey)
+	}
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (b *batchRecorder) Name() string { return "batch" }
+
+func (b *batchRecorder) Forward(event *types.Event) bool {
+	return b.ForwardBatch([]*types.Event{event})
+}
+
+func (b *batchRecorder) ForwardBatch(events []*types.Event) bool {
+	keys := make([]string, len(events))
+	for i, event := range events {
+		keys[i] = event.AlertKey
+	}
+	b.mu.Lock()
+	b.batches = append(b.batches, keys)
+	b.mu.Unlock()
+	return true
+}
+
+func (b *batchRecorder) snapshot() [][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([][]string(nil), b.batches...)
+}
+
+func hostEvent(key, host string) *types.Event {
+	return &types.Event{
+		AlertKey:    key,
+		EventStatus: types.EventStatusCritical,
+		Labels:      map[string]string{"from_hostip": host},
+	}
+}
+
+func setupGrouping(t *testing.T, cfg config.GroupConfig, ns ...Notifier) {
+	t.Helper()
+	initNotifyTestLogger()
+	oldNotifiers := notifiers
+	notifiers = ns
+	SetGrouping(cfg)
+	t.Cleanup(func() {
+		SetGrouping(config.GroupConfig{})
+		notifiers = oldNotifiers
+	})
+}
+
+func TestGroupingBatchesPerGroup(t *testing.T) {
+	rec := &batchRecorder{}
+	plain := &namedNotifier{name: "console"}
+	setupGrouping(t, config.GroupConfig{
+		GroupBy:       []string{"from_hostip"},
+		GroupWait:     config.Duration(50 * time.Millisecond),
+		GroupInterval: config.Duration(100 * time.Millisecond),
+		MaxSize:       100,
+	}, rec, plain)
+
+	if _, ok := notifiers[1].(*namedNotifier); !ok {
+		t.Fatal("notifier without ForwardBatch should not be grouped")
+	}
+
+	Forward(hostEvent("a1", "10.0.0.1"))
+	Forward(hostEvent("a2", "10.0.0.1"))
+	Forward(hostEvent("b1", "10.0.0.2"))
+	if len(plain.events) != 3 {
+		t.Fatalf("ungrouped notifier got %d events, want 3", len(plain.events))
+	}
+	if got := rec.snapshot(); len(got) != 0 {
+		t.Fatalf("batches sent before group_wait: %v", got)
+	}
+
+	waitFor(t, func() bool { return len(rec.snapshot()) == 2 })
+	for _, batch := range rec.snapshot() {
+		if !(len(batch) == 2 && batch[0] == "a1" && batch[1] == "a2") && !(len(batch) == 1 && batch[0] == "b1") {
+			t.Fatalf("unexpected batch %v", batch)
+		}
+	}
+
+	// the group is still active: the next event waits for group_interval
+	Forward(hostEvent("a3", "10.0.0.1"))
+	waitFor(t, func() bool { return len(rec.snapshot()) == 3 })
+	if got := rec.snapshot()[2]; len(got) != 1 || got[0] != "a3" {
+		t.Fatalf("unexpected follow-up batch %v", got)
+	}
+}
+
+func TestGroupingMaxSizeAndCloseFlush(t *testing.T) {
+	rec := &batchRecorder{}
+	setupGrouping(t, config.GroupConfig{
+		GroupBy:       []string{"from_hostip"},
+		GroupWait:     config.Duration(time.Hour),
+		GroupInterval: config.Duration(time.Hour),
+		MaxSize:       2,
+	}, rec)
+
+	Forward(hostEvent("a1", "10.0.0.1"))
+	Forward(hostEvent("a2", "10.0.0.1"))
+	Forward(hostEvent("a3", "10.0.0.1"))
+	if got := rec.snapshot(); len(got) != 1 || len(got[0]) != 2 {
+		t.Fatalf("full group not sent right away: %v", got)
+	}
+
+	Shutdown()
+	if got := rec.snapshot(); len(got) != 2 || got[1][0] != "a3" {
+		t.Fatalf("pending group not flushed on shutdown: %v", got)
+	}
+}
+
+func TestGroupingThroughOutbox(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]types.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+		var events []types.Event
+		if err := json.Unmarshal(bs, &events); err != nil {
+			t.Errorf("batch body is not a JSON array: %s", bs)
+		}
+		mu.Lock()
+		bodies = append(bodies, events)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	web, err := NewWebAPINotifier(&config.WebAPIConfig{URL: srv.URL, Method: "POST", Timeout: config.Duration(2 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob, err := NewOutbox(web, t.TempDir(), testOutboxConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setupGrouping(t, config.GroupConfig{
+		GroupBy:       []string{"from_hostip"},
+		GroupWait:     config.Duration(20 * time.Millisecond),
+		GroupInterval: config.Duration(time.Hour),
+		MaxSize:       100,
+		Notifiers:     []string{"webapi"},
+	}, ob)
+	defer ob.(*Outbox).Close()
+
+	Forward(hostEvent("a1", "10.0.0.1"))
+	Forward(hostEvent("a2", "10.0.0.1"))
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bodies) == 1
+	})
+	if len(bodies[0]) != 2 || bodies[0][0].AlertKey != "a1" || bodies[0][1].AlertKey != "a2" {
+		t.Fatalf("unexpected batch body: %+v", bodies[0])
+	}
+}
+
+func TestWebAPIBatchTemplate(t *testing.T) {
+	n, err := NewWebAPINotifier(&config.WebAPIConfig{
+		Name:          "lark",
+		BatchTemplate: `{{ .Title }}|{{ .CommonLabels.from_hostip }}|{{ range .Events }}{{ .AlertKey }};{{ end }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+		got = string(bs)
+	}))
+	defer srv.Close()
+	n.cfg.URL, n.cfg.Method = srv.URL, "POST"
+
+	initNotifyTestLogger()
+	ok := n.ForwardBatch([]*types.Event{hostEvent("a1", "10.0.0.1"), hostEvent("a2", "10.0.0.1")})
+	if !ok || got != "2 events: 2 Critical|10.0.0.1|a1;a2;" {
+		t.Fatalf("ForwardBatch = %v, body %q", ok, got)
+	}
+}
@@ -16,31 +16,88 @@ type CommentNotifier interface {
 	Comment(alertKey, comment string) bool
 }
 
-var notifiers []Notifier
+// BatchNotifier is implemented by notifiers that can deliver a group of
+// events in one call; see SetGrouping.
+type BatchNotifier interface {
+	ForwardBatch(events []*types.Event) bool
+}
+
+var (
+	notifiers []Notifier
+
+	// reloadMu keeps deliveries out while Reload replaces the notifiers.
+	reloadMu sync.RWMutex
+)
 
 func Register(n Notifier) {
 	notifiers = append(notifiers, n)
 	logger.Logger.Infow("notifier registered", "name", n.Name())
 }
 
+// Shutdown stops background delivery workers (e.g. outboxes). Entries that
+// are still pending remain on disk and are replayed on the next start.
+func Shutdown() {
+	for _, n := range notifiers {
+		if c, ok := n.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+// Reload shuts down and unregisters every notifier, then calls register to
+// set them up again from a reloaded config. Forward and ForwardComment wait
+// until it returns; pending outbox entries are replayed by the new outboxes.
+func Reload(register func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	Shutdown()
+	notifiers = nil
+	resetFailureStreaks()
+	register()
+}
+
+// Names returns the names of the registered notifiers.
+func Names() []string {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
+	ret := make([]string, len(notifiers))
+	for i, n := range notifiers {
+		ret[i] = n.Name()
+	}
+	return ret
+}
+
 func Forward(event *types.Event) bool {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
 	if len(notifiers) == 0 {
 		logger.Logger.Warnw("forward: no notifiers configured, event dropped",
 			"event_key", event.AlertKey)
 		return false
 	}
 
-	if len(notifiers) == 1 {
-		return notifiers[0].Forward(event)
+	targets, routed := routeEvent(event)
+	if !routed {
+		targets = notifiers
+	} else if len(targets) == 0 {
+		logger.Logger.Debugw("forward: no route matched, event dropped",
+			"event_key", event.AlertKey)
+		return false
+	}
+
+	if len(targets) == 1 {
+		return forwardTo(targets[0], event)
 	}
 
 	var wg sync.WaitGroup
-	results := make([]bool, len(notifiers))
-	for i, n := range notifiers {
+	results := make([]bool, len(targets))
+	for i, n := range targets {
 		wg.Add(1)
 		go func(idx int, notifier Notifier) {
 			defer wg.Done()
-			results[idx] = notifier.Forward(event)
+			results[idx] = forwardTo(notifier, event)
 		}(i, n)
 	}
 	wg.Wait()
@@ -54,14 +111,22 @@ func Forward(event *types.Event) bool {
 }
 
 func ForwardComment(alertKey, comment string) bool {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
 	if len(notifiers) == 0 {
 		logger.Logger.Warnw("forward comment: no notifiers configured, comment dropped",
 			"alert_key", alertKey)
 		return false
 	}
 
-	commentNotifiers := make([]CommentNotifier, 0, len(notifiers))
-	for _, notifier := range notifiers {
+	targets, routed := routeComment(alertKey)
+	if !routed {
+		targets = notifiers
+	}
+
+	commentNotifiers := make([]CommentNotifier, 0, len(targets))
+	for _, notifier := range targets {
 		cn, ok := notifier.(CommentNotifier)
 		if !ok {
 			continue
@@ -0,0 +1,463 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const (
+	outboxKindEvent   = "event"
+	outboxKindComment = "comment"
+	outboxKindBatch   = "batch"
+
+	outboxDeadDir = "dead"
+)
+
+// outboxEntry is one pending delivery persisted as a single JSON file.
+type outboxEntry struct {
+	Seq         uint64         `json:"seq"`
+	Kind        string         `json:"kind"`
+	Event       *types.Event   `json:"event,omitempty"`
+	Events      []*types.Event `json:"events,omitempty"`
+	AlertKey    string         `json:"alert_key,omitempty"`
+	Comment     string         `json:"comment,omitempty"`
+	EnqueuedAt  int64          `json:"enqueued_at"`
+	Attempts    int            `json:"attempts"`
+	NextAttempt int64          `json:"next_attempt,omitempty"`
+	LastError   string         `json:"last_error,omitempty"`
+}
+
+func (e *outboxEntry) key() string {
+	if e.Event != nil {
+		return e.Event.AlertKey
+	}
+	if len(e.Events) > 0 {
+		return e.Events[0].AlertKey
+	}
+	return e.AlertKey
+}
+
+// Outbox wraps a Notifier with a durable FIFO queue on disk. Forward and
+// Comment only enqueue; a single worker delivers entries in order with
+// exponential backoff and moves entries that keep failing to a dead-letter
+// directory. Pending entries survive restarts and are replayed on startup.
+type Outbox struct {
+	inner Notifier
+	dir   string
+	cfg   config.OutboxConfig
+
+	mu      sync.Mutex
+	pending []uint64 // sequence numbers, oldest first
+	nextSeq uint64
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// commentOutbox is returned for inner notifiers that also implement
+// CommentNotifier, so ForwardComment only targets outboxes that can deliver.
+type commentOutbox struct {
+	*Outbox
+}
+
+func (o *commentOutbox) Comment(alertKey, comment string) bool {
+	return o.enqueue(&outboxEntry{
+		Kind:     outboxKindComment,
+		AlertKey: alertKey,
+		Comment:  comment,
+	})
+}
+
+// NewOutbox opens (or creates) the outbox for n under dir and starts its
+// delivery worker. The returned Notifier also implements CommentNotifier
+// when n does.
+func NewOutbox(n Notifier, dir string, cfg config.OutboxConfig) (Notifier, error) {
+	o := &Outbox{
+		inner: n,
+		dir:   dir,
+		cfg:   cfg,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+	if err := o.open(); err != nil {
+		return nil, err
+	}
+
+	o.wg.Add(1)
+	go o.run()
+
+	var ret Notifier = o
+	if _, ok := n.(CommentNotifier); ok {
+		ret = &commentOutbox{Outbox: o}
+	}
+	return ret, nil
+}
+
+// RegisterDurable registers n behind a persistent outbox, or as-is when
+// [notify.outbox] disabled = true or the outbox cannot be opened.
+func RegisterDurable(n Notifier) {
+	cfg := config.Config.Notify.Outbox
+	if cfg.Disabled {
+		Register(n)
+		return
+	}
+	ob, err := NewOutbox(n, OutboxDir(n.Name()), cfg)
+	if err != nil {
+		logger.Logger.Errorw("outbox: open fail, delivering synchronously",
+			"notifier", n.Name(), "error", err)
+		Register(n)
+		return
+	}
+	Register(ob)
+}
+
+// OutboxDir returns state.d/notify_outbox/<name>.
+func OutboxDir(name string) string {
+	return filepath.Join(config.Config.StateDir, "notify_outbox", name)
+}
+
+func (o *Outbox) Name() string { return o.inner.Name() }
+
+func (o *Outbox) Forward(event *types.Event) bool {
+	cp := *event
+	return o.enqueue(&outboxEntry{
+		Kind:  outboxKindEvent,
+		Event: &cp,
+	})
+}
+
+// ForwardBatch queues a group of events as one entry. It is only used when
+// the inner notifier is a BatchNotifier (see batchTarget).
+func (o *Outbox) ForwardBatch(events []*types.Event) bool {
+	cps := make([]*types.Event, len(events))
+	for i, event := range events {
+		cp := *event
+		cps[i] = &cp
+	}
+	return o.enqueue(&outboxEntry{
+		Kind:   outboxKindBatch,
+		Events: cps,
+	})
+}
+
+// Len returns the number of entries waiting for delivery.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Close stops the worker. Pending entries stay on disk for the next start.
+func (o *Outbox) Close() {
+	o.stopOnce.Do(func() { close(o.stop) })
+	o.wg.Wait()
+}
+
+func (o *Outbox) open() error {
+	if err := os.MkdirAll(filepath.Join(o.dir, outboxDeadDir), 0755); err != nil {
+		return fmt.Errorf("create outbox dir: %w", err)
+	}
+
+	seqs, err := listSeqFiles(o.dir)
+	if err != nil {
+		return err
+	}
+	o.pending = seqs
+	if len(seqs) > 0 {
+		o.nextSeq = seqs[len(seqs)-1] + 1
+		logger.Logger.Infow("outbox: replaying pending entries",
+			"notifier", o.inner.Name(), "count", len(seqs))
+	}
+
+	dead, err := listSeqFiles(filepath.Join(o.dir, outboxDeadDir))
+	if err != nil {
+		return err
+	}
+	if len(dead) > 0 && dead[len(dead)-1] >= o.nextSeq {
+		o.nextSeq = dead[len(dead)-1] + 1
+	}
+	return nil
+}
+
+func (o *Outbox) enqueue(e *outboxEntry) bool {
+	o.mu.Lock()
+	e.Seq = o.nextSeq
+	e.EnqueuedAt = time.Now().Unix()
+	if err := writeEntry(o.entryPath(e.Seq), e); err != nil {
+		o.mu.Unlock()
+		logger.Logger.Errorw("outbox: persist entry fail",
+			"notifier", o.inner.Name(), "event_key", e.key(), "error", err)
+		return false
+	}
+	o.nextSeq++
+	o.pending = append(o.pending, e.Seq)
+
+	var overflow []uint64
+	if len(o.pending) > o.cfg.MaxSize {
+		n := len(o.pending) - o.cfg.MaxSize
+		overflow = append(overflow, o.pending[:n]...)
+		o.pending = o.pending[n:]
+	}
+	o.mu.Unlock()
+
+	for _, seq := range overflow {
+		o.deadLetter(seq, "outbox full")
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (o *Outbox) run() {
+	defer o.wg.Done()
+
+	for {
+		o.mu.Lock()
+		var head uint64
+		has := len(o.pending) > 0
+		if has {
+			head = o.pending[0]
+		}
+		o.mu.Unlock()
+
+		if !has {
+			select {
+			case <-o.stop:
+				return
+			case <-o.wake:
+				continue
+			}
+		}
+
+		wait := o.process(head)
+		if wait <= 0 {
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// process tries to deliver the entry at seq and returns how long to wait
+// before the next attempt (0 to move on immediately).
+func (o *Outbox) process(seq uint64) time.Duration {
+	path := o.entryPath(seq)
+	e, err := readEntry(path)
+	if err != nil {
+		logger.Logger.Errorw("outbox: unreadable entry, dead-lettering",
+			"notifier", o.inner.Name(), "seq", seq, "error", err)
+		o.popHead(seq)
+		o.deadLetter(seq, "unreadable entry")
+		return 0
+	}
+
+	now := time.Now()
+	if e.NextAttempt > now.Unix() {
+		return time.Until(time.Unix(e.NextAttempt, 0))
+	}
+
+	delivered := o.deliver(e)
+	recordDelivery(o.inner.Name(), delivered)
+	if !o.isHead(seq) {
+		// dead-lettered by an overflowing enqueue while we were delivering
+		return 0
+	}
+
+	if delivered {
+		o.popHead(seq)
+		os.Remove(path)
+		if e.Attempts > 0 {
+			logger.Logger.Infow("outbox: delivered after retry",
+				"notifier", o.inner.Name(), "event_key", e.key(), "attempts", e.Attempts+1)
+		}
+		return 0
+	}
+
+	e.Attempts++
+	e.LastError = "delivery failed"
+	age := now.Sub(time.Unix(e.EnqueuedAt, 0))
+	if e.Attempts >= o.cfg.MaxAttempts || age >= time.Duration(o.cfg.MaxAge) {
+		o.popHead(seq)
+		writeEntry(path, e)
+		o.deadLetter(seq, fmt.Sprintf("gave up after %d attempts (age %s)", e.Attempts, age.Truncate(time.Second)))
+		return 0
+	}
+
+	backoff := o.backoff(e.Attempts)
+	e.NextAttempt = now.Add(backoff).Unix()
+	if err := writeEntry(path, e); err != nil {
+		logger.Logger.Warnw("outbox: update entry fail",
+			"notifier", o.inner.Name(), "seq", seq, "error", err)
+	}
+	logger.Logger.Warnw("outbox: delivery failed, will retry",
+		"notifier", o.inner.Name(), "event_key", e.key(),
+		"attempts", e.Attempts, "retry_in", backoff)
+	return backoff
+}
+
+func (o *Outbox) deliver(e *outboxEntry) bool {
+	switch e.Kind {
+	case outboxKindEvent:
+		if e.Event == nil {
+			return true
+		}
+		return o.inner.Forward(e.Event)
+	case outboxKindComment:
+		cn, ok := o.inner.(CommentNotifier)
+		if !ok {
+			return true
+		}
+		return cn.Comment(e.AlertKey, e.Comment)
+	case outboxKindBatch:
+		if bn, ok := o.inner.(BatchNotifier); ok {
+			return bn.ForwardBatch(e.Events)
+		}
+		// grouping was turned off for this notifier since the entry was queued
+		ok := true
+		for _, event := range e.Events {
+			if !o.inner.Forward(event) {
+				ok = false
+			}
+		}
+		return ok
+	default:
+		logger.Logger.Warnw("outbox: unknown entry kind dropped",
+			"notifier", o.inner.Name(), "kind", e.Kind)
+		return true
+	}
+}
+
+// backoff returns initial_backoff * 2^(attempts-1), capped at max_backoff.
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := time.Duration(o.cfg.InitialBackoff)
+	max := time.Duration(o.cfg.MaxBackoff)
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+func (o *Outbox) isHead(seq uint64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending) > 0 && o.pending[0] == seq
+}
+
+func (o *Outbox) popHead(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending) > 0 && o.pending[0] == seq {
+		o.pending = o.pending[1:]
+	}
+}
+
+func (o *Outbox) deadLetter(seq uint64, reason string) {
+	src := o.entryPath(seq)
+	dst := filepath.Join(o.dir, outboxDeadDir, seqFileName(seq))
+	if err := os.Rename(src, dst); err != nil {
+		logger.Logger.Errorw("outbox: move to dead-letter fail",
+			"notifier", o.inner.Name(), "seq", seq, "error", err)
+		os.Remove(src)
+		return
+	}
+	logger.Logger.Errorw("outbox: entry dead-lettered",
+		"notifier", o.inner.Name(), "seq", seq, "reason", reason, "path", dst)
+	o.pruneDeadLetters()
+}
+
+func (o *Outbox) pruneDeadLetters() {
+	deadDir := filepath.Join(o.dir, outboxDeadDir)
+	seqs, err := listSeqFiles(deadDir)
+	if err != nil || len(seqs) <= o.cfg.DeadLetterMax {
+		return
+	}
+	for _, seq := range seqs[:len(seqs)-o.cfg.DeadLetterMax] {
+		os.Remove(filepath.Join(deadDir, seqFileName(seq)))
+	}
+}
+
+func (o *Outbox) entryPath(seq uint64) string {
+	return filepath.Join(o.dir, seqFileName(seq))
+}
+
+func seqFileName(seq uint64) string {
+	return fmt.Sprintf("%020d.json", seq)
+}
+
+// listSeqFiles returns the sequence numbers of entry files in dir, ascending.
+func listSeqFiles(dir string) ([]uint64, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("list outbox dir %s: %w", dir, err)
+	}
+	var seqs []uint64
+	for _, de := range des {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func writeEntry(path string, e *outboxEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func readEntry(path string) (*outboxEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e outboxEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+type flakyNotifier struct {
+	mu        sync.Mutex
+	failFirst int
+	calls     int
+	delivered []string
+}
+
+func (f *flakyNotifier) Name() string { return "flaky" }
+
+func (f *flakyNotifier) Forward(event *types.Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failFirst {
+		return false
+	}
+	f.delivered = append(f.delivered, event.AlertKey)
+	return true
+}
+
+func (f *flakyNotifier) snapshot() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.delivered...)
+}
+
+func testOutboxConfig() config.OutboxConfig {
+	return config.OutboxConfig{
+		MaxSize:        10,
+		MaxAttempts:    5,
+		InitialBackoff: config.Duration(10 * time.Millisecond),
+		MaxBackoff:     config.Duration(20 * time.Millisecond),
+		MaxAge:         config.Duration(time.Hour),
+		DeadLetterMax:  10,
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met before deadline")
+}
+
+func TestOutboxRetriesInOrder(t *testing.T) {
+	initNotifyTestLogger()
+
+	inner := &flakyNotifier{failFirst: 2}
+	n, err := NewOutbox(inner, t.TempDir(), testOutboxConfig())
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	ob := n.(*Outbox)
+	defer ob.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if !ob.Forward(&types.Event{AlertKey: k, EventStatus: types.EventStatusCritical}) {
+			t.Fatalf("Forward(%s) = false", k)
+		}
+	}
+
+	waitFor(t, func() bool { return len(inner.snapshot()) == 3 })
+	got := inner.snapshot()
+	if got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("delivery order = %v, want [a b c]", got)
+	}
+	if ob.Len() != 0 {
+		t.Fatalf("pending = %d, want 0", ob.Len())
+	}
+}
+
+func TestOutboxReplaysAfterRestart(t *testing.T) {
+	initNotifyTestLogger()
+	dir := t.TempDir()
+
+	down := &flakyNotifier{failFirst: 1 << 30}
+	cfg := testOutboxConfig()
+	cfg.InitialBackoff = config.Duration(time.Hour)
+	cfg.MaxBackoff = config.Duration(time.Hour)
+	n, err := NewOutbox(down, dir, cfg)
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	n.Forward(&types.Event{AlertKey: "x"})
+	waitFor(t, func() bool {
+		down.mu.Lock()
+		defer down.mu.Unlock()
+		return down.calls > 0
+	})
+	n.(*Outbox).Close()
+
+	up := &flakyNotifier{}
+	n2, err := NewOutbox(up, dir, testOutboxConfig())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer n2.(*Outbox).Close()
+
+	if n2.(*Outbox).Len() != 1 {
+		t.Fatalf("pending after reopen = %d, want 1", n2.(*Outbox).Len())
+	}
+	// the failed attempt and its backoff were persisted before the restart
+	e, err := readEntry(filepath.Join(dir, seqFileName(0)))
+	if err != nil {
+		t.Fatalf("readEntry: %v", err)
+	}
+	if e.Attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", e.Attempts)
+	}
+}
+
+func TestOutboxDeadLettersAfterMaxAttempts(t *testing.T) {
+	initNotifyTestLogger()
+	dir := t.TempDir()
+
+	inner := &flakyNotifier{failFirst: 1 << 30}
+	cfg := testOutboxConfig()
+	cfg.MaxAttempts = 2
+	n, err := NewOutbox(inner, dir, cfg)
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	ob := n.(*Outbox)
+	defer ob.Close()
+
+	ob.Forward(&types.Event{AlertKey: "dead"})
+	waitFor(t, func() bool { return ob.Len() == 0 })
+
+	if _, err := os.Stat(filepath.Join(dir, outboxDeadDir, seqFileName(0))); err != nil {
+		t.Fatalf("dead-letter file missing: %v", err)
+	}
+}
+
+func TestOutboxCommentWrapper(t *testing.T) {
+	initNotifyTestLogger()
+
+	n, err := NewOutbox(NewConsoleNotifier(), t.TempDir(), testOutboxConfig())
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	defer n.(*commentOutbox).Close()
+	if _, ok := n.(CommentNotifier); !ok {
+		t.Fatal("outbox over a CommentNotifier should implement CommentNotifier")
+	}
+
+	n2, err := NewOutbox(&flakyNotifier{}, t.TempDir(), testOutboxConfig())
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	defer n2.(*Outbox).Close()
+	if _, ok := n2.(CommentNotifier); ok {
+		t.Fatal("outbox over a plain Notifier must not implement CommentNotifier")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	o := &Outbox{cfg: config.OutboxConfig{
+		InitialBackoff: config.Duration(time.Second),
+		MaxBackoff:     config.Duration(5 * time.Second),
+	}}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := o.backoff(i + 1); got != w {
+			t.Fatalf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
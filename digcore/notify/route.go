@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/filter"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// route is the compiled form of one [[notify.routes]] entry.
+type route struct {
+	name      string
+	labels    map[string]filter.Filter
+	statuses  filter.Filter
+	notifiers []string
+	cont      bool
+}
+
+var (
+	routesMu sync.RWMutex
+	routes   []*route
+
+	// delivered remembers which notifiers an alert was routed to, so its
+	// recovery and AI diagnosis comments follow the same path even when the
+	// route only matches on alert statuses. Entries go away with the
+	// recovery, or through Forget when the alert leaves the event cache.
+	deliveredMu sync.Mutex
+	delivered   = map[string]map[string]struct{}{}
+)
+
+// SetRoutes compiles and installs routing rules. With no rules every
+// registered notifier receives every event.
+func SetRoutes(cfgs []config.RouteConfig) error {
+	compiled, err := compileRoutes(cfgs)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]struct{}, len(notifiers))
+	for _, n := range notifiers {
+		known[n.Name()] = struct{}{}
+	}
+	for _, r := range compiled {
+		for _, name := range r.notifiers {
+			if _, ok := known[name]; !ok {
+				logger.Logger.Warnw("notify route references unregistered notifier",
+					"route", r.name, "notifier", name)
+			}
+		}
+	}
+
+	routesMu.Lock()
+	routes = compiled
+	routesMu.Unlock()
+	return nil
+}
+
+// ValidateRoutes checks routing rules without installing them. Unlike
+// SetRoutes, a route naming a notifier outside names is an error.
+func ValidateRoutes(cfgs []config.RouteConfig, names []string) error {
+	compiled, err := compileRoutes(cfgs)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		known[name] = struct{}{}
+	}
+	for i, r := range compiled {
+		for _, name := range r.notifiers {
+			if _, ok := known[name]; !ok {
+				return fmt.Errorf("notify route %s: notifier %q is not configured", routeName(r.name, i), name)
+			}
+		}
+	}
+	return nil
+}
+
+func compileRoutes(cfgs []config.RouteConfig) ([]*route, error) {
+	compiled := make([]*route, 0, len(cfgs))
+	for i, c := range cfgs {
+		r, err := compileRoute(c)
+		if err != nil {
+			return nil, fmt.Errorf("notify route %s: %w", routeName(c.Name, i), err)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+func routeName(name string, i int) string {
+	if name == "" {
+		return fmt.Sprintf("#%d", i+1)
+	}
+	return name
+}
+
+func compileRoute(c config.RouteConfig) (*route, error) {
+	if len(c.Notifiers) == 0 {
+		return nil, fmt.Errorf("notifiers is required")
+	}
+	r := &route{
+		name:      c.Name,
+		labels:    make(map[string]filter.Filter, len(c.Labels)+1),
+		notifiers: c.Notifiers,
+		cont:      c.Continue,
+	}
+
+	matchers := make(map[string][]string, len(c.Labels)+1)
+	for k, v := range c.Labels {
+		matchers[k] = v
+	}
+	if len(c.FromPlugins) > 0 {
+		matchers["from_plugin"] = append(matchers["from_plugin"], c.FromPlugins...)
+	}
+	for k, patterns := range matchers {
+		f, err := filter.Compile(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("labels.%s: %w", k, err)
+		}
+		if f != nil {
+			r.labels[k] = f
+		}
+	}
+
+	for _, s := range c.Statuses {
+		if !types.EventStatusValid(s) && !filter.HasMeta(s) {
+			return nil, fmt.Errorf("invalid status %q", s)
+		}
+	}
+	f, err := filter.Compile(c.Statuses)
+	if err != nil {
+		return nil, fmt.Errorf("statuses: %w", err)
+	}
+	r.statuses = f
+	return r, nil
+}
+
+func (r *route) match(event *types.Event, checkStatus bool) bool {
+	if checkStatus && r.statuses != nil && !r.statuses.Match(event.EventStatus) {
+		return false
+	}
+	for k, f := range r.labels {
+		if !f.Match(event.Labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// routeEvent returns the notifiers an event should go to. ok is false when
+// no routes are configured, meaning "all notifiers".
+func routeEvent(event *types.Event) (targets []Notifier, ok bool) {
+	routesMu.RLock()
+	rs := routes
+	routesMu.RUnlock()
+	if len(rs) == 0 {
+		return nil, false
+	}
+
+	names := make(map[string]struct{})
+	if event.EventStatus == types.EventStatusOk {
+		if prev := takeDelivered(event.AlertKey); prev != nil {
+			names = prev
+		} else {
+			// unknown alert (e.g. after a restart): match ignoring statuses
+			matchRoutes(rs, event, false, names)
+		}
+	} else {
+		matchRoutes(rs, event, true, names)
+		rememberDelivered(event.AlertKey, names)
+	}
+
+	return notifiersByName(names), true
+}
+
+func matchRoutes(rs []*route, event *types.Event, checkStatus bool, names map[string]struct{}) {
+	for _, r := range rs {
+		if !r.match(event, checkStatus) {
+			continue
+		}
+		for _, n := range r.notifiers {
+			names[n] = struct{}{}
+		}
+		if !r.cont {
+			return
+		}
+	}
+}
+
+// routeComment returns the notifiers that received alertKey. ok is false when
+// no routes are configured or the alert is unknown.
+func routeComment(alertKey string) (targets []Notifier, ok bool) {
+	routesMu.RLock()
+	n := len(routes)
+	routesMu.RUnlock()
+	if n == 0 {
+		return nil, false
+	}
+
+	deliveredMu.Lock()
+	names, has := delivered[alertKey]
+	deliveredMu.Unlock()
+	if !has {
+		return nil, false
+	}
+	return notifiersByName(names), true
+}
+
+func rememberDelivered(alertKey string, names map[string]struct{}) {
+	deliveredMu.Lock()
+	defer deliveredMu.Unlock()
+	prev := delivered[alertKey]
+	if prev == nil {
+		prev = make(map[string]struct{}, len(names))
+		delivered[alertKey] = prev
+	}
+	for n := range names {
+		prev[n] = struct{}{}
+	}
+}
+
+// Forget drops the notifiers remembered for alertKey. The engine calls it
+// when an alert leaves the event cache, so alerts that go away without a
+// forwarded recovery do not keep their entry forever.
+func Forget(alertKey string) {
+	takeDelivered(alertKey)
+}
+
+func takeDelivered(alertKey string) map[string]struct{} {
+	deliveredMu.Lock()
+	defer deliveredMu.Unlock()
+	names := delivered[alertKey]
+	delete(delivered, alertKey)
+	return names
+}
+
+func notifiersByName(names map[string]struct{}) []Notifier {
+	ret := make([]Notifier, 0, len(names))
+	for _, n := range notifiers {
+		if _, ok := names[n.Name()]; ok {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+type namedNotifier struct {
+	name     string
+	events   []*types.Event
+	comments []string
+}
+
+func (n *namedNotifier) Name() string { return n.name }
+
+func (n *namedNotifier) Forward(event *types.Event) bool {
+	n.events = append(n.events, event)
+	return true
+}
+
+func (n *namedNotifier) Comment(alertKey, comment string) bool {
+	n.comments = append(n.comments, alertKey)
+	return true
+}
+
+func setupRoutes(t *testing.T, cfgs []config.RouteConfig) (pd, web, console *namedNotifier) {
+	t.Helper()
+	initNotifyTestLogger()
+
+	pd = &namedNotifier{name: "pagerduty"}
+	web = &namedNotifier{name: "webapi"}
+	console = &namedNotifier{name: "console"}
+
+	oldNotifiers := notifiers
+	notifiers = []Notifier{pd, web, console}
+	t.Cleanup(func() {
+		notifiers = oldNotifiers
+		routes = nil
+		delivered = map[string]map[string]struct{}{}
+	})
+
+	if err := SetRoutes(cfgs); err != nil {
+		t.Fatalf("SetRoutes: %v", err)
+	}
+	return pd, web, console
+}
+
+func redisEvent(key, status string) *types.Event {
+	return &types.Event{
+		AlertKey:    key,
+		EventStatus: status,
+		Labels:      map[string]string{"from_plugin": "redis", "target": "10.0.0.1:6379"},
+	}
+}
+
+func TestRoutesFirstMatchAndContinue(t *testing.T) {
+	pd, web, console := setupRoutes(t, []config.RouteConfig{
+		{
+			Name:        "page-critical-redis",
+			FromPlugins: []string{"redis*"},
+			Statuses:    []string{"Critical"},
+			Notifiers:   []string{"pagerduty"},
+			Continue:    true,
+		},
+		{
+			Name:      "everything",
+			Notifiers: []string{"webapi", "console"},
+		},
+	})
+
+	Forward(redisEvent("crit", types.EventStatusCritical))
+	Forward(redisEvent("warn", types.EventStatusWarning))
+
+	if len(pd.events) != 1 || pd.events[0].AlertKey != "crit" {
+		t.Fatalf("pagerduty got %d events, want only the critical one", len(pd.events))
+	}
+	if len(web.events) != 2 || len(console.events) != 2 {
+		t.Fatalf("webapi/console got %d/%d events, want 2/2", len(web.events), len(console.events))
+	}
+}
+
+func TestRoutesRecoveryFollowsAlert(t *testing.T) {
+	pd, web, _ := setupRoutes(t, []config.RouteConfig{
+		{
+			FromPlugins: []string{"redis"},
+			Statuses:    []string{"Critical"},
+			Notifiers:   []string{"pagerduty"},
+		},
+	})
+
+	Forward(redisEvent("k", types.EventStatusCritical))
+	ForwardComment("k", "diagnosis")
+	Forward(redisEvent("k", types.EventStatusOk))
+
+	if len(pd.events) != 2 || pd.events[1].EventStatus != types.EventStatusOk {
+		t.Fatalf("pagerduty should receive alert and recovery, got %d events", len(pd.events))
+	}
+	if len(pd.comments) != 1 {
+		t.Fatalf("pagerduty comments = %d, want 1", len(pd.comments))
+	}
+	if len(web.events) != 0 || len(web.comments) != 0 {
+		t.Fatal("webapi should not receive anything")
+	}
+}
+
+func TestForgetDropsDelivered(t *testing.T) {
+	setupRoutes(t, []config.RouteConfig{
+		{FromPlugins: []string{"redis"}, Notifiers: []string{"pagerduty"}},
+	})
+
+	Forward(redisEvent("recovered", types.EventStatusCritical))
+	Forward(redisEvent("recovered", types.EventStatusOk))
+	Forward(redisEvent("silent", types.EventStatusCritical))
+	Forget("silent")
+
+	if len(delivered) != 0 {
+		t.Fatalf("delivered should be empty once alerts leave the cache, got %d entries", len(delivered))
+	}
+	if _, ok := routeComment("silent"); ok {
+		t.Fatal("a forgotten alert should not keep its comment route")
+	}
+}
+
+func TestRoutesLabelRegexAndNoMatch(t *testing.T) {
+	pd, web, console := setupRoutes(t, []config.RouteConfig{
+		{
+			Labels:    map[string][]string{"target": {"/^10\\.0\\./"}},
+			Notifiers: []string{"webapi"},
+		},
+	})
+
+	ev := redisEvent("a", types.EventStatusWarning)
+	if !Forward(ev) {
+		t.Fatal("Forward() = false for matching route")
+	}
+	ev2 := redisEvent("b", types.EventStatusWarning)
+	ev2.Labels["target"] = "192.168.0.1:6379"
+	if Forward(ev2) {
+		t.Fatal("Forward() = true for event matching no route")
+	}
+
+	if len(web.events) != 1 || len(pd.events) != 0 || len(console.events) != 0 {
+		t.Fatalf("unexpected fan-out: pd=%d web=%d console=%d", len(pd.events), len(web.events), len(console.events))
+	}
+}
+
+func TestSetRoutesRejectsInvalid(t *testing.T) {
+	initNotifyTestLogger()
+	t.Cleanup(func() { routes = nil })
+
+	if err := SetRoutes([]config.RouteConfig{{Name: "x"}}); err == nil {
+		t.Fatal("expected error for route without notifiers")
+	}
+	if err := SetRoutes([]config.RouteConfig{{Statuses: []string{"Bad"}, Notifiers: []string{"console"}}}); err == nil {
+		t.Fatal("expected error for invalid status")
+	}
+	if err := SetRoutes([]config.RouteConfig{{Labels: map[string][]string{"a": {"/(/"}}, Notifiers: []string{"console"}}}); err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+}
+
+func TestValidateRoutesRejectsUnknownNotifier(t *testing.T) {
+	cfgs := []config.RouteConfig{
+		{Name: "db", FromPlugins: []string{"redis"}, Notifiers: []string{"pagerduty"}},
+		{Notifiers: []string{"webhook"}},
+	}
+	if err := ValidateRoutes(cfgs, []string{"pagerduty", "webhook"}); err != nil {
+		t.Fatalf("ValidateRoutes() error = %v", err)
+	}
+
+	err := ValidateRoutes(cfgs, []string{"pagerduty"})
+	if err == nil || !strings.Contains(err.Error(), `route #2: notifier "webhook"`) {
+		t.Fatalf("ValidateRoutes() error = %v, want unknown webhook in route #2", err)
+	}
+	if len(routes) != 0 {
+		t.Fatal("ValidateRoutes must not install routes")
+	}
+}
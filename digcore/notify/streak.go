@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+var (
+	streakMu       sync.Mutex
+	failureStreaks = make(map[string]int)
+)
+
+// recordDelivery counts consecutive failed deliveries per notifier; a
+// success resets the count. Only real delivery attempts are recorded, not
+// hand-offs to an outbox or a grouping layer.
+func recordDelivery(name string, ok bool) {
+	streakMu.Lock()
+	defer streakMu.Unlock()
+	if ok {
+		delete(failureStreaks, name)
+		return
+	}
+	failureStreaks[name]++
+}
+
+// FailureStreaks returns, per notifier name, how many deliveries in a row
+// have failed. Notifiers whose last delivery succeeded are absent.
+func FailureStreaks() map[string]int {
+	streakMu.Lock()
+	defer streakMu.Unlock()
+	ret := make(map[string]int, len(failureStreaks))
+	for name, n := range failureStreaks {
+		ret[name] = n
+	}
+	return ret
+}
+
+func resetFailureStreaks() {
+	streakMu.Lock()
+	defer streakMu.Unlock()
+	failureStreaks = make(map[string]int)
+}
+
+// queued reports whether n only hands events on to a background worker, so
+// its Forward result says nothing about delivery.
+func queued(n Notifier) bool {
+	switch n.(type) {
+	case *Outbox, *commentOutbox, *groupNotifier, *commentGroupNotifier:
+		return true
+	}
+	return false
+}
+
+// forwardTo calls n.Forward and records the result of a real delivery.
+func forwardTo(n Notifier, event *types.Event) bool {
+	ok := n.Forward(event)
+	if !queued(n) {
+		recordDelivery(n.Name(), ok)
+	}
+	return ok
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func TestFailureStreaks(t *testing.T) {
+	initNotifyTestLogger()
+	resetFailureStreaks()
+	t.Cleanup(resetFailureStreaks)
+
+	oldNotifiers := notifiers
+	t.Cleanup(func() { notifiers = oldNotifiers })
+
+	flaky := &flakyNotifier{failFirst: 3}
+	notifiers = []Notifier{flaky}
+
+	event := &types.Event{AlertKey: "k", EventStatus: types.EventStatusCritical}
+	for i := 0; i < 3; i++ {
+		Forward(event)
+	}
+	if got := FailureStreaks()["flaky"]; got != 3 {
+		t.Fatalf("streak = %d, want 3", got)
+	}
+
+	Forward(event)
+	if _, ok := FailureStreaks()["flaky"]; ok {
+		t.Fatalf("streak still recorded after a successful delivery: %v", FailureStreaks())
+	}
+}
+
+func TestFailureStreaksThroughOutbox(t *testing.T) {
+	initNotifyTestLogger()
+	resetFailureStreaks()
+	t.Cleanup(resetFailureStreaks)
+
+	down := &flakyNotifier{failFirst: 1 << 30}
+	n, err := NewOutbox(down, t.TempDir(), testOutboxConfig())
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	ob := n.(*Outbox)
+	defer ob.Close()
+
+	// the enqueue succeeds, the streak reflects the background retries
+	if !forwardTo(ob, &types.Event{AlertKey: "k", EventStatus: types.EventStatusCritical}) {
+		t.Fatal("forwardTo(outbox) = false")
+	}
+	waitFor(t, func() bool { return FailureStreaks()["flaky"] >= 2 })
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// templateData is the dot value of webapi body templates. Event fields are
+// promoted, so {{ .EventStatus }} and {{ .Labels.check }} work directly, and
+// {{ json .Event }} renders the raw event.
+type templateData struct {
+	*types.Event
+
+	Title      string // "${check} ${from_hostip} ${target}"
+	IsRecovery bool
+	Time       time.Time
+}
+
+func newTemplateData(event *types.Event) templateData {
+	title := strings.TrimSpace(event.Labels["check"] + " " + event.Labels["from_hostip"])
+	if target := event.Labels["target"]; target != "" {
+		title += " " + target
+	}
+	return templateData{
+		Event:      event,
+		Title:      title,
+		IsRecovery: event.EventStatus == types.EventStatusOk,
+		Time:       time.Unix(event.EventTime, 0),
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes any value, strings come out quoted: "text": {{ json .Description }}
+	"json": func(v any) (string, error) {
+		bs, err := json.Marshal(v)
+		return string(bs), err
+	},
+	// jsonEscape escapes a string for use inside existing quotes
+	"jsonEscape": func(s string) string {
+		bs, _ := json.Marshal(s)
+		return string(bs[1 : len(bs)-1])
+	},
+	// formatTime formats a unix timestamp; layout defaults to "2006-01-02 15:04:05"
+	"formatTime": func(unix int64, layout ...string) string {
+		l := time.DateTime
+		if len(layout) > 0 && layout[0] != "" {
+			l = layout[0]
+		}
+		return time.Unix(unix, 0).Format(l)
+	},
+	"isoTime": func(unix int64) string {
+		return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+	},
+	"unixMilli": func(unix int64) int64 {
+		return unix * 1000
+	},
+	"sortedKeys": sortedKeys,
+	// kv renders a map as "k1=v1, k2=v2" in key order
+	"kv": func(m map[string]string) string {
+		parts := make([]string, 0, len(m))
+		for _, k := range sortedKeys(m) {
+			parts = append(parts, k+"="+m[k])
+		}
+		return strings.Join(parts, ", ")
+	},
+	// kvLines renders a map as one "k: v" line per key, in key order
+	"kvLines": func(m map[string]string) string {
+		var sb strings.Builder
+		for _, k := range sortedKeys(m) {
+			fmt.Fprintf(&sb, "%s: %s\n", k, m[k])
+		}
+		return sb.String()
+	},
+	"default": func(def string, v string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	},
+	"trunc": func(n int, s string) string {
+		if len(s) <= n {
+			return s
+		}
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		return s[:n]
+	},
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+}
+
+func parseBodyTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// batchTemplateData is the dot value of webapi batch templates:
+// {{ range .Events }}...{{ end }} iterates per-event data as in body templates.
+type batchTemplateData struct {
+	Events       []templateData
+	CommonLabels map[string]string // labels with the same value on every event
+	Title        string            // e.g. "3 events: 2 Critical, 1 Ok"
+}
+
+func newBatchTemplateData(events []*types.Event) batchTemplateData {
+	data := batchTemplateData{
+		Events:       make([]templateData, 0, len(events)),
+		CommonLabels: commonLabels(events),
+		Title:        digestTitle(events),
+	}
+	for _, event := range events {
+		data.Events = append(data.Events, newTemplateData(event))
+	}
+	return data
+}
+
+func commonLabels(events []*types.Event) map[string]string {
+	common := map[string]string{}
+	if len(events) == 0 {
+		return common
+	}
+	for k, v := range events[0].Labels {
+		common[k] = v
+	}
+	for _, event := range events[1:] {
+		for k, v := range common {
+			if event.Labels[k] != v {
+				delete(common, k)
+			}
+		}
+	}
+	return common
+}
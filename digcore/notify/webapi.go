@@ -3,8 +3,12 @@ package notify
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/cprobe/catpaw/digcore/config"
@@ -13,37 +17,110 @@ import (
 )
 
 type WebAPINotifier struct {
-	cfg    *config.WebAPIConfig
-	client *http.Client
+	cfg       *config.WebAPIConfig
+	tmpl      *template.Template
+	batchTmpl *template.Template
+	client    *http.Client
 }
 
-func NewWebAPINotifier(cfg *config.WebAPIConfig) *WebAPINotifier {
-	return &WebAPINotifier{
+// NewWebAPINotifier creates a webapi notifier. It fails only when a
+// configured body template cannot be loaded or parsed.
+func NewWebAPINotifier(cfg *config.WebAPIConfig) (*WebAPINotifier, error) {
+	w := &WebAPINotifier{
 		cfg: cfg,
 		client: &http.Client{
 			Timeout: time.Duration(cfg.Timeout),
 		},
 	}
+
+	var err error
+	if w.tmpl, err = loadBodyTemplate(w.Name(), cfg.Template, cfg.TemplateFile); err != nil {
+		return nil, fmt.Errorf("webapi %s: %w", w.Name(), err)
+	}
+	if w.batchTmpl, err = loadBodyTemplate(w.Name()+"/batch", cfg.BatchTemplate, cfg.BatchTemplateFile); err != nil {
+		return nil, fmt.Errorf("webapi %s: batch template: %w", w.Name(), err)
+	}
+	return w, nil
+}
+
+// loadBodyTemplate parses the inline template or the template file; it
+// returns nil when neither is configured.
+func loadBodyTemplate(name, inline, file string) (*template.Template, error) {
+	text := inline
+	if file != "" {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read template: %w", err)
+		}
+		text = string(bs)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return parseBodyTemplate(name, text)
 }
 
-func (w *WebAPINotifier) Name() string { return "webapi" }
+func (w *WebAPINotifier) Name() string {
+	if w.cfg.Name != "" {
+		return w.cfg.Name
+	}
+	return "webapi"
+}
 
 func (w *WebAPINotifier) Forward(event *types.Event) bool {
-	bs, err := json.Marshal(event)
+	bs, err := w.render(event)
+	if err != nil {
+		logger.Logger.Errorw("webapi: render body fail",
+			"notifier", w.Name(), "event_key", event.AlertKey, "error", err.Error())
+		return false
+	}
+	return w.send(event.AlertKey, bs)
+}
+
+// ForwardBatch sends a group of events in one request: the batch template
+// when configured, otherwise a JSON array of events. Targets with only a
+// per-event template get one request per event.
+func (w *WebAPINotifier) ForwardBatch(events []*types.Event) bool {
+	if len(events) == 0 {
+		return true
+	}
+	key := events[0].AlertKey
+
+	var bs []byte
+	var err error
+	switch {
+	case w.batchTmpl != nil:
+		var buf bytes.Buffer
+		err = w.batchTmpl.Execute(&buf, newBatchTemplateData(events))
+		bs = buf.Bytes()
+	case w.tmpl != nil:
+		ok := true
+		for _, event := range events {
+			if !w.Forward(event) {
+				ok = false
+			}
+		}
+		return ok
+	default:
+		bs, err = json.Marshal(events)
+	}
 	if err != nil {
-		logger.Logger.Errorw("webapi: marshal fail",
-			"event_key", event.AlertKey, "error", err.Error())
+		logger.Logger.Errorw("webapi: render batch body fail",
+			"notifier", w.Name(), "event_key", key, "events", len(events), "error", err.Error())
 		return false
 	}
+	return w.send(key, bs)
+}
 
+func (w *WebAPINotifier) send(alertKey string, bs []byte) bool {
 	for attempt := 0; attempt <= w.cfg.MaxRetries; attempt++ {
 		if attempt > 0 {
 			time.Sleep(time.Duration(attempt) * time.Second)
 			logger.Logger.Infow("webapi: retrying",
-				"event_key", event.AlertKey, "attempt", attempt+1)
+				"notifier", w.Name(), "event_key", alertKey, "attempt", attempt+1)
 		}
 
-		ok, retryable := w.doRequest(event.AlertKey, bs)
+		ok, retryable := w.doRequest(alertKey, bs)
 		if ok {
 			return true
 		}
@@ -53,19 +130,36 @@ func (w *WebAPINotifier) Forward(event *types.Event) bool {
 	}
 
 	logger.Logger.Errorw("webapi: all retries exhausted",
-		"event_key", event.AlertKey, "max_retries", w.cfg.MaxRetries)
+		"notifier", w.Name(), "event_key", alertKey, "max_retries", w.cfg.MaxRetries)
 	return false
 }
 
+// render returns the request body: the raw Event JSON, or the rendered
+// template when one is configured.
+func (w *WebAPINotifier) render(event *types.Event) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, newTemplateData(event)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (w *WebAPINotifier) doRequest(alertKey string, payload []byte) (ok bool, retryable bool) {
 	req, err := http.NewRequest(w.cfg.Method, w.cfg.URL, bytes.NewReader(payload))
 	if err != nil {
 		logger.Logger.Errorw("webapi: new request fail",
-			"event_key", alertKey, "error", err.Error())
+			"notifier", w.Name(), "event_key", alertKey, "error", err.Error())
 		return false, false
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	contentType := w.cfg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
 	for k, v := range w.cfg.Headers {
 		req.Header.Set(k, v)
 	}
@@ -73,7 +167,7 @@ func (w *WebAPINotifier) doRequest(alertKey string, payload []byte) (ok bool, re
 	res, err := w.client.Do(req)
 	if err != nil {
 		logger.Logger.Errorw("webapi: do request fail",
-			"event_key", alertKey, "error", err.Error())
+			"notifier", w.Name(), "event_key", alertKey, "error", err.Error())
 		return false, true
 	}
 
@@ -85,20 +179,20 @@ func (w *WebAPINotifier) doRequest(alertKey string, payload []byte) (ok bool, re
 
 	if res.StatusCode >= 200 && res.StatusCode < 300 {
 		logger.Logger.Infow("webapi: forward completed",
-			"event_key", alertKey, "response_status", res.StatusCode)
+			"notifier", w.Name(), "event_key", alertKey, "response_status", res.StatusCode)
 		return true, false
 	}
 
 	if res.StatusCode == 429 || res.StatusCode >= 500 {
 		logger.Logger.Errorw("webapi: retryable error",
-			"event_key", alertKey,
+			"notifier", w.Name(), "event_key", alertKey,
 			"response_status", res.StatusCode,
 			"response_body", string(body))
 		return false, true
 	}
 
 	logger.Logger.Errorw("webapi: non-retryable error",
-		"event_key", alertKey,
+		"notifier", w.Name(), "event_key", alertKey,
 		"response_status", res.StatusCode,
 		"response_body", string(body))
 	return false, false
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func webapiTestEvent() *types.Event {
+	return &types.Event{
+		EventTime:   1700000000,
+		EventStatus: types.EventStatusCritical,
+		AlertKey:    "k1",
+		Labels: map[string]string{
+			"check":       "redis::ping",
+			"from_hostip": "10.0.0.1",
+			"target":      "10.0.0.2:6379",
+		},
+		Attrs:       map[string]string{"current_value": "timeout"},
+		Description: "redis \"ping\" failed\nline 2",
+	}
+}
+
+func TestWebAPITemplateBody(t *testing.T) {
+	initNotifyTestLogger()
+
+	var body []byte
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	tmpl := `{"msgtype":"markdown","markdown":{"title":{{ json .Title }},` +
+		`"text":"### [{{ .EventStatus }}] {{ jsonEscape .Title }}\n{{ jsonEscape .Description }}\n` +
+		`{{ jsonEscape (kvLines .Attrs) }}at {{ formatTime .EventTime "2006-01-02" }}"},` +
+		`"recovery":{{ .IsRecovery }},"host":{{ json (default "-" .Labels.from_hostname) }}}`
+	n, err := NewWebAPINotifier(&config.WebAPIConfig{
+		Name:        "dingtalk",
+		URL:         srv.URL,
+		Method:      "POST",
+		ContentType: "application/json; charset=utf-8",
+		Template:    tmpl,
+		Timeout:     config.Duration(2 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Name() != "dingtalk" {
+		t.Fatalf("Name() = %q", n.Name())
+	}
+	if !n.Forward(webapiTestEvent()) {
+		t.Fatal("Forward failed")
+	}
+
+	var got struct {
+		Markdown struct {
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"markdown"`
+		Recovery bool   `json:"recovery"`
+		Host     string `json:"host"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("rendered body is not valid JSON: %v\n%s", err, body)
+	}
+	if got.Markdown.Title != "redis::ping 10.0.0.1 10.0.0.2:6379" {
+		t.Fatalf("title = %q", got.Markdown.Title)
+	}
+	wantText := "### [Critical] redis::ping 10.0.0.1 10.0.0.2:6379\nredis \"ping\" failed\nline 2\ncurrent_value: timeout\nat " +
+		time.Unix(1700000000, 0).Format("2006-01-02")
+	if got.Markdown.Text != wantText {
+		t.Fatalf("text = %q, want %q", got.Markdown.Text, wantText)
+	}
+	if got.Recovery || got.Host != "-" {
+		t.Fatalf("unexpected body: %+v", got)
+	}
+	if contentType != "application/json; charset=utf-8" {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+}
+
+func TestWebAPIRawEventWithoutTemplate(t *testing.T) {
+	initNotifyTestLogger()
+
+	var got types.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	n, err := NewWebAPINotifier(&config.WebAPIConfig{URL: srv.URL, Method: "POST", Timeout: config.Duration(2 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Name() != "webapi" {
+		t.Fatalf("Name() = %q", n.Name())
+	}
+	if !n.Forward(webapiTestEvent()) {
+		t.Fatal("Forward failed")
+	}
+	if got.AlertKey != "k1" || got.Labels["check"] != "redis::ping" {
+		t.Fatalf("unexpected raw event: %+v", got)
+	}
+}
+
+func TestWebAPITemplateFileAndErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "body.tmpl")
+	if err := os.WriteFile(path, []byte(`{"event":{{ json .Event }}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewWebAPINotifier(&config.WebAPIConfig{Name: "raw", TemplateFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := n.render(webapiTestEvent())
+	if err != nil || !strings.HasPrefix(string(bs), `{"event":{"event_time":1700000000`) {
+		t.Fatalf("render = %s, %v", bs, err)
+	}
+
+	if _, err := NewWebAPINotifier(&config.WebAPIConfig{Template: "{{ nosuchfunc . }}"}); err == nil {
+		t.Fatal("unknown template func should fail")
+	}
+	if _, err := NewWebAPINotifier(&config.WebAPIConfig{TemplateFile: filepath.Join(dir, "missing")}); err == nil {
+		t.Fatal("missing template file should fail")
+	}
+}
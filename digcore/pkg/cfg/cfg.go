@@ -2,6 +2,8 @@ package cfg
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"path"
 	"sort"
@@ -86,6 +88,33 @@ func LoadConfigByDir(configDir string, configPtr interface{}) error {
 	return m.Load(configPtr)
 }
 
+// DigestDir returns a content hash of the config files LoadConfigByDir reads
+// from configDir (subdirectories are not included).
+func DigestDir(configDir string) (string, error) {
+	files, err := file.FilesUnder(configDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to list files under: %s : %v", configDir, err)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, fpath := range files {
+		switch {
+		case strings.HasSuffix(fpath, ".toml"), strings.HasSuffix(fpath, ".json"),
+			strings.HasSuffix(fpath, ".yaml"), strings.HasSuffix(fpath, ".yml"):
+		default:
+			continue
+		}
+		bs, err := file.ReadBytes(path.Join(configDir, fpath))
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %v", fpath, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", fpath, len(bs))
+		h.Write(bs)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func isLocalOverrideToml(name string) bool {
 	return strings.HasSuffix(strings.ToLower(name), ".local.toml")
 }
@@ -149,6 +149,37 @@ name = "second"
 	}
 }
 
+func TestDigestDirTracksTopLevelConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, DefaultConfigFile), "[log]\nlevel = \"info\"\n")
+
+	first, err := DigestDir(dir)
+	if err != nil {
+		t.Fatalf("DigestDir() error = %v", err)
+	}
+
+	// files LoadConfigByDir ignores do not change the digest
+	writeTestFile(t, filepath.Join(dir, "README.md"), "notes")
+	if err := os.Mkdir(filepath.Join(dir, "p.cpu"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "p.cpu", "cpu.toml"), "interval = \"30s\"\n")
+	if got, _ := DigestDir(dir); got != first {
+		t.Fatal("digest changed for files outside the main config")
+	}
+
+	writeTestFile(t, filepath.Join(dir, DefaultConfigFile), "[log]\nlevel = \"debug\"\n")
+	second, _ := DigestDir(dir)
+	if second == first {
+		t.Fatal("digest did not change after editing config.toml")
+	}
+
+	writeTestFile(t, filepath.Join(dir, LocalOverrideConfigFile), "")
+	if got, _ := DigestDir(dir); got == second {
+		t.Fatal("digest did not change after adding config.local.toml")
+	}
+}
+
 func writeTestFile(t *testing.T, path, content string) {
 	t.Helper()
 
@@ -0,0 +1,99 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, expr string) *Schedule {
+	t.Helper()
+	s, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	return s
+}
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) should fail", expr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		time string
+		want bool
+	}{
+		{"0 3 * * *", "2026-03-10 03:00", true},
+		{"0 3 * * *", "2026-03-10 03:01", false},
+		{"*/15 * * * *", "2026-03-10 10:45", true},
+		{"*/15 * * * *", "2026-03-10 10:46", false},
+		{"0 9-18 * * mon-fri", "2026-03-13 12:00", true},  // Friday
+		{"0 9-18 * * mon-fri", "2026-03-14 12:00", false}, // Saturday
+		{"0 0 * * 7", "2026-03-15 00:00", true},           // Sunday via 7
+		{"0 0 1,15 * *", "2026-03-15 00:00", true},
+		{"0 0 1 jan *", "2026-01-01 00:00", true},
+		{"@hourly", "2026-01-01 05:00", true},
+		// both day fields restricted: either matches
+		{"0 0 13 * 5", "2026-03-13 00:00", true},
+		{"0 0 13 * 1", "2026-03-09 00:00", true},
+	}
+	for _, tt := range tests {
+		s := mustParse(t, tt.expr)
+		if got := s.Matches(at(tt.time)); got != tt.want {
+			t.Errorf("%q.Matches(%s) = %v, want %v", tt.expr, tt.time, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	s := mustParse(t, "30 2 * * sat")
+	got := s.Next(at("2026-03-10 10:00"))
+	if want := at("2026-03-14 02:30"); !got.Equal(want) {
+		t.Fatalf("Next = %s, want %s", got, want)
+	}
+
+	s = mustParse(t, "0 0 29 2 *")
+	got = s.Next(at("2026-03-01 00:00"))
+	if want := at("2028-02-29 00:00"); !got.Equal(want) {
+		t.Fatalf("Next(leap) = %s, want %s", got, want)
+	}
+}
+
+func TestActiveWithin(t *testing.T) {
+	s := mustParse(t, "0 2 * * *")
+	if !s.ActiveWithin(at("2026-03-10 02:00"), 2*time.Hour) {
+		t.Fatal("window should be active at its start")
+	}
+	if !s.ActiveWithin(at("2026-03-10 03:59"), 2*time.Hour) {
+		t.Fatal("window should be active before its end")
+	}
+	if s.ActiveWithin(at("2026-03-10 04:00"), 2*time.Hour) {
+		t.Fatal("window should be closed at its end")
+	}
+	if s.ActiveWithin(at("2026-03-10 01:59"), 2*time.Hour) {
+		t.Fatal("window should not be active before start")
+	}
+}
@@ -1,6 +1,8 @@
 package plugins
 
 import (
+	"context"
+
 	"github.com/cprobe/catpaw/digcore/config"
 	"github.com/cprobe/catpaw/digcore/diagnose"
 	"github.com/cprobe/catpaw/digcore/pkg/safe"
@@ -27,6 +29,13 @@ type Gatherer interface {
 	Gather(*safe.Queue[*types.Event])
 }
 
+// ContextGatherer is implemented by instances that can abandon a gather when
+// ctx is done. The agent cancels ctx once the gather timeout expires; plain
+// Gatherers keep running in the background and block their next gather.
+type ContextGatherer interface {
+	GatherContext(context.Context, *safe.Queue[*types.Event])
+}
+
 func MayApplyPartials(p any) error {
 	if ap, ok := p.(IApplyPartials); ok {
 		return ap.ApplyPartials()
@@ -72,6 +81,15 @@ func MayGather(t any, q *safe.Queue[*types.Event]) {
 	}
 }
 
+// MayGatherContext prefers GatherContext and falls back to Gather.
+func MayGatherContext(ctx context.Context, t any, q *safe.Queue[*types.Event]) {
+	if gather, ok := t.(ContextGatherer); ok {
+		gather.GatherContext(ctx, q)
+		return
+	}
+	MayGather(t, q)
+}
+
 func MayDrop(t any) {
 	if dropper, ok := t.(Dropper); ok {
 		dropper.Drop()
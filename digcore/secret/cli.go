@@ -0,0 +1,109 @@
+package secret
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// CLISet stores a secret. Without a value it reads one line from stdin, so
+// the secret stays out of the shell history.
+func CLISet(stateDir, name, value string, readValue bool) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	if readValue {
+		v, err := readLine(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = v
+	}
+	if value == "" {
+		return fmt.Errorf("secret value is empty")
+	}
+
+	ks, err := OpenKeystore(KeystorePath(stateDir))
+	if err != nil {
+		return err
+	}
+	ks.Set(name, value)
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Secret %s saved. Reference it as \"%s%s\".\n", name, prefixKeystore, name)
+	return nil
+}
+
+// CLIGet prints a secret.
+func CLIGet(stateDir, name string) error {
+	path := KeystorePath(stateDir)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		return err
+	}
+	v, err := ks.Get(name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(v)
+	return nil
+}
+
+// CLIList prints the secret names, never their values.
+func CLIList(stateDir string) error {
+	path := KeystorePath(stateDir)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Println("No secrets found.")
+		return nil
+	}
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		return err
+	}
+	names := ks.Names()
+	if len(names) == 0 {
+		fmt.Println("No secrets found.")
+		return nil
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// CLIDelete removes a secret.
+func CLIDelete(stateDir, name string) error {
+	ks, err := OpenKeystore(KeystorePath(stateDir))
+	if err != nil {
+		return err
+	}
+	if !ks.Delete(name) {
+		return fmt.Errorf("no secret named %q", name)
+	}
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Secret %s deleted.\n", name)
+	return nil
+}
+
+func validName(name string) error {
+	if name == "" || strings.TrimSpace(name) != name || strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("invalid secret name %q", name)
+	}
+	return nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
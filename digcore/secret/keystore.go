@@ -0,0 +1,199 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// PasswordEnv holds the keystore password. Without it the key is a random
+// file next to the keystore, which keeps secrets out of conf.d and backups
+// of it but not away from anyone who can read state.d.
+const PasswordEnv = "CATPAW_KEYSTORE_PASSWORD"
+
+const (
+	keystoreFile = "secrets.keystore"
+
+	kdfPassword = "pbkdf2-sha256"
+	kdfKeyFile  = "keyfile"
+
+	pbkdf2Iterations = 600000
+	keyLen           = 32
+)
+
+// KeystorePath returns state.d/secrets.keystore.
+func KeystorePath(stateDir string) string {
+	return filepath.Join(stateDir, keystoreFile)
+}
+
+// Keystore is a file of named secrets, each sealed with AES-256-GCM.
+type Keystore struct {
+	path string
+	file keystoreFileData
+	aead cipher.AEAD
+}
+
+type keystoreFileData struct {
+	Version int               `json:"version"`
+	KDF     string            `json:"kdf"`
+	Salt    string            `json:"salt,omitempty"`
+	Entries map[string]string `json:"entries"` // name -> base64(nonce|ciphertext)
+}
+
+// OpenKeystore loads the keystore at path. A missing file yields an empty
+// keystore that Save creates, protected by PasswordEnv when it is set.
+func OpenKeystore(path string) (*Keystore, error) {
+	ks := &Keystore{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		ks.file = keystoreFileData{Version: 1, KDF: kdfKeyFile, Entries: map[string]string{}}
+		if os.Getenv(PasswordEnv) != "" {
+			salt := make([]byte, 16)
+			rand.Read(salt)
+			ks.file.KDF = kdfPassword
+			ks.file.Salt = base64.StdEncoding.EncodeToString(salt)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("keystore: %w", err)
+	default:
+		if err := json.Unmarshal(data, &ks.file); err != nil {
+			return nil, fmt.Errorf("keystore: parse %s: %w", path, err)
+		}
+		if ks.file.Entries == nil {
+			ks.file.Entries = map[string]string{}
+		}
+	}
+
+	key, err := ks.key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if ks.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	return ks, nil
+}
+
+func (ks *Keystore) key() ([]byte, error) {
+	switch ks.file.KDF {
+	case kdfPassword:
+		password := os.Getenv(PasswordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("keystore: %s is password protected, set %s", ks.path, PasswordEnv)
+		}
+		salt, err := base64.StdEncoding.DecodeString(ks.file.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("keystore: invalid salt: %w", err)
+		}
+		return pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, keyLen)
+	case kdfKeyFile:
+		return ks.loadOrCreateKeyFile()
+	default:
+		return nil, fmt.Errorf("keystore: unsupported kdf %q", ks.file.KDF)
+	}
+}
+
+func (ks *Keystore) loadOrCreateKeyFile() ([]byte, error) {
+	path := ks.path + ".key"
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != keyLen {
+			return nil, fmt.Errorf("keystore: %s is not a %d byte key", path, keyLen)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if len(ks.file.Entries) > 0 {
+		return nil, fmt.Errorf("keystore: key file %s is missing", path)
+	}
+
+	key = make([]byte, keyLen)
+	rand.Read(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("keystore: write key file: %w", err)
+	}
+	return key, nil
+}
+
+// Get decrypts the named secret.
+func (ks *Keystore) Get(name string) (string, error) {
+	sealed, ok := ks.file.Entries[name]
+	if !ok {
+		return "", fmt.Errorf("keystore: no secret named %q", name)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < ks.aead.NonceSize() {
+		return "", fmt.Errorf("keystore: secret %q is corrupt", name)
+	}
+	nonce, ciphertext := raw[:ks.aead.NonceSize()], raw[ks.aead.NonceSize():]
+	plain, err := ks.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("keystore: cannot decrypt %q, wrong key or password", name)
+	}
+	return string(plain), nil
+}
+
+// Set encrypts value under name. Call Save to write it.
+func (ks *Keystore) Set(name, value string) {
+	nonce := make([]byte, ks.aead.NonceSize())
+	rand.Read(nonce)
+	// the name is authenticated, so entries cannot be swapped in the file
+	sealed := ks.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	ks.file.Entries[name] = base64.StdEncoding.EncodeToString(sealed)
+}
+
+// Delete removes the named secret and reports whether it existed.
+func (ks *Keystore) Delete(name string) bool {
+	_, ok := ks.file.Entries[name]
+	delete(ks.file.Entries, name)
+	return ok
+}
+
+// Names returns the secret names, sorted.
+func (ks *Keystore) Names() []string {
+	ret := make([]string, 0, len(ks.file.Entries))
+	for name := range ks.file.Entries {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Save atomically writes the keystore.
+func (ks *Keystore) Save() error {
+	data, err := json.MarshalIndent(ks.file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal keystore: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp := ks.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write keystore: %w", err)
+	}
+	if err := os.Rename(tmp, ks.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename keystore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Package secret resolves secret references in credential settings and
+// keeps the resolved values out of logs and diagnosis records.
+//
+// A credential setting (API keys, notifier tokens, plugin passwords, MCP
+// env) may hold, instead of the literal secret:
+//
+//	file:/etc/catpaw/redis.pass    content of the file, trailing newline trimmed
+//	exec:/usr/local/bin/vault-get redis   stdout of the command (no shell)
+//	keystore:redis_password        entry of the keystore managed by `catpaw secret`
+//
+// Every value a reference resolves to is remembered so Mask can redact it.
+// Literal values are not: a plain setting may well be an ordinary word, and
+// masking it everywhere would garble logs and diagnosis records.
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/pkg/cmdx"
+)
+
+const (
+	prefixFile     = "file:"
+	prefixExec     = "exec:"
+	prefixKeystore = "keystore:"
+
+	execTimeout = 10 * time.Second
+
+	// values shorter than this are not masked: redacting "on" or "42"
+	// everywhere would garble logs without hiding anything
+	minMaskLen = 4
+
+	Redacted = "******"
+)
+
+var (
+	mu      sync.RWMutex
+	secrets []string // longest first, so overlapping values mask fully
+
+	keystorePath string
+	keystore     *Keystore
+	keystoreMod  time.Time
+)
+
+// SetKeystore sets the keystore file that keystore: references read.
+func SetKeystore(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if path != keystorePath {
+		keystorePath = path
+		keystore = nil
+	}
+}
+
+// IsRef reports whether val is a secret reference.
+func IsRef(val string) bool {
+	return strings.HasPrefix(val, prefixFile) || strings.HasPrefix(val, prefixExec) ||
+		strings.HasPrefix(val, prefixKeystore)
+}
+
+// IsExecRef reports whether val is a reference that runs a command.
+func IsExecRef(val string) bool {
+	return strings.HasPrefix(val, prefixExec)
+}
+
+// Resolve returns the secret val refers to, or val itself when it is not a
+// reference. Only secrets resolved from a reference are registered for
+// masking.
+func Resolve(val string) (string, error) {
+	var (
+		ret string
+		err error
+	)
+	switch {
+	case strings.HasPrefix(val, prefixFile):
+		ret, err = readFile(strings.TrimPrefix(val, prefixFile))
+	case strings.HasPrefix(val, prefixExec):
+		ret, err = runCommand(strings.TrimPrefix(val, prefixExec))
+	case strings.HasPrefix(val, prefixKeystore):
+		ret, err = fromKeystore(strings.TrimPrefix(val, prefixKeystore))
+	default:
+		return val, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	register(ret)
+	return ret, nil
+}
+
+func readFile(path string) (string, error) {
+	bs, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return "", fmt.Errorf("secret file: %w", err)
+	}
+	return strings.TrimRight(string(bs), "\r\n"), nil
+}
+
+func runCommand(command string) (string, error) {
+	stdout, stderr, err := cmdx.CommandRun(strings.TrimSpace(command), execTimeout)
+	if err != nil {
+		if msg := strings.TrimSpace(string(stderr)); msg != "" {
+			return "", fmt.Errorf("secret command: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("secret command: %w", err)
+	}
+	return strings.TrimRight(string(stdout), "\r\n"), nil
+}
+
+func fromKeystore(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if keystorePath == "" {
+		return "", fmt.Errorf("keystore: not configured")
+	}
+	// reopen when `catpaw secret set` changed the file
+	fi, err := os.Stat(keystorePath)
+	if err != nil {
+		return "", fmt.Errorf("keystore: %w", err)
+	}
+	if keystore == nil || !fi.ModTime().Equal(keystoreMod) {
+		ks, err := OpenKeystore(keystorePath)
+		if err != nil {
+			return "", err
+		}
+		keystore, keystoreMod = ks, fi.ModTime()
+	}
+	return keystore.Get(name)
+}
+
+func register(val string) {
+	if len(val) < minMaskLen {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == val {
+			return
+		}
+	}
+	// copy on write: Mask reads the old slice without the lock
+	next := append(make([]string, 0, len(secrets)+1), secrets...)
+	next = append(next, val)
+	sort.Slice(next, func(i, j int) bool { return len(next[i]) > len(next[j]) })
+	secrets = next
+}
+
+func registered() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return secrets
+}
+
+// Mask replaces every resolved secret in s with Redacted.
+func Mask(s string) string {
+	for _, v := range registered() {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, Redacted)
+		}
+	}
+	return s
+}
+
+// MaskJSON is Mask for encoded JSON, where secrets appear JSON-escaped.
+func MaskJSON(data []byte) []byte {
+	for _, v := range registered() {
+		esc, _ := json.Marshal(v)
+		esc = esc[1 : len(esc)-1]
+		if bytes.Contains(data, esc) {
+			data = bytes.ReplaceAll(data, esc, []byte(Redacted))
+		}
+	}
+	return data
+}
@@ -0,0 +1,159 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveLiteral(t *testing.T) {
+	got, err := Resolve("plain-value")
+	if err != nil || got != "plain-value" {
+		t.Fatalf("Resolve literal = %q, %v", got, err)
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pass")
+	if err := os.WriteFile(path, []byte("from-file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Resolve("file:" + path)
+	if err != nil || got != "from-file-secret" {
+		t.Fatalf("Resolve file = %q, %v", got, err)
+	}
+
+	if _, err := Resolve("file:" + path + ".missing"); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestResolveExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs echo")
+	}
+	got, err := Resolve("exec:echo from-exec-secret")
+	if err != nil || got != "from-exec-secret" {
+		t.Fatalf("Resolve exec = %q, %v", got, err)
+	}
+
+	if _, err := Resolve("exec:false"); err == nil {
+		t.Fatal("expected error for failing command")
+	}
+}
+
+func TestResolveKeystore(t *testing.T) {
+	t.Setenv(PasswordEnv, "")
+	path := KeystorePath(t.TempDir())
+	SetKeystore(path)
+	defer SetKeystore("")
+
+	if _, err := Resolve("keystore:redis"); err == nil {
+		t.Fatal("expected error without keystore file")
+	}
+
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("redis", "from-keystore-secret")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Resolve("keystore:redis")
+	if err != nil || got != "from-keystore-secret" {
+		t.Fatalf("Resolve keystore = %q, %v", got, err)
+	}
+	if _, err := Resolve("keystore:nope"); err == nil {
+		t.Fatal("expected error for unknown name")
+	}
+}
+
+func TestKeystorePassword(t *testing.T) {
+	path := KeystorePath(t.TempDir())
+
+	t.Setenv(PasswordEnv, "correct horse")
+	ks, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("token", "abc123")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".key"); !os.IsNotExist(err) {
+		t.Fatal("password protected keystore must not write a key file")
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "abc123") {
+		t.Fatal("keystore holds the plaintext")
+	}
+
+	ks, err = OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ks.Get("token"); err != nil || v != "abc123" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+
+	t.Setenv(PasswordEnv, "wrong")
+	ks, err = OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("token"); err == nil {
+		t.Fatal("expected error with wrong password")
+	}
+
+	t.Setenv(PasswordEnv, "")
+	if _, err := OpenKeystore(path); err == nil {
+		t.Fatal("expected error without password")
+	}
+}
+
+func TestKeystoreNameIsAuthenticated(t *testing.T) {
+	t.Setenv(PasswordEnv, "")
+	ks, err := OpenKeystore(KeystorePath(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("a", "value-a")
+	ks.file.Entries["b"] = ks.file.Entries["a"]
+	if _, err := ks.Get("b"); err == nil {
+		t.Fatal("an entry copied under another name must not decrypt")
+	}
+}
+
+func TestMask(t *testing.T) {
+	dir := t.TempDir()
+	writeSecret := func(name, val string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(val), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return "file:" + path
+	}
+	if _, err := Resolve(writeSecret("long", `mask"me\secret`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(writeSecret("short", "abc")); err != nil { // too short to mask
+		t.Fatal(err)
+	}
+	if _, err := Resolve("failed"); err != nil { // literal, not a secret reference
+		t.Fatal(err)
+	}
+
+	got := Mask(`auth with mask"me\secret failed, code abc`)
+	if got != "auth with "+Redacted+" failed, code abc" {
+		t.Fatalf("Mask = %q", got)
+	}
+
+	got = string(MaskJSON([]byte(`{"result":"password mask\"me\\secret"}`)))
+	if got != `{"result":"password `+Redacted+`"}` {
+		t.Fatalf("MaskJSON = %q", got)
+	}
+}
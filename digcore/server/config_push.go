@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/cprobe/catpaw/digcore/logger"
+)
+
+// ConfigApplier applies plugin configs pushed by the Server. Implemented by
+// the agent, which loads, persists and reports them.
+type ConfigApplier interface {
+	// ApplyRemoteConfigs applies configs and returns one result per config
+	// (plus one per remote plugin removed because a full push omitted it).
+	ApplyRemoteConfigs(configs []RemotePluginConfig, full bool) []RemoteConfigResult
+	// RemoteConfigDigests returns the digests of the remote configs in use,
+	// reported on register so the Server only pushes what differs.
+	RemoteConfigDigests() map[string]string
+}
+
+var configApplier ConfigApplier
+
+// SetConfigApplier sets the applier of config_push messages. Without one,
+// as when [server] allow_config_push is off, every pushed config is rejected.
+func SetConfigApplier(a ConfigApplier) {
+	configApplier = a
+}
+
+func (c *Conn) handleConfigPush(msg *Message) {
+	var payload configPushPayload
+	if err := msg.decodePayload(&payload); err != nil {
+		c.sendACK(msg.ID, false, "invalid config_push payload: "+err.Error())
+		return
+	}
+
+	logger.Logger.Infow("config_push_received",
+		"agent_id", c.agentID,
+		"configs", len(payload.Configs),
+		"full", payload.Full,
+	)
+
+	applier := configApplier
+	if applier == nil {
+		results := make([]RemoteConfigResult, 0, len(payload.Configs))
+		for _, pc := range payload.Configs {
+			results = append(results, RemoteConfigResult{
+				Name: pc.Name, Digest: pc.Digest, Error: "remote config is disabled on this agent ([server] allow_config_push)",
+			})
+		}
+		c.sendConfigResult(msg.ID, results)
+		return
+	}
+
+	// plugin init may block; keep the read loop going
+	go func() {
+		c.sendConfigResult(msg.ID, applier.ApplyRemoteConfigs(payload.Configs, payload.Full))
+	}()
+}
+
+func (c *Conn) sendConfigResult(refID string, results []RemoteConfigResult) {
+	msg, err := newMessage(typeConfigResult, configResultPayload{Results: results})
+	if err != nil {
+		logger.Logger.Errorw("config_result_marshal_fail", "agent_id", c.agentID, "error", err)
+		return
+	}
+	msg.RefID = refID
+	data, _ := json.Marshal(msg)
+	select {
+	case c.sendCh <- data:
+	case <-c.done:
+		logger.Logger.Warnw("config_result_dropped", "agent_id", c.agentID, "ref_id", refID)
+	}
+}
+
+func remoteConfigDigests() map[string]string {
+	if configApplier == nil {
+		return nil
+	}
+	return configApplier.RemoteConfigDigests()
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type fakeApplier struct {
+	got  []RemotePluginConfig
+	full bool
+}
+
+func (f *fakeApplier) ApplyRemoteConfigs(configs []RemotePluginConfig, full bool) []RemoteConfigResult {
+	f.got, f.full = configs, full
+	ret := make([]RemoteConfigResult, 0, len(configs))
+	for _, c := range configs {
+		ret = append(ret, RemoteConfigResult{Name: c.Name, Digest: c.Digest, OK: true})
+	}
+	return ret
+}
+
+func (f *fakeApplier) RemoteConfigDigests() map[string]string {
+	return map[string]string{"ping": "abc"}
+}
+
+func recvConfigResult(t *testing.T, c *Conn) (*Message, configResultPayload) {
+	t.Helper()
+	var data []byte
+	select {
+	case data = <-c.sendCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no config_result sent")
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	var payload configResultPayload
+	if err := msg.decodePayload(&payload); err != nil {
+		t.Fatal(err)
+	}
+	return &msg, payload
+}
+
+func TestHandleConfigPush(t *testing.T) {
+	f := &fakeApplier{}
+	SetConfigApplier(f)
+	defer SetConfigApplier(nil)
+
+	c := &Conn{sendCh: make(chan []byte, 1), done: make(chan struct{})}
+	push, err := newMessage(typeConfigPush, configPushPayload{
+		Configs: []RemotePluginConfig{{Name: "ping", Digest: "abc", Content: "[[instances]]"}},
+		Full:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handleServerMessage(context.Background(), push)
+
+	msg, payload := recvConfigResult(t, c)
+	if msg.Type != typeConfigResult || msg.RefID != push.ID {
+		t.Fatalf("got type %q ref %q, want %q ref %q", msg.Type, msg.RefID, typeConfigResult, push.ID)
+	}
+	if len(payload.Results) != 1 || !payload.Results[0].OK || payload.Results[0].Name != "ping" {
+		t.Fatalf("unexpected results: %+v", payload.Results)
+	}
+	if !f.full || len(f.got) != 1 || f.got[0].Content != "[[instances]]" {
+		t.Fatalf("applier got full=%v configs=%+v", f.full, f.got)
+	}
+	if d := remoteConfigDigests(); d["ping"] != "abc" {
+		t.Fatalf("remoteConfigDigests() = %v", d)
+	}
+}
+
+func TestHandleConfigPush_NoApplier(t *testing.T) {
+	SetConfigApplier(nil)
+
+	c := &Conn{sendCh: make(chan []byte, 1), done: make(chan struct{})}
+	push, _ := newMessage(typeConfigPush, configPushPayload{
+		Configs: []RemotePluginConfig{{Name: "ping", Digest: "abc"}, {Name: "dns", Delete: true}},
+	})
+	c.handleConfigPush(push)
+
+	_, payload := recvConfigResult(t, c)
+	if len(payload.Results) != 2 {
+		t.Fatalf("want 2 results, got %+v", payload.Results)
+	}
+	for _, r := range payload.Results {
+		if r.OK || r.Error == "" {
+			t.Fatalf("want rejection, got %+v", r)
+		}
+	}
+	if d := remoteConfigDigests(); d != nil {
+		t.Fatalf("remoteConfigDigests() = %v, want nil", d)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -32,6 +33,21 @@ const (
 	alertFlushBatch    = 100
 )
 
+// disconnectedSince is when the agent last lost (or started without) a
+// registered connection, in unix nanoseconds; 0 while connected.
+var disconnectedSince atomic.Int64
+
+// DisconnectedSince returns since when the agent has had no registered
+// connection to catpaw-server. ok is false while connected or when the
+// server is not in use.
+func DisconnectedSince() (since time.Time, ok bool) {
+	ns := disconnectedSince.Load()
+	if ns == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
 // alertRing is the package-level ring buffer shared across connection attempts.
 // Events survive disconnects and are flushed after reconnection.
 var alertRing *RingBuffer
@@ -53,6 +69,15 @@ func SendAlertEvent(event *types.Event) {
 	alertRing.Push(event)
 }
 
+// SendAlertEvents enqueues a group of alert events under one lock so no other
+// event is interleaved. The same ownership rule as SendAlertEvent applies.
+func SendAlertEvents(events []*types.Event) {
+	if alertRing == nil {
+		return
+	}
+	alertRing.PushAll(events)
+}
+
 // Conn manages one WebSocket connection to catpaw-server.
 type Conn struct {
 	cfg           config.ServerConfig
@@ -169,6 +194,7 @@ func Run(ctx context.Context, startTime time.Time, plugins []string, agentVersio
 	}
 
 	logger.Logger.Infow("server_registered", "agent_id", agentID)
+	disconnectedSince.Store(0)
 
 	connCtx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
@@ -188,6 +214,7 @@ func Run(ctx context.Context, startTime time.Time, plugins []string, agentVersio
 	wg.Wait()
 
 	ws.Close(websocket.StatusNormalClosure, "")
+	disconnectedSince.Store(time.Now().UnixNano())
 	logger.Logger.Infow("server_disconnected", "agent_id", agentID)
 
 	if c.retryAfterSec > 0 {
@@ -214,6 +241,9 @@ func RunForever(ctx context.Context, startTime time.Time, plugins []string, agen
 	)
 	backoff := normalMin
 
+	disconnectedSince.Store(time.Now().UnixNano())
+	defer disconnectedSince.Store(0)
+
 	for {
 		err := Run(ctx, startTime, plugins, agentVersion)
 		if ctx.Err() != nil {
@@ -284,6 +314,9 @@ func (c *Conn) handleServerMessage(ctx context.Context, msg *Message) {
 	case typeSessionCancel:
 		c.handleSessionCancel(msg)
 
+	case typeConfigPush:
+		c.handleConfigPush(msg)
+
 	default:
 		logger.Logger.Debugw("ws_unhandled_type", "agent_id", c.agentID, "type", msg.Type)
 	}
@@ -406,14 +439,15 @@ func (c *Conn) sendRegister(ctx context.Context) error {
 	ip := config.AgentIP()
 
 	msg, err := newMessage(typeRegister, registerPayload{
-		Hostname:     hostname,
-		IP:           ip,
-		OS:           runtime.GOOS,
-		Arch:         runtime.GOARCH,
-		Labels:       config.AgentLabels(),
-		Plugins:      c.plugins,
-		AgentVersion: c.agentVersion,
-		UptimeSec:    int64(time.Since(c.startTime).Seconds()),
+		Hostname:      hostname,
+		IP:            ip,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Labels:        config.AgentLabels(),
+		Plugins:       c.plugins,
+		AgentVersion:  c.agentVersion,
+		UptimeSec:     int64(time.Since(c.startTime).Seconds()),
+		ConfigDigests: remoteConfigDigests(),
 	})
 	if err != nil {
 		return err
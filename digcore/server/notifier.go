@@ -23,3 +23,10 @@ func (n *ServerNotifier) Forward(event *types.Event) bool {
 	SendAlertEvent(event)
 	return true
 }
+
+// ForwardBatch enqueues a group of events contiguously, so the flush loop
+// normally sends them in a single alert_events message.
+func (n *ServerNotifier) ForwardBatch(events []*types.Event) bool {
+	SendAlertEvents(events)
+	return true
+}
@@ -20,6 +20,7 @@ const (
 	typeAlertEvents   = "alert_events"
 	typeSessionOutput = "session_output"
 	typeSessionError  = "session_error"
+	typeConfigResult  = "config_result"
 )
 
 // Message types — Server -> Agent
@@ -30,6 +31,7 @@ const (
 	typeSessionStart  = "session_start"
 	typeSessionInput  = "session_input"
 	typeSessionCancel = "session_cancel"
+	typeConfigPush    = "config_push"
 )
 
 // Message is the protocol envelope for all Agent <-> Server communication.
@@ -74,6 +76,8 @@ type registerPayload struct {
 	Plugins      []string          `json:"plugins"`
 	AgentVersion string            `json:"agent_version"`
 	UptimeSec    int64             `json:"uptime_sec"`
+	// digests of the remote plugin configs the agent runs, by plugin name
+	ConfigDigests map[string]string `json:"config_digests,omitempty"`
 }
 
 type heartbeatPayload struct {
@@ -145,3 +149,35 @@ type sessionErrorPayload struct {
 	Error     string `json:"error"`
 	Code      string `json:"code"`
 }
+
+// --- Config payloads ---
+
+// configPushPayload (Server -> Agent) delivers plugin configs. With Full set
+// the list is the complete remote config set: remote plugins missing from it
+// are removed.
+type configPushPayload struct {
+	Configs []RemotePluginConfig `json:"configs"`
+	Full    bool                 `json:"full"`
+}
+
+// RemotePluginConfig is the TOML of one plugin (what conf.d/p.<name>/ would
+// hold) and its sha256 hex digest. Delete removes the plugin's remote config.
+type RemotePluginConfig struct {
+	Name    string `json:"name"`
+	Digest  string `json:"digest"`
+	Content string `json:"content,omitempty"`
+	Delete  bool   `json:"delete,omitempty"`
+}
+
+// configResultPayload (Agent -> Server) answers a config_push (RefID set to
+// its ID) with one result per plugin.
+type configResultPayload struct {
+	Results []RemoteConfigResult `json:"results"`
+}
+
+type RemoteConfigResult struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
@@ -39,6 +39,19 @@ func (r *RingBuffer) Push(event *types.Event) {
 	r.mu.Unlock()
 }
 
+// PushAll adds events in order, overwriting the oldest ones when full.
+func (r *RingBuffer) PushAll(events []*types.Event) {
+	r.mu.Lock()
+	for _, event := range events {
+		r.buf[r.head] = event
+		r.head = (r.head + 1) % r.cap
+		if r.count < r.cap {
+			r.count++
+		}
+	}
+	r.mu.Unlock()
+}
+
 // Drain removes and returns up to maxItems events from the buffer in FIFO order.
 // Returns nil if the buffer is empty.
 func (r *RingBuffer) Drain(maxItems int) []*types.Event {
@@ -0,0 +1,105 @@
+package silence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CLIAdd stores a new silence and prints its ID.
+func CLIAdd(stateDir string, s *Silence) error {
+	st := NewStore(StatePath(stateDir))
+	if err := st.Load(); err != nil {
+		return err
+	}
+	if err := st.Add(s); err != nil {
+		return err
+	}
+	if err := st.Save(); err != nil {
+		return fmt.Errorf("save silences: %w", err)
+	}
+	fmt.Printf("Silence %s created (%s).\n", s.ID, describeWindow(s))
+	return nil
+}
+
+// CLIExpire ends a silence immediately.
+func CLIExpire(stateDir, id string) error {
+	st := NewStore(StatePath(stateDir))
+	if err := st.Load(); err != nil {
+		return err
+	}
+	s, err := st.Expire(id)
+	if err != nil {
+		return err
+	}
+	if err := st.Save(); err != nil {
+		return fmt.Errorf("save silences: %w", err)
+	}
+	fmt.Printf("Silence %s expired.\n", s.ID)
+	return nil
+}
+
+// CLIList prints all known silences.
+func CLIList(stateDir string) error {
+	st := NewStore(StatePath(stateDir))
+	if err := st.Load(); err != nil {
+		return err
+	}
+	list := st.List()
+	if len(list) == 0 {
+		fmt.Println("No silences found.")
+		return nil
+	}
+
+	now := time.Now()
+	fmt.Printf("%-10s  %-8s  %-40s  %-40s  %s\n", "ID", "State", "Matchers", "Window", "Comment")
+	fmt.Println(strings.Repeat("-", 120))
+	for _, s := range list {
+		fmt.Printf("%-10s  %-8s  %-40s  %-40s  %s\n",
+			s.ID, s.State(now), formatMatchers(s.Matchers), describeWindow(s), s.Comment)
+	}
+	fmt.Printf("\nTotal: %d silences\n", len(list))
+	return nil
+}
+
+func formatMatchers(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+m[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+func describeWindow(s *Silence) string {
+	var sb strings.Builder
+	if s.Cron != "" {
+		fmt.Fprintf(&sb, "cron %q for %s", s.Cron, s.Duration)
+		if s.Timezone != "" {
+			fmt.Fprintf(&sb, " %s", s.Timezone)
+		}
+		if s.EndsAt > 0 {
+			fmt.Fprintf(&sb, " until %s", time.Unix(s.EndsAt, 0).Format(time.DateTime))
+		}
+		return sb.String()
+	}
+	return time.Unix(s.StartsAt, 0).Format(time.DateTime) + " ~ " + time.Unix(s.EndsAt, 0).Format(time.DateTime)
+}
+
+// ParseTime accepts RFC3339 or "YYYY-MM-DD HH:MM[:SS]" in local time.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC3339 or \"YYYY-MM-DD HH:MM\")", s)
+}
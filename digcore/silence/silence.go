@@ -0,0 +1,359 @@
+// Package silence mutes alert notifications during planned maintenance.
+//
+// Silences are stored in state.d/silences.json. The `catpaw silence` CLI
+// writes that file; the running agent only reads it and picks up changes
+// automatically. A silence matches events by label patterns (pkg/filter
+// syntax: glob or /regex/) and is either a one-off window [starts_at, ends_at)
+// or a recurring window that opens on each cron fire time for `duration`.
+package silence
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/cron"
+	"github.com/cprobe/catpaw/digcore/pkg/filter"
+	"github.com/google/uuid"
+)
+
+const (
+	stateFile = "silences.json"
+
+	// reloadCheckInterval bounds how often IsSilenced stats the state file.
+	reloadCheckInterval = 5 * time.Second
+
+	// expiredRetention keeps expired silences visible in `silence list`
+	// for a while before they are garbage-collected on the next write.
+	expiredRetention = 24 * time.Hour
+)
+
+// Silence is one maintenance window.
+type Silence struct {
+	ID        string            `json:"id"`
+	Matchers  map[string]string `json:"matchers"`
+	StartsAt  int64             `json:"starts_at"`
+	EndsAt    int64             `json:"ends_at,omitempty"` // 0: no end (recurring only)
+	Cron      string            `json:"cron,omitempty"`
+	Duration  string            `json:"duration,omitempty"` // window length for cron
+	Timezone  string            `json:"timezone,omitempty"` // for cron, default local
+	Comment   string            `json:"comment,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"`
+	CreatedAt int64             `json:"created_at"`
+
+	matchers map[string]filter.Filter
+	schedule *cron.Schedule
+	window   time.Duration
+	loc      *time.Location
+}
+
+// Compile validates the silence and prepares its matchers.
+func (s *Silence) Compile() error {
+	if len(s.Matchers) == 0 {
+		return fmt.Errorf("at least one matcher is required")
+	}
+	s.matchers = make(map[string]filter.Filter, len(s.Matchers))
+	for k, p := range s.Matchers {
+		f, err := filter.Compile([]string{p})
+		if err != nil {
+			return fmt.Errorf("matcher %s: %w", k, err)
+		}
+		s.matchers[k] = f
+	}
+
+	if s.Cron == "" {
+		if s.EndsAt == 0 {
+			return fmt.Errorf("ends_at is required for a one-off silence")
+		}
+		return nil
+	}
+
+	sched, err := cron.Parse(s.Cron)
+	if err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(s.Duration)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("recurring silence needs a positive duration, got %q", s.Duration)
+	}
+	loc := time.Local
+	if s.Timezone != "" {
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	s.schedule, s.window, s.loc = sched, d, loc
+	return nil
+}
+
+// Matches reports whether every matcher matches the given labels.
+func (s *Silence) Matches(labels map[string]string) bool {
+	for k, f := range s.matchers {
+		if !f.Match(labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveAt reports whether the silence mutes alerts at t.
+func (s *Silence) ActiveAt(t time.Time) bool {
+	if t.Unix() < s.StartsAt {
+		return false
+	}
+	if s.EndsAt > 0 && t.Unix() >= s.EndsAt {
+		return false
+	}
+	if s.schedule == nil {
+		return true
+	}
+	return s.schedule.ActiveWithin(t.In(s.loc), s.window)
+}
+
+// Expired reports whether the silence can never be active again after t.
+func (s *Silence) Expired(t time.Time) bool {
+	return s.EndsAt > 0 && t.Unix() >= s.EndsAt
+}
+
+// State describes the silence at t: "active", "pending" or "expired".
+func (s *Silence) State(t time.Time) string {
+	switch {
+	case s.Expired(t):
+		return "expired"
+	case s.ActiveAt(t):
+		return "active"
+	default:
+		return "pending"
+	}
+}
+
+// Store holds silences backed by a JSON file.
+type Store struct {
+	path string
+
+	mu        sync.RWMutex
+	silences  []*Silence
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewStore returns a store for path; call Load to read it.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// StatePath returns stateDir/silences.json.
+func StatePath(stateDir string) string {
+	return filepath.Join(stateDir, stateFile)
+}
+
+// Load (re)reads the file. A missing file yields an empty store. Invalid
+// entries are skipped with a warning so one bad silence cannot disable all.
+func (st *Store) Load() error {
+	info, err := os.Stat(st.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			st.mu.Lock()
+			st.silences, st.modTime = nil, time.Time{}
+			st.mu.Unlock()
+			return nil
+		}
+		return err
+	}
+
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		return err
+	}
+	var list []*Silence
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("parse %s: %w", st.path, err)
+		}
+	}
+
+	valid := list[:0]
+	for _, s := range list {
+		if err := s.Compile(); err != nil {
+			if logger.Logger != nil {
+				logger.Logger.Warnw("invalid silence skipped", "id", s.ID, "error", err)
+			}
+			continue
+		}
+		valid = append(valid, s)
+	}
+
+	st.mu.Lock()
+	st.silences, st.modTime = valid, info.ModTime()
+	st.mu.Unlock()
+	return nil
+}
+
+// Save writes all silences, dropping those expired for longer than a day.
+func (st *Store) Save() error {
+	now := time.Now()
+	st.mu.Lock()
+	kept := st.silences[:0]
+	for _, s := range st.silences {
+		if s.Expired(now.Add(-expiredRetention)) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	st.silences = kept
+	data, err := json.MarshalIndent(kept, "", "  ")
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(st.path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, st.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Add validates s, assigns an ID if needed and appends it.
+func (st *Store) Add(s *Silence) error {
+	if s.ID == "" {
+		s.ID = uuid.NewString()[:8]
+	}
+	if s.CreatedAt == 0 {
+		s.CreatedAt = time.Now().Unix()
+	}
+	if s.StartsAt == 0 {
+		s.StartsAt = s.CreatedAt
+	}
+	if err := s.Compile(); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, old := range st.silences {
+		if old.ID == s.ID {
+			return fmt.Errorf("silence %s already exists", s.ID)
+		}
+	}
+	st.silences = append(st.silences, s)
+	return nil
+}
+
+// Expire ends the silence with the given ID (or unique ID prefix) now.
+func (st *Store) Expire(id string) (*Silence, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var found *Silence
+	for _, s := range st.silences {
+		if s.ID == id || (len(id) >= 4 && len(s.ID) > len(id) && s.ID[:len(id)] == id) {
+			if found != nil {
+				return nil, fmt.Errorf("silence id %q is ambiguous", id)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("silence %q not found", id)
+	}
+	now := time.Now().Unix()
+	if found.EndsAt == 0 || found.EndsAt > now {
+		found.EndsAt = now
+	}
+	return found, nil
+}
+
+// List returns all silences sorted by creation time.
+func (st *Store) List() []*Silence {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ret := append([]*Silence(nil), st.silences...)
+	sort.Slice(ret, func(i, j int) bool { return ret[i].CreatedAt < ret[j].CreatedAt })
+	return ret
+}
+
+// Match returns the first silence active at t that matches labels.
+func (st *Store) Match(labels map[string]string, t time.Time) *Silence {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	for _, s := range st.silences {
+		if s.ActiveAt(t) && s.Matches(labels) {
+			return s
+		}
+	}
+	return nil
+}
+
+// reloadIfChanged re-reads the file when its mtime changed, at most once
+// every reloadCheckInterval.
+func (st *Store) reloadIfChanged(now time.Time) {
+	st.mu.Lock()
+	if now.Sub(st.lastCheck) < reloadCheckInterval {
+		st.mu.Unlock()
+		return
+	}
+	st.lastCheck = now
+	modTime := st.modTime
+	st.mu.Unlock()
+
+	info, err := os.Stat(st.path)
+	switch {
+	case err != nil && os.IsNotExist(err):
+		if modTime.IsZero() {
+			return
+		}
+	case err != nil:
+		return
+	case info.ModTime().Equal(modTime):
+		return
+	}
+
+	if err := st.Load(); err != nil {
+		logger.Logger.Warnw("reload silences fail", "path", st.path, "error", err)
+		return
+	}
+	logger.Logger.Infow("silences reloaded", "path", st.path, "count", len(st.List()))
+}
+
+var (
+	globalMu    sync.RWMutex
+	globalStore *Store
+)
+
+// Init loads state.d/silences.json for the running agent.
+func Init(stateDir string) {
+	st := NewStore(StatePath(stateDir))
+	if err := st.Load(); err != nil {
+		logger.Logger.Warnw("load silences fail", "path", st.path, "error", err)
+	}
+	st.lastCheck = time.Now()
+
+	globalMu.Lock()
+	globalStore = st
+	globalMu.Unlock()
+}
+
+// IsSilenced returns the active silence matching labels, or nil.
+func IsSilenced(labels map[string]string) *Silence {
+	globalMu.RLock()
+	st := globalStore
+	globalMu.RUnlock()
+	if st == nil {
+		return nil
+	}
+	now := time.Now()
+	st.reloadIfChanged(now)
+	return st.Match(labels, now)
+}
@@ -0,0 +1,141 @@
+package silence
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/logger"
+	"go.uber.org/zap"
+)
+
+func init() {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop().Sugar()
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s := &Silence{
+		Matchers: map[string]string{"from_plugin": "redis", "target": "10.0.0.*"},
+		EndsAt:   time.Now().Add(time.Hour).Unix(),
+	}
+	if err := s.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Matches(map[string]string{"from_plugin": "redis", "target": "10.0.0.1:6379"}) {
+		t.Fatal("expected match")
+	}
+	if s.Matches(map[string]string{"from_plugin": "redis", "target": "10.0.1.1:6379"}) {
+		t.Fatal("target should not match")
+	}
+	if s.Matches(map[string]string{"target": "10.0.0.1:6379"}) {
+		t.Fatal("missing label should not match")
+	}
+}
+
+func TestOneOffWindow(t *testing.T) {
+	now := time.Now()
+	s := &Silence{
+		Matchers: map[string]string{"check": "disk::*"},
+		StartsAt: now.Unix(),
+		EndsAt:   now.Add(time.Hour).Unix(),
+	}
+	if err := s.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ActiveAt(now.Add(-time.Minute)) {
+		t.Fatal("should not be active before start")
+	}
+	if !s.ActiveAt(now.Add(30 * time.Minute)) {
+		t.Fatal("should be active inside window")
+	}
+	if s.ActiveAt(now.Add(time.Hour)) {
+		t.Fatal("should not be active at end")
+	}
+	if got := s.State(now.Add(2 * time.Hour)); got != "expired" {
+		t.Fatalf("State = %s, want expired", got)
+	}
+}
+
+func TestCronWindow(t *testing.T) {
+	s := &Silence{
+		Matchers: map[string]string{"from_plugin": "disk"},
+		Cron:     "0 2 * * sat",
+		Duration: "3h",
+		Timezone: "UTC",
+	}
+	if err := s.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	sat := time.Date(2026, 3, 14, 3, 30, 0, 0, time.UTC)
+	if !s.ActiveAt(sat) {
+		t.Fatal("should be active on Saturday 03:30")
+	}
+	if s.ActiveAt(sat.Add(2 * time.Hour)) {
+		t.Fatal("should be closed after the 3h window")
+	}
+	if s.ActiveAt(sat.AddDate(0, 0, 1)) {
+		t.Fatal("should not be active on Sunday")
+	}
+	if got := s.State(sat.Add(2 * time.Hour)); got != "pending" {
+		t.Fatalf("State = %s, want pending", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for name, s := range map[string]*Silence{
+		"no matchers":  {EndsAt: 1},
+		"no end":       {Matchers: map[string]string{"a": "b"}},
+		"bad cron":     {Matchers: map[string]string{"a": "b"}, Cron: "* *", Duration: "1h"},
+		"no duration":  {Matchers: map[string]string{"a": "b"}, Cron: "@daily"},
+		"bad timezone": {Matchers: map[string]string{"a": "b"}, Cron: "@daily", Duration: "1h", Timezone: "Nowhere/City"},
+	} {
+		if err := s.Compile(); err == nil {
+			t.Errorf("%s: Compile should fail", name)
+		}
+	}
+}
+
+func TestStoreRoundTripAndExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.d", stateFile)
+	st := NewStore(path)
+	if err := st.Load(); err != nil {
+		t.Fatalf("Load missing file: %v", err)
+	}
+
+	s := &Silence{
+		Matchers: map[string]string{"from_plugin": "redis"},
+		EndsAt:   time.Now().Add(time.Hour).Unix(),
+		Comment:  "upgrade",
+	}
+	if err := st.Add(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewStore(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"from_plugin": "redis"}
+	got := loaded.Match(labels, time.Now())
+	if got == nil || got.ID != s.ID || got.Comment != "upgrade" {
+		t.Fatalf("Match = %+v, want silence %s", got, s.ID)
+	}
+
+	if _, err := loaded.Expire(s.ID[:4]); err != nil {
+		t.Fatalf("Expire by prefix: %v", err)
+	}
+	if loaded.Match(labels, time.Now().Add(time.Second)) != nil {
+		t.Fatal("expired silence should not match")
+	}
+	if _, err := loaded.Expire("zzzz"); err == nil {
+		t.Fatal("Expire unknown id should fail")
+	}
+}
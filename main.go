@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/cprobe/catpaw/agent"
 	"github.com/cprobe/catpaw/chat"
@@ -13,6 +14,8 @@ import (
 	"github.com/cprobe/catpaw/digcore/diagnose"
 	"github.com/cprobe/catpaw/digcore/logger"
 	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/secret"
+	"github.com/cprobe/catpaw/digcore/silence"
 	"github.com/toolkits/pkg/runner"
 )
 
@@ -71,6 +74,18 @@ func handleSubcommand(args []string) bool {
 	case "selftest":
 		handleSelftestSubcommand(args)
 		return true
+	case "silence":
+		handleSilenceSubcommand(args)
+		return true
+	case "secret":
+		handleSecretSubcommand(args)
+		return true
+	case "check-config":
+		handleCheckConfigSubcommand(args)
+		return true
+	case "test":
+		handleTestSubcommand(args)
+		return true
 	default:
 		return false
 	}
@@ -130,6 +145,160 @@ func handleDiagnoseSubcommand(args []string) {
 	}
 }
 
+// stringList collects repeated string flags.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func handleSilenceSubcommand(args []string) {
+	stateDir := filepath.Join(filepath.Dir(*configDir), "state.d")
+
+	if len(args) < 2 {
+		printSilenceUsage()
+		return
+	}
+
+	var err error
+	switch args[1] {
+	case "list":
+		err = silence.CLIList(stateDir)
+	case "add":
+		var s *silence.Silence
+		if s, err = parseSilenceAddFlags(args[2:]); err == nil {
+			err = silence.CLIAdd(stateDir, s)
+		}
+	case "expire":
+		if len(args) < 3 {
+			fmt.Fprintf(os.Stderr, "Usage: catpaw silence expire <id>\n")
+			os.Exit(1)
+		}
+		err = silence.CLIExpire(stateDir, args[2])
+	default:
+		printSilenceUsage()
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleSecretSubcommand(args []string) {
+	stateDir := filepath.Join(filepath.Dir(*configDir), "state.d")
+
+	if len(args) < 2 {
+		printSecretUsage()
+		return
+	}
+
+	var err error
+	switch args[1] {
+	case "list":
+		err = secret.CLIList(stateDir)
+	case "set":
+		if len(args) < 3 {
+			fmt.Fprintf(os.Stderr, "Usage: catpaw secret set <name> [value]\n")
+			os.Exit(1)
+		}
+		if len(args) >= 4 {
+			err = secret.CLISet(stateDir, args[2], args[3], false)
+		} else {
+			err = secret.CLISet(stateDir, args[2], "", true)
+		}
+	case "get":
+		if len(args) < 3 {
+			fmt.Fprintf(os.Stderr, "Usage: catpaw secret get <name>\n")
+			os.Exit(1)
+		}
+		err = secret.CLIGet(stateDir, args[2])
+	case "delete":
+		if len(args) < 3 {
+			fmt.Fprintf(os.Stderr, "Usage: catpaw secret delete <name>\n")
+			os.Exit(1)
+		}
+		err = secret.CLIDelete(stateDir, args[2])
+	default:
+		printSecretUsage()
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func parseSilenceAddFlags(args []string) (*silence.Silence, error) {
+	fs := flag.NewFlagSet("silence add", flag.ExitOnError)
+	var matchers stringList
+	fs.Var(&matchers, "m", "Label matcher key=pattern (repeatable)")
+	fs.Var(&matchers, "match", "Label matcher key=pattern (repeatable)")
+	duration := fs.String("duration", "", "Silence length, or window length with --cron (e.g. 2h)")
+	start := fs.String("start", "", "Start time (default now)")
+	end := fs.String("end", "", "End time (alternative to --duration for one-off silences)")
+	cronExpr := fs.String("cron", "", "Recurring window start as a 5-field cron expression")
+	tz := fs.String("tz", "", "Timezone for --cron (default local)")
+	comment := fs.String("comment", "", "Reason for the silence")
+	author := fs.String("author", os.Getenv("USER"), "Who created the silence")
+	fs.Usage = printSilenceUsage
+	fs.Parse(args)
+
+	s := &silence.Silence{
+		Matchers:  make(map[string]string, len(matchers)),
+		Cron:      *cronExpr,
+		Timezone:  *tz,
+		Comment:   *comment,
+		CreatedBy: *author,
+	}
+	for _, m := range matchers {
+		k, v, ok := strings.Cut(m, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid matcher %q, want key=pattern", m)
+		}
+		s.Matchers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	startAt := time.Now()
+	if *start != "" {
+		t, err := silence.ParseTime(*start)
+		if err != nil {
+			return nil, err
+		}
+		startAt = t
+	}
+	s.StartsAt = startAt.Unix()
+
+	if *end != "" {
+		t, err := silence.ParseTime(*end)
+		if err != nil {
+			return nil, err
+		}
+		s.EndsAt = t.Unix()
+	}
+
+	if s.Cron != "" {
+		s.Duration = *duration
+		return s, nil
+	}
+
+	if *duration != "" {
+		d, err := time.ParseDuration(*duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid --duration %q", *duration)
+		}
+		s.EndsAt = startAt.Add(d).Unix()
+	}
+	if s.EndsAt == 0 {
+		return nil, fmt.Errorf("--duration or --end is required")
+	}
+	if s.EndsAt <= s.StartsAt {
+		return nil, fmt.Errorf("end must be after start")
+	}
+	return s, nil
+}
+
 func handleChatSubcommand(args []string) {
 	fs := flag.NewFlagSet("chat", flag.ExitOnError)
 	verbose := fs.Bool("v", false, "Verbose: show tool output summaries")
@@ -179,6 +348,51 @@ func handleInspectSubcommand(args []string) {
 	}
 }
 
+func handleCheckConfigSubcommand(args []string) {
+	if err := config.InitConfig(*configDir, 0, "", *loglevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	closefn := logger.Build()
+	defer closefn()
+
+	if err := agent.RunCheckConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleTestSubcommand(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	format := fs.String("format", "table", "Output format: table, text or json")
+	fs.Usage = printTestUsage
+	fs.Parse(args[1:])
+
+	// allow flags after the plugin name: catpaw test cpu --format json
+	pluginName := fs.Arg(0)
+	if pluginName == "" {
+		printTestUsage()
+		os.Exit(3)
+	}
+	fs.Parse(fs.Args()[1:])
+
+	if err := config.InitConfig(*configDir, 0, "", *loglevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(3)
+	}
+
+	closefn := logger.Build()
+
+	code, err := agent.RunOneShot(pluginName, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	// os.Exit skips deferred calls, flush the log here
+	closefn()
+	os.Exit(code)
+}
+
 func handleSelftestSubcommand(args []string) {
 	registry := diagnose.NewToolRegistry()
 	for _, creator := range plugins.PluginCreators {
@@ -214,6 +428,10 @@ Usage:
   catpaw inspect <plugin> [target]        Run health inspection on a target
   catpaw diagnose <command>               Manage diagnosis records
   catpaw selftest [filter] [-q]           Smoke-test all diagnostic tools
+  catpaw silence <command>                Manage alert silences (maintenance windows)
+  catpaw secret <command>                 Manage the encrypted secret keystore
+  catpaw check-config                     Validate config.toml and plugin configs
+  catpaw test <plugin> [--format json]    Gather a plugin once and print the events
   catpaw help [command]                   Show help for a command
 
 Global Flags:
@@ -227,6 +445,10 @@ Commands:
   inspect     Proactive health inspection (AI-powered)
   diagnose    View past diagnosis / inspection records
   selftest    Smoke-test all diagnostic tools on this machine
+  silence     Mute alert notifications during planned maintenance
+  secret      Store credentials referenced as keystore:<name>
+  check-config  Validate configuration without starting the agent
+  test        Run one plugin's checks once, without notifying
 
 Run 'catpaw help <command>' for details on a specific command.
 `, version)
@@ -244,6 +466,14 @@ func printSubcommandHelp(cmd string) {
 		printDiagnoseUsage()
 	case "selftest":
 		printSelftestUsage()
+	case "silence":
+		printSilenceUsage()
+	case "secret":
+		printSecretUsage()
+	case "check-config":
+		printCheckConfigUsage()
+	case "test":
+		printTestUsage()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %q\n\n", cmd)
 		printUsage()
@@ -346,3 +576,111 @@ Examples:
   catpaw selftest sysdiag          Test only sysdiag tools
   catpaw selftest -q               Quiet mode`)
 }
+
+func printSilenceUsage() {
+	fmt.Println(`Usage: catpaw silence <command> [flags]
+
+Mute alert notifications (and AI diagnosis) for events whose labels match,
+without editing plugin configs. Silences are stored in state.d/silences.json
+and picked up by a running agent within a few seconds. Recovery notifications
+are still sent. When a silence ends, alerts that are still firing notify
+normally on the next check.
+
+Commands:
+  list                List silences and their state (active/pending/expired)
+  add [flags]         Create a silence
+  expire <id>         End a silence now
+
+Flags for add:
+  -m, --match k=v     Label matcher, repeatable; all must match.
+                      Values support glob (redis*) and /regex/ syntax
+  --duration <d>      Silence length (e.g. 2h); with --cron, window length
+  --start <time>      Start time (default now)
+  --end <time>        End time (instead of --duration)
+  --cron <expr>       Recurring window: opens at each cron fire time
+  --tz <zone>         Timezone for --cron (e.g. Asia/Shanghai, default local)
+  --comment <text>    Reason for the silence
+  --author <name>     Creator (default $USER)
+
+Times accept RFC3339 or "YYYY-MM-DD HH:MM" (local time).
+
+Examples:
+  catpaw silence add -m from_plugin=redis -m target=10.0.0.1:6379 --duration 2h --comment "redis upgrade"
+  catpaw silence add -m check='disk::*' --cron "0 2 * * sat" --duration 3h --comment "weekly backup"
+  catpaw silence list
+  catpaw silence expire 3f2a9c1e`)
+}
+
+func printSecretUsage() {
+	fmt.Println(`Usage: catpaw secret <command>
+
+Store credentials in state.d/secrets.keystore, encrypted with AES-256-GCM.
+Reference them from any credential setting as "keystore:<name>". The same
+settings also accept "file:<path>" (file content) and "exec:<command>"
+(command stdout). Resolved secrets are masked in logs and diagnosis records.
+
+The keystore key is derived from $CATPAW_KEYSTORE_PASSWORD when it is set at
+creation (the agent then needs it too); otherwise a random key is kept in
+state.d/secrets.keystore.key.
+
+Commands:
+  list                List secret names
+  set <name> [value]  Store a secret; without value, read it from stdin
+  get <name>          Print a secret
+  delete <name>       Remove a secret
+
+Examples:
+  catpaw secret set redis_password
+  echo -n "$TOKEN" | catpaw secret set flashduty_key
+  catpaw secret list
+
+  # conf.d/p.redis/redis.toml
+  password = "keystore:redis_password"`)
+}
+
+func printCheckConfigUsage() {
+	fmt.Println(`Usage: catpaw check-config
+
+Load config.toml and every conf.d/p.<plugin> directory the way 'catpaw run'
+would, without starting any checks or sending notifications. Reports:
+
+  - TOML syntax errors and unknown keys (typos) in every file
+  - invalid durations, thresholds and other values rejected by plugin Init
+  - [ai], [notify] (webapi templates, email, routes, group) and
+    inhibit_rules errors
+
+Exit code:
+  0           Configuration is valid
+  1           One or more problems were found
+
+Examples:
+  catpaw check-config
+  catpaw --configs /etc/catpaw/conf.d check-config`)
+}
+
+func printTestUsage() {
+	fmt.Println(`Usage: catpaw test <plugin> [--format table|text|json]
+
+Load conf.d/p.<plugin>, run the checks of every instance once and print the
+events they produce as a table; text and json also show the computed alert
+key, labels and attrs. Each gather is given the instance's gather timeout.
+Nothing is notified, cached or diagnosed, so it is safe to run next to a
+running agent. Useful when writing a new plugin config.
+
+Flags:
+  --format <fmt>      Output format: table (default, one row per event), text
+                      (one block per event with alert key, labels and attrs)
+                      or json
+
+Exit code (Nagios convention):
+  0           All events Ok or Info (or no events)
+  1           Worst event is Warning
+  2           Worst event is Critical
+  3           Config or instance init error
+
+Examples:
+  catpaw test cpu
+  catpaw test http --format json
+  catpaw test disk --format text
+  catpaw --configs /etc/catpaw/conf.d test disk`)
+}
@@ -1,6 +1,7 @@
 package disk
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -47,8 +48,10 @@ type Instance struct {
 	InodeUsage InodeUsageCheck `toml:"inode_usage"`
 	Writable   WritableCheck   `toml:"writable"`
 
-	Concurrency   int             `toml:"concurrency"`
-	GatherTimeout config.Duration `toml:"gather_timeout"`
+	Concurrency int `toml:"concurrency"`
+	// how long a gather waits for the mount point checks before it flags
+	// the unfinished ones as hung; defaults to gather_timeout, then 10s
+	MountTimeout config.Duration `toml:"mount_timeout"`
 
 	mountFilter filter.Filter
 	inFlight    sync.Map
@@ -79,8 +82,11 @@ func (ins *Instance) Init() error {
 		ins.Concurrency = 10
 	}
 
-	if ins.GatherTimeout == 0 {
-		ins.GatherTimeout = config.Duration(10 * time.Second)
+	if ins.MountTimeout == 0 {
+		ins.MountTimeout = ins.GatherTimeout
+	}
+	if ins.MountTimeout == 0 {
+		ins.MountTimeout = config.Duration(10 * time.Second)
 	}
 
 	if ins.Writable.Severity != "" && ins.Writable.TestFile == "" {
@@ -109,6 +115,14 @@ func (ins *Instance) Init() error {
 }
 
 func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	ins.GatherContext(context.Background(), q)
+}
+
+// GatherContext stops waiting for the mount point checks after mount_timeout
+// or when ctx is done, whichever comes first. A stat stuck on a dead NFS
+// mount cannot be interrupted; it is left running and reported as hung by
+// the next gather.
+func (ins *Instance) GatherContext(ctx context.Context, q *safe.Queue[*types.Event]) {
 	partitions, err := disk.Partitions(true)
 	if err != nil {
 		logger.Logger.Errorw("failed to get disk partitions", "error", err)
@@ -147,7 +161,7 @@ func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
 		return
 	}
 
-	gatherTimeout := time.Duration(ins.GatherTimeout)
+	mountTimeout := time.Duration(ins.MountTimeout)
 
 	var wg sync.WaitGroup
 	se := semaphore.NewSemaphore(ins.Concurrency)
@@ -157,7 +171,7 @@ func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
 
 		if startTime, ok := ins.inFlight.Load(mp); ok {
 			elapsed := time.Now().Unix() - startTime.(int64)
-			if elapsed > int64(gatherTimeout.Seconds()) {
+			if elapsed > int64(mountTimeout.Seconds()) {
 				q.PushFront(ins.buildHungEvent(mp, elapsed))
 			}
 			continue
@@ -191,16 +205,26 @@ func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
 
 	done := make(chan struct{})
 	go func() { wg.Wait(); close(done) }()
+	timer := time.NewTimer(mountTimeout)
+	defer timer.Stop()
 	select {
 	case <-done:
-	case <-time.After(gatherTimeout):
-		ins.inFlight.Range(func(key, value any) bool {
-			ins.prevHung.Store(key, true)
-			return true
-		})
+	case <-timer.C:
+		ins.markHung()
+	case <-ctx.Done():
+		ins.markHung()
 	}
 }
 
+// markHung remembers the mount points still being checked, so their
+// recovery is reported once they return.
+func (ins *Instance) markHung() {
+	ins.inFlight.Range(func(key, value any) bool {
+		ins.prevHung.Store(key, true)
+		return true
+	})
+}
+
 func (ins *Instance) gatherMountPoint(q *safe.Queue[*types.Event], mountPoint, device, fsType string) {
 	usage, err := disk.Usage(mountPoint)
 	if err != nil {
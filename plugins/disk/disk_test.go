@@ -0,0 +1,33 @@
+package disk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+)
+
+func TestInitMountTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		gatherTimeout time.Duration
+		mountTimeout  time.Duration
+		want          time.Duration
+	}{
+		{"default", 0, 0, 10 * time.Second},
+		{"falls back to gather_timeout", 3 * time.Second, 0, 3 * time.Second},
+		{"explicit", 3 * time.Second, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins := &Instance{MountTimeout: config.Duration(tt.mountTimeout)}
+			ins.GatherTimeout = config.Duration(tt.gatherTimeout)
+			if err := ins.Init(); err != nil {
+				t.Fatal(err)
+			}
+			if got := time.Duration(ins.MountTimeout); got != tt.want {
+				t.Errorf("MountTimeout = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
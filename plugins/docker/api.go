@@ -112,8 +112,18 @@ func (ins *Instance) apiURL(path string) string {
 	return fmt.Sprintf("%s/v%s%s", ins.baseURL, ins.apiVersion, path)
 }
 
-func (ins *Instance) negotiateAPIVersion() {
-	resp, err := ins.httpClient.Get(ins.baseURL + "/version")
+// get issues a GET bound to ctx, so an abandoned gather does not leave the
+// request hanging on a stuck socket.
+func (ins *Instance) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ins.httpClient.Do(req)
+}
+
+func (ins *Instance) negotiateAPIVersion(ctx context.Context) {
+	resp, err := ins.get(ctx, ins.baseURL+"/version")
 	if err != nil {
 		ins.apiVersion = "1.25"
 		return
@@ -135,8 +145,8 @@ func (ins *Instance) negotiateAPIVersion() {
 	ins.apiVersion = ver.APIVersion
 }
 
-func (ins *Instance) listContainers() ([]containerListEntry, error) {
-	resp, err := ins.httpClient.Get(ins.apiURL("/containers/json?all=true"))
+func (ins *Instance) listContainers(ctx context.Context) ([]containerListEntry, error) {
+	resp, err := ins.get(ctx, ins.apiURL("/containers/json?all=true"))
 	if err != nil {
 		return nil, err
 	}
@@ -154,8 +164,8 @@ func (ins *Instance) listContainers() ([]containerListEntry, error) {
 	return containers, nil
 }
 
-func (ins *Instance) inspectContainer(id string) (*containerInspect, error) {
-	resp, err := ins.httpClient.Get(ins.apiURL("/containers/" + id + "/json"))
+func (ins *Instance) inspectContainer(ctx context.Context, id string) (*containerInspect, error) {
+	resp, err := ins.get(ctx, ins.apiURL("/containers/"+id+"/json"))
 	if err != nil {
 		return nil, err
 	}
@@ -173,8 +183,8 @@ func (ins *Instance) inspectContainer(id string) (*containerInspect, error) {
 	return &detail, nil
 }
 
-func (ins *Instance) getContainerStats(id string) (*containerStats, error) {
-	resp, err := ins.httpClient.Get(ins.apiURL("/containers/" + id + "/stats?stream=false"))
+func (ins *Instance) getContainerStats(ctx context.Context, id string) (*containerStats, error) {
+	resp, err := ins.get(ctx, ins.apiURL("/containers/"+id+"/stats?stream=false"))
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -173,16 +174,22 @@ func (ins *Instance) Init() error {
 }
 
 func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	ins.GatherContext(context.Background(), q)
+}
+
+// GatherContext aborts the Docker API requests in flight when ctx is done,
+// e.g. when the agent's gather timeout expires on a stuck socket.
+func (ins *Instance) GatherContext(ctx context.Context, q *safe.Queue[*types.Event]) {
 	if len(ins.Targets) == 0 {
 		return
 	}
 
 	// Negotiate API version on first Gather if not configured
 	if ins.apiVersion == "" {
-		ins.negotiateAPIVersion()
+		ins.negotiateAPIVersion(ctx)
 	}
 
-	containers, err := ins.listContainers()
+	containers, err := ins.listContainers(ctx)
 	if err != nil {
 		q.PushFront(ins.buildEvent("docker::container_running", "docker-engine").
 			SetEventStatus(types.EventStatusCritical).
@@ -258,7 +265,7 @@ func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
 
 			ins.checkContainerRunning(q, c, name, shortID)
 
-			detail, err := ins.inspectContainer(c.Id)
+			detail, err := ins.inspectContainer(ctx, c.Id)
 			if err != nil {
 				q.PushFront(ins.buildContainerEvent("docker::container_running", name, shortID, image).
 					SetEventStatus(types.EventStatusCritical).
@@ -275,7 +282,7 @@ func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
 			ins.checkHealthStatus(q, detail, name, shortID, image)
 
 			if needStats {
-				stats, err := ins.getContainerStats(c.Id)
+				stats, err := ins.getContainerStats(ctx, c.Id)
 				if err != nil {
 					if ins.CpuUsage.WarnGe > 0 || ins.CpuUsage.CriticalGe > 0 {
 						q.PushFront(ins.buildContainerEvent("docker::cpu_usage", name, shortID, image).
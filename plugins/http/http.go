@@ -17,6 +17,7 @@ import (
 	"github.com/cprobe/catpaw/digcore/pkg/netx"
 	"github.com/cprobe/catpaw/digcore/pkg/safe"
 	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/secret"
 	"github.com/cprobe/catpaw/digcore/types"
 	"github.com/toolkits/pkg/concurrent/semaphore"
 )
@@ -193,6 +194,20 @@ func (ins *Instance) Init() error {
 		return fmt.Errorf("headers must be key-value pairs (even number of elements), got %d", len(ins.Headers))
 	}
 
+	pass, err := secret.Resolve(ins.BasicAuthPass)
+	if err != nil {
+		return fmt.Errorf("basic_auth_pass: %w", err)
+	}
+	ins.BasicAuthPass = pass
+	for i := 1; i < len(ins.Headers); i += 2 {
+		if !secret.IsRef(ins.Headers[i]) {
+			continue
+		}
+		if ins.Headers[i], err = secret.Resolve(ins.Headers[i]); err != nil {
+			return fmt.Errorf("header %s: %w", ins.Headers[i-1], err)
+		}
+	}
+
 	for _, target := range ins.Targets {
 		addr, err := url.Parse(target)
 		if err != nil {
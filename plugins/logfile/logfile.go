@@ -2,6 +2,7 @@ package logfile
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -60,7 +61,7 @@ type Instance struct {
 	ContextAfter    int             `toml:"context_after"`
 	Encoding        string          `toml:"encoding"`
 	StateFile       string          `toml:"state_file"`
-	GatherTimeout   config.Duration `toml:"gather_timeout"`
+	ReadTimeout     config.Duration `toml:"read_timeout"`
 	Match           MatchCheck      `toml:"match"`
 
 	mu              sync.Mutex
@@ -142,8 +143,12 @@ func (ins *Instance) Init() error {
 	if ins.MaxTargets <= 0 {
 		ins.MaxTargets = 100
 	}
-	if ins.GatherTimeout <= 0 {
-		ins.GatherTimeout = config.Duration(10 * time.Second)
+	// read_timeout falls back to gather_timeout, then 10s
+	if ins.ReadTimeout <= 0 {
+		ins.ReadTimeout = ins.GatherTimeout
+	}
+	if ins.ReadTimeout <= 0 {
+		ins.ReadTimeout = config.Duration(10 * time.Second)
 	}
 
 	if ins.ContextBefore < 0 {
@@ -195,10 +200,16 @@ func (ins *Instance) Drop() {
 }
 
 func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	ins.GatherContext(context.Background(), q)
+}
+
+// GatherContext skips the remaining files once read_timeout has passed or
+// ctx is done. A read already in progress is not interrupted.
+func (ins *Instance) GatherContext(ctx context.Context, q *safe.Queue[*types.Event]) {
 	ins.mu.Lock()
 	defer ins.mu.Unlock()
 
-	deadline := time.Now().Add(time.Duration(ins.GatherTimeout))
+	deadline := time.Now().Add(time.Duration(ins.ReadTimeout))
 
 	prevGlobExceeded := ins.globExceeded
 	ins.globExceeded = false
@@ -267,14 +278,14 @@ func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
 	}
 
 	for _, filePath := range resolvedFiles {
-		if time.Now().After(deadline) {
+		if time.Now().After(deadline) || ctx.Err() != nil {
 			ins.gatherTimedOut = true
 			q.PushFront(types.BuildEvent(map[string]string{
 				"check":  "logfile::match",
 				"target": "gather_timeout",
 			}).
 				SetEventStatus(types.EventStatusCritical).
-				SetDescription(fmt.Sprintf("gather_timeout (%s) exceeded, skipped remaining files", time.Duration(ins.GatherTimeout))))
+				SetDescription(fmt.Sprintf("read_timeout (%s) exceeded, skipped remaining files", time.Duration(ins.ReadTimeout))))
 			break
 		}
 
@@ -1,6 +1,7 @@
 package logfile
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"github.com/cprobe/catpaw/digcore/config"
@@ -177,6 +179,30 @@ func TestInitDefaults(t *testing.T) {
 	if ins.InitialPosition != "end" {
 		t.Errorf("InitialPosition = %q, want \"end\"", ins.InitialPosition)
 	}
+	if ins.ReadTimeout != config.Duration(10*time.Second) {
+		t.Errorf("ReadTimeout = %s, want 10s", time.Duration(ins.ReadTimeout))
+	}
+}
+
+func TestInitReadTimeoutFallsBackToGatherTimeout(t *testing.T) {
+	ins := newTestInstance(t)
+	ins.GatherTimeout = config.Duration(3 * time.Second)
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if ins.ReadTimeout != config.Duration(3*time.Second) {
+		t.Errorf("ReadTimeout = %s, want gather_timeout 3s", time.Duration(ins.ReadTimeout))
+	}
+
+	ins = newTestInstance(t)
+	ins.GatherTimeout = config.Duration(3 * time.Second)
+	ins.ReadTimeout = config.Duration(time.Second)
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if ins.ReadTimeout != config.Duration(time.Second) {
+		t.Errorf("ReadTimeout = %s, want explicit 1s", time.Duration(ins.ReadTimeout))
+	}
 }
 
 func TestInitNegativeValuesFallbackToDefaults(t *testing.T) {
@@ -209,6 +235,40 @@ func TestInitNegativeValuesFallbackToDefaults(t *testing.T) {
 
 // --- Gather tests ---
 
+func TestGatherContextCancelledSkipsFiles(t *testing.T) {
+	initTestConfig(t)
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "app.log")
+	os.WriteFile(logFile, []byte("line1 ERROR something\n"), 0644)
+
+	ins := &Instance{
+		Targets:         []string{logFile},
+		FilterInclude:   []string{"*ERROR*"},
+		InitialPosition: "beginning",
+		StateFile:       filepath.Join(tmpDir, "state.json"),
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q := safe.NewQueue[*types.Event]()
+	ins.GatherContext(ctx, q)
+
+	ep := q.PopBack()
+	if ep == nil {
+		t.Fatal("expected an event")
+	}
+	event := *ep
+	if event.Labels["target"] != "gather_timeout" || event.EventStatus != types.EventStatusCritical {
+		t.Errorf("cancelled gather should skip files, got target=%s status=%s", event.Labels["target"], event.EventStatus)
+	}
+	if !strings.Contains(event.Description, "read_timeout") {
+		t.Errorf("description = %q, want read_timeout mention", event.Description)
+	}
+}
+
 func TestGatherNewFileFromEnd(t *testing.T) {
 	initTestConfig(t)
 	tmpDir := t.TempDir()
@@ -0,0 +1,234 @@
+package mailq
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/plugins"
+)
+
+const maxReasonLen = 120
+
+var _ plugins.Diagnosable = (*MailqPlugin)(nil)
+
+func (p *MailqPlugin) RegisterDiagnoseTools(registry *diagnose.ToolRegistry) {
+	registry.RegisterCategory("mailq", "mailq",
+		"Mail queue diagnostic tools for Postfix and sendmail. Reads the spool directly, no mailq binary needed.",
+		diagnose.ToolScopeLocal)
+
+	registry.Register("mailq", diagnose.DiagnoseTool{
+		Name:        "mailq_deferred",
+		Description: "Summarize why mail is stuck: queue sizes, then deferred recipients grouped by destination domain with message counts and the most common deferral reason. Postfix reads the defer logs, sendmail the qf status lines.",
+		Scope:       diagnose.ToolScopeLocal,
+		Parameters: []diagnose.ToolParam{
+			{Name: "mta", Type: "string", Description: "postfix or sendmail (default: auto detect)"},
+			{Name: "queue_dir", Type: "string", Description: "Queue directory (default: /var/spool/postfix or /var/spool/mqueue)"},
+			{Name: "top", Type: "string", Description: "Max domains to show (default: 20)"},
+		},
+		Execute: execMailqDeferred,
+	})
+}
+
+// domainSummary aggregates the deferred recipients of one domain.
+type domainSummary struct {
+	domain     string
+	recipients int
+	messages   int
+	reasons    map[string]int
+}
+
+func (s *domainSummary) topReason() (string, int) {
+	var reason string
+	var n int
+	for r, c := range s.reasons {
+		if c > n || (c == n && r < reason) {
+			reason, n = r, c
+		}
+	}
+	return reason, n
+}
+
+// deferredSummary groups recipients by domain; each message counts once
+// per domain however many of its recipients go there.
+type deferredSummary struct {
+	domains map[string]*domainSummary
+}
+
+func (s *deferredSummary) add(entries []deferEntry) {
+	seen := map[string]bool{}
+	for _, e := range entries {
+		domain := recipientDomain(e.recipient)
+		ds := s.domains[domain]
+		if ds == nil {
+			ds = &domainSummary{domain: domain, reasons: map[string]int{}}
+			s.domains[domain] = ds
+		}
+		ds.recipients++
+		if !seen[domain] {
+			seen[domain] = true
+			ds.messages++
+		}
+		reason := strings.TrimSpace(e.reason)
+		if reason == "" {
+			reason = "(no reason recorded)"
+		}
+		ds.reasons[reason]++
+	}
+}
+
+func (s *deferredSummary) sorted() []*domainSummary {
+	ret := make([]*domainSummary, 0, len(s.domains))
+	for _, ds := range s.domains {
+		ret = append(ret, ds)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].messages != ret[j].messages {
+			return ret[i].messages > ret[j].messages
+		}
+		return ret[i].domain < ret[j].domain
+	})
+	return ret
+}
+
+func execMailqDeferred(ctx context.Context, args map[string]string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("mailq_deferred does not support windows")
+	}
+
+	top := 20
+	if s := strings.TrimSpace(args["top"]); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("invalid top %q", s)
+		}
+		top = n
+	}
+
+	mta := strings.TrimSpace(args["mta"])
+	dir := strings.TrimSpace(args["queue_dir"])
+	switch mta {
+	case "", mtaAuto:
+		var err error
+		if mta, dir, err = detectMTA(dir); err != nil {
+			return "", err
+		}
+	case mtaPostfix, mtaSendmail:
+		if dir == "" {
+			dir = defaultQueueDir(mta)
+		}
+	default:
+		return "", fmt.Errorf("invalid mta %q, must be postfix or sendmail", mta)
+	}
+
+	var b strings.Builder
+	summary := &deferredSummary{domains: map[string]*domainSummary{}}
+	var err error
+	if mta == mtaPostfix {
+		err = summarizePostfix(ctx, &b, dir, summary)
+	} else {
+		err = summarizeSendmail(ctx, &b, dir, summary)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	domains := summary.sorted()
+	if len(domains) == 0 {
+		b.WriteString("\nNo deferred recipients.\n")
+		return b.String(), nil
+	}
+
+	fmt.Fprintf(&b, "\nDeferred by domain (%d domains", len(domains))
+	if len(domains) > top {
+		fmt.Fprintf(&b, ", top %d", top)
+		domains = domains[:top]
+	}
+	b.WriteString("):\n")
+	fmt.Fprintf(&b, "  %-30s  %8s  %10s  %s\n", "DOMAIN", "MESSAGES", "RECIPIENTS", "TOP REASON")
+	for _, ds := range domains {
+		reason, n := ds.topReason()
+		if len(reason) > maxReasonLen {
+			reason = reason[:maxReasonLen] + "..."
+		}
+		if len(ds.reasons) > 1 {
+			reason = fmt.Sprintf("%s (%d of %d, %d distinct)", reason, n, ds.recipients, len(ds.reasons))
+		}
+		fmt.Fprintf(&b, "  %-30s  %8d  %10d  %s\n", ds.domain, ds.messages, ds.recipients, reason)
+	}
+	return b.String(), nil
+}
+
+func summarizePostfix(ctx context.Context, b *strings.Builder, dir string, summary *deferredSummary) error {
+	fmt.Fprintf(b, "Postfix queue %s\n", dir)
+	for _, name := range postfixQueues {
+		st, err := scanPostfixQueue(filepath.Join(dir, name), false)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			if os.IsPermission(err) {
+				return fmt.Errorf("%w (the queue is owned by postfix, run catpaw as root)", err)
+			}
+			return err
+		}
+		fmt.Fprintf(b, "  %-9s %d\n", name+":", st.count)
+	}
+
+	deferDir := filepath.Join(dir, "defer")
+	err := filepath.WalkDir(deferDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path != deferDir {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		entries, err := readPostfixDeferLog(path)
+		if err != nil {
+			return nil
+		}
+		summary.add(entries)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func summarizeSendmail(ctx context.Context, b *strings.Builder, dir string, summary *deferredSummary) error {
+	files, err := sendmailQueueFiles(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "Sendmail queue %s\n  messages: %d\n", dir, len(files))
+
+	for _, path := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		m, err := readSendmailQf(path)
+		if err != nil {
+			continue
+		}
+		entries := make([]deferEntry, 0, len(m.recipients))
+		for _, rcpt := range m.recipients {
+			entries = append(entries, deferEntry{recipient: rcpt, reason: m.status})
+		}
+		summary.add(entries)
+	}
+	return nil
+}
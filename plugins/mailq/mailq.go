@@ -0,0 +1,299 @@
+package mailq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const pluginName = "mailq"
+
+type QueueSizeCheck struct {
+	WarnGe     int `toml:"warn_ge"`
+	CriticalGe int `toml:"critical_ge"`
+}
+
+type OldestAgeCheck struct {
+	WarnGe     config.Duration `toml:"warn_ge"`
+	CriticalGe config.Duration `toml:"critical_ge"`
+}
+
+type Instance struct {
+	config.InternalConfig
+
+	MTA      string   `toml:"mta"`
+	QueueDir string   `toml:"queue_dir"`
+	Queues   []string `toml:"queues"`
+
+	QueueSize QueueSizeCheck `toml:"queue_size"`
+	OldestAge OldestAgeCheck `toml:"oldest_age"`
+
+	mta string
+	dir string
+}
+
+type MailqPlugin struct {
+	config.InternalConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+func (p *MailqPlugin) GetInstances() []plugins.Instance {
+	ret := make([]plugins.Instance, len(p.Instances))
+	for i := 0; i < len(p.Instances); i++ {
+		ret[i] = p.Instances[i]
+	}
+	return ret
+}
+
+func init() {
+	plugins.Add(pluginName, func() plugins.Plugin {
+		return &MailqPlugin{}
+	})
+}
+
+func (ins *Instance) Init() error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("mailq plugin does not support windows")
+	}
+
+	if ins.QueueSize.WarnGe < 0 || ins.QueueSize.CriticalGe < 0 {
+		return fmt.Errorf("queue_size thresholds must be non-negative")
+	}
+	if ins.QueueSize.WarnGe > 0 && ins.QueueSize.CriticalGe > 0 && ins.QueueSize.WarnGe >= ins.QueueSize.CriticalGe {
+		return fmt.Errorf("queue_size.warn_ge(%d) must be less than queue_size.critical_ge(%d)",
+			ins.QueueSize.WarnGe, ins.QueueSize.CriticalGe)
+	}
+	if ins.OldestAge.WarnGe < 0 || ins.OldestAge.CriticalGe < 0 {
+		return fmt.Errorf("oldest_age thresholds must be non-negative")
+	}
+	if ins.OldestAge.WarnGe > 0 && ins.OldestAge.CriticalGe > 0 && ins.OldestAge.WarnGe >= ins.OldestAge.CriticalGe {
+		return fmt.Errorf("oldest_age.warn_ge(%s) must be less than oldest_age.critical_ge(%s)",
+			time.Duration(ins.OldestAge.WarnGe), time.Duration(ins.OldestAge.CriticalGe))
+	}
+
+	mta := strings.TrimSpace(ins.MTA)
+	if mta == "" {
+		mta = mtaAuto
+	}
+	switch mta {
+	case mtaAuto:
+		detected, dir, err := detectMTA(ins.QueueDir)
+		if err != nil {
+			return err
+		}
+		ins.mta, ins.dir = detected, dir
+	case mtaPostfix, mtaSendmail:
+		ins.mta, ins.dir = mta, ins.QueueDir
+		if ins.dir == "" {
+			ins.dir = defaultQueueDir(mta)
+		}
+	default:
+		return fmt.Errorf("invalid mta %q, must be one of: auto, postfix, sendmail", ins.MTA)
+	}
+
+	if ins.mta == mtaPostfix {
+		if len(ins.Queues) == 0 {
+			ins.Queues = []string{"incoming", "active", "deferred"}
+		}
+		for _, q := range ins.Queues {
+			if !slices.Contains(postfixQueues, q) {
+				return fmt.Errorf("invalid queue %q, must be one of: %s", q, strings.Join(postfixQueues, ", "))
+			}
+		}
+	} else if len(ins.Queues) > 0 {
+		logger.Logger.Warnw("mailq: sendmail has a single queue, queues will be ignored")
+	}
+
+	logger.Logger.Infow("mailq: initialized", "mta", ins.mta, "queue_dir", ins.dir)
+	return nil
+}
+
+func defaultQueueDir(mta string) string {
+	if mta == mtaSendmail {
+		return defaultSendmailDir
+	}
+	return defaultPostfixDir
+}
+
+// detectMTA picks Postfix when dir (or its default) has a deferred queue,
+// otherwise sendmail when the directory exists.
+func detectMTA(dir string) (string, string, error) {
+	candidates := [][2]string{{mtaPostfix, defaultPostfixDir}, {mtaSendmail, defaultSendmailDir}}
+	if dir != "" {
+		candidates = [][2]string{{mtaPostfix, dir}, {mtaSendmail, dir}}
+	}
+	for _, c := range candidates {
+		mta, d := c[0], c[1]
+		if mta == mtaPostfix {
+			if fi, err := os.Stat(filepath.Join(d, "deferred")); err == nil && fi.IsDir() {
+				return mta, d, nil
+			}
+			continue
+		}
+		if fi, err := os.Stat(d); err == nil && fi.IsDir() {
+			return mta, d, nil
+		}
+	}
+	if dir != "" {
+		return "", "", fmt.Errorf("no postfix or sendmail queue found in %s", dir)
+	}
+	return "", "", fmt.Errorf("no mail queue found (tried %s, %s)", defaultPostfixDir, defaultSendmailDir)
+}
+
+func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	checkSize := ins.QueueSize.WarnGe > 0 || ins.QueueSize.CriticalGe > 0
+	checkAge := ins.OldestAge.WarnGe > 0 || ins.OldestAge.CriticalGe > 0
+	if !checkSize && !checkAge {
+		return
+	}
+
+	stats, err := ins.scan(checkAge)
+	if err != nil {
+		check := "mailq::queue_size"
+		if !checkSize {
+			check = "mailq::oldest_age"
+		}
+		q.PushFront(types.BuildEvent(map[string]string{
+			"check":  check,
+			"target": ins.mta,
+		}).SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to read %s queue %s: %v", ins.mta, ins.dir, err)))
+		return
+	}
+
+	total := 0
+	var oldest time.Time
+	attrs := map[string]string{"queue_dir": ins.dir}
+	var parts []string
+	for _, st := range stats {
+		total += st.count
+		attrs[st.name] = strconv.Itoa(st.count)
+		parts = append(parts, fmt.Sprintf("%s %d", st.name, st.count))
+		if !st.oldest.IsZero() && (oldest.IsZero() || st.oldest.Before(oldest)) {
+			oldest = st.oldest
+		}
+	}
+	breakdown := strings.Join(parts, ", ")
+
+	if checkSize {
+		ins.checkQueueSize(q, attrs, total, breakdown)
+	}
+	if checkAge {
+		ins.checkOldestAge(q, attrs, total, oldest)
+	}
+}
+
+func (ins *Instance) scan(readAge bool) ([]queueStat, error) {
+	if ins.mta == mtaSendmail {
+		st, err := scanSendmailQueue(ins.dir, readAge)
+		if err != nil {
+			return nil, err
+		}
+		return []queueStat{st}, nil
+	}
+
+	stats := make([]queueStat, 0, len(ins.Queues))
+	for _, name := range ins.Queues {
+		st, err := scanPostfixQueue(filepath.Join(ins.dir, name), readAge)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+func (ins *Instance) checkQueueSize(q *safe.Queue[*types.Event], attrs map[string]string, total int, breakdown string) {
+	event := types.BuildEvent(map[string]string{
+		"check":  "mailq::queue_size",
+		"target": ins.mta,
+	}).SetAttrs(attrs).SetCurrentValue(strconv.Itoa(total))
+
+	var tdParts []string
+	if ins.QueueSize.WarnGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Warning ≥ %d", ins.QueueSize.WarnGe))
+	}
+	if ins.QueueSize.CriticalGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Critical ≥ %d", ins.QueueSize.CriticalGe))
+	}
+	event.Attrs["threshold_desc"] = strings.Join(tdParts, ", ")
+
+	status := types.EvaluateGeThreshold(float64(total), float64(ins.QueueSize.WarnGe), float64(ins.QueueSize.CriticalGe))
+	event.SetEventStatus(status)
+
+	switch status {
+	case types.EventStatusCritical:
+		event.SetDescription(fmt.Sprintf("%s queue has %d messages (%s), above critical threshold %d",
+			ins.mta, total, breakdown, ins.QueueSize.CriticalGe))
+	case types.EventStatusWarning:
+		event.SetDescription(fmt.Sprintf("%s queue has %d messages (%s), above warning threshold %d",
+			ins.mta, total, breakdown, ins.QueueSize.WarnGe))
+	default:
+		event.SetDescription(fmt.Sprintf("%s queue has %d messages (%s), everything is ok",
+			ins.mta, total, breakdown))
+	}
+
+	q.PushFront(event)
+}
+
+func (ins *Instance) checkOldestAge(q *safe.Queue[*types.Event], attrs map[string]string, total int, oldest time.Time) {
+	event := types.BuildEvent(map[string]string{
+		"check":  "mailq::oldest_age",
+		"target": ins.mta,
+	}).SetAttrs(attrs)
+
+	var tdParts []string
+	if ins.OldestAge.WarnGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Warning ≥ %s", time.Duration(ins.OldestAge.WarnGe)))
+	}
+	if ins.OldestAge.CriticalGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Critical ≥ %s", time.Duration(ins.OldestAge.CriticalGe)))
+	}
+	event.Attrs["threshold_desc"] = strings.Join(tdParts, ", ")
+
+	if total == 0 {
+		q.PushFront(event.SetCurrentValue("0s").
+			SetDescription(fmt.Sprintf("%s queue is empty", ins.mta)))
+		return
+	}
+	// messages are queued but none of their queue files could be read:
+	// the age is unknown, which must not pass for an empty queue
+	if oldest.IsZero() {
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to read the arrival time of any of the %d messages in %s queue %s",
+				total, ins.mta, ins.dir)))
+		return
+	}
+
+	age := time.Since(oldest).Truncate(time.Second)
+	if age < 0 {
+		age = 0
+	}
+	event.SetCurrentValue(age.String())
+	event.Attrs["oldest_arrival"] = oldest.Format(time.RFC3339)
+
+	if ins.OldestAge.CriticalGe > 0 && age >= time.Duration(ins.OldestAge.CriticalGe) {
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("oldest message in %s queue is %s old, above critical threshold %s",
+				ins.mta, age, time.Duration(ins.OldestAge.CriticalGe))))
+		return
+	}
+	if ins.OldestAge.WarnGe > 0 && age >= time.Duration(ins.OldestAge.WarnGe) {
+		q.PushFront(event.SetEventStatus(types.EventStatusWarning).
+			SetDescription(fmt.Sprintf("oldest message in %s queue is %s old, above warning threshold %s",
+				ins.mta, age, time.Duration(ins.OldestAge.WarnGe))))
+		return
+	}
+	q.PushFront(event.SetDescription(fmt.Sprintf("oldest message in %s queue is %s old, everything is ok", ins.mta, age)))
+}
@@ -0,0 +1,305 @@
+package mailq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+// postfixSpool builds a spool with two deferred messages (the oldest two
+// hours old), one active message and their defer logs.
+func postfixSpool(t *testing.T) string {
+	spool := t.TempDir()
+	now := time.Now()
+	writePostfixMsg(t, spool, "deferred", "4F1A2B3C4D", now.Add(-2*time.Hour))
+	writePostfixMsg(t, spool, "deferred", "A1B2C3D4E5", now.Add(-10*time.Minute))
+	writePostfixMsg(t, spool, "active", "7E8F9A0B1C", now)
+	for _, q := range []string{"incoming", "hold"} {
+		if err := os.MkdirAll(filepath.Join(spool, q), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(spool, "defer", "4", "4F1A2B3C4D"), deferLog)
+	writeFile(t, filepath.Join(spool, "defer", "A", "A1B2C3D4E5"), `recipient=carol@example.net
+reason=connect to mx.example.net[192.0.2.1]:25: Connection timed out
+
+recipient=dave@example.net
+reason=host mx.example.net[192.0.2.1] said: 452 4.2.2 Mailbox full
+
+`)
+	return spool
+}
+
+func gather(t *testing.T, ins *Instance) map[string]*types.Event {
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+	ret := map[string]*types.Event{}
+	for q.Len() > 0 {
+		e := *q.PopBack()
+		ret[e.Labels["check"]] = e
+	}
+	return ret
+}
+
+func TestInit_Validation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	spool := postfixSpool(t)
+
+	tests := []struct {
+		name    string
+		ins     Instance
+		wantErr bool
+	}{
+		{
+			name: "auto detect postfix",
+			ins:  Instance{QueueDir: spool},
+		},
+		{
+			name: "explicit sendmail",
+			ins:  Instance{MTA: "sendmail", QueueDir: t.TempDir()},
+		},
+		{
+			name:    "unknown mta",
+			ins:     Instance{MTA: "exim", QueueDir: spool},
+			wantErr: true,
+		},
+		{
+			name:    "auto detect without a queue",
+			ins:     Instance{QueueDir: filepath.Join(spool, "missing")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown queue",
+			ins:     Instance{MTA: "postfix", QueueDir: spool, Queues: []string{"corrupt"}},
+			wantErr: true,
+		},
+		{
+			name:    "queue_size warn_ge >= critical_ge",
+			ins:     Instance{QueueDir: spool, QueueSize: QueueSizeCheck{WarnGe: 100, CriticalGe: 10}},
+			wantErr: true,
+		},
+		{
+			name: "oldest_age warn_ge >= critical_ge",
+			ins: Instance{QueueDir: spool, OldestAge: OldestAgeCheck{
+				WarnGe: config.Duration(time.Hour), CriticalGe: config.Duration(time.Minute)}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ins.Init()
+			if tt.wantErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	ins := &Instance{QueueDir: spool}
+	if err := ins.Init(); err != nil || ins.mta != mtaPostfix || len(ins.Queues) != 3 {
+		t.Errorf("auto detect: mta=%q queues=%v err=%v", ins.mta, ins.Queues, err)
+	}
+}
+
+func TestGather_Postfix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	spool := postfixSpool(t)
+
+	events := gather(t, &Instance{
+		QueueDir:  spool,
+		QueueSize: QueueSizeCheck{WarnGe: 3, CriticalGe: 100},
+		OldestAge: OldestAgeCheck{WarnGe: config.Duration(time.Hour), CriticalGe: config.Duration(24 * time.Hour)},
+	})
+
+	size := events["mailq::queue_size"]
+	if size == nil || size.EventStatus != types.EventStatusWarning || size.Attrs[types.AttrCurrentValue] != "3" {
+		t.Fatalf("queue_size: %+v", size)
+	}
+	if size.Labels["target"] != "postfix" || size.Attrs["deferred"] != "2" || size.Attrs["active"] != "1" ||
+		size.Attrs["incoming"] != "0" || size.Attrs["threshold_desc"] != "Warning ≥ 3, Critical ≥ 100" {
+		t.Errorf("queue_size labels/attrs: %v %v", size.Labels, size.Attrs)
+	}
+	if !strings.Contains(size.Description, "incoming 0, active 1, deferred 2") {
+		t.Errorf("queue_size description: %q", size.Description)
+	}
+
+	age := events["mailq::oldest_age"]
+	if age == nil || age.EventStatus != types.EventStatusWarning || !strings.HasPrefix(age.Attrs[types.AttrCurrentValue], "2h0m") {
+		t.Errorf("oldest_age should use the arrival record, not the mtime: %+v", age)
+	}
+}
+
+func TestGather_Thresholds(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	spool := postfixSpool(t)
+
+	events := gather(t, &Instance{QueueDir: spool, Queues: []string{"deferred"}, QueueSize: QueueSizeCheck{CriticalGe: 2}})
+	if e := events["mailq::queue_size"]; e == nil || e.EventStatus != types.EventStatusCritical {
+		t.Errorf("critical: %+v", e)
+	}
+	if _, ok := events["mailq::oldest_age"]; ok {
+		t.Error("oldest_age is not configured and should not be checked")
+	}
+
+	events = gather(t, &Instance{QueueDir: spool, Queues: []string{"hold"},
+		QueueSize: QueueSizeCheck{WarnGe: 1}, OldestAge: OldestAgeCheck{WarnGe: config.Duration(time.Minute)}})
+	if e := events["mailq::queue_size"]; e == nil || e.EventStatus != types.EventStatusOk ||
+		!strings.HasSuffix(e.Description, "everything is ok") {
+		t.Errorf("empty hold queue: %+v", e)
+	}
+	if e := events["mailq::oldest_age"]; e == nil || e.EventStatus != types.EventStatusOk || e.Attrs[types.AttrCurrentValue] != "0s" {
+		t.Errorf("empty queue age: %+v", e)
+	}
+
+	if events := gather(t, &Instance{QueueDir: spool}); len(events) != 0 {
+		t.Errorf("no thresholds configured, expected no events: %v", events)
+	}
+}
+
+func TestGather_QueueUnreadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	spool := postfixSpool(t)
+	ins := &Instance{MTA: "postfix", QueueDir: spool, QueueSize: QueueSizeCheck{WarnGe: 10}}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(spool, "incoming")); err != nil {
+		t.Fatal(err)
+	}
+
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+	if q.Len() != 1 {
+		t.Fatalf("expected 1 event, got %d", q.Len())
+	}
+	e := *q.PopBack()
+	if e.EventStatus != types.EventStatusCritical || !strings.Contains(e.Description, "failed to read postfix queue") {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestGather_AgeUnreadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "qfx9ABCD012345"), "RPFD:someone@example.com\n")
+
+	events := gather(t, &Instance{MTA: "sendmail", QueueDir: dir,
+		OldestAge: OldestAgeCheck{WarnGe: config.Duration(time.Hour)}})
+
+	age := events["mailq::oldest_age"]
+	if age == nil || age.EventStatus != types.EventStatusCritical ||
+		!strings.Contains(age.Description, "failed to read the arrival time of any of the 1 messages") {
+		t.Errorf("a non-empty queue without readable ages should not look empty: %+v", age)
+	}
+}
+
+func TestGather_Sendmail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "qfx9ABCD012345"), sendmailQf)
+	writeFile(t, filepath.Join(dir, "qfx9ABCD012346"), "T1700000100\nRPFD:someone@example.com\n")
+
+	events := gather(t, &Instance{MTA: "sendmail", QueueDir: dir,
+		QueueSize: QueueSizeCheck{WarnGe: 5}, OldestAge: OldestAgeCheck{CriticalGe: config.Duration(time.Hour)}})
+
+	if e := events["mailq::queue_size"]; e == nil || e.EventStatus != types.EventStatusOk || e.Attrs[types.AttrCurrentValue] != "2" ||
+		e.Labels["target"] != "sendmail" {
+		t.Errorf("queue_size: %+v", e)
+	}
+	age := events["mailq::oldest_age"]
+	if age == nil || age.EventStatus != types.EventStatusCritical ||
+		age.Attrs["oldest_arrival"] != time.Unix(1700000000, 0).Format(time.RFC3339) {
+		t.Errorf("oldest_age: %+v", age)
+	}
+}
+
+func TestMailqDeferred_Postfix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	spool := postfixSpool(t)
+
+	out, err := execMailqDeferred(context.Background(), map[string]string{"queue_dir": spool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Postfix queue " + spool,
+		"deferred: 2",
+		"Deferred by domain (2 domains)",
+		"Connection timed out (2 of 3, 2 distinct)",
+		"Greylisted",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+	// example.net has 2 messages and goes first
+	if strings.Index(out, "example.net") > strings.Index(out, "example.com ") {
+		t.Errorf("domains should be sorted by message count:\n%s", out)
+	}
+
+	out, err = execMailqDeferred(context.Background(), map[string]string{"queue_dir": spool, "top": "1"})
+	if err != nil || !strings.Contains(out, "(2 domains, top 1)") || strings.Contains(out, "example.com ") {
+		t.Errorf("top 1: %v\n%s", err, out)
+	}
+
+	if _, err := execMailqDeferred(context.Background(), map[string]string{"queue_dir": spool, "top": "x"}); err == nil {
+		t.Error("expected error for invalid top")
+	}
+}
+
+func TestMailqDeferred_Sendmail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mailq does not support windows")
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "qfx9ABCD012345"), sendmailQf)
+
+	out, err := execMailqDeferred(context.Background(), map[string]string{"mta": "sendmail", "queue_dir": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"messages: 1", "example.org", "Deferred: Connection timed out with mx.example.org."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+	// two recipients of the same message at one domain count once
+	if !strings.Contains(out, "example.org                            1           2") {
+		t.Errorf("messages/recipients columns:\n%s", out)
+	}
+}
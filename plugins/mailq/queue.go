@@ -0,0 +1,268 @@
+package mailq
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mtaPostfix  = "postfix"
+	mtaSendmail = "sendmail"
+	mtaAuto     = "auto"
+
+	defaultPostfixDir  = "/var/spool/postfix"
+	defaultSendmailDir = "/var/spool/mqueue"
+)
+
+// postfixQueues are the Postfix queue directories the plugin can count.
+var postfixQueues = []string{"incoming", "active", "deferred", "hold"}
+
+// queueStat is the size of one queue and the arrival time of its oldest
+// message. oldest is zero when the queue is empty or ages were not read.
+type queueStat struct {
+	name   string
+	count  int
+	oldest time.Time
+}
+
+// scanPostfixQueue counts the files of a Postfix queue directory, including
+// its hashed subdirectories. With readAge it also reads each message's
+// arrival time.
+func scanPostfixQueue(dir string, readAge bool) (queueStat, error) {
+	st := queueStat{name: filepath.Base(dir)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// a message moved to another queue while we walked
+			if os.IsNotExist(err) && path != dir {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		st.count++
+		if readAge {
+			if t, ok := postfixArrivalTime(path); ok && (st.oldest.IsZero() || t.Before(st.oldest)) {
+				st.oldest = t
+			}
+		}
+		return nil
+	})
+	return st, err
+}
+
+// postfixArrivalTime reads the arrival time from the REC_TYPE_TIME record
+// near the start of a Postfix queue file. The file's mtime is no substitute:
+// Postfix sets it to the next retry time of a deferred message.
+func postfixArrivalTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 512)
+	// the time record follows the size record; give up after a few records
+	for i := 0; i < 8; i++ {
+		typ, data, err := readPostfixRecord(r)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if typ != 'T' {
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.Fields(string(data) + " ")[0], 10, 64)
+		if err != nil || sec <= 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// readPostfixRecord reads one queue file record: a type byte, the length in
+// base-128 little-endian with the high bit set on all but the last byte,
+// then the data.
+func readPostfixRecord(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+	}
+	if length > 4096 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return typ, data, nil
+}
+
+// sendmailMessage is what a sendmail qf control file says about a message.
+type sendmailMessage struct {
+	created    time.Time
+	status     string // M line, the last delivery status
+	recipients []string
+}
+
+// sendmailQueueFiles returns the qf control files of a sendmail queue, which
+// sit in the queue directory or in its qf/ subdirectory.
+func sendmailQueueFiles(dir string) ([]string, error) {
+	var ret []string
+	for _, d := range []string{dir, filepath.Join(dir, "qf")} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			if os.IsNotExist(err) && d != dir {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && strings.HasPrefix(e.Name(), "qf") {
+				ret = append(ret, filepath.Join(d, e.Name()))
+			}
+		}
+	}
+	return ret, nil
+}
+
+func scanSendmailQueue(dir string, readAge bool) (queueStat, error) {
+	st := queueStat{name: filepath.Base(dir)}
+	files, err := sendmailQueueFiles(dir)
+	if err != nil {
+		return st, err
+	}
+	st.count = len(files)
+	if !readAge {
+		return st, nil
+	}
+	for _, path := range files {
+		m, err := readSendmailQf(path)
+		if err != nil || m.created.IsZero() {
+			continue
+		}
+		if st.oldest.IsZero() || m.created.Before(st.oldest) {
+			st.oldest = m.created
+		}
+	}
+	return st, nil
+}
+
+// readSendmailQf parses the lines of a qf file the plugin uses:
+// T<creation time>, M<status message> and R<flags>:<recipient>.
+func readSendmailQf(path string) (*sendmailMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &sendmailMessage{}
+	sc := bufio.NewScanner(io.LimitReader(f, 1<<20))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'T':
+			if sec, err := strconv.ParseInt(line[1:], 10, 64); err == nil {
+				m.created = time.Unix(sec, 0)
+			}
+		case 'M':
+			m.status = line[1:]
+		case 'R':
+			rcpt := line[1:]
+			if i := strings.Index(rcpt, ":"); i >= 0 && isQfFlags(rcpt[:i]) {
+				rcpt = rcpt[i+1:]
+			}
+			m.recipients = append(m.recipients, strings.Trim(rcpt, "<>"))
+		}
+	}
+	return m, sc.Err()
+}
+
+func isQfFlags(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// deferEntry is one recipient of a Postfix defer logfile.
+type deferEntry struct {
+	recipient string
+	reason    string
+}
+
+// readPostfixDeferLog parses a defer logfile (defer/<hash>/<queue id>): one
+// name=value attribute per line, a blank line after each recipient.
+func readPostfixDeferLog(path string) ([]deferEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		ret []deferEntry
+		cur deferEntry
+	)
+	flush := func() {
+		if cur.recipient != "" {
+			ret = append(ret, cur)
+		}
+		cur = deferEntry{}
+	}
+	sc := bufio.NewScanner(io.LimitReader(f, 1<<20))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "recipient":
+			cur.recipient = v
+		case "reason":
+			cur.reason = v
+		}
+	}
+	flush()
+	return ret, sc.Err()
+}
+
+func recipientDomain(rcpt string) string {
+	if i := strings.LastIndex(rcpt, "@"); i >= 0 && i < len(rcpt)-1 {
+		return strings.ToLower(rcpt[i+1:])
+	}
+	return "(local)"
+}
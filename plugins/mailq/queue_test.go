@@ -0,0 +1,172 @@
+package mailq
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postfixRecord encodes one queue file record.
+func postfixRecord(typ byte, data string) []byte {
+	rec := []byte{typ}
+	n := len(data)
+	for n >= 0x80 {
+		rec = append(rec, byte(n&0x7f)|0x80)
+		n >>= 7
+	}
+	rec = append(rec, byte(n))
+	return append(rec, data...)
+}
+
+// writePostfixMsg writes a minimal queue file: size record, then the
+// arrival time record, like cleanup(8) does. Files go into a hashed
+// subdirectory as with hash_queue_names.
+func writePostfixMsg(t *testing.T, spool, queue, id string, arrival time.Time) {
+	dir := filepath.Join(spool, queue, id[:1])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.Write(postfixRecord('C', "             581             168               1               0             581"))
+	buf.Write(postfixRecord('T', fmt.Sprintf("%d 123456", arrival.Unix())))
+	buf.Write(postfixRecord('F', ""))
+	buf.Write(postfixRecord('S', "sender@example.com"))
+	if err := os.WriteFile(filepath.Join(dir, id), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Postfix sets the mtime to the next retry; make sure we don't use it
+	future := time.Now().Add(time.Hour)
+	_ = os.Chtimes(filepath.Join(dir, id), future, future)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadPostfixRecord(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	r := bufio.NewReader(bytes.NewReader(append(postfixRecord('T', "1700000000 0"), postfixRecord('N', long)...)))
+
+	typ, data, err := readPostfixRecord(r)
+	if err != nil || typ != 'T' || string(data) != "1700000000 0" {
+		t.Errorf("first record: %c %q %v", typ, data, err)
+	}
+	typ, data, err = readPostfixRecord(r)
+	if err != nil || typ != 'N' || string(data) != long {
+		t.Errorf("multi-byte length record: %c %d %v", typ, len(data), err)
+	}
+	if _, _, err = readPostfixRecord(r); err == nil {
+		t.Error("expected EOF")
+	}
+}
+
+func TestScanPostfixQueue(t *testing.T) {
+	spool := t.TempDir()
+	old := time.Unix(1700000000, 0)
+	writePostfixMsg(t, spool, "deferred", "4F1A2B3C4D", old.Add(time.Hour))
+	writePostfixMsg(t, spool, "deferred", "A1B2C3D4E5", old)
+	writeFile(t, filepath.Join(spool, "deferred", "B", "B0000000000"), "garbage")
+
+	st, err := scanPostfixQueue(filepath.Join(spool, "deferred"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.name != "deferred" || st.count != 3 || !st.oldest.Equal(old) {
+		t.Errorf("got %+v, want 3 messages, oldest %v", st, old)
+	}
+
+	st, err = scanPostfixQueue(filepath.Join(spool, "deferred"), false)
+	if err != nil || st.count != 3 || !st.oldest.IsZero() {
+		t.Errorf("without ages: %+v %v", st, err)
+	}
+
+	if _, err := scanPostfixQueue(filepath.Join(spool, "active"), false); !os.IsNotExist(err) {
+		t.Errorf("missing queue should fail with not exist, got %v", err)
+	}
+}
+
+const sendmailQf = `V8
+T1700000000
+K1700003600
+N3
+P120345
+I8/1/1234
+MDeferred: Connection timed out with mx.example.org.
+Fbs
+$_localhost [127.0.0.1]
+Sfoo@example.com
+RPFD:<bar@example.org>
+RPFD:baz@Example.ORG
+.
+`
+
+func TestReadSendmailQf(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "qf", "qfx9ABCD012345"), sendmailQf)
+	writeFile(t, filepath.Join(dir, "dfx9ABCD012345"), "body")
+
+	files, err := sendmailQueueFiles(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("queue files: %v %v", files, err)
+	}
+	m, err := readSendmailQf(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.created.Equal(time.Unix(1700000000, 0)) || m.status != "Deferred: Connection timed out with mx.example.org." {
+		t.Errorf("got %+v", m)
+	}
+	if len(m.recipients) != 2 || m.recipients[0] != "bar@example.org" || m.recipients[1] != "baz@Example.ORG" {
+		t.Errorf("recipients: %v", m.recipients)
+	}
+	if d := recipientDomain(m.recipients[1]); d != "example.org" {
+		t.Errorf("domain should be lower-cased: %q", d)
+	}
+	if d := recipientDomain("root"); d != "(local)" {
+		t.Errorf("local recipient: %q", d)
+	}
+}
+
+const deferLog = `recipient=alice@example.net
+offset=412
+dsn_orig_rcpt=rfc822;alice@example.net
+status=4.4.1
+action=delayed
+reason=connect to mx.example.net[192.0.2.1]:25: Connection timed out
+
+recipient=bob@example.com
+offset=450
+status=4.7.1
+action=delayed
+reason=host mx.example.com[198.51.100.7] said: 450 4.7.1 Greylisted, try again later
+
+`
+
+func TestReadPostfixDeferLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "4F1A2B3C4D")
+	writeFile(t, path, deferLog)
+
+	entries, err := readPostfixDeferLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if entries[0].recipient != "alice@example.net" || !strings.HasSuffix(entries[0].reason, "Connection timed out") {
+		t.Errorf("first entry: %+v", entries[0])
+	}
+	if entries[1].recipient != "bob@example.com" || !strings.Contains(entries[1].reason, "Greylisted") {
+		t.Errorf("second entry: %+v", entries[1])
+	}
+}
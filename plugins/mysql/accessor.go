@@ -0,0 +1,283 @@
+package mysql
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MySQLAccessorConfig holds the connection parameters for creating a MySQLAccessor.
+type MySQLAccessorConfig struct {
+	Target      string
+	Username    string
+	Password    string
+	Timeout     time.Duration
+	ReadTimeout time.Duration
+	TLSConfig   *tls.Config
+	DialFunc    func(network, address string) (net.Conn, error)
+
+	// ServerPublicKey encrypts the password for caching_sha2_password full
+	// authentication without TLS. Without it the key is requested from the
+	// server only when AllowPublicKeyRetrieval is set, as nothing verifies
+	// that key.
+	ServerPublicKey         *rsa.PublicKey
+	AllowPublicKeyRetrieval bool
+}
+
+// MySQLAccessor encapsulates a MySQL connection and provides structured data access.
+// It handles connection, authentication, protocol interaction, and result parsing.
+// Every statement it sends is read-only.
+// Thread-unsafe: callers must synchronize concurrent use.
+type MySQLAccessor struct {
+	conn   *mysqlConn
+	target string
+}
+
+// NewMySQLAccessor creates a connected and authenticated MySQLAccessor.
+func NewMySQLAccessor(cfg MySQLAccessorConfig) (*MySQLAccessor, error) {
+	dialFn := cfg.DialFunc
+	if dialFn == nil {
+		dialer := &net.Dialer{Timeout: cfg.Timeout}
+		dialFn = dialer.Dial
+	}
+
+	rawConn, err := dialFn("tcp", cfg.Target)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := handshakeConn(rawConn, cfg)
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return &MySQLAccessor{conn: conn, target: cfg.Target}, nil
+}
+
+// Close sends COM_QUIT and releases the underlying TCP connection.
+func (a *MySQLAccessor) Close() error {
+	return a.conn.Close()
+}
+
+// Ping sends COM_PING and returns nil if the server answers OK.
+func (a *MySQLAccessor) Ping() error {
+	return a.conn.ping()
+}
+
+// Target returns the target address this accessor is connected to.
+func (a *MySQLAccessor) Target() string {
+	return a.target
+}
+
+// ServerVersion returns the version string from the server greeting.
+func (a *MySQLAccessor) ServerVersion() string {
+	return a.conn.serverVersion
+}
+
+// Query executes a statement and returns its text result set.
+// For use by diagnostic tools that need flexible access.
+func (a *MySQLAccessor) Query(q string) (*ResultSet, error) {
+	return a.conn.query(q)
+}
+
+// GlobalStatus returns the named SHOW GLOBAL STATUS counters.
+// Names the server does not know are absent from the map.
+func (a *MySQLAccessor) GlobalStatus(names ...string) (map[string]string, error) {
+	return a.nameValues("SHOW GLOBAL STATUS", names)
+}
+
+// GlobalVariables returns the named SHOW GLOBAL VARIABLES values.
+func (a *MySQLAccessor) GlobalVariables(names ...string) (map[string]string, error) {
+	return a.nameValues("SHOW GLOBAL VARIABLES", names)
+}
+
+// StatusLike runs SHOW GLOBAL STATUS LIKE <pattern>.
+func (a *MySQLAccessor) StatusLike(pattern string) (*ResultSet, error) {
+	return a.like("SHOW GLOBAL STATUS", pattern)
+}
+
+// VariablesLike runs SHOW GLOBAL VARIABLES LIKE <pattern>.
+func (a *MySQLAccessor) VariablesLike(pattern string) (*ResultSet, error) {
+	return a.like("SHOW GLOBAL VARIABLES", pattern)
+}
+
+var likePatternRe = regexp.MustCompile(`^[A-Za-z0-9_%]+$`)
+
+func (a *MySQLAccessor) like(stmt, pattern string) (*ResultSet, error) {
+	if pattern == "" {
+		pattern = "%"
+	}
+	if !likePatternRe.MatchString(pattern) {
+		return nil, fmt.Errorf("invalid pattern %q, only letters, digits, _ and %% are allowed", pattern)
+	}
+	return a.conn.query(fmt.Sprintf("%s LIKE '%s'", stmt, pattern))
+}
+
+func (a *MySQLAccessor) nameValues(stmt string, names []string) (map[string]string, error) {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		if !likePatternRe.MatchString(n) || strings.Contains(n, "%") {
+			return nil, fmt.Errorf("invalid variable name %q", n)
+		}
+		quoted = append(quoted, "'"+n+"'")
+	}
+	q := stmt
+	if len(quoted) > 0 {
+		q = fmt.Sprintf("%s WHERE Variable_name IN (%s)", stmt, strings.Join(quoted, ","))
+	}
+	rs, err := a.conn.query(q)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string, len(rs.Rows))
+	for _, row := range rs.Rows {
+		if len(row) >= 2 {
+			ret[row[0].String] = row[1].String
+		}
+	}
+	return ret, nil
+}
+
+// ReplicaStatus runs SHOW REPLICA STATUS, falling back to SHOW SLAVE STATUS
+// on servers older than MySQL 8.0.22 / MariaDB 10.5.1. An empty result means
+// the server is not a replica; multi-source replicas return one row per channel.
+func (a *MySQLAccessor) ReplicaStatus() (*ResultSet, error) {
+	rs, err := a.conn.query("SHOW REPLICA STATUS")
+	if isMySQLError(err, erParseError) {
+		return a.conn.query("SHOW SLAVE STATUS")
+	}
+	return rs, err
+}
+
+// InnoDBStatus returns the text of SHOW ENGINE INNODB STATUS.
+func (a *MySQLAccessor) InnoDBStatus() (string, error) {
+	rs, err := a.conn.query("SHOW ENGINE INNODB STATUS")
+	if err != nil {
+		return "", err
+	}
+	idx := rs.ColumnIndex("Status")
+	if idx < 0 || len(rs.Rows) == 0 {
+		return "", fmt.Errorf("unexpected SHOW ENGINE INNODB STATUS result")
+	}
+	return rs.Rows[0][idx].String, nil
+}
+
+// Processlist returns server threads, longest running first. Statement text
+// is truncated; idle (Sleep) connections are skipped unless includeSleep.
+func (a *MySQLAccessor) Processlist(includeSleep bool, limit int) (*ResultSet, error) {
+	where := "WHERE ID <> CONNECTION_ID()"
+	if !includeSleep {
+		where += " AND COMMAND <> 'Sleep'"
+	}
+	return a.conn.query(fmt.Sprintf(
+		"SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, LEFT(INFO, %d) AS INFO "+
+			"FROM information_schema.PROCESSLIST %s ORDER BY TIME DESC LIMIT %d",
+		maxQueryTextLen, where, limit))
+}
+
+// LockWaits returns InnoDB row lock waits with the waiting and blocking
+// sessions, longest wait first. It reads sys.innodb_lock_waits (MySQL 5.7+)
+// and falls back to the information_schema lock tables on servers without
+// the sys schema (MySQL 5.6, MariaDB).
+func (a *MySQLAccessor) LockWaits(limit int) (*ResultSet, error) {
+	rs, err := a.conn.query(fmt.Sprintf(
+		"SELECT wait_age_secs, locked_table, locked_index, waiting_lock_mode, "+
+			"waiting_pid, LEFT(waiting_query, %[1]d) AS waiting_query, "+
+			"blocking_pid, LEFT(blocking_query, %[1]d) AS blocking_query, blocking_trx_age "+
+			"FROM sys.innodb_lock_waits ORDER BY wait_age_secs DESC LIMIT %[2]d",
+		maxQueryTextLen, limit))
+	if !isMySQLError(err, erNoSuchTable, erBadDB, erDBAccessDenied, erTableAccessDenied) {
+		return rs, err
+	}
+	return a.conn.query(fmt.Sprintf(
+		"SELECT TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()) AS wait_age_secs, "+
+			"l.lock_table AS locked_table, l.lock_index AS locked_index, l.lock_mode AS waiting_lock_mode, "+
+			"r.trx_mysql_thread_id AS waiting_pid, LEFT(r.trx_query, %[1]d) AS waiting_query, "+
+			"b.trx_mysql_thread_id AS blocking_pid, LEFT(b.trx_query, %[1]d) AS blocking_query, "+
+			"SEC_TO_TIME(TIMESTAMPDIFF(SECOND, b.trx_started, NOW())) AS blocking_trx_age "+
+			"FROM information_schema.INNODB_LOCK_WAITS w "+
+			"JOIN information_schema.INNODB_TRX r ON r.trx_id = w.requesting_trx_id "+
+			"JOIN information_schema.INNODB_TRX b ON b.trx_id = w.blocking_trx_id "+
+			"JOIN information_schema.INNODB_LOCKS l ON l.lock_id = w.requested_lock_id "+
+			"ORDER BY wait_age_secs DESC LIMIT %[2]d",
+		maxQueryTextLen, limit))
+}
+
+// StatementDigests returns the statements with the highest total latency
+// from performance_schema, with times in seconds. The result is empty when
+// performance_schema is disabled.
+func (a *MySQLAccessor) StatementDigests(limit int) (*ResultSet, error) {
+	return a.conn.query(fmt.Sprintf(
+		"SELECT SCHEMA_NAME AS db, COUNT_STAR AS exec_count, "+
+			"ROUND(SUM_TIMER_WAIT/1e12, 3) AS total_sec, ROUND(AVG_TIMER_WAIT/1e12, 3) AS avg_sec, "+
+			"ROUND(MAX_TIMER_WAIT/1e12, 3) AS max_sec, SUM_ROWS_EXAMINED AS rows_examined, "+
+			"SUM_ROWS_SENT AS rows_sent, SUM_NO_INDEX_USED AS no_index_used, LAST_SEEN AS last_seen, "+
+			"LEFT(DIGEST_TEXT, %d) AS query "+
+			"FROM performance_schema.events_statements_summary_by_digest "+
+			"WHERE DIGEST_TEXT IS NOT NULL ORDER BY SUM_TIMER_WAIT DESC LIMIT %d",
+		maxQueryTextLen, limit))
+}
+
+// replicaChannel is one row of SHOW REPLICA STATUS, using the MySQL 8.0.22+
+// column names with fallbacks to the older Master/Slave names.
+type replicaChannel struct {
+	channel    string
+	sourceHost string
+	sourcePort string
+	ioRunning  string
+	sqlRunning string
+	lag        int64 // seconds behind source, -1 when NULL
+	lastIOErr  string
+	lastSQLErr string
+}
+
+func parseReplicaChannels(rs *ResultSet) []replicaChannel {
+	ret := make([]replicaChannel, 0, len(rs.Rows))
+	for _, row := range rs.RowMaps() {
+		get := func(names ...string) (string, bool) {
+			for _, n := range names {
+				if v, ok := row[n]; ok {
+					return v.String, v.Valid
+				}
+			}
+			return "", false
+		}
+		ch := replicaChannel{lag: -1}
+		ch.channel, _ = get("Channel_Name", "Connection_name")
+		ch.sourceHost, _ = get("Source_Host", "Master_Host")
+		ch.sourcePort, _ = get("Source_Port", "Master_Port")
+		ch.ioRunning, _ = get("Replica_IO_Running", "Slave_IO_Running")
+		ch.sqlRunning, _ = get("Replica_SQL_Running", "Slave_SQL_Running")
+		ch.lastIOErr, _ = get("Last_IO_Error")
+		ch.lastSQLErr, _ = get("Last_SQL_Error")
+		if v, ok := get("Seconds_Behind_Source", "Seconds_Behind_Master"); ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				ch.lag = n
+			}
+		}
+		ret = append(ret, ch)
+	}
+	return ret
+}
+
+func (ch replicaChannel) name() string {
+	if ch.channel == "" {
+		return "default"
+	}
+	return ch.channel
+}
+
+func (ch replicaChannel) source() string {
+	if ch.sourceHost == "" {
+		return ""
+	}
+	return net.JoinHostPort(ch.sourceHost, ch.sourcePort)
+}
+
+func (ch replicaChannel) running() bool {
+	return ch.ioRunning == "Yes" && ch.sqlRunning == "Yes"
+}
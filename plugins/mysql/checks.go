@@ -0,0 +1,316 @@
+package mysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const maxErrorAttrLen = 256
+
+func (ins *Instance) checkResponseTime(q *safe.Queue[*types.Event], target string, responseTime time.Duration) {
+	if ins.ResponseTime.WarnGe == 0 && ins.ResponseTime.CriticalGe == 0 {
+		return
+	}
+
+	attrs := map[string]string{
+		"response_time":  responseTime.String(),
+		"threshold_desc": durationThresholdDesc(ins.ResponseTime.WarnGe, ins.ResponseTime.CriticalGe),
+	}
+	event := ins.newEvent("mysql::response_time", target).SetAttrs(attrs).SetCurrentValue(responseTime.String())
+
+	status := types.EvaluateGeThreshold(float64(responseTime), float64(ins.ResponseTime.WarnGe), float64(ins.ResponseTime.CriticalGe))
+	switch status {
+	case types.EventStatusCritical:
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("mysql response time %s >= critical threshold %s",
+				responseTime, time.Duration(ins.ResponseTime.CriticalGe))))
+	case types.EventStatusWarning:
+		q.PushFront(event.SetEventStatus(types.EventStatusWarning).
+			SetDescription(fmt.Sprintf("mysql response time %s >= warning threshold %s",
+				responseTime, time.Duration(ins.ResponseTime.WarnGe))))
+	default:
+		q.PushFront(event.SetDescription(fmt.Sprintf("mysql response time %s, everything is ok", responseTime)))
+	}
+}
+
+// checkReplication alerts when the IO or SQL thread of any replication
+// channel is not running. Servers that are not replicas are reported ok.
+func (ins *Instance) checkReplication(q *safe.Queue[*types.Event], target string, channels []replicaChannel) {
+	event := ins.newEvent("mysql::replication", target)
+	attrs := map[string]string{
+		"threshold_desc": fmt.Sprintf("%s: replica IO or SQL thread not running", ins.Replication.Severity),
+	}
+	if len(channels) == 0 {
+		attrs["replica"] = "false"
+		q.PushFront(event.SetAttrs(attrs).SetDescription("mysql is not a replica, everything is ok"))
+		return
+	}
+
+	attrs["replica"] = "true"
+	if len(channels) > 1 {
+		attrs["channels"] = strconv.Itoa(len(channels))
+	}
+	var broken []string
+	var states []string
+	for _, ch := range channels {
+		prefix := ""
+		if len(channels) > 1 {
+			prefix = ch.name() + "."
+		}
+		attrs[prefix+"io_running"] = ch.ioRunning
+		attrs[prefix+"sql_running"] = ch.sqlRunning
+		if src := ch.source(); src != "" {
+			attrs[prefix+"source"] = src
+		}
+		if ch.lastIOErr != "" {
+			attrs[prefix+"last_io_error"] = truncate(ch.lastIOErr, maxErrorAttrLen)
+		}
+		if ch.lastSQLErr != "" {
+			attrs[prefix+"last_sql_error"] = truncate(ch.lastSQLErr, maxErrorAttrLen)
+		}
+		state := fmt.Sprintf("io=%s sql=%s", ch.ioRunning, ch.sqlRunning)
+		if len(channels) > 1 {
+			state = ch.name() + ": " + state
+		}
+		states = append(states, state)
+		if ch.running() {
+			continue
+		}
+
+		desc := fmt.Sprintf("channel %s: IO thread %s, SQL thread %s", ch.name(), ch.ioRunning, ch.sqlRunning)
+		if ch.lastIOErr != "" {
+			desc += ", last IO error: " + truncate(ch.lastIOErr, maxErrorAttrLen)
+		}
+		if ch.lastSQLErr != "" {
+			desc += ", last SQL error: " + truncate(ch.lastSQLErr, maxErrorAttrLen)
+		}
+		broken = append(broken, desc)
+	}
+	event.SetAttrs(attrs).SetCurrentValue(strings.Join(states, "; "))
+
+	if len(broken) > 0 {
+		q.PushFront(event.SetEventStatus(ins.Replication.Severity).
+			SetDescription("mysql replication is not running: " + strings.Join(broken, "; ")))
+		return
+	}
+	q.PushFront(event.SetDescription("mysql replication IO and SQL threads are running, everything is ok"))
+}
+
+// checkReplLag evaluates Seconds_Behind_Source, taking the largest lag across
+// channels. A NULL lag means a replication thread is stopped and the lag is
+// unknown, which is reported as critical.
+func (ins *Instance) checkReplLag(q *safe.Queue[*types.Event], target string, channels []replicaChannel) {
+	event := ins.newEvent("mysql::repl_lag", target)
+	attrs := map[string]string{
+		"threshold_desc": durationThresholdDesc(ins.ReplLag.WarnGe, ins.ReplLag.CriticalGe),
+	}
+	if len(channels) == 0 {
+		q.PushFront(event.SetAttrs(attrs).SetDescription("mysql is not a replica, replication lag check skipped"))
+		return
+	}
+
+	var maxLag int64
+	var maxChannel string
+	var unknown []string
+	for _, ch := range channels {
+		if ch.lag < 0 {
+			unknown = append(unknown, ch.name())
+			continue
+		}
+		if maxChannel == "" || ch.lag > maxLag {
+			maxLag, maxChannel = ch.lag, ch.name()
+		}
+	}
+	if len(unknown) > 0 {
+		attrs["repl_lag"] = "NULL"
+		q.PushFront(event.SetAttrs(attrs).SetCurrentValue("NULL").
+			SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("mysql replication lag unknown on channel %s, replication threads are not running",
+				strings.Join(unknown, ", "))))
+		return
+	}
+
+	lag := time.Duration(maxLag) * time.Second
+	attrs["repl_lag"] = lag.String()
+	attrs["repl_lag_seconds"] = strconv.FormatInt(maxLag, 10)
+	if len(channels) > 1 {
+		attrs["channel"] = maxChannel
+	}
+	event.SetAttrs(attrs).SetCurrentValue(lag.String())
+
+	status := types.EvaluateGeThreshold(float64(lag), float64(ins.ReplLag.WarnGe), float64(ins.ReplLag.CriticalGe))
+	switch status {
+	case types.EventStatusCritical:
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("mysql replication lag %s >= critical threshold %s",
+				lag, time.Duration(ins.ReplLag.CriticalGe))))
+	case types.EventStatusWarning:
+		q.PushFront(event.SetEventStatus(types.EventStatusWarning).
+			SetDescription(fmt.Sprintf("mysql replication lag %s >= warning threshold %s",
+				lag, time.Duration(ins.ReplLag.WarnGe))))
+	default:
+		q.PushFront(event.SetDescription(fmt.Sprintf("mysql replication lag %s, everything is ok", lag)))
+	}
+}
+
+// checkConnections compares Threads_connected with max_connections.
+func (ins *Instance) checkConnections(q *safe.Queue[*types.Event], target string, acc *MySQLAccessor) {
+	event := ins.newEvent("mysql::connections", target)
+	vars, err := acc.GlobalVariables("max_connections")
+	if err != nil {
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to query mysql global variables: %v", err)))
+		return
+	}
+	status, err := acc.GlobalStatus("Threads_connected", "Threads_running", "Max_used_connections")
+	if err != nil {
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to query mysql global status: %v", err)))
+		return
+	}
+
+	maxConn, err := strconv.ParseInt(vars["max_connections"], 10, 64)
+	if err != nil || maxConn <= 0 {
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("invalid mysql max_connections %q", vars["max_connections"])))
+		return
+	}
+	connected, err := strconv.ParseInt(status["Threads_connected"], 10, 64)
+	if err != nil {
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("invalid mysql Threads_connected %q", status["Threads_connected"])))
+		return
+	}
+
+	percent := float64(connected) * 100 / float64(maxConn)
+	var parts []string
+	if ins.Connections.WarnGe > 0 {
+		parts = append(parts, fmt.Sprintf("Warning ≥ %d%%", ins.Connections.WarnGe))
+	}
+	if ins.Connections.CriticalGe > 0 {
+		parts = append(parts, fmt.Sprintf("Critical ≥ %d%%", ins.Connections.CriticalGe))
+	}
+	attrs := map[string]string{
+		"threads_connected": strconv.FormatInt(connected, 10),
+		"max_connections":   strconv.FormatInt(maxConn, 10),
+		"connections_pct":   fmt.Sprintf("%.1f%%", percent),
+		"threshold_desc":    strings.Join(parts, ", "),
+	}
+	if v, ok := status["Threads_running"]; ok {
+		attrs["threads_running"] = v
+	}
+	if v, ok := status["Max_used_connections"]; ok {
+		attrs["max_used_connections"] = v
+	}
+	event.SetAttrs(attrs).SetCurrentValue(fmt.Sprintf("%.1f%%", percent))
+
+	result := types.EvaluateGeThreshold(percent, float64(ins.Connections.WarnGe), float64(ins.Connections.CriticalGe))
+	switch result {
+	case types.EventStatusCritical:
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("mysql connections %d/%d (%.1f%%) >= critical threshold %d%%",
+				connected, maxConn, percent, ins.Connections.CriticalGe)))
+	case types.EventStatusWarning:
+		q.PushFront(event.SetEventStatus(types.EventStatusWarning).
+			SetDescription(fmt.Sprintf("mysql connections %d/%d (%.1f%%) >= warning threshold %d%%",
+				connected, maxConn, percent, ins.Connections.WarnGe)))
+	default:
+		q.PushFront(event.SetDescription(fmt.Sprintf("mysql connections %d/%d (%.1f%%), everything is ok",
+			connected, maxConn, percent)))
+	}
+}
+
+// checkAbortedConnects alerts on the growth of Aborted_connects (failed
+// logins, handshake timeouts) between two gathers.
+func (ins *Instance) checkAbortedConnects(q *safe.Queue[*types.Event], target string, status map[string]string) {
+	raw, ok := status["Aborted_connects"]
+	if !ok {
+		q.PushFront(ins.newEvent("mysql::aborted_connects", target).
+			SetEventStatus(types.EventStatusCritical).
+			SetDescription("mysql global status missing Aborted_connects"))
+		return
+	}
+	total, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		q.PushFront(ins.newEvent("mysql::aborted_connects", target).
+			SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to parse mysql Aborted_connects: %v", err)))
+		return
+	}
+
+	ins.statsMu.Lock()
+	prev := ins.prevStats[target]
+	initialized := ins.initialized[target]
+	ins.prevStats[target] = total
+	ins.initialized[target] = true
+	ins.statsMu.Unlock()
+
+	if !initialized {
+		event := ins.newEvent("mysql::aborted_connects", target).SetAttrs(map[string]string{
+			"delta": "0",
+			"total": strconv.FormatUint(total, 10),
+		})
+		q.PushFront(event.SetDescription(fmt.Sprintf("mysql aborted connects baseline established (total: %d)", total)))
+		return
+	}
+
+	delta := uint64(0)
+	if total >= prev {
+		delta = total - prev
+	}
+
+	var parts []string
+	if ins.AbortedConnects.WarnGe > 0 {
+		parts = append(parts, fmt.Sprintf("Warning ≥ %d", ins.AbortedConnects.WarnGe))
+	}
+	if ins.AbortedConnects.CriticalGe > 0 {
+		parts = append(parts, fmt.Sprintf("Critical ≥ %d", ins.AbortedConnects.CriticalGe))
+	}
+	attrs := map[string]string{
+		"delta":          strconv.FormatUint(delta, 10),
+		"total":          strconv.FormatUint(total, 10),
+		"threshold_desc": strings.Join(parts, ", "),
+	}
+	event := ins.newEvent("mysql::aborted_connects", target).SetAttrs(attrs).SetCurrentValue(strconv.FormatUint(delta, 10))
+
+	result := types.EvaluateGeThreshold(float64(delta), float64(ins.AbortedConnects.WarnGe), float64(ins.AbortedConnects.CriticalGe))
+	switch result {
+	case types.EventStatusCritical:
+		q.PushFront(event.SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("mysql aborted connects delta %d >= critical threshold %d", delta, ins.AbortedConnects.CriticalGe)))
+	case types.EventStatusWarning:
+		q.PushFront(event.SetEventStatus(types.EventStatusWarning).
+			SetDescription(fmt.Sprintf("mysql aborted connects delta %d >= warning threshold %d", delta, ins.AbortedConnects.WarnGe)))
+	default:
+		q.PushFront(event.SetDescription(fmt.Sprintf("mysql aborted connects delta %d, everything is ok", delta)))
+	}
+}
+
+func durationThresholdDesc(warn, critical config.Duration) string {
+	var parts []string
+	if warn > 0 {
+		parts = append(parts, fmt.Sprintf("Warning ≥ %s", time.Duration(warn)))
+	}
+	if critical > 0 {
+		parts = append(parts, fmt.Sprintf("Critical ≥ %s", time.Duration(critical)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,315 @@
+package mysql
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	tlscfg "github.com/cprobe/catpaw/digcore/pkg/tls"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/secret"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+// This file owns MySQL plugin configuration lifecycle:
+// partial template merge, Init defaults, validation, and normalization helpers.
+
+func (p *MySQLPlugin) ApplyPartials() error {
+	partialByID := make(map[string]Partial, len(p.Partials))
+	for _, partial := range p.Partials {
+		if partial.ID == "" {
+			return fmt.Errorf("mysql partial id must not be empty")
+		}
+		if _, exists := partialByID[partial.ID]; exists {
+			return fmt.Errorf("duplicate mysql partial id %q", partial.ID)
+		}
+		partialByID[partial.ID] = partial
+	}
+
+	for i := 0; i < len(p.Instances); i++ {
+		id := p.Instances[i].Partial
+		if id == "" {
+			continue
+		}
+		partial, ok := partialByID[id]
+		if !ok {
+			return fmt.Errorf("mysql partial %q not found", id)
+		}
+		ins := p.Instances[i]
+		if ins.Concurrency == 0 {
+			ins.Concurrency = partial.Concurrency
+		}
+		if ins.Timeout == 0 {
+			ins.Timeout = partial.Timeout
+		}
+		if ins.ReadTimeout == 0 {
+			ins.ReadTimeout = partial.ReadTimeout
+		}
+		if ins.Username == "" {
+			ins.Username = partial.Username
+		}
+		if ins.Password == "" {
+			ins.Password = partial.Password
+		}
+		if ins.ClusterName == "" {
+			ins.ClusterName = partial.ClusterName
+		}
+		if ins.ServerPublicKey == "" {
+			ins.ServerPublicKey = partial.ServerPublicKey
+		}
+		if ins.AllowPublicKeyRetrieval == nil {
+			ins.AllowPublicKeyRetrieval = cloneBoolPtr(partial.AllowPublicKeyRetrieval)
+		}
+		mergeClientConfig(&ins.ClientConfig, partial.ClientConfig)
+		mergeConnectivityCheck(&ins.Connectivity, partial.Connectivity)
+		mergeResponseTimeCheck(&ins.ResponseTime, partial.ResponseTime)
+		mergeReplicationCheck(&ins.Replication, partial.Replication)
+		mergeReplLagCheck(&ins.ReplLag, partial.ReplLag)
+		mergePercentCheck(&ins.Connections, partial.Connections)
+		mergeCountCheck(&ins.AbortedConnects, partial.AbortedConnects)
+	}
+	return nil
+}
+
+func mergeConnectivityCheck(dst *ConnectivityCheck, src ConnectivityCheck) {
+	if dst.Severity == "" {
+		dst.Severity = src.Severity
+	}
+}
+
+func mergeResponseTimeCheck(dst *ResponseTimeCheck, src ResponseTimeCheck) {
+	if dst.WarnGe == 0 {
+		dst.WarnGe = src.WarnGe
+	}
+	if dst.CriticalGe == 0 {
+		dst.CriticalGe = src.CriticalGe
+	}
+}
+
+func mergeReplLagCheck(dst *ReplLagCheck, src ReplLagCheck) {
+	if dst.WarnGe == 0 {
+		dst.WarnGe = src.WarnGe
+	}
+	if dst.CriticalGe == 0 {
+		dst.CriticalGe = src.CriticalGe
+	}
+}
+
+func mergeReplicationCheck(dst *ReplicationCheck, src ReplicationCheck) {
+	if dst.Disabled == nil {
+		dst.Disabled = cloneBoolPtr(src.Disabled)
+	}
+	if dst.Severity == "" {
+		dst.Severity = src.Severity
+	}
+}
+
+func mergePercentCheck(dst *PercentCheck, src PercentCheck) {
+	if dst.WarnGe == 0 {
+		dst.WarnGe = src.WarnGe
+	}
+	if dst.CriticalGe == 0 {
+		dst.CriticalGe = src.CriticalGe
+	}
+}
+
+func mergeCountCheck(dst *CountCheck, src CountCheck) {
+	if dst.WarnGe == 0 {
+		dst.WarnGe = src.WarnGe
+	}
+	if dst.CriticalGe == 0 {
+		dst.CriticalGe = src.CriticalGe
+	}
+}
+
+func cloneBoolPtr(v *bool) *bool {
+	if v == nil {
+		return nil
+	}
+	cp := *v
+	return &cp
+}
+
+func (p *MySQLPlugin) GetInstances() []plugins.Instance {
+	ret := make([]plugins.Instance, len(p.Instances))
+	for i := 0; i < len(p.Instances); i++ {
+		ret[i] = p.Instances[i]
+	}
+	return ret
+}
+
+func (ins *Instance) Init() error {
+	if ins.Concurrency == 0 {
+		ins.Concurrency = 10
+	}
+	if ins.Timeout == 0 {
+		ins.Timeout = config.Duration(3 * time.Second)
+	}
+	if ins.ReadTimeout == 0 {
+		ins.ReadTimeout = config.Duration(2 * time.Second)
+	}
+	if ins.Connectivity.Severity == "" {
+		ins.Connectivity.Severity = types.EventStatusCritical
+	} else if !types.EventStatusValid(ins.Connectivity.Severity) {
+		return fmt.Errorf("invalid connectivity.severity %q", ins.Connectivity.Severity)
+	}
+	if err := validateDurationCheck("response_time", ins.ResponseTime.WarnGe, ins.ResponseTime.CriticalGe); err != nil {
+		return err
+	}
+	if ins.replicationEnabled() {
+		if ins.Replication.Severity == "" {
+			ins.Replication.Severity = types.EventStatusCritical
+		} else if !types.EventStatusValid(ins.Replication.Severity) {
+			return fmt.Errorf("invalid replication.severity %q", ins.Replication.Severity)
+		}
+	}
+	if err := validateDurationCheck("repl_lag", ins.ReplLag.WarnGe, ins.ReplLag.CriticalGe); err != nil {
+		return err
+	}
+	if err := validatePercentCheck("connections", ins.Connections); err != nil {
+		return err
+	}
+	if err := validateCountCheck("aborted_connects", ins.AbortedConnects); err != nil {
+		return err
+	}
+
+	var err error
+	if ins.Password, err = secret.Resolve(ins.Password); err != nil {
+		return fmt.Errorf("password: %w", err)
+	}
+	if len(ins.Targets) > 0 && ins.Username == "" {
+		return fmt.Errorf("username must not be empty")
+	}
+
+	for i := 0; i < len(ins.Targets); i++ {
+		target, err := normalizeTarget(ins.Targets[i])
+		if err != nil {
+			return err
+		}
+		ins.Targets[i] = target
+	}
+
+	tlsConfig, err := ins.ClientConfig.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build mysql TLS config: %v", err)
+	}
+	ins.tlsConfig = tlsConfig
+
+	if ins.ServerPublicKey != "" {
+		data, err := os.ReadFile(ins.ServerPublicKey)
+		if err != nil {
+			return fmt.Errorf("server_public_key: %w", err)
+		}
+		if ins.serverKey, err = parsePublicKey(data); err != nil {
+			return fmt.Errorf("server_public_key %s: %w", ins.ServerPublicKey, err)
+		}
+	}
+	if ins.prevStats == nil {
+		ins.prevStats = make(map[string]uint64)
+	}
+	if ins.initialized == nil {
+		ins.initialized = make(map[string]bool)
+	}
+
+	return nil
+}
+
+func (ins *Instance) replicationEnabled() bool {
+	return ins.Replication.Disabled == nil || !*ins.Replication.Disabled
+}
+
+func mergeClientConfig(dst *tlscfg.ClientConfig, src tlscfg.ClientConfig) {
+	if dst.UseTLS == nil {
+		dst.UseTLS = cloneBoolPtr(src.UseTLS)
+	}
+	if dst.TLSCA == "" {
+		dst.TLSCA = src.TLSCA
+	}
+	if dst.TLSCert == "" {
+		dst.TLSCert = src.TLSCert
+	}
+	if dst.TLSKey == "" {
+		dst.TLSKey = src.TLSKey
+	}
+	if dst.TLSKeyPwd == "" {
+		dst.TLSKeyPwd = src.TLSKeyPwd
+	}
+	if dst.InsecureSkipVerify == nil {
+		dst.InsecureSkipVerify = cloneBoolPtr(src.InsecureSkipVerify)
+	}
+	if dst.ServerName == "" {
+		dst.ServerName = src.ServerName
+	}
+	if dst.TLSMinVersion == "" {
+		dst.TLSMinVersion = src.TLSMinVersion
+	}
+	if dst.TLSMaxVersion == "" {
+		dst.TLSMaxVersion = src.TLSMaxVersion
+	}
+}
+
+func validateDurationCheck(name string, warn, critical config.Duration) error {
+	if warn < 0 || critical < 0 {
+		return fmt.Errorf("%s thresholds must be >= 0", name)
+	}
+	if warn > 0 && critical > 0 && warn >= critical {
+		return fmt.Errorf("%s.warn_ge(%s) must be less than %s.critical_ge(%s)",
+			name, time.Duration(warn), name, time.Duration(critical))
+	}
+	return nil
+}
+
+func validateCountCheck(name string, check CountCheck) error {
+	if check.WarnGe < 0 || check.CriticalGe < 0 {
+		return fmt.Errorf("%s thresholds must be >= 0", name)
+	}
+	if check.WarnGe > 0 && check.CriticalGe > 0 && check.WarnGe >= check.CriticalGe {
+		return fmt.Errorf("%s.warn_ge(%d) must be less than %s.critical_ge(%d)",
+			name, check.WarnGe, name, check.CriticalGe)
+	}
+	return nil
+}
+
+func validatePercentCheck(name string, check PercentCheck) error {
+	if check.WarnGe < 0 || check.CriticalGe < 0 {
+		return fmt.Errorf("%s thresholds must be >= 0", name)
+	}
+	if check.WarnGe > 100 || check.CriticalGe > 100 {
+		return fmt.Errorf("%s thresholds must be <= 100", name)
+	}
+	if check.WarnGe > 0 && check.CriticalGe > 0 && check.WarnGe >= check.CriticalGe {
+		return fmt.Errorf("%s.warn_ge(%d) must be less than %s.critical_ge(%d)",
+			name, check.WarnGe, name, check.CriticalGe)
+	}
+	return nil
+}
+
+func normalizeTarget(raw string) (string, error) {
+	target := strings.TrimSpace(raw)
+	if target == "" {
+		return "", fmt.Errorf("mysql target must not be empty")
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err == nil {
+		if port == "" {
+			return "", fmt.Errorf("bad port, target: %s", raw)
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+
+	if strings.Contains(err.Error(), "missing port in address") {
+		if strings.Count(target, ":") > 1 && !strings.HasPrefix(target, "[") {
+			return "", fmt.Errorf("mysql IPv6 target must use [addr]:port format: %s", raw)
+		}
+		return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(target, "["), "]"), defaultMySQLPort), nil
+	}
+
+	return "", fmt.Errorf("failed to parse mysql target %q: %v", raw, err)
+}
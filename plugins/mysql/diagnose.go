@@ -0,0 +1,445 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/plugins"
+)
+
+const maxCellLen = 120
+
+var _ plugins.Diagnosable = (*MySQLPlugin)(nil)
+
+// RegisterDiagnoseTools implements plugins.Diagnosable for MySQLPlugin.
+// It registers read-only diagnostic tools and the accessor factory.
+func (p *MySQLPlugin) RegisterDiagnoseTools(registry *diagnose.ToolRegistry) {
+	registry.RegisterCategory("mysql", "mysql", "MySQL diagnostic tools (PROCESSLIST, INNODB STATUS, lock waits, slow queries, replication, status/variables)", diagnose.ToolScopeRemote)
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name: "mysql_processlist",
+		Description: "Show server threads from information_schema.PROCESSLIST, longest running first, with statement text truncated. " +
+			"Idle (Sleep) connections are hidden unless include_sleep=true. Use for slow response, connection usage and lock alerts.",
+		Parameters: []diagnose.ToolParam{
+			{Name: "include_sleep", Type: "bool", Description: "Include idle Sleep connections (default false)", Required: false},
+			{Name: "limit", Type: "int", Description: "Max threads to return (default 50, max 500)", Required: false},
+		},
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			includeSleep, _ := strconv.ParseBool(strings.TrimSpace(args["include_sleep"]))
+			limit := clampInt(parseIntArg(args["limit"], 50), 1, 500)
+			rs, err := acc.Processlist(includeSleep, limit)
+			if err != nil {
+				return "", fmt.Errorf("mysql processlist: %w", err)
+			}
+			if len(rs.Rows) == 0 {
+				return "No active threads besides this connection.", nil
+			}
+			return formatTable(rs), nil
+		},
+	})
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name: "mysql_innodb_status",
+		Description: "Get SHOW ENGINE INNODB STATUS: LATEST DETECTED DEADLOCK, TRANSACTIONS, SEMAPHORES, BUFFER POOL AND MEMORY, ROW OPERATIONS, LOG, etc. " +
+			"Pass section to return only matching sections (e.g. section=deadlock or section=transactions). Requires the PROCESS privilege.",
+		Parameters: []diagnose.ToolParam{
+			{Name: "section", Type: "string", Description: "Case-insensitive section title filter (default: whole output)", Required: false},
+		},
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			status, err := acc.InnoDBStatus()
+			if err != nil {
+				return "", fmt.Errorf("mysql SHOW ENGINE INNODB STATUS: %w", err)
+			}
+			section := strings.TrimSpace(args["section"])
+			if section == "" {
+				return status, nil
+			}
+			out, titles := filterInnoDBSections(status, section)
+			if out == "" {
+				return fmt.Sprintf("No InnoDB status section matches %q. Available sections: %s", section, strings.Join(titles, ", ")), nil
+			}
+			return out, nil
+		},
+	})
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name: "mysql_lock_waits",
+		Description: "Show InnoDB row lock waits: who is waiting, on which table/index, and the blocking session with its statement and transaction age. " +
+			"Uses sys.innodb_lock_waits, or the information_schema lock tables on MySQL 5.6 / MariaDB. " +
+			"A blocking session with a NULL query is an idle transaction that has not committed.",
+		Parameters: []diagnose.ToolParam{
+			{Name: "limit", Type: "int", Description: "Max lock waits to return (default 20, max 200)", Required: false},
+		},
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			limit := clampInt(parseIntArg(args["limit"], 20), 1, 200)
+			rs, err := acc.LockWaits(limit)
+			if err != nil {
+				return "", fmt.Errorf("mysql lock waits: %w", err)
+			}
+			if len(rs.Rows) == 0 {
+				return "No InnoDB lock waits.", nil
+			}
+			return formatVertical(rs), nil
+		},
+	})
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name: "mysql_slow_queries",
+		Description: "Show slow query settings (slow_query_log, long_query_time, Slow_queries counter) and the statements with the highest total latency " +
+			"from performance_schema.events_statements_summary_by_digest (exec count, total/avg/max seconds, rows examined vs sent, no-index scans). " +
+			"Digests are cumulative since server start or the last truncate.",
+		Parameters: []diagnose.ToolParam{
+			{Name: "limit", Type: "int", Description: "Max statement digests to return (default 10, max 50)", Required: false},
+		},
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			limit := clampInt(parseIntArg(args["limit"], 10), 1, 50)
+			return slowQueries(acc, limit)
+		},
+	})
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name: "mysql_replication_status",
+		Description: "Show the full SHOW REPLICA STATUS (SHOW SLAVE STATUS on older servers) output, one block per channel: " +
+			"IO/SQL thread state, source, lag, executed positions/GTIDs and last errors. NOTE: a summary is pre-collected in context.",
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			rs, err := acc.ReplicaStatus()
+			if err != nil {
+				return "", fmt.Errorf("mysql replica status: %w", err)
+			}
+			if len(rs.Rows) == 0 {
+				return "This server is not a replica (replica status is empty).", nil
+			}
+			return formatVertical(rs), nil
+		},
+	})
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name:        "mysql_status",
+		Description: "Execute SHOW GLOBAL STATUS LIKE <pattern> (e.g. Threads%, Innodb_row_lock%, Aborted%, Com_%). Default: all counters.",
+		Parameters: []diagnose.ToolParam{
+			{Name: "pattern", Type: "string", Description: "LIKE pattern, letters/digits/_/% only (default %)", Required: false},
+		},
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			rs, err := acc.StatusLike(strings.TrimSpace(args["pattern"]))
+			if err != nil {
+				return "", fmt.Errorf("mysql SHOW GLOBAL STATUS: %w", err)
+			}
+			return formatNameValues(rs), nil
+		},
+	})
+
+	registry.Register("mysql", diagnose.DiagnoseTool{
+		Name:        "mysql_variables",
+		Description: "Execute SHOW GLOBAL VARIABLES LIKE <pattern> (e.g. max_connections, innodb_buffer_pool%, %timeout). Default: all variables.",
+		Parameters: []diagnose.ToolParam{
+			{Name: "pattern", Type: "string", Description: "LIKE pattern, letters/digits/_/% only (default %)", Required: false},
+		},
+		Scope: diagnose.ToolScopeRemote,
+		RemoteExecute: func(ctx context.Context, session *diagnose.DiagnoseSession, args map[string]string) (string, error) {
+			acc, err := getAccessor(session)
+			if err != nil {
+				return "", err
+			}
+			rs, err := acc.VariablesLike(strings.TrimSpace(args["pattern"]))
+			if err != nil {
+				return "", fmt.Errorf("mysql SHOW GLOBAL VARIABLES: %w", err)
+			}
+			return formatNameValues(rs), nil
+		},
+	})
+
+	registry.RegisterAccessorFactory("mysql", func(ctx context.Context, instanceRef any, target string) (any, error) {
+		ins, ok := instanceRef.(*Instance)
+		if !ok {
+			return nil, fmt.Errorf("mysql accessor factory: expected *Instance, got %T", instanceRef)
+		}
+		if target == "" && len(ins.Targets) > 0 {
+			target = ins.Targets[0]
+		}
+		acc, err := ins.newAccessor(target)
+		if err != nil {
+			return nil, err
+		}
+		return acc, nil
+	})
+
+	registry.RegisterPreCollector("mysql", func(ctx context.Context, accessor any) string {
+		acc, ok := accessor.(*MySQLAccessor)
+		if !ok {
+			return ""
+		}
+		return preCollect(acc)
+	})
+	registry.SetDiagnoseHints("mysql", `
+- 连接数告警 → 预采集数据已含 Threads_connected / max_connections，再调 mysql_processlist 看连接来源；大量 Sleep 连接时加 include_sleep=true 判断是否连接池泄漏
+- 响应慢 / Threads_running 高 → mysql_processlist + mysql_lock_waits（可并行调用），再用 mysql_slow_queries 找总耗时最高的语句
+- 锁等待 / 死锁 → mysql_lock_waits；死锁详情调 mysql_innodb_status section=deadlock；blocking_query 为 NULL 说明持锁事务已空闲未提交
+- 复制告警 → 预采集数据已含复制摘要，需要完整字段（GTID、位点、错误）时调 mysql_replication_status
+- aborted_connects 告警 → mysql_status pattern=Aborted% + mysql_status pattern=Connection_errors%，区分密码错误、超时与 max_connect_errors
+- 参数核对 → mysql_variables，如 pattern=%timeout 或 pattern=innodb_buffer_pool%
+- 首轮建议并行调用 2-3 个最相关的工具，避免逐个调用浪费轮次`)
+}
+
+func getAccessor(session *diagnose.DiagnoseSession) (*MySQLAccessor, error) {
+	if session.Accessor == nil {
+		return nil, fmt.Errorf("no mysql accessor in session (remote connection not established)")
+	}
+	acc, ok := session.Accessor.(*MySQLAccessor)
+	if !ok {
+		return nil, fmt.Errorf("session accessor is %T, expected *MySQLAccessor", session.Accessor)
+	}
+	return acc, nil
+}
+
+var (
+	preCollectVariables = []string{
+		"version", "version_comment", "read_only", "super_read_only", "max_connections",
+		"innodb_buffer_pool_size", "long_query_time", "slow_query_log",
+	}
+	preCollectStatus = []string{
+		"Uptime", "Threads_connected", "Threads_running", "Max_used_connections",
+		"Aborted_connects", "Aborted_clients", "Slow_queries", "Questions",
+		"Innodb_row_lock_current_waits", "Innodb_row_lock_waits",
+	}
+)
+
+// preCollect gathers a compact server summary: key variables and counters
+// plus one replication line per channel.
+func preCollect(acc *MySQLAccessor) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[SERVER]\ntarget: %s\nversion: %s\n", acc.Target(), acc.ServerVersion())
+
+	if vars, err := acc.GlobalVariables(preCollectVariables...); err == nil {
+		b.WriteString("\n[VARIABLES]\n")
+		writeOrdered(&b, vars, preCollectVariables)
+	}
+	if status, err := acc.GlobalStatus(preCollectStatus...); err == nil {
+		b.WriteString("\n[STATUS]\n")
+		writeOrdered(&b, status, preCollectStatus)
+	}
+
+	b.WriteString("\n[REPLICATION]\n")
+	rs, err := acc.ReplicaStatus()
+	switch {
+	case err != nil:
+		fmt.Fprintf(&b, "replica status unavailable: %v\n", err)
+	case len(rs.Rows) == 0:
+		b.WriteString("not a replica\n")
+	default:
+		for _, ch := range parseReplicaChannels(rs) {
+			lag := "NULL"
+			if ch.lag >= 0 {
+				lag = strconv.FormatInt(ch.lag, 10) + "s"
+			}
+			fmt.Fprintf(&b, "channel %s: source=%s io=%s sql=%s lag=%s\n",
+				ch.name(), ch.source(), ch.ioRunning, ch.sqlRunning, lag)
+			if ch.lastIOErr != "" {
+				fmt.Fprintf(&b, "  last_io_error: %s\n", ch.lastIOErr)
+			}
+			if ch.lastSQLErr != "" {
+				fmt.Fprintf(&b, "  last_sql_error: %s\n", ch.lastSQLErr)
+			}
+		}
+	}
+	return b.String()
+}
+
+func writeOrdered(b *strings.Builder, values map[string]string, keys []string) {
+	for _, k := range keys {
+		if v, ok := values[k]; ok {
+			fmt.Fprintf(b, "%s: %s\n", k, v)
+		}
+	}
+}
+
+func slowQueries(acc *MySQLAccessor, limit int) (string, error) {
+	var b strings.Builder
+	b.WriteString("[SLOW QUERY LOG]\n")
+	if vars, err := acc.GlobalVariables("slow_query_log", "long_query_time", "log_output", "performance_schema"); err == nil {
+		writeOrdered(&b, vars, []string{"slow_query_log", "long_query_time", "log_output", "performance_schema"})
+	}
+	if status, err := acc.GlobalStatus("Slow_queries"); err == nil {
+		writeOrdered(&b, status, []string{"Slow_queries"})
+	}
+
+	b.WriteString("\n[TOP STATEMENTS BY TOTAL LATENCY]\n")
+	rs, err := acc.StatementDigests(limit)
+	switch {
+	case err != nil:
+		fmt.Fprintf(&b, "performance_schema statement digests unavailable: %v\n", err)
+		b.WriteString("Grant SELECT on performance_schema.* to the monitoring user, or check the slow query log file on the server.\n")
+	case len(rs.Rows) == 0:
+		b.WriteString("No statement digests (performance_schema is disabled or the digest table was truncated).\n")
+	default:
+		b.WriteString(formatVertical(rs))
+	}
+	return b.String(), nil
+}
+
+// filterInnoDBSections returns the sections of SHOW ENGINE INNODB STATUS
+// whose title contains filter, plus all section titles. Sections start with
+// a title line framed by dashed lines.
+func filterInnoDBSections(status, filter string) (string, []string) {
+	lines := strings.Split(status, "\n")
+	filter = strings.ToLower(filter)
+
+	var b strings.Builder
+	var titles []string
+	include := false
+	for i := 0; i < len(lines); i++ {
+		if isDashLine(lines[i]) && i+2 < len(lines) && isDashLine(lines[i+2]) && !isDashLine(lines[i+1]) {
+			title := strings.TrimSpace(lines[i+1])
+			titles = append(titles, title)
+			include = strings.Contains(strings.ToLower(title), filter)
+			if include {
+				b.WriteString(strings.Join(lines[i:i+3], "\n"))
+				b.WriteByte('\n')
+			}
+			i += 2 // the closing dash line must not start another header
+			continue
+		}
+		if include {
+			b.WriteString(lines[i])
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), titles
+}
+
+func isDashLine(s string) bool {
+	s = strings.TrimSpace(s)
+	return len(s) >= 3 && strings.Trim(s, "-") == ""
+}
+
+// formatTable renders a result set as aligned columns, NULL as "NULL".
+func formatTable(rs *ResultSet) string {
+	cells := make([][]string, 0, len(rs.Rows)+1)
+	cells = append(cells, rs.Columns)
+	for _, row := range rs.Rows {
+		line := make([]string, len(rs.Columns))
+		for i := range line {
+			line[i] = cellString(row, i)
+		}
+		cells = append(cells, line)
+	}
+
+	widths := make([]int, len(rs.Columns))
+	for _, line := range cells {
+		for i, c := range line {
+			if len(c) > widths[i] {
+				widths[i] = len(c)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range cells {
+		for i, c := range line {
+			if i == len(line)-1 {
+				b.WriteString(c)
+				break
+			}
+			fmt.Fprintf(&b, "%-*s  ", widths[i], c)
+		}
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "(%d rows)\n", len(rs.Rows))
+	return b.String()
+}
+
+// formatVertical renders one "name: value" block per row, like the mysql
+// client's \G.
+func formatVertical(rs *ResultSet) string {
+	width := 0
+	for _, c := range rs.Columns {
+		if len(c) > width {
+			width = len(c)
+		}
+	}
+	var b strings.Builder
+	for n, row := range rs.Rows {
+		fmt.Fprintf(&b, "*************************** %d. row ***************************\n", n+1)
+		for i, c := range rs.Columns {
+			v := "NULL"
+			if i < len(row) && row[i].Valid {
+				v = row[i].String
+			}
+			fmt.Fprintf(&b, "%*s: %s\n", width, c, v)
+		}
+	}
+	return b.String()
+}
+
+func formatNameValues(rs *ResultSet) string {
+	if len(rs.Rows) == 0 {
+		return "No matching entries."
+	}
+	var b strings.Builder
+	for _, row := range rs.Rows {
+		fmt.Fprintf(&b, "%-45s %s\n", cellString(row, 0), cellString(row, 1))
+	}
+	return b.String()
+}
+
+func cellString(row []sql.NullString, i int) string {
+	if i >= len(row) || !row[i].Valid {
+		return "NULL"
+	}
+	s := strings.Join(strings.Fields(row[i].String), " ")
+	return truncate(s, maxCellLen)
+}
+
+func parseIntArg(raw string, fallback int) int {
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func clampInt(v, minV, maxV int) int {
+	if v < minV {
+		return minV
+	}
+	if v > maxV {
+		return maxV
+	}
+	return v
+}
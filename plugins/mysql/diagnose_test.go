@@ -0,0 +1,253 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/diagnose"
+)
+
+var expectedTools = []string{
+	"mysql_processlist", "mysql_innodb_status", "mysql_lock_waits", "mysql_slow_queries",
+	"mysql_replication_status", "mysql_status", "mysql_variables",
+}
+
+func TestRegisterDiagnoseTools(t *testing.T) {
+	registry := diagnose.NewToolRegistry()
+	p := &MySQLPlugin{}
+	p.RegisterDiagnoseTools(registry)
+
+	for _, name := range expectedTools {
+		tool, ok := registry.Get(name)
+		if !ok {
+			t.Fatalf("tool %q not registered", name)
+		}
+		if tool.Scope != diagnose.ToolScopeRemote {
+			t.Fatalf("tool %q should be remote scope, got %v", name, tool.Scope)
+		}
+		if tool.RemoteExecute == nil {
+			t.Fatalf("tool %q has nil RemoteExecute", name)
+		}
+	}
+	if registry.ToolCount() != len(expectedTools) {
+		t.Fatalf("expected %d tools, got %d", len(expectedTools), registry.ToolCount())
+	}
+
+	cats := registry.Categories()
+	if len(cats) != 1 || cats[0] != "mysql" {
+		t.Fatalf("unexpected categories: %v", cats)
+	}
+}
+
+func TestPreCollectorRegistered(t *testing.T) {
+	registry := diagnose.NewToolRegistry()
+	p := &MySQLPlugin{}
+	p.RegisterDiagnoseTools(registry)
+
+	if result := registry.RunPreCollector(context.Background(), "mysql", nil); result != "" {
+		t.Fatal("PreCollector with nil accessor should return empty string")
+	}
+}
+
+func TestDiagnoseHintsRegistered(t *testing.T) {
+	registry := diagnose.NewToolRegistry()
+	p := &MySQLPlugin{}
+	p.RegisterDiagnoseTools(registry)
+
+	hints := registry.GetDiagnoseHints("mysql")
+	for _, want := range []string{"连接数告警", "锁等待", "复制告警"} {
+		if !strings.Contains(hints, want) {
+			t.Fatalf("DiagnoseHints should contain %q route", want)
+		}
+	}
+}
+
+// runTool opens a session through the registered accessor factory, the way
+// the diagnose engine does, and runs one tool.
+func runTool(t *testing.T, state *fakeServerState, name string, args map[string]string) (string, []string) {
+	t.Helper()
+	registry := diagnose.NewToolRegistry()
+	(&MySQLPlugin{}).RegisterDiagnoseTools(registry)
+
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: state.handle})
+	ins := newTestInstance(srv)
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	accessor, err := registry.CreateAccessor(context.Background(), "mysql", ins, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &diagnose.DiagnoseSession{Accessor: accessor}
+	defer session.Close()
+
+	tool, _ := registry.Get(name)
+	out, err := tool.RemoteExecute(context.Background(), session, args)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return out, srv.Queries()
+}
+
+func TestProcesslistTool(t *testing.T) {
+	state := &fakeServerState{extra: map[string]*ResultSet{
+		"SELECT ID, USER": rows([]string{"ID", "USER", "HOST", "DB", "COMMAND", "TIME", "STATE", "INFO"},
+			[]any{"12", "app", "10.0.0.5:51234", "orders", "Query", "340", "updating", "UPDATE orders\n  SET status = 2 WHERE id = 7"},
+			[]any{"15", "app", "10.0.0.6:40211", "orders", "Query", "2", "Waiting for row lock", nil}),
+	}}
+
+	out, queries := runTool(t, state, "mysql_processlist", map[string]string{"limit": "5"})
+	for _, want := range []string{"ID  USER", "UPDATE orders SET status = 2 WHERE id = 7", "Waiting for row lock", "NULL", "(2 rows)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+	q := queries[len(queries)-1]
+	if !strings.Contains(q, "COMMAND <> 'Sleep'") || !strings.HasSuffix(q, "LIMIT 5") {
+		t.Errorf("unexpected processlist query: %s", q)
+	}
+
+	_, queries = runTool(t, state, "mysql_processlist", map[string]string{"include_sleep": "true", "limit": "100000"})
+	q = queries[len(queries)-1]
+	if strings.Contains(q, "Sleep") || !strings.HasSuffix(q, "LIMIT 500") {
+		t.Errorf("include_sleep / limit clamp not applied: %s", q)
+	}
+}
+
+func TestLockWaitsToolFallback(t *testing.T) {
+	state := &fakeServerState{
+		errs: map[string]error{"SELECT wait_age_secs": &mysqlError{Number: 1049, SQLState: "42000", Message: "Unknown database 'sys'"}},
+		extra: map[string]*ResultSet{
+			"SELECT TIMESTAMPDIFF": rows([]string{"wait_age_secs", "locked_table", "waiting_pid", "blocking_pid", "blocking_query"},
+				[]any{"31", "`orders`.`items`", "15", "12", nil}),
+		},
+	}
+
+	out, queries := runTool(t, state, "mysql_lock_waits", nil)
+	if len(queries) != 2 || !strings.Contains(queries[1], "information_schema.INNODB_LOCK_WAITS") {
+		t.Fatalf("expected fallback to information_schema, got %v", queries)
+	}
+	for _, want := range []string{"1. row", "locked_table: `orders`.`items`", "blocking_query: NULL"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+
+	state = &fakeServerState{extra: map[string]*ResultSet{"SELECT wait_age_secs": rows([]string{"wait_age_secs"})}}
+	if out, _ := runTool(t, state, "mysql_lock_waits", nil); out != "No InnoDB lock waits." {
+		t.Errorf("empty lock waits: %q", out)
+	}
+}
+
+func TestSlowQueriesTool(t *testing.T) {
+	state := &fakeServerState{
+		status:    map[string]string{"Slow_queries": "42"},
+		variables: map[string]string{"slow_query_log": "ON", "long_query_time": "1.000000", "performance_schema": "ON"},
+		extra: map[string]*ResultSet{
+			"SELECT SCHEMA_NAME": rows([]string{"db", "exec_count", "total_sec", "query"},
+				[]any{"orders", "1200", "845.120", "SELECT * FROM `items` WHERE `sku` = ?"}),
+		},
+	}
+	out, _ := runTool(t, state, "mysql_slow_queries", nil)
+	for _, want := range []string{"slow_query_log: ON", "long_query_time: 1.000000", "Slow_queries: 42", "total_sec: 845.120", "WHERE `sku` = ?"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+
+	state.errs = map[string]error{"SELECT SCHEMA_NAME": &mysqlError{Number: 1142, SQLState: "42000", Message: "SELECT command denied"}}
+	out, _ = runTool(t, state, "mysql_slow_queries", nil)
+	if !strings.Contains(out, "digests unavailable") || !strings.Contains(out, "Slow_queries: 42") {
+		t.Errorf("denied performance_schema should still report slow log settings:\n%s", out)
+	}
+}
+
+const innodbStatus = `
+=====================================
+2024-05-01 10:00:00 0x7f INNODB MONITOR OUTPUT
+=====================================
+----------
+SEMAPHORES
+----------
+OS WAIT ARRAY INFO: reservation count 10
+------------------------
+LATEST DETECTED DEADLOCK
+------------------------
+*** (1) TRANSACTION:
+TRANSACTION 1234, ACTIVE 3 sec starting index read
+------------
+TRANSACTIONS
+------------
+Trx id counter 5678
+`
+
+func TestInnoDBStatusTool(t *testing.T) {
+	state := &fakeServerState{extra: map[string]*ResultSet{
+		"SHOW ENGINE INNODB STATUS": rows([]string{"Type", "Name", "Status"}, []any{"InnoDB", "", innodbStatus}),
+	}}
+
+	out, _ := runTool(t, state, "mysql_innodb_status", map[string]string{"section": "deadlock"})
+	if !strings.Contains(out, "TRANSACTION 1234") || strings.Contains(out, "reservation count") || strings.Contains(out, "Trx id counter") {
+		t.Errorf("section filter:\n%s", out)
+	}
+
+	out, _ = runTool(t, state, "mysql_innodb_status", map[string]string{"section": "buffer pool"})
+	if !strings.Contains(out, "Available sections: SEMAPHORES, LATEST DETECTED DEADLOCK, TRANSACTIONS") {
+		t.Errorf("unknown section: %s", out)
+	}
+
+	out, _ = runTool(t, state, "mysql_innodb_status", nil)
+	if out != innodbStatus {
+		t.Errorf("without section the whole status should be returned")
+	}
+}
+
+func TestStatusAndVariablesTools(t *testing.T) {
+	state := &fakeServerState{extra: map[string]*ResultSet{
+		"SHOW GLOBAL STATUS LIKE 'Threads%'": rows([]string{"Variable_name", "Value"}, []any{"Threads_connected", "12"}),
+		"SHOW GLOBAL VARIABLES LIKE '%'":     rows([]string{"Variable_name", "Value"}),
+	}}
+	out, _ := runTool(t, state, "mysql_status", map[string]string{"pattern": "Threads%"})
+	if !strings.Contains(out, "Threads_connected") || !strings.Contains(out, "12") {
+		t.Errorf("status output:\n%s", out)
+	}
+	if out, _ := runTool(t, state, "mysql_variables", nil); out != "No matching entries." {
+		t.Errorf("variables output: %q", out)
+	}
+}
+
+func TestPreCollect(t *testing.T) {
+	state := &fakeServerState{
+		status:    map[string]string{"Threads_connected": "12", "Uptime": "3600"},
+		variables: map[string]string{"max_connections": "500", "read_only": "ON"},
+		replica: rows(replicaColumns,
+			[]any{"", "10.0.0.1", "3306", "Yes", "No", "Error 1062", "", nil, ""}),
+	}
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: state.handle})
+	ins := newTestInstance(srv)
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	acc, err := ins.newAccessor(ins.Targets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer acc.Close()
+
+	registry := diagnose.NewToolRegistry()
+	(&MySQLPlugin{}).RegisterDiagnoseTools(registry)
+	out := registry.RunPreCollector(context.Background(), "mysql", acc)
+	for _, want := range []string{
+		"version: 8.0.36-fake", "read_only: ON", "max_connections: 500", "Threads_connected: 12",
+		"channel default: source=10.0.0.1:3306 io=Yes sql=No lag=NULL", "last_sql_error: Error 1062",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("pre-collected context should contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "read_only") > strings.Index(out, "max_connections") {
+		t.Errorf("variables should keep their configured order:\n%s", out)
+	}
+}
@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+	"github.com/toolkits/pkg/concurrent/semaphore"
+)
+
+func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	if len(ins.Targets) == 0 {
+		return
+	}
+
+	perTarget := time.Duration(ins.Timeout) + time.Duration(ins.ReadTimeout)*4
+	batches := (len(ins.Targets) + ins.Concurrency - 1) / ins.Concurrency
+	gatherTimeout := perTarget * time.Duration(batches+1)
+	if gatherTimeout < 30*time.Second {
+		gatherTimeout = 30 * time.Second
+	}
+
+	wg := new(sync.WaitGroup)
+	se := semaphore.NewSemaphore(ins.Concurrency)
+	for _, target := range ins.Targets {
+		if startTime, ok := ins.inFlight.Load(target); ok {
+			elapsed := time.Now().Unix() - startTime.(int64)
+			if elapsed > int64(gatherTimeout.Seconds()) {
+				q.PushFront(ins.buildHungEvent(target, elapsed))
+			}
+			continue
+		}
+
+		if _, wasHung := ins.prevHung.Load(target); wasHung {
+			q.PushFront(ins.buildHungRecoveryEvent(target))
+			ins.prevHung.Delete(target)
+		}
+
+		wg.Add(1)
+		go func(target string) {
+			se.Acquire()
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Logger.Errorw("panic in mysql gather goroutine", "target", target, "recover", r)
+					q.PushFront(types.BuildEvent(map[string]string{
+						"check":  "mysql::connectivity",
+						"target": target,
+					}).SetEventStatus(types.EventStatusCritical).
+						SetDescription(fmt.Sprintf("panic during check: %v", r)))
+				}
+				ins.inFlight.Delete(target)
+				se.Release()
+				wg.Done()
+			}()
+			ins.inFlight.Store(target, time.Now().Unix())
+			ins.gatherTarget(q, target)
+		}(target)
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(gatherTimeout):
+		logger.Logger.Errorw("mysql gather timeout, some targets may still be running",
+			"timeout", gatherTimeout, "targets", len(ins.Targets))
+		ins.inFlight.Range(func(key, value any) bool {
+			ins.prevHung.Store(key, true)
+			return true
+		})
+	}
+}
+
+func (ins *Instance) newAccessor(target string) (*MySQLAccessor, error) {
+	return NewMySQLAccessor(MySQLAccessorConfig{
+		Target:      target,
+		Username:    ins.Username,
+		Password:    ins.Password,
+		Timeout:     time.Duration(ins.Timeout),
+		ReadTimeout: time.Duration(ins.ReadTimeout),
+		TLSConfig:   ins.tlsConfig,
+		DialFunc:    ins.dialFunc,
+
+		ServerPublicKey:         ins.serverKey,
+		AllowPublicKeyRetrieval: ins.AllowPublicKeyRetrieval != nil && *ins.AllowPublicKeyRetrieval,
+	})
+}
+
+func (ins *Instance) gatherTarget(q *safe.Queue[*types.Event], target string) {
+	connEvent := ins.newEvent("mysql::connectivity", target)
+	start := time.Now()
+
+	acc, err := ins.newAccessor(target)
+	if err != nil {
+		connEvent.SetAttrs(map[string]string{
+			"response_time":  time.Since(start).String(),
+			"threshold_desc": fmt.Sprintf("%s: mysql connect failed", ins.Connectivity.Severity),
+		})
+		q.PushFront(connEvent.SetEventStatus(ins.Connectivity.Severity).
+			SetDescription(fmt.Sprintf("mysql connect failed: %v", err)))
+		return
+	}
+	defer acc.Close()
+
+	if err := acc.Ping(); err != nil {
+		connEvent.SetAttrs(map[string]string{
+			"response_time":  time.Since(start).String(),
+			"threshold_desc": fmt.Sprintf("%s: mysql connect failed", ins.Connectivity.Severity),
+		})
+		q.PushFront(connEvent.SetEventStatus(ins.Connectivity.Severity).
+			SetDescription(fmt.Sprintf("mysql ping failed: %v", err)))
+		return
+	}
+
+	responseTime := time.Since(start)
+	connEvent.SetAttrs(map[string]string{
+		"response_time":  responseTime.String(),
+		"server_version": acc.ServerVersion(),
+		"threshold_desc": fmt.Sprintf("%s: mysql connect failed", ins.Connectivity.Severity),
+	})
+	q.PushFront(connEvent.SetDescription("mysql ping ok"))
+
+	ins.checkResponseTime(q, target, responseTime)
+
+	if ins.replicationEnabled() || ins.ReplLag.WarnGe > 0 || ins.ReplLag.CriticalGe > 0 {
+		rs, err := acc.ReplicaStatus()
+		if err != nil {
+			if ins.replicationEnabled() {
+				q.PushFront(ins.newEvent("mysql::replication", target).
+					SetEventStatus(types.EventStatusCritical).
+					SetDescription(fmt.Sprintf("failed to query mysql replica status: %v", err)))
+			}
+			if ins.ReplLag.WarnGe > 0 || ins.ReplLag.CriticalGe > 0 {
+				q.PushFront(ins.newEvent("mysql::repl_lag", target).
+					SetEventStatus(types.EventStatusCritical).
+					SetDescription(fmt.Sprintf("failed to query mysql replica status: %v", err)))
+			}
+		} else {
+			channels := parseReplicaChannels(rs)
+			if ins.replicationEnabled() {
+				ins.checkReplication(q, target, channels)
+			}
+			if ins.ReplLag.WarnGe > 0 || ins.ReplLag.CriticalGe > 0 {
+				ins.checkReplLag(q, target, channels)
+			}
+		}
+	}
+
+	if ins.Connections.WarnGe > 0 || ins.Connections.CriticalGe > 0 {
+		ins.checkConnections(q, target, acc)
+	}
+
+	if ins.AbortedConnects.WarnGe > 0 || ins.AbortedConnects.CriticalGe > 0 {
+		status, err := acc.GlobalStatus("Aborted_connects")
+		if err != nil {
+			q.PushFront(ins.newEvent("mysql::aborted_connects", target).
+				SetEventStatus(types.EventStatusCritical).
+				SetDescription(fmt.Sprintf("failed to query mysql global status: %v", err)))
+		} else {
+			ins.checkAbortedConnects(q, target, status)
+		}
+	}
+}
+
+func (ins *Instance) newEvent(check, target string) *types.Event {
+	labels := map[string]string{
+		"check":  check,
+		"target": target,
+	}
+	if ins.ClusterName != "" {
+		labels["cluster_name"] = ins.ClusterName
+	}
+	return types.BuildEvent(labels)
+}
+
+func (ins *Instance) buildHungEvent(target string, elapsedSec int64) *types.Event {
+	return types.BuildEvent(map[string]string{
+		"check":  "mysql::hung",
+		"target": target,
+	}).SetAttrs(map[string]string{
+		"elapsed_seconds": fmt.Sprintf("%d", elapsedSec),
+		"threshold_desc":  "Critical: mysql check hung",
+	}).SetEventStatus(types.EventStatusCritical).
+		SetDescription(fmt.Sprintf("mysql check hung for %d seconds (target may be unreachable or blocked)", elapsedSec))
+}
+
+func (ins *Instance) buildHungRecoveryEvent(target string) *types.Event {
+	return types.BuildEvent(map[string]string{
+		"check":  "mysql::hung",
+		"target": target,
+	}).SetDescription("mysql check recovered from hung state")
+}
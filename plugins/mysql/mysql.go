@@ -0,0 +1,14 @@
+// Package mysql provides a catpaw remote plugin for monitoring MySQL and
+// MariaDB servers: connectivity, replication thread state and lag,
+// connection usage against max_connections, and aborted connects. It speaks
+// the client/server protocol directly instead of pulling in a driver, and
+// shares one accessor between checks and the AI diagnosis tools.
+package mysql
+
+import "github.com/cprobe/catpaw/digcore/plugins"
+
+func init() {
+	plugins.Add(pluginName, func() plugins.Plugin {
+		return &MySQLPlugin{}
+	})
+}
@@ -0,0 +1,910 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	clogger "github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+	"go.uber.org/zap"
+)
+
+func initTestConfig(t *testing.T) {
+	t.Helper()
+	if config.Config == nil {
+		tmpDir := t.TempDir()
+		config.Config = &config.ConfigType{
+			ConfigDir: tmpDir,
+			StateDir:  tmpDir,
+		}
+	}
+	if clogger.Logger == nil {
+		l, _ := zap.NewDevelopment()
+		clogger.Logger = l.Sugar()
+	}
+}
+
+// fakeMySQLServer speaks the server side of the protocol over net.Pipe and
+// verifies authentication the way mysqld does, from the stored password hash.
+type fakeMySQLServer struct {
+	mu      sync.Mutex
+	cfg     fakeMySQLConfig
+	queries []string
+}
+
+type fakeMySQLConfig struct {
+	username   string
+	password   string
+	authPlugin string // announced in the greeting, default mysql_native_password
+	switchTo   string // answer the handshake response with an auth switch to this plugin
+	cacheMiss  bool   // caching_sha2_password: force full authentication
+	noScramble bool   // send the auth switch without auth data
+	rsaKey     *rsa.PrivateKey
+	handler    func(query string) (*ResultSet, error)
+}
+
+func newFakeMySQLServer(cfg fakeMySQLConfig) *fakeMySQLServer {
+	if cfg.username == "" {
+		cfg.username = "monitor"
+	}
+	if cfg.authPlugin == "" {
+		cfg.authPlugin = authNativePassword
+	}
+	return &fakeMySQLServer{cfg: cfg}
+}
+
+func (s *fakeMySQLServer) Dial(network, address string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.handleConn(server)
+	return client, nil
+}
+
+func (s *fakeMySQLServer) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.queries...)
+}
+
+type fakePacketConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	seq  byte
+}
+
+func (c *fakePacketConn) write(payload []byte) error {
+	hdr := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), c.seq}
+	c.seq++
+	_, err := c.conn.Write(append(hdr, payload...))
+	return err
+}
+
+func (c *fakePacketConn) read() ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+	c.seq = hdr[3] + 1
+	buf := make([]byte, n)
+	_, err := io.ReadFull(c.r, buf)
+	return buf, err
+}
+
+func newScramble() []byte {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = b[i]%94 + 33 // printable, never NUL
+	}
+	return b
+}
+
+func (s *fakeMySQLServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	cfg := s.cfg
+	s.mu.Unlock()
+
+	c := &fakePacketConn{conn: conn, r: bufio.NewReader(conn)}
+	scramble := newScramble()
+	caps := clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions |
+		clientSecureConnection | clientPluginAuth
+	greeting := []byte{10}
+	greeting = append(greeting, "8.0.36-fake\x00"...)
+	greeting = binary.LittleEndian.AppendUint32(greeting, 42)
+	greeting = append(greeting, scramble[:8]...)
+	greeting = append(greeting, 0)
+	greeting = binary.LittleEndian.AppendUint16(greeting, uint16(caps))
+	greeting = append(greeting, 0xff, 2, 0)
+	greeting = binary.LittleEndian.AppendUint16(greeting, uint16(caps>>16))
+	greeting = append(greeting, 21)
+	greeting = append(greeting, make([]byte, 10)...)
+	greeting = append(greeting, scramble[8:]...)
+	greeting = append(greeting, 0)
+	greeting = append(greeting, cfg.authPlugin+"\x00"...)
+	if c.write(greeting) != nil {
+		return
+	}
+
+	resp, err := c.read()
+	if err != nil || len(resp) < 33 {
+		return
+	}
+	pos := 32
+	user, rest, _ := bytes.Cut(resp[pos:], []byte{0})
+	authLen := int(rest[0])
+	authData := rest[1 : 1+authLen]
+	plugin, _, _ := bytes.Cut(rest[1+authLen:], []byte{0})
+	clientPlugin := string(plugin)
+
+	if cfg.switchTo != "" {
+		scramble = newScramble()
+		if cfg.noScramble {
+			scramble = nil
+		}
+		sw := append([]byte{0xfe}, cfg.switchTo+"\x00"...)
+		sw = append(sw, scramble...)
+		sw = append(sw, 0)
+		if c.write(sw) != nil {
+			return
+		}
+		if authData, err = c.read(); err != nil {
+			return
+		}
+		clientPlugin = cfg.switchTo
+	}
+
+	ok := string(user) == cfg.username
+	switch clientPlugin {
+	case authNativePassword:
+		ok = ok && verifyNativePassword(scramble, authData, cfg.password)
+	case authCachingSHA2:
+		if !cfg.cacheMiss {
+			ok = ok && verifySHA2Password(scramble, authData, cfg.password)
+			if c.write([]byte{packetAuthMore, 3}) != nil {
+				return
+			}
+			break
+		}
+		if c.write([]byte{packetAuthMore, 4}) != nil {
+			return
+		}
+		enc, err := c.read()
+		if err != nil {
+			return
+		}
+		if len(enc) == 1 && enc[0] == 2 { // public key request
+			der, _ := x509.MarshalPKIXPublicKey(&cfg.rsaKey.PublicKey)
+			keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+			if c.write(append([]byte{packetAuthMore}, keyPEM...)) != nil {
+				return
+			}
+			if enc, err = c.read(); err != nil {
+				return
+			}
+		}
+		plain, err := rsa.DecryptOAEP(sha1.New(), nil, cfg.rsaKey, enc, nil)
+		if err != nil {
+			ok = false
+			break
+		}
+		for i := range plain {
+			plain[i] ^= scramble[i%len(scramble)]
+		}
+		ok = ok && string(plain) == cfg.password+"\x00"
+	default:
+		ok = false
+	}
+	if !ok {
+		_ = c.write(errPacket(&mysqlError{Number: 1045, SQLState: "28000",
+			Message: "Access denied for user '" + string(user) + "'@'localhost' (using password: YES)"}))
+		return
+	}
+	if c.write(okPacket()) != nil {
+		return
+	}
+
+	for {
+		cmd, err := c.read()
+		if err != nil || len(cmd) == 0 {
+			return
+		}
+		switch cmd[0] {
+		case comQuit:
+			return
+		case comPing:
+			_ = c.write(okPacket())
+		case comQuery:
+			q := string(cmd[1:])
+			s.mu.Lock()
+			s.queries = append(s.queries, q)
+			handler := s.cfg.handler
+			s.mu.Unlock()
+			var rs *ResultSet
+			if handler != nil {
+				rs, err = handler(q)
+			} else {
+				err = &mysqlError{Number: 1064, SQLState: "42000", Message: "unexpected query"}
+			}
+			if writeResult(c, rs, err) != nil {
+				return
+			}
+		default:
+			_ = c.write(errPacket(&mysqlError{Number: 1047, SQLState: "08S01", Message: "Unknown command"}))
+		}
+	}
+}
+
+// verifyNativePassword checks a mysql_native_password response against the
+// stored hash SHA1(SHA1(password)), as the server does.
+func verifyNativePassword(scramble, resp []byte, password string) bool {
+	if password == "" {
+		return len(resp) == 0
+	}
+	s1 := sha1.Sum([]byte(password))
+	stored := sha1.Sum(s1[:])
+	h := sha1.Sum(append(append([]byte{}, scramble...), stored[:]...))
+	if len(resp) != len(h) {
+		return false
+	}
+	candidate := make([]byte, len(h))
+	for i := range h {
+		candidate[i] = resp[i] ^ h[i]
+	}
+	check := sha1.Sum(candidate)
+	return check == stored
+}
+
+// verifySHA2Password checks a caching_sha2_password fast-auth response
+// against the cached SHA256(SHA256(password)).
+func verifySHA2Password(scramble, resp []byte, password string) bool {
+	if password == "" {
+		return len(resp) == 0
+	}
+	m1 := sha256.Sum256([]byte(password))
+	stored := sha256.Sum256(m1[:])
+	h := sha256.Sum256(append(append([]byte{}, stored[:]...), scramble...))
+	if len(resp) != len(h) {
+		return false
+	}
+	candidate := make([]byte, len(h))
+	for i := range h {
+		candidate[i] = resp[i] ^ h[i]
+	}
+	check := sha256.Sum256(candidate)
+	return check == stored
+}
+
+func okPacket() []byte {
+	return []byte{packetOK, 0, 0, 2, 0, 0, 0}
+}
+
+func errPacket(e *mysqlError) []byte {
+	p := []byte{packetERR}
+	p = binary.LittleEndian.AppendUint16(p, e.Number)
+	p = append(p, '#')
+	p = append(p, e.SQLState...)
+	return append(p, e.Message...)
+}
+
+func appendLenEncString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 251:
+		b = append(b, byte(n))
+	case n < 1<<16:
+		b = append(b, 0xfc, byte(n), byte(n>>8))
+	default:
+		b = append(b, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return append(b, s...)
+}
+
+func writeResult(c *fakePacketConn, rs *ResultSet, err error) error {
+	if err != nil {
+		var me *mysqlError
+		if !errors.As(err, &me) {
+			me = &mysqlError{Number: 1105, SQLState: "HY000", Message: err.Error()}
+		}
+		return c.write(errPacket(me))
+	}
+	if rs == nil {
+		return c.write(okPacket())
+	}
+	if err := c.write([]byte{byte(len(rs.Columns))}); err != nil {
+		return err
+	}
+	for _, col := range rs.Columns {
+		var def []byte
+		for _, s := range []string{"def", "", "", "", col, col} {
+			def = appendLenEncString(def, s)
+		}
+		def = append(def, 0x0c, 0x21, 0, 0, 1, 0, 0, 0xfd, 0, 0, 0, 0, 0)
+		if err := c.write(def); err != nil {
+			return err
+		}
+	}
+	eof := []byte{packetEOF, 0, 0, 2, 0}
+	if err := c.write(eof); err != nil {
+		return err
+	}
+	for _, row := range rs.Rows {
+		var p []byte
+		for _, v := range row {
+			if !v.Valid {
+				p = append(p, 0xfb)
+				continue
+			}
+			p = appendLenEncString(p, v.String)
+		}
+		if err := c.write(p); err != nil {
+			return err
+		}
+	}
+	return c.write(eof)
+}
+
+// rows builds a result set; a nil value is NULL.
+func rows(columns []string, values ...[]any) *ResultSet {
+	rs := &ResultSet{Columns: columns}
+	for _, vs := range values {
+		row := make([]sql.NullString, len(vs))
+		for i, v := range vs {
+			if s, ok := v.(string); ok {
+				row[i] = sql.NullString{String: s, Valid: true}
+			}
+		}
+		rs.Rows = append(rs.Rows, row)
+	}
+	return rs
+}
+
+var quotedNameRe = regexp.MustCompile(`'([^']*)'`)
+
+// fakeServerState answers the statements the checks and diagnose tools send.
+type fakeServerState struct {
+	mu         sync.Mutex
+	status     map[string]string
+	variables  map[string]string
+	replica    *ResultSet
+	oldReplica bool // only SHOW SLAVE STATUS is understood
+	extra      map[string]*ResultSet
+	errs       map[string]error
+}
+
+func (st *fakeServerState) handle(q string) (*ResultSet, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for prefix, err := range st.errs {
+		if strings.HasPrefix(q, prefix) {
+			return nil, err
+		}
+	}
+	for prefix, rs := range st.extra {
+		if strings.HasPrefix(q, prefix) {
+			return rs, nil
+		}
+	}
+	switch {
+	case strings.HasPrefix(q, "SHOW GLOBAL STATUS WHERE"):
+		return nameValueRows(q, st.status), nil
+	case strings.HasPrefix(q, "SHOW GLOBAL VARIABLES WHERE"):
+		return nameValueRows(q, st.variables), nil
+	case q == "SHOW REPLICA STATUS":
+		if st.oldReplica {
+			return nil, &mysqlError{Number: 1064, SQLState: "42000", Message: "You have an error in your SQL syntax"}
+		}
+		fallthrough
+	case q == "SHOW SLAVE STATUS":
+		if st.replica == nil {
+			return &ResultSet{Columns: []string{"Replica_IO_State"}}, nil
+		}
+		return st.replica, nil
+	}
+	return nil, &mysqlError{Number: 1064, SQLState: "42000", Message: "unexpected query: " + q}
+}
+
+func nameValueRows(q string, values map[string]string) *ResultSet {
+	rs := &ResultSet{Columns: []string{"Variable_name", "Value"}}
+	for _, m := range quotedNameRe.FindAllStringSubmatch(q, -1) {
+		if v, ok := values[m[1]]; ok {
+			rs.Rows = append(rs.Rows, []sql.NullString{{String: m[1], Valid: true}, {String: v, Valid: true}})
+		}
+	}
+	return rs
+}
+
+var replicaColumns = []string{
+	"Replica_IO_State", "Source_Host", "Source_Port", "Replica_IO_Running", "Replica_SQL_Running",
+	"Last_SQL_Error", "Last_IO_Error", "Seconds_Behind_Source", "Channel_Name",
+}
+
+func newTestInstance(srv *fakeMySQLServer) *Instance {
+	return &Instance{
+		Targets:  []string{"db.local"},
+		Username: "monitor",
+		Password: "secret",
+		dialFunc: srv.Dial,
+	}
+}
+
+func gatherEvents(t *testing.T, ins *Instance) map[string]*types.Event {
+	t.Helper()
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+	ret := map[string]*types.Event{}
+	for q.Len() > 0 {
+		e := *q.PopBack()
+		ret[e.Labels["check"]] = e
+	}
+	return ret
+}
+
+func TestAccessorAuthentication(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullAuth := fakeMySQLConfig{password: "s3cr3t!", authPlugin: authCachingSHA2, cacheMiss: true, rsaKey: key}
+
+	tests := []struct {
+		name     string
+		server   fakeMySQLConfig
+		password string
+		pubKey   *rsa.PublicKey
+		retrieve bool
+		wantErr  string
+	}{
+		{name: "native password", server: fakeMySQLConfig{password: "secret"}, password: "secret"},
+		{name: "empty password", server: fakeMySQLConfig{}, password: ""},
+		{name: "caching_sha2 fast auth", server: fakeMySQLConfig{password: "secret", authPlugin: authCachingSHA2}, password: "secret"},
+		{name: "caching_sha2 full auth with server_public_key", server: fullAuth, password: "s3cr3t!", pubKey: &key.PublicKey},
+		{name: "caching_sha2 full auth with key retrieval", server: fullAuth, password: "s3cr3t!", retrieve: true},
+		{name: "caching_sha2 full auth without key", server: fullAuth, password: "s3cr3t!", wantErr: "needs server_public_key"},
+		{name: "caching_sha2 full auth with wrong key", server: fullAuth, password: "s3cr3t!", pubKey: &other.PublicKey, wantErr: "Access denied"},
+		{name: "auth switch without scramble", server: fakeMySQLConfig{password: "secret", switchTo: authCachingSHA2, noScramble: true, cacheMiss: true, rsaKey: key},
+			password: "secret", retrieve: true, wantErr: "empty auth scramble"},
+		{name: "auth switch to native", server: fakeMySQLConfig{password: "secret", authPlugin: authCachingSHA2, switchTo: authNativePassword}, password: "secret"},
+		{name: "auth switch to caching_sha2", server: fakeMySQLConfig{password: "secret", switchTo: authCachingSHA2}, password: "secret"},
+		{name: "wrong password", server: fakeMySQLConfig{password: "secret"}, password: "nope", wantErr: "Error 1045 (28000): Access denied"},
+		{name: "unsupported plugin", server: fakeMySQLConfig{password: "secret", switchTo: "auth_gssapi_client"}, password: "secret", wantErr: "unsupported mysql auth plugin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeMySQLServer(tt.server)
+			acc, err := NewMySQLAccessor(MySQLAccessorConfig{
+				Target:      "db.local:3306",
+				Username:    "monitor",
+				Password:    tt.password,
+				Timeout:     time.Second,
+				ReadTimeout: time.Second,
+				DialFunc:    srv.Dial,
+
+				ServerPublicKey:         tt.pubKey,
+				AllowPublicKeyRetrieval: tt.retrieve,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer acc.Close()
+			if err := acc.Ping(); err != nil {
+				t.Fatalf("ping: %v", err)
+			}
+			if acc.ServerVersion() != "8.0.36-fake" {
+				t.Errorf("server version: %q", acc.ServerVersion())
+			}
+		})
+	}
+}
+
+func TestAccessorQuery(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: func(q string) (*ResultSet, error) {
+		switch q {
+		case "SELECT 1":
+			return rows([]string{"a", "b", "c"}, []any{"1", nil, long}, []any{"", "two", "3"}), nil
+		case "DO 1":
+			return nil, nil
+		}
+		return nil, &mysqlError{Number: 1146, SQLState: "42S02", Message: "Table 'x' doesn't exist"}
+	}})
+	acc, err := NewMySQLAccessor(MySQLAccessorConfig{
+		Target: "db.local:3306", Username: "monitor", Password: "secret",
+		Timeout: time.Second, ReadTimeout: time.Second, DialFunc: srv.Dial,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer acc.Close()
+
+	rs, err := acc.Query("SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Columns) != 3 || rs.Columns[2] != "c" || len(rs.Rows) != 2 {
+		t.Fatalf("unexpected result: %+v", rs)
+	}
+	if rs.Rows[0][1].Valid || rs.Rows[0][2].String != long || !rs.Rows[1][0].Valid || rs.Rows[1][0].String != "" {
+		t.Errorf("NULL/empty/long values not decoded: %+v", rs.Rows)
+	}
+	if rs.ColumnIndex("B") != 1 {
+		t.Errorf("column lookup should be case-insensitive")
+	}
+
+	_, err = acc.Query("SELECT * FROM x")
+	if !isMySQLError(err, erNoSuchTable) {
+		t.Fatalf("expected table error, got %v", err)
+	}
+	if rs, err := acc.Query("DO 1"); err != nil || len(rs.Columns) != 0 {
+		t.Errorf("statement without result set: %+v %v", rs, err)
+	}
+	if err := acc.Ping(); err != nil {
+		t.Errorf("connection should stay usable after a server error: %v", err)
+	}
+
+	if _, err := acc.StatusLike("x' OR '1"); err == nil {
+		t.Error("expected pattern validation error")
+	}
+}
+
+func TestInitValidation(t *testing.T) {
+	boolPtr := func(v bool) *bool { return &v }
+	tests := []struct {
+		name    string
+		ins     *Instance
+		wantErr bool
+	}{
+		{name: "minimal", ins: &Instance{Targets: []string{"db"}, Username: "monitor"}},
+		{name: "no targets without username", ins: &Instance{}},
+		{name: "username required", ins: &Instance{Targets: []string{"db"}}, wantErr: true},
+		{name: "invalid connectivity severity", ins: &Instance{Username: "u", Connectivity: ConnectivityCheck{Severity: "Fatal"}}, wantErr: true},
+		{name: "invalid replication severity", ins: &Instance{Username: "u", Replication: ReplicationCheck{Severity: "Bad"}}, wantErr: true},
+		{name: "disabled replication ignores severity", ins: &Instance{Username: "u", Replication: ReplicationCheck{Disabled: boolPtr(true), Severity: "Bad"}}},
+		{name: "response_time warn >= critical", ins: &Instance{Username: "u", ResponseTime: ResponseTimeCheck{
+			WarnGe: config.Duration(time.Second), CriticalGe: config.Duration(time.Millisecond)}}, wantErr: true},
+		{name: "repl_lag warn >= critical", ins: &Instance{Username: "u", ReplLag: ReplLagCheck{
+			WarnGe: config.Duration(time.Minute), CriticalGe: config.Duration(time.Minute)}}, wantErr: true},
+		{name: "connections over 100", ins: &Instance{Username: "u", Connections: PercentCheck{CriticalGe: 120}}, wantErr: true},
+		{name: "aborted_connects warn >= critical", ins: &Instance{Username: "u", AbortedConnects: CountCheck{WarnGe: 10, CriticalGe: 5}}, wantErr: true},
+		{name: "ipv6 without brackets", ins: &Instance{Targets: []string{"::1"}, Username: "u"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ins.Init()
+			if tt.wantErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestInitDefaultsAndNormalization(t *testing.T) {
+	ins := &Instance{Targets: []string{"db.local", " 10.0.0.1:3307 ", "[::1]"}, Username: "monitor"}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"db.local:3306", "10.0.0.1:3307", "[::1]:3306"}
+	for i, target := range want {
+		if ins.Targets[i] != target {
+			t.Errorf("target %d: got %q, want %q", i, ins.Targets[i], target)
+		}
+	}
+	if ins.Concurrency != 10 || time.Duration(ins.Timeout) != 3*time.Second || time.Duration(ins.ReadTimeout) != 2*time.Second {
+		t.Errorf("defaults: concurrency=%d timeout=%s read_timeout=%s", ins.Concurrency, time.Duration(ins.Timeout), time.Duration(ins.ReadTimeout))
+	}
+	if ins.Connectivity.Severity != types.EventStatusCritical || ins.Replication.Severity != types.EventStatusCritical {
+		t.Errorf("severity defaults: %q %q", ins.Connectivity.Severity, ins.Replication.Severity)
+	}
+	if ins.tlsConfig != nil {
+		t.Error("TLS should be off by default")
+	}
+}
+
+func TestInitServerPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "public_key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ins := &Instance{Username: "monitor", ServerPublicKey: path}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if ins.serverKey == nil || !ins.serverKey.Equal(&key.PublicKey) {
+		t.Fatal("server_public_key not loaded")
+	}
+
+	for name, file := range map[string]string{"missing": filepath.Join(dir, "missing.pem"), "not pem": os.Args[0]} {
+		ins := &Instance{Username: "monitor", ServerPublicKey: file}
+		if err := ins.Init(); err == nil || !strings.Contains(err.Error(), "server_public_key") {
+			t.Errorf("%s: expected a server_public_key error, got %v", name, err)
+		}
+	}
+}
+
+func TestApplyPartials(t *testing.T) {
+	boolPtr := func(v bool) *bool { return &v }
+	p := &MySQLPlugin{
+		Partials: []Partial{{
+			ID:          "default",
+			Username:    "monitor",
+			Password:    "secret",
+			Timeout:     config.Duration(5 * time.Second),
+			Replication: ReplicationCheck{Disabled: boolPtr(true)},
+			ReplLag:     ReplLagCheck{WarnGe: config.Duration(time.Minute), CriticalGe: config.Duration(5 * time.Minute)},
+			Connections: PercentCheck{WarnGe: 80, CriticalGe: 90},
+
+			AllowPublicKeyRetrieval: boolPtr(true),
+		}},
+		Instances: []*Instance{
+			{Partial: "default", Targets: []string{"a"}},
+			{Partial: "default", Targets: []string{"b"}, Username: "other", Connections: PercentCheck{WarnGe: 70},
+				AllowPublicKeyRetrieval: boolPtr(false)},
+		},
+	}
+	if err := p.ApplyPartials(); err != nil {
+		t.Fatal(err)
+	}
+	a, b := p.Instances[0], p.Instances[1]
+	if a.Username != "monitor" || a.Password != "secret" || time.Duration(a.Timeout) != 5*time.Second ||
+		a.replicationEnabled() || time.Duration(a.ReplLag.CriticalGe) != 5*time.Minute || !*a.AllowPublicKeyRetrieval {
+		t.Errorf("partial not applied: %+v", a)
+	}
+	if b.Username != "other" || b.Connections.WarnGe != 70 || b.Connections.CriticalGe != 90 || *b.AllowPublicKeyRetrieval {
+		t.Errorf("instance values should win: %+v", b)
+	}
+
+	p.Instances[0].Partial = "missing"
+	if err := p.ApplyPartials(); err == nil {
+		t.Error("expected error for missing partial")
+	}
+}
+
+func TestGatherPrimary(t *testing.T) {
+	initTestConfig(t)
+	state := &fakeServerState{
+		status: map[string]string{
+			"Threads_connected": "85", "Threads_running": "4", "Max_used_connections": "90", "Aborted_connects": "7",
+		},
+		variables: map[string]string{"max_connections": "100"},
+	}
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: state.handle})
+	ins := newTestInstance(srv)
+	ins.ClusterName = "orders"
+	ins.Connections = PercentCheck{WarnGe: 80, CriticalGe: 95}
+	ins.AbortedConnects = CountCheck{WarnGe: 5, CriticalGe: 50}
+	ins.ReplLag = ReplLagCheck{WarnGe: config.Duration(time.Minute)}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := gatherEvents(t, ins)
+	conn := events["mysql::connectivity"]
+	if conn == nil || conn.EventStatus != types.EventStatusOk || conn.Labels["target"] != "db.local:3306" ||
+		conn.Labels["cluster_name"] != "orders" || conn.Attrs["server_version"] != "8.0.36-fake" {
+		t.Fatalf("connectivity: %+v", conn)
+	}
+	if e := events["mysql::replication"]; e == nil || e.EventStatus != types.EventStatusOk || e.Attrs["replica"] != "false" {
+		t.Errorf("replication on a primary: %+v", e)
+	}
+	if e := events["mysql::repl_lag"]; e == nil || e.EventStatus != types.EventStatusOk {
+		t.Errorf("repl_lag on a primary: %+v", e)
+	}
+	c := events["mysql::connections"]
+	if c == nil || c.EventStatus != types.EventStatusWarning || c.Attrs[types.AttrCurrentValue] != "85.0%" ||
+		c.Attrs["max_used_connections"] != "90" || c.Attrs["threshold_desc"] != "Warning ≥ 80%, Critical ≥ 95%" {
+		t.Errorf("connections: %+v", c)
+	}
+	if e := events["mysql::aborted_connects"]; e == nil || e.EventStatus != types.EventStatusOk ||
+		!strings.Contains(e.Description, "baseline established (total: 7)") {
+		t.Errorf("aborted_connects baseline: %+v", e)
+	}
+	if _, ok := events["mysql::response_time"]; ok {
+		t.Error("response_time is not configured and should not be checked")
+	}
+
+	state.mu.Lock()
+	state.status["Aborted_connects"] = "19"
+	state.mu.Unlock()
+	events = gatherEvents(t, ins)
+	if e := events["mysql::aborted_connects"]; e == nil || e.EventStatus != types.EventStatusWarning ||
+		e.Attrs["delta"] != "12" || e.Attrs["total"] != "19" {
+		t.Errorf("aborted_connects delta: %+v", e)
+	}
+
+	state.mu.Lock()
+	state.status["Aborted_connects"] = "3" // server restarted
+	state.mu.Unlock()
+	events = gatherEvents(t, ins)
+	if e := events["mysql::aborted_connects"]; e == nil || e.EventStatus != types.EventStatusOk || e.Attrs["delta"] != "0" {
+		t.Errorf("aborted_connects after restart: %+v", e)
+	}
+
+	ins.Connections = PercentCheck{CriticalGe: 95}
+	events = gatherEvents(t, ins)
+	if c := events["mysql::connections"]; c == nil || c.EventStatus != types.EventStatusOk ||
+		c.Attrs["threshold_desc"] != "Critical ≥ 95%" {
+		t.Errorf("connections with only critical_ge: %+v", c)
+	}
+}
+
+func TestGatherReplica(t *testing.T) {
+	initTestConfig(t)
+	state := &fakeServerState{replica: rows(replicaColumns,
+		[]any{"Waiting for source to send event", "10.0.0.1", "3306", "Yes", "Yes", "", "", "90", ""})}
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: state.handle})
+	ins := newTestInstance(srv)
+	ins.ReplLag = ReplLagCheck{WarnGe: config.Duration(time.Minute), CriticalGe: config.Duration(10 * time.Minute)}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := gatherEvents(t, ins)
+	r := events["mysql::replication"]
+	if r == nil || r.EventStatus != types.EventStatusOk || r.Attrs["source"] != "10.0.0.1:3306" ||
+		r.Attrs[types.AttrCurrentValue] != "io=Yes sql=Yes" {
+		t.Errorf("healthy replication: %+v", r)
+	}
+	lag := events["mysql::repl_lag"]
+	if lag == nil || lag.EventStatus != types.EventStatusWarning || lag.Attrs["repl_lag_seconds"] != "90" ||
+		lag.Attrs["threshold_desc"] != "Warning ≥ 1m0s, Critical ≥ 10m0s" {
+		t.Errorf("repl_lag: %+v", lag)
+	}
+
+	state.mu.Lock()
+	state.replica = rows(replicaColumns,
+		[]any{"", "10.0.0.1", "3306", "Yes", "No", "Error 'Duplicate entry '1' for key 'PRIMARY'' on query", "", nil, ""})
+	state.mu.Unlock()
+	events = gatherEvents(t, ins)
+	r = events["mysql::replication"]
+	if r == nil || r.EventStatus != types.EventStatusCritical || !strings.Contains(r.Description, "SQL thread No") ||
+		!strings.Contains(r.Description, "Duplicate entry") || r.Attrs["last_sql_error"] == "" {
+		t.Errorf("broken SQL thread: %+v", r)
+	}
+	if e := events["mysql::repl_lag"]; e == nil || e.EventStatus != types.EventStatusCritical || e.Attrs[types.AttrCurrentValue] != "NULL" {
+		t.Errorf("NULL lag should be critical: %+v", e)
+	}
+}
+
+func TestGatherReplicaMultiChannelLegacyColumns(t *testing.T) {
+	initTestConfig(t)
+	legacy := []string{"Master_Host", "Master_Port", "Slave_IO_Running", "Slave_SQL_Running", "Seconds_Behind_Master", "Last_IO_Error", "Channel_Name"}
+	state := &fakeServerState{
+		oldReplica: true,
+		replica: rows(legacy,
+			[]any{"10.0.0.1", "3306", "Yes", "Yes", "5", "", "orders"},
+			[]any{"10.0.0.2", "3306", "Connecting", "Yes", nil, "error connecting to master", "users"}),
+	}
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: state.handle})
+	ins := newTestInstance(srv)
+	ins.Replication.Severity = types.EventStatusWarning
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := gatherEvents(t, ins)
+	r := events["mysql::replication"]
+	if r == nil || r.EventStatus != types.EventStatusWarning || r.Attrs["channels"] != "2" ||
+		r.Attrs["users.io_running"] != "Connecting" || r.Attrs["orders.source"] != "10.0.0.1:3306" {
+		t.Fatalf("multi-channel replication: %+v", r)
+	}
+	if !strings.Contains(r.Description, "channel users") || strings.Contains(r.Description, "channel orders") {
+		t.Errorf("only the broken channel should be described: %q", r.Description)
+	}
+	queries := srv.Queries()
+	if len(queries) < 2 || queries[0] != "SHOW REPLICA STATUS" || queries[1] != "SHOW SLAVE STATUS" {
+		t.Errorf("expected fallback to SHOW SLAVE STATUS, got %v", queries)
+	}
+}
+
+func TestGatherConnectFailure(t *testing.T) {
+	initTestConfig(t)
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "other"})
+	ins := newTestInstance(srv)
+	ins.Connections = PercentCheck{WarnGe: 80}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := gatherEvents(t, ins)
+	if len(events) != 1 {
+		t.Fatalf("expected only the connectivity event, got %v", events)
+	}
+	e := events["mysql::connectivity"]
+	if e == nil || e.EventStatus != types.EventStatusCritical || !strings.Contains(e.Description, "Access denied") {
+		t.Errorf("connectivity: %+v", e)
+	}
+}
+
+func TestGatherQueryErrors(t *testing.T) {
+	initTestConfig(t)
+	denied := &mysqlError{Number: 1227, SQLState: "42000", Message: "Access denied; you need (at least one of) the REPLICATION CLIENT privilege(s)"}
+	state := &fakeServerState{
+		status:    map[string]string{"Aborted_connects": "1"},
+		variables: map[string]string{"max_connections": "0"},
+		errs:      map[string]error{"SHOW REPLICA STATUS": denied},
+	}
+	srv := newFakeMySQLServer(fakeMySQLConfig{password: "secret", handler: state.handle})
+	ins := newTestInstance(srv)
+	ins.Connections = PercentCheck{WarnGe: 80}
+	ins.AbortedConnects = CountCheck{WarnGe: 5}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := gatherEvents(t, ins)
+	if e := events["mysql::replication"]; e == nil || e.EventStatus != types.EventStatusCritical ||
+		!strings.Contains(e.Description, "REPLICATION CLIENT") {
+		t.Errorf("replication query error: %+v", e)
+	}
+	if e := events["mysql::connections"]; e == nil || e.EventStatus != types.EventStatusCritical {
+		t.Errorf("invalid max_connections: %+v", e)
+	}
+	if e := events["mysql::aborted_connects"]; e == nil || e.EventStatus != types.EventStatusOk {
+		t.Errorf("a failed replication query should not block other checks: %+v", e)
+	}
+}
+
+func TestReadLengthEncodedInt(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want uint64
+		size int
+	}{
+		{[]byte{0x05}, 5, 1},
+		{[]byte{0xfc, 0x01, 0x02}, 0x0201, 3},
+		{[]byte{0xfd, 0x01, 0x02, 0x03}, 0x030201, 4},
+		{[]byte{0xfe, 1, 0, 0, 0, 0, 0, 0, 1}, 1<<56 | 1, 9},
+	}
+	for _, tt := range tests {
+		v, size, ok := readLengthEncodedInt(tt.in)
+		if !ok || v != tt.want || size != tt.size {
+			t.Errorf("%x: got %d/%d/%v, want %d/%d", tt.in, v, size, ok, tt.want, tt.size)
+		}
+	}
+	if _, _, ok := readLengthEncodedInt([]byte{0xfc, 0x01}); ok {
+		t.Error("truncated integer should fail")
+	}
+	if _, _, ok := readLengthEncodedString([]byte{0x05, 'a', 'b'}); ok {
+		t.Error("truncated string should fail")
+	}
+}
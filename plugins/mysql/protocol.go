@@ -0,0 +1,729 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// This file is a minimal MySQL client/server protocol implementation:
+// handshake v10 with optional TLS upgrade, mysql_native_password and
+// caching_sha2_password authentication, and COM_QUERY text result sets.
+// It speaks just enough of the protocol for read-only monitoring queries,
+// and works with MySQL 5.6+ and MariaDB 10.x.
+
+const (
+	clientLongPassword     uint32 = 0x00000001
+	clientLongFlag         uint32 = 0x00000004
+	clientProtocol41       uint32 = 0x00000200
+	clientSSL              uint32 = 0x00000800
+	clientTransactions     uint32 = 0x00002000
+	clientSecureConnection uint32 = 0x00008000
+	clientPluginAuth       uint32 = 0x00080000
+
+	comQuit  byte = 0x01
+	comQuery byte = 0x03
+	comPing  byte = 0x0e
+
+	packetOK          byte = 0x00
+	packetAuthMore    byte = 0x01
+	packetLocalInfile byte = 0xfb
+	packetEOF         byte = 0xfe
+	packetERR         byte = 0xff
+
+	maxPayloadLen  = 1<<24 - 1
+	charsetUTF8MB4 = 45
+
+	authNativePassword = "mysql_native_password"
+	authCachingSHA2    = "caching_sha2_password"
+)
+
+// mysqlError is an ERR packet returned by the server.
+type mysqlError struct {
+	Number   uint16
+	SQLState string
+	Message  string
+}
+
+func (e *mysqlError) Error() string {
+	if e.SQLState != "" {
+		return fmt.Sprintf("Error %d (%s): %s", e.Number, e.SQLState, e.Message)
+	}
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+// isMySQLError reports whether err is a server error with one of the numbers.
+func isMySQLError(err error, numbers ...uint16) bool {
+	var me *mysqlError
+	if !errors.As(err, &me) {
+		return false
+	}
+	for _, n := range numbers {
+		if me.Number == n {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	erDBAccessDenied    = 1044
+	erBadDB             = 1049
+	erParseError        = 1064
+	erTableAccessDenied = 1142
+	erNoSuchTable       = 1146
+)
+
+// ResultSet is a text protocol query result. NULL values have Valid == false.
+type ResultSet struct {
+	Columns []string
+	Rows    [][]sql.NullString
+}
+
+// ColumnIndex returns the index of the named column, case-insensitively, or -1.
+func (r *ResultSet) ColumnIndex(name string) int {
+	for i, c := range r.Columns {
+		if equalFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// RowMaps returns every row keyed by column name.
+func (r *ResultSet) RowMaps() []map[string]sql.NullString {
+	ret := make([]map[string]sql.NullString, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		m := make(map[string]sql.NullString, len(r.Columns))
+		for i, c := range r.Columns {
+			if i < len(row) {
+				m[c] = row[i]
+			}
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func equalFold(a, b string) bool {
+	return len(a) == len(b) && bytes.EqualFold([]byte(a), []byte(b))
+}
+
+type handshake struct {
+	protocol      byte
+	serverVersion string
+	connectionID  uint32
+	capabilities  uint32
+	authData      []byte
+	authPlugin    string
+}
+
+type mysqlConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	seq         byte
+	timeout     time.Duration
+	readTimeout time.Duration
+	tls         bool
+	broken      bool
+
+	serverVersion string
+	connectionID  uint32
+}
+
+// handshakeConn runs the connection phase on an established TCP connection:
+// reads the server greeting, upgrades to TLS when tlsConfig is set, and
+// authenticates.
+func handshakeConn(conn net.Conn, cfg MySQLAccessorConfig) (*mysqlConn, error) {
+	c := &mysqlConn{
+		conn:        conn,
+		reader:      bufio.NewReader(conn),
+		timeout:     cfg.Timeout,
+		readTimeout: cfg.ReadTimeout,
+	}
+	if err := conn.SetDeadline(time.Now().Add(cfg.Timeout)); err != nil {
+		return nil, err
+	}
+
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, fmt.Errorf("read handshake: %w", err)
+	}
+	if data[0] == packetERR {
+		return nil, parseErrorPacket(data)
+	}
+	hs, err := parseHandshake(data)
+	if err != nil {
+		return nil, err
+	}
+	if hs.capabilities&clientProtocol41 == 0 || hs.capabilities&clientSecureConnection == 0 {
+		return nil, fmt.Errorf("mysql server %s is too old (protocol 4.1 required)", hs.serverVersion)
+	}
+	c.serverVersion = hs.serverVersion
+	c.connectionID = hs.connectionID
+
+	caps := clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions |
+		clientSecureConnection | (hs.capabilities & clientPluginAuth)
+
+	if cfg.TLSConfig != nil {
+		if hs.capabilities&clientSSL == 0 {
+			return nil, fmt.Errorf("mysql server does not support TLS")
+		}
+		caps |= clientSSL
+		if err := c.writePacket(sslRequest(caps)); err != nil {
+			return nil, err
+		}
+		tlsCfg := cfg.TLSConfig.Clone()
+		host, _, splitErr := net.SplitHostPort(cfg.Target)
+		if splitErr == nil && tlsCfg.ServerName == "" && net.ParseIP(host) == nil {
+			tlsCfg.ServerName = host
+		}
+		tlsConn := tls.Client(conn, tlsCfg)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		c.conn = tlsConn
+		c.reader = bufio.NewReader(tlsConn)
+		c.tls = true
+	}
+
+	plugin := hs.authPlugin
+	if plugin != authCachingSHA2 {
+		// let the server switch us if it wants something else
+		plugin = authNativePassword
+	}
+	authResp := scramblePassword(plugin, hs.authData, cfg.Password)
+	if err := c.writePacket(handshakeResponse(caps, cfg.Username, plugin, authResp)); err != nil {
+		return nil, err
+	}
+	if err := c.authResult(plugin, hs.authData, cfg); err != nil {
+		return nil, err
+	}
+
+	_ = c.conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func parseHandshake(data []byte) (*handshake, error) {
+	hs := &handshake{protocol: data[0]}
+	if hs.protocol != 10 {
+		return nil, fmt.Errorf("unsupported mysql protocol version %d", hs.protocol)
+	}
+	pos := 1
+	end := bytes.IndexByte(data[pos:], 0)
+	if end < 0 {
+		return nil, fmt.Errorf("malformed handshake packet")
+	}
+	hs.serverVersion = string(data[pos : pos+end])
+	pos += end + 1
+
+	// connection id (4), auth data part 1 (8), filler (1), capabilities (2)
+	if len(data) < pos+15 {
+		return nil, fmt.Errorf("malformed handshake packet")
+	}
+	hs.connectionID = binary.LittleEndian.Uint32(data[pos:])
+	pos += 4
+	hs.authData = append([]byte{}, data[pos:pos+8]...)
+	pos += 9
+	hs.capabilities = uint32(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+
+	// charset (1), status (2), capabilities upper (2), auth data length (1), reserved (10)
+	if len(data) < pos+16 {
+		return hs, nil
+	}
+	pos += 3
+	hs.capabilities |= uint32(binary.LittleEndian.Uint16(data[pos:])) << 16
+	pos += 2
+	authLen := int(data[pos])
+	pos += 11
+
+	if hs.capabilities&clientSecureConnection != 0 {
+		n := authLen - 8
+		if n < 13 {
+			n = 13
+		}
+		if len(data) < pos+n {
+			return nil, fmt.Errorf("malformed handshake packet")
+		}
+		// the second part is NUL terminated
+		hs.authData = append(hs.authData, bytes.TrimRight(data[pos:pos+n], "\x00")...)
+		pos += n
+	}
+	if hs.capabilities&clientPluginAuth != 0 && pos < len(data) {
+		name := data[pos:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		hs.authPlugin = string(name)
+	}
+	return hs, nil
+}
+
+func sslRequest(caps uint32) []byte {
+	buf := make([]byte, 32)
+	binary.LittleEndian.PutUint32(buf, caps)
+	binary.LittleEndian.PutUint32(buf[4:], maxPayloadLen)
+	buf[8] = charsetUTF8MB4
+	return buf
+}
+
+func handshakeResponse(caps uint32, user, plugin string, authResp []byte) []byte {
+	buf := make([]byte, 32, 64+len(user)+len(authResp))
+	binary.LittleEndian.PutUint32(buf, caps)
+	binary.LittleEndian.PutUint32(buf[4:], maxPayloadLen)
+	buf[8] = charsetUTF8MB4
+	buf = append(buf, user...)
+	buf = append(buf, 0)
+	buf = append(buf, byte(len(authResp)))
+	buf = append(buf, authResp...)
+	if caps&clientPluginAuth != 0 {
+		buf = append(buf, plugin...)
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// authResult reads the server's answers after the handshake response until
+// authentication succeeds or fails, following auth switch requests and the
+// caching_sha2_password fast/full authentication exchange.
+func (c *mysqlConn) authResult(plugin string, scramble []byte, cfg MySQLAccessorConfig) error {
+	password := cfg.Password
+	for i := 0; i < 4; i++ {
+		data, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf("read auth result: %w", err)
+		}
+		switch data[0] {
+		case packetOK:
+			return nil
+		case packetERR:
+			return parseErrorPacket(data)
+		case packetEOF:
+			if len(data) == 1 {
+				return fmt.Errorf("mysql server requested the old (pre-4.1) password authentication, which is not supported")
+			}
+			name, rest, _ := bytes.Cut(data[1:], []byte{0})
+			plugin = string(name)
+			if plugin != authNativePassword && plugin != authCachingSHA2 {
+				return fmt.Errorf("unsupported mysql auth plugin %q", plugin)
+			}
+			scramble = bytes.TrimRight(rest, "\x00")
+			if err := c.writePacket(scramblePassword(plugin, scramble, password)); err != nil {
+				return err
+			}
+		case packetAuthMore:
+			if plugin != authCachingSHA2 || len(data) < 2 {
+				return fmt.Errorf("unexpected auth data from mysql server for %s", plugin)
+			}
+			switch data[1] {
+			case 3: // fast auth succeeded, OK follows
+			case 4: // full authentication
+				if err := c.fullAuthSHA2(scramble, cfg); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unexpected caching_sha2_password state %d", data[1])
+			}
+		default:
+			return fmt.Errorf("unexpected packet 0x%02x during mysql authentication", data[0])
+		}
+	}
+	return fmt.Errorf("mysql authentication did not complete")
+}
+
+// fullAuthSHA2 sends the password for caching_sha2_password full
+// authentication: in clear text over TLS, otherwise RSA encrypted with the
+// configured server public key or, only when retrieval is allowed, with the
+// key the server sends. A retrieved key is not verified, so an on-path
+// attacker could substitute theirs and recover the password.
+func (c *mysqlConn) fullAuthSHA2(scramble []byte, cfg MySQLAccessorConfig) error {
+	plain := append([]byte(cfg.Password), 0)
+	if c.tls {
+		return c.writePacket(plain)
+	}
+	if len(scramble) == 0 {
+		return fmt.Errorf("mysql server sent an empty auth scramble")
+	}
+
+	pub := cfg.ServerPublicKey
+	if pub == nil {
+		if !cfg.AllowPublicKeyRetrieval {
+			return fmt.Errorf("caching_sha2_password full authentication without TLS needs server_public_key, " +
+				"or allow_public_key_retrieval = true to trust the key the server sends")
+		}
+		if err := c.writePacket([]byte{2}); err != nil { // request public key
+			return err
+		}
+		data, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf("read mysql public key: %w", err)
+		}
+		if data[0] == packetERR {
+			return parseErrorPacket(data)
+		}
+		if data[0] != packetAuthMore {
+			return fmt.Errorf("unexpected packet 0x%02x instead of mysql public key", data[0])
+		}
+		if pub, err = parsePublicKey(data[1:]); err != nil {
+			return fmt.Errorf("mysql server public key: %w", err)
+		}
+	}
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	enc, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, plain, nil)
+	if err != nil {
+		return fmt.Errorf("encrypt password: %w", err)
+	}
+	return c.writePacket(enc)
+}
+
+func parsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		if pub, ok := key.(*rsa.PublicKey); ok {
+			return pub, nil
+		}
+		return nil, fmt.Errorf("public key is %T, expected RSA", key)
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+func scramblePassword(plugin string, scramble []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+	if plugin == authCachingSHA2 {
+		return scrambleSHA256Password(scramble, password)
+	}
+	return scrambleNativePassword(scramble, password)
+}
+
+// scrambleNativePassword computes SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password))).
+func scrambleNativePassword(scramble []byte, password string) []byte {
+	if len(scramble) > 20 {
+		scramble = scramble[:20]
+	}
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(scramble)
+	h.Write(stage2[:])
+	out := h.Sum(nil)
+	for i := range out {
+		out[i] ^= stage1[i]
+	}
+	return out
+}
+
+// scrambleSHA256Password computes SHA256(password) XOR
+// SHA256(SHA256(SHA256(password)) + scramble).
+func scrambleSHA256Password(scramble []byte, password string) []byte {
+	m1 := sha256.Sum256([]byte(password))
+	m2 := sha256.Sum256(m1[:])
+	h := sha256.New()
+	h.Write(m2[:])
+	h.Write(scramble)
+	out := h.Sum(nil)
+	for i := range out {
+		out[i] ^= m1[i]
+	}
+	return out
+}
+
+func (c *mysqlConn) Close() error {
+	if !c.broken {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+		c.seq = 0
+		_ = c.writePacket([]byte{comQuit})
+	}
+	return c.conn.Close()
+}
+
+func (c *mysqlConn) ping() error {
+	if err := c.writeCommand(comPing, ""); err != nil {
+		return err
+	}
+	data, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	if data[0] == packetERR {
+		return parseErrorPacket(data)
+	}
+	if data[0] != packetOK {
+		return fmt.Errorf("unexpected reply 0x%02x to COM_PING", data[0])
+	}
+	return nil
+}
+
+// query runs a statement with COM_QUERY and reads its text result set.
+// Statements without a result set return an empty ResultSet.
+func (c *mysqlConn) query(q string) (*ResultSet, error) {
+	if err := c.writeCommand(comQuery, q); err != nil {
+		return nil, err
+	}
+	data, err := c.readResponse()
+	if err != nil {
+		return nil, err
+	}
+	switch data[0] {
+	case packetOK:
+		return &ResultSet{}, nil
+	case packetERR:
+		return nil, parseErrorPacket(data)
+	case packetLocalInfile:
+		// never send local files; an empty packet ends the request
+		if err := c.writePacket(nil); err != nil {
+			c.broken = true
+			return nil, err
+		}
+		if _, err := c.readPacket(); err != nil {
+			c.broken = true
+			return nil, err
+		}
+		return nil, fmt.Errorf("LOAD DATA LOCAL INFILE is not supported")
+	}
+
+	count, _, ok := readLengthEncodedInt(data)
+	if !ok || count == 0 || count > 4096 {
+		c.broken = true
+		return nil, fmt.Errorf("malformed result set header")
+	}
+	rs := &ResultSet{Columns: make([]string, count)}
+	for i := range rs.Columns {
+		col, err := c.readPacket()
+		if err != nil {
+			c.broken = true
+			return nil, err
+		}
+		name, err := parseColumnName(col)
+		if err != nil {
+			c.broken = true
+			return nil, err
+		}
+		rs.Columns[i] = name
+	}
+	if data, err = c.readPacket(); err != nil || !isEOFPacket(data) {
+		c.broken = true
+		if err == nil {
+			err = fmt.Errorf("expected EOF after column definitions")
+		}
+		return nil, err
+	}
+
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			c.broken = true
+			return nil, err
+		}
+		if isEOFPacket(data) {
+			return rs, nil
+		}
+		if data[0] == packetERR {
+			return nil, parseErrorPacket(data)
+		}
+		row, err := parseTextRow(data, len(rs.Columns))
+		if err != nil {
+			c.broken = true
+			return nil, err
+		}
+		rs.Rows = append(rs.Rows, row)
+	}
+}
+
+func (c *mysqlConn) writeCommand(cmd byte, arg string) error {
+	if c.broken {
+		return fmt.Errorf("mysql connection is broken by a previous error")
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	c.seq = 0
+	payload := make([]byte, 0, 1+len(arg))
+	payload = append(payload, cmd)
+	payload = append(payload, arg...)
+	if err := c.writePacket(payload); err != nil {
+		c.broken = true
+		return err
+	}
+	return nil
+}
+
+// readResponse reads the first packet of a command response; the read
+// deadline covers the whole response.
+func (c *mysqlConn) readResponse() ([]byte, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+		return nil, err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		c.broken = true
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *mysqlConn) writePacket(payload []byte) error {
+	for {
+		n := len(payload)
+		if n > maxPayloadLen {
+			n = maxPayloadLen
+		}
+		buf := make([]byte, 4+n)
+		buf[0] = byte(n)
+		buf[1] = byte(n >> 8)
+		buf[2] = byte(n >> 16)
+		buf[3] = c.seq
+		copy(buf[4:], payload[:n])
+		if _, err := c.conn.Write(buf); err != nil {
+			return err
+		}
+		c.seq++
+		payload = payload[n:]
+		if n < maxPayloadLen {
+			return nil
+		}
+	}
+}
+
+// readPacket reads one logical packet, joining payloads split at 16MB.
+func (c *mysqlConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.reader, hdr[:]); err != nil {
+			return nil, err
+		}
+		n := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+		if hdr[3] != c.seq {
+			return nil, fmt.Errorf("mysql packet out of order: sequence %d, expected %d", hdr[3], c.seq)
+		}
+		c.seq++
+		if len(payload)+n > maxPacketBytes {
+			return nil, fmt.Errorf("mysql packet size exceeds limit %d", maxPacketBytes)
+		}
+		start := len(payload)
+		payload = append(payload, make([]byte, n)...)
+		if _, err := io.ReadFull(c.reader, payload[start:]); err != nil {
+			return nil, err
+		}
+		if n < maxPayloadLen {
+			break
+		}
+	}
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("empty mysql packet")
+	}
+	return payload, nil
+}
+
+func isEOFPacket(data []byte) bool {
+	return data[0] == packetEOF && len(data) < 9
+}
+
+func parseErrorPacket(data []byte) error {
+	if len(data) < 3 {
+		return &mysqlError{Message: "malformed error packet"}
+	}
+	e := &mysqlError{Number: binary.LittleEndian.Uint16(data[1:3])}
+	msg := data[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		e.SQLState = string(msg[1:6])
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+	return e
+}
+
+// parseColumnName returns the name of a ColumnDefinition41 packet: the fifth
+// field after catalog, schema, table and org_table.
+func parseColumnName(data []byte) (string, error) {
+	pos := 0
+	for i := 0; i < 4; i++ {
+		n, size, ok := readLengthEncodedInt(data[pos:])
+		if !ok || pos+size+int(n) > len(data) {
+			return "", fmt.Errorf("malformed column definition")
+		}
+		pos += size + int(n)
+	}
+	name, _, ok := readLengthEncodedString(data[pos:])
+	if !ok {
+		return "", fmt.Errorf("malformed column definition")
+	}
+	return string(name), nil
+}
+
+func parseTextRow(data []byte, columns int) ([]sql.NullString, error) {
+	row := make([]sql.NullString, columns)
+	pos := 0
+	for i := range row {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("malformed row: %d of %d columns", i, columns)
+		}
+		if data[pos] == packetLocalInfile { // 0xfb is NULL in a row
+			pos++
+			continue
+		}
+		v, size, ok := readLengthEncodedString(data[pos:])
+		if !ok {
+			return nil, fmt.Errorf("malformed row value")
+		}
+		row[i] = sql.NullString{String: string(v), Valid: true}
+		pos += size
+	}
+	return row, nil
+}
+
+// readLengthEncodedInt returns the value and the number of bytes it used.
+func readLengthEncodedInt(b []byte) (uint64, int, bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) < 3 {
+			return 0, 0, false
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:])), 3, true
+	case 0xfd:
+		if len(b) < 4 {
+			return 0, 0, false
+		}
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4, true
+	case 0xfe:
+		if len(b) < 9 {
+			return 0, 0, false
+		}
+		return binary.LittleEndian.Uint64(b[1:]), 9, true
+	case 0xfb, 0xff:
+		return 0, 0, false
+	}
+	return uint64(b[0]), 1, true
+}
+
+func readLengthEncodedString(b []byte) ([]byte, int, bool) {
+	n, size, ok := readLengthEncodedInt(b)
+	if !ok || uint64(len(b)-size) < n {
+		return nil, 0, false
+	}
+	return b[size : size+int(n)], size + int(n), true
+}
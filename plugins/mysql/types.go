@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	tlscfg "github.com/cprobe/catpaw/digcore/pkg/tls"
+)
+
+const (
+	pluginName       = "mysql"
+	defaultMySQLPort = "3306"
+	maxPacketBytes   = 4 << 20 // 4MB, prevent unbounded allocation from malformed replies
+	maxQueryTextLen  = 512
+)
+
+type ConnectivityCheck struct {
+	Severity string `toml:"severity"`
+}
+
+type ResponseTimeCheck struct {
+	WarnGe     config.Duration `toml:"warn_ge"`
+	CriticalGe config.Duration `toml:"critical_ge"`
+}
+
+type ReplicationCheck struct {
+	Disabled *bool  `toml:"disabled"`
+	Severity string `toml:"severity"`
+}
+
+type ReplLagCheck struct {
+	WarnGe     config.Duration `toml:"warn_ge"`
+	CriticalGe config.Duration `toml:"critical_ge"`
+}
+
+type PercentCheck struct {
+	WarnGe     int `toml:"warn_ge"`
+	CriticalGe int `toml:"critical_ge"`
+}
+
+type CountCheck struct {
+	WarnGe     int `toml:"warn_ge"`
+	CriticalGe int `toml:"critical_ge"`
+}
+
+type Partial struct {
+	ID          string          `toml:"id"`
+	Concurrency int             `toml:"concurrency"`
+	Timeout     config.Duration `toml:"timeout"`
+	ReadTimeout config.Duration `toml:"read_timeout"`
+	Username    string          `toml:"username"`
+	Password    string          `toml:"password"`
+	ClusterName string          `toml:"cluster_name"`
+
+	// caching_sha2_password full authentication without TLS
+	ServerPublicKey         string `toml:"server_public_key"`
+	AllowPublicKeyRetrieval *bool  `toml:"allow_public_key_retrieval"`
+
+	tlscfg.ClientConfig
+	Connectivity    ConnectivityCheck `toml:"connectivity"`
+	ResponseTime    ResponseTimeCheck `toml:"response_time"`
+	Replication     ReplicationCheck  `toml:"replication"`
+	ReplLag         ReplLagCheck      `toml:"repl_lag"`
+	Connections     PercentCheck      `toml:"connections"`
+	AbortedConnects CountCheck        `toml:"aborted_connects"`
+}
+
+type Instance struct {
+	config.InternalConfig
+	Partial string `toml:"partial"`
+
+	Targets         []string          `toml:"targets"`
+	Concurrency     int               `toml:"concurrency"`
+	Timeout         config.Duration   `toml:"timeout"`
+	ReadTimeout     config.Duration   `toml:"read_timeout"`
+	Username        string            `toml:"username"`
+	Password        string            `toml:"password"`
+	ClusterName     string            `toml:"cluster_name"`
+	Connectivity    ConnectivityCheck `toml:"connectivity"`
+	ResponseTime    ResponseTimeCheck `toml:"response_time"`
+	Replication     ReplicationCheck  `toml:"replication"`
+	ReplLag         ReplLagCheck      `toml:"repl_lag"`
+	Connections     PercentCheck      `toml:"connections"`
+	AbortedConnects CountCheck        `toml:"aborted_connects"`
+
+	ServerPublicKey         string `toml:"server_public_key"`
+	AllowPublicKeyRetrieval *bool  `toml:"allow_public_key_retrieval"`
+
+	tlscfg.ClientConfig
+	tlsConfig *tls.Config
+	serverKey *rsa.PublicKey
+	dialFunc  func(network, address string) (net.Conn, error)
+
+	statsMu     sync.Mutex
+	prevStats   map[string]uint64 // target → Aborted_connects
+	initialized map[string]bool
+
+	inFlight sync.Map // target → int64 (unix timestamp)
+	prevHung sync.Map // target → bool
+}
+
+type MySQLPlugin struct {
+	config.InternalConfig
+	Partials  []Partial   `toml:"partials"`
+	Instances []*Instance `toml:"instances"`
+}
@@ -0,0 +1,288 @@
+package psi
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+	"github.com/cprobe/catpaw/plugins/sysdiag"
+)
+
+const pluginName = "psi"
+
+// psiPath is swapped in tests to point at fixture files.
+var psiPath = sysdiag.PSIPath
+
+type PercentThreshold struct {
+	WarnGe     float64 `toml:"warn_ge"`
+	CriticalGe float64 `toml:"critical_ge"`
+}
+
+type StallTimeThreshold struct {
+	WarnGe     config.Duration `toml:"warn_ge"`
+	CriticalGe config.Duration `toml:"critical_ge"`
+}
+
+// PressureCheck holds the thresholds of one pressure line, e.g. memory "some".
+// Total is the stall time accumulated since the previous gather.
+type PressureCheck struct {
+	Avg10 PercentThreshold   `toml:"avg10"`
+	Avg60 PercentThreshold   `toml:"avg60"`
+	Total StallTimeThreshold `toml:"total"`
+}
+
+func (c PressureCheck) enabled() bool {
+	return c.Avg10.WarnGe > 0 || c.Avg10.CriticalGe > 0 ||
+		c.Avg60.WarnGe > 0 || c.Avg60.CriticalGe > 0 ||
+		c.Total.WarnGe > 0 || c.Total.CriticalGe > 0
+}
+
+type Instance struct {
+	config.InternalConfig
+
+	Cgroups []string `toml:"cgroups"`
+
+	CPUSome    PressureCheck `toml:"cpu_some"`
+	CPUFull    PressureCheck `toml:"cpu_full"`
+	MemorySome PressureCheck `toml:"memory_some"`
+	MemoryFull PressureCheck `toml:"memory_full"`
+	IOSome     PressureCheck `toml:"io_some"`
+	IOFull     PressureCheck `toml:"io_full"`
+
+	prevTotals map[string]uint64
+}
+
+type PSIPlugin struct {
+	config.InternalConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+func (p *PSIPlugin) GetInstances() []plugins.Instance {
+	ret := make([]plugins.Instance, len(p.Instances))
+	for i := 0; i < len(p.Instances); i++ {
+		ret[i] = p.Instances[i]
+	}
+	return ret
+}
+
+func init() {
+	plugins.Add(pluginName, func() plugins.Plugin {
+		return &PSIPlugin{}
+	})
+}
+
+// checks returns the pressure checks of resource keyed by category.
+func (ins *Instance) checks(resource string) map[string]*PressureCheck {
+	switch resource {
+	case "cpu":
+		return map[string]*PressureCheck{"some": &ins.CPUSome, "full": &ins.CPUFull}
+	case "memory":
+		return map[string]*PressureCheck{"some": &ins.MemorySome, "full": &ins.MemoryFull}
+	case "io":
+		return map[string]*PressureCheck{"some": &ins.IOSome, "full": &ins.IOFull}
+	}
+	return nil
+}
+
+func (ins *Instance) Init() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("psi plugin only supports linux (current: %s)", runtime.GOOS)
+	}
+
+	for _, res := range sysdiag.PSIResources {
+		for _, cat := range []string{"some", "full"} {
+			c := ins.checks(res)[cat]
+			name := res + "_" + cat
+			if err := validatePercent(name+".avg10", c.Avg10); err != nil {
+				return err
+			}
+			if err := validatePercent(name+".avg60", c.Avg60); err != nil {
+				return err
+			}
+			if c.Total.WarnGe < 0 || c.Total.CriticalGe < 0 {
+				return fmt.Errorf("%s.total thresholds must be non-negative", name)
+			}
+			if c.Total.WarnGe > 0 && c.Total.CriticalGe > 0 && c.Total.WarnGe >= c.Total.CriticalGe {
+				return fmt.Errorf("%s.total.warn_ge(%s) must be less than %s.total.critical_ge(%s)",
+					name, time.Duration(c.Total.WarnGe), name, time.Duration(c.Total.CriticalGe))
+			}
+		}
+	}
+
+	for i, cg := range ins.Cgroups {
+		cg = strings.TrimSpace(cg)
+		if cg == "" {
+			return fmt.Errorf("cgroups[%d] is empty", i)
+		}
+		if _, err := psiPath(cg, "cpu"); err != nil {
+			return fmt.Errorf("cgroups[%d]: %v", i, err)
+		}
+		ins.Cgroups[i] = cg
+	}
+
+	ins.prevTotals = make(map[string]uint64)
+	return nil
+}
+
+func validatePercent(name string, t PercentThreshold) error {
+	if t.WarnGe < 0 || t.WarnGe > 100 || t.CriticalGe < 0 || t.CriticalGe > 100 {
+		return fmt.Errorf("%s thresholds must be between 0 and 100 (got warn_ge=%.1f, critical_ge=%.1f)",
+			name, t.WarnGe, t.CriticalGe)
+	}
+	if t.WarnGe > 0 && t.CriticalGe > 0 && t.WarnGe >= t.CriticalGe {
+		return fmt.Errorf("%s.warn_ge(%.1f) must be less than %s.critical_ge(%.1f)",
+			name, t.WarnGe, name, t.CriticalGe)
+	}
+	return nil
+}
+
+func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	if ins.prevTotals == nil {
+		ins.prevTotals = make(map[string]uint64)
+	}
+
+	// an empty cgroup is the system-wide /proc/pressure
+	cgroups := ins.Cgroups
+	if len(cgroups) == 0 {
+		cgroups = []string{""}
+	}
+
+	for _, cg := range cgroups {
+		target := cg
+		if target == "" {
+			target = "system"
+		}
+		for _, res := range sysdiag.PSIResources {
+			ins.gatherResource(q, cg, target, res)
+		}
+	}
+}
+
+func (ins *Instance) gatherResource(q *safe.Queue[*types.Event], cgroup, target, resource string) {
+	checks := ins.checks(resource)
+	if !checks["some"].enabled() && !checks["full"].enabled() {
+		return
+	}
+
+	path, err := psiPath(cgroup, resource)
+	var lines []sysdiag.PSILine
+	if err == nil {
+		lines, err = sysdiag.ReadPSIFile(path)
+	}
+
+	for _, cat := range []string{"some", "full"} {
+		c := checks[cat]
+		if !c.enabled() {
+			continue
+		}
+		labels := map[string]string{
+			"check":  fmt.Sprintf("psi::%s_%s", resource, cat),
+			"target": target,
+		}
+
+		if err != nil {
+			q.PushFront(types.BuildEvent(labels).
+				SetEventStatus(types.EventStatusCritical).
+				SetDescription(fmt.Sprintf("failed to read %s pressure: %v", resource, err)))
+			continue
+		}
+
+		line, ok := findLine(lines, cat)
+		if !ok {
+			// kernels before 5.13 have no system-wide "full" line for cpu
+			continue
+		}
+		q.PushFront(ins.buildEvent(labels, target, resource, *c, line))
+	}
+}
+
+func findLine(lines []sysdiag.PSILine, category string) (sysdiag.PSILine, bool) {
+	for _, l := range lines {
+		if l.Category == category {
+			return l, true
+		}
+	}
+	return sysdiag.PSILine{}, false
+}
+
+func (ins *Instance) buildEvent(labels map[string]string, target, resource string, c PressureCheck, line sysdiag.PSILine) *types.Event {
+	name := resource + " " + line.Category
+
+	status := types.EventStatusOk
+	var reasons, thresholds []string
+
+	eval := func(what string, value, warnGe, criticalGe float64, valueStr, warnStr, critStr string) {
+		if warnGe > 0 {
+			thresholds = append(thresholds, fmt.Sprintf("%s Warning ≥ %s", what, warnStr))
+		}
+		if criticalGe > 0 {
+			thresholds = append(thresholds, fmt.Sprintf("%s Critical ≥ %s", what, critStr))
+		}
+		s := types.EvaluateGeThreshold(value, warnGe, criticalGe)
+		switch s {
+		case types.EventStatusCritical:
+			reasons = append(reasons, fmt.Sprintf("%s %s ≥ critical %s", what, valueStr, critStr))
+		case types.EventStatusWarning:
+			reasons = append(reasons, fmt.Sprintf("%s %s ≥ warning %s", what, valueStr, warnStr))
+		}
+		status = worseStatus(status, s)
+	}
+
+	eval("avg10", line.Avg10, c.Avg10.WarnGe, c.Avg10.CriticalGe,
+		fmt.Sprintf("%.2f%%", line.Avg10), fmt.Sprintf("%.0f%%", c.Avg10.WarnGe), fmt.Sprintf("%.0f%%", c.Avg10.CriticalGe))
+	eval("avg60", line.Avg60, c.Avg60.WarnGe, c.Avg60.CriticalGe,
+		fmt.Sprintf("%.2f%%", line.Avg60), fmt.Sprintf("%.0f%%", c.Avg60.WarnGe), fmt.Sprintf("%.0f%%", c.Avg60.CriticalGe))
+
+	attrs := map[string]string{
+		"avg10":  fmt.Sprintf("%.2f%%", line.Avg10),
+		"avg60":  fmt.Sprintf("%.2f%%", line.Avg60),
+		"avg300": fmt.Sprintf("%.2f%%", line.Avg300),
+		"total":  time.Duration(line.TotalUs * uint64(time.Microsecond)).String(),
+	}
+
+	key := target + "/" + resource + "/" + line.Category
+	prev, hasPrev := ins.prevTotals[key]
+	ins.prevTotals[key] = line.TotalUs
+	// the first gather only records the baseline; a counter that went
+	// backwards means the cgroup was recreated
+	if hasPrev && line.TotalUs >= prev {
+		delta := time.Duration((line.TotalUs - prev) * uint64(time.Microsecond))
+		attrs["total_delta"] = delta.String()
+		eval("total delta", float64(delta), float64(c.Total.WarnGe), float64(c.Total.CriticalGe),
+			delta.String(), time.Duration(c.Total.WarnGe).String(), time.Duration(c.Total.CriticalGe).String())
+	}
+
+	if len(thresholds) > 0 {
+		attrs["threshold_desc"] = strings.Join(thresholds, ", ")
+	}
+
+	event := types.BuildEvent(labels).
+		SetAttrs(attrs).
+		SetCurrentValue(fmt.Sprintf("%.2f%%", line.Avg10)).
+		SetEventStatus(status)
+
+	if len(reasons) > 0 {
+		event.SetDescription(fmt.Sprintf("%s pressure on %s: %s", name, target, strings.Join(reasons, ", ")))
+	} else {
+		event.SetDescription(fmt.Sprintf("%s pressure on %s: avg10 %.2f%%, avg60 %.2f%%, everything is ok",
+			name, target, line.Avg10, line.Avg60))
+	}
+	return event
+}
+
+func worseStatus(a, b string) string {
+	rank := map[string]int{
+		types.EventStatusOk:       0,
+		types.EventStatusWarning:  1,
+		types.EventStatusCritical: 2,
+	}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,241 @@
+package psi
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func TestInit_PlatformCheck(t *testing.T) {
+	ins := &Instance{}
+	err := ins.Init()
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Error("expected error on non-linux platform")
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("unexpected error on linux: %v", err)
+	}
+}
+
+func TestInit_Validation(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("psi only supports linux")
+	}
+
+	tests := []struct {
+		name    string
+		ins     Instance
+		wantErr bool
+	}{
+		{
+			name: "valid thresholds",
+			ins: Instance{MemorySome: PressureCheck{
+				Avg10: PercentThreshold{WarnGe: 10, CriticalGe: 30},
+				Total: StallTimeThreshold{WarnGe: config.Duration(time.Second), CriticalGe: config.Duration(5 * time.Second)},
+			}},
+		},
+		{
+			name:    "avg10 warn_ge >= critical_ge",
+			ins:     Instance{CPUSome: PressureCheck{Avg10: PercentThreshold{WarnGe: 50, CriticalGe: 20}}},
+			wantErr: true,
+		},
+		{
+			name:    "avg60 above 100",
+			ins:     Instance{IOFull: PressureCheck{Avg60: PercentThreshold{CriticalGe: 120}}},
+			wantErr: true,
+		},
+		{
+			name: "total warn_ge >= critical_ge",
+			ins: Instance{IOSome: PressureCheck{
+				Total: StallTimeThreshold{WarnGe: config.Duration(5 * time.Second), CriticalGe: config.Duration(time.Second)},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "cgroup path",
+			ins:  Instance{Cgroups: []string{"/system.slice/nginx.service"}},
+		},
+		{
+			name:    "cgroup path escaping the mount",
+			ins:     Instance{Cgroups: []string{"/../etc"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ins.Init()
+			if tt.wantErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGather_SkipWhenUnconfigured(t *testing.T) {
+	ins := &Instance{}
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+
+	if q.Len() != 0 {
+		t.Errorf("expected 0 events when unconfigured, got %d", q.Len())
+	}
+}
+
+// mockPressure points psiPath at dir/<cgroup>/<resource>.
+func mockPressure(t *testing.T, dir string) {
+	orig := psiPath
+	t.Cleanup(func() { psiPath = orig })
+	psiPath = func(cgroup, resource string) (string, error) {
+		return filepath.Join(dir, cgroup, resource), nil
+	}
+}
+
+func writePressure(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func popAll(q *safe.Queue[*types.Event]) map[string]*types.Event {
+	ret := map[string]*types.Event{}
+	for q.Len() > 0 {
+		e := *q.PopBack()
+		ret[e.Labels["target"]+" "+e.Labels["check"]] = e
+	}
+	return ret
+}
+
+func TestGather_Averages(t *testing.T) {
+	dir := t.TempDir()
+	mockPressure(t, dir)
+	writePressure(t, filepath.Join(dir, "memory"),
+		"some avg10=35.00 avg60=12.00 avg300=3.00 total=1000\n"+
+			"full avg10=1.00 avg60=0.50 avg300=0.10 total=100\n")
+
+	ins := &Instance{
+		MemorySome: PressureCheck{Avg10: PercentThreshold{WarnGe: 10, CriticalGe: 30}},
+		MemoryFull: PressureCheck{Avg60: PercentThreshold{WarnGe: 5, CriticalGe: 20}},
+	}
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+
+	events := popAll(q)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	some := events["system psi::memory_some"]
+	if some == nil || some.EventStatus != types.EventStatusCritical {
+		t.Fatalf("memory_some: %+v", some)
+	}
+	if some.Attrs["avg10"] != "35.00%" || !strings.Contains(some.Attrs["threshold_desc"], "avg10 Critical ≥ 30%") {
+		t.Errorf("memory_some attrs: %v", some.Attrs)
+	}
+
+	full := events["system psi::memory_full"]
+	if full == nil || full.EventStatus != types.EventStatusOk {
+		t.Fatalf("memory_full: %+v", full)
+	}
+}
+
+func TestGather_TotalDelta(t *testing.T) {
+	dir := t.TempDir()
+	mockPressure(t, dir)
+	path := filepath.Join(dir, "io")
+
+	ins := &Instance{
+		IOFull: PressureCheck{Total: StallTimeThreshold{
+			WarnGe:     config.Duration(time.Second),
+			CriticalGe: config.Duration(3 * time.Second),
+		}},
+	}
+	gather := func(totalUs string) *types.Event {
+		writePressure(t, path,
+			"some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"+
+				"full avg10=0.00 avg60=0.00 avg300=0.00 total="+totalUs+"\n")
+		q := safe.NewQueue[*types.Event]()
+		ins.Gather(q)
+		return popAll(q)["system psi::io_full"]
+	}
+
+	// first gather only records the baseline
+	e := gather("10000000")
+	if e.EventStatus != types.EventStatusOk || e.Attrs["total_delta"] != "" {
+		t.Fatalf("first gather: status=%s attrs=%v", e.EventStatus, e.Attrs)
+	}
+
+	e = gather("11500000")
+	if e.EventStatus != types.EventStatusWarning || e.Attrs["total_delta"] != "1.5s" {
+		t.Fatalf("second gather: status=%s attrs=%v", e.EventStatus, e.Attrs)
+	}
+
+	e = gather("15000000")
+	if e.EventStatus != types.EventStatusCritical {
+		t.Fatalf("third gather: status=%s attrs=%v", e.EventStatus, e.Attrs)
+	}
+
+	// counter reset: new baseline, no alert
+	e = gather("100")
+	if e.EventStatus != types.EventStatusOk {
+		t.Fatalf("after reset: status=%s attrs=%v", e.EventStatus, e.Attrs)
+	}
+}
+
+func TestGather_Cgroups(t *testing.T) {
+	dir := t.TempDir()
+	mockPressure(t, dir)
+	writePressure(t, filepath.Join(dir, "/system.slice/nginx.service", "cpu"),
+		"some avg10=60.00 avg60=40.00 avg300=10.00 total=1000\n"+
+			"full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+
+	ins := &Instance{
+		Cgroups: []string{"/system.slice/nginx.service", "/system.slice/gone.service"},
+		CPUSome: PressureCheck{Avg10: PercentThreshold{WarnGe: 20, CriticalGe: 50}},
+	}
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+
+	events := popAll(q)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if e := events["/system.slice/nginx.service psi::cpu_some"]; e == nil || e.EventStatus != types.EventStatusCritical {
+		t.Errorf("nginx cpu_some: %+v", e)
+	}
+	if e := events["/system.slice/gone.service psi::cpu_some"]; e == nil || e.EventStatus != types.EventStatusCritical ||
+		!strings.Contains(e.Description, "failed to read cpu pressure") {
+		t.Errorf("missing cgroup: %+v", e)
+	}
+}
+
+func TestGather_MissingFullLine(t *testing.T) {
+	dir := t.TempDir()
+	mockPressure(t, dir)
+	// kernels before 5.13 report only "some" for system-wide cpu
+	writePressure(t, filepath.Join(dir, "cpu"), "some avg10=1.00 avg60=1.00 avg300=1.00 total=10\n")
+
+	ins := &Instance{CPUFull: PressureCheck{Avg10: PercentThreshold{WarnGe: 10}}}
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+
+	if q.Len() != 0 {
+		t.Errorf("expected no event without a full line, got %d", q.Len())
+	}
+}
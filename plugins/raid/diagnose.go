@@ -0,0 +1,139 @@
+package raid
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/plugins"
+)
+
+var _ plugins.Diagnosable = (*RaidPlugin)(nil)
+
+func (p *RaidPlugin) RegisterDiagnoseTools(registry *diagnose.ToolRegistry) {
+	registry.RegisterCategory("raid", "raid",
+		"Linux software RAID (mdadm) diagnostic tools. Linux only.",
+		diagnose.ToolScopeLocal)
+
+	registry.Register("raid", diagnose.DiagnoseTool{
+		Name:        "raid_topology",
+		Description: "Show md software RAID topology from /proc/mdstat and sysfs: level, state, [n/m] [UU_] status, every member with its slot and state (in_sync, faulty, spare), resync/recovery progress and mismatch_cnt.",
+		Scope:       diagnose.ToolScopeLocal,
+		Parameters: []diagnose.ToolParam{
+			{Name: "array", Type: "string", Description: "Only show this array, e.g. md0 (default: all)"},
+		},
+		Execute: execRaidTopology,
+	})
+}
+
+func execRaidTopology(_ context.Context, args map[string]string) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("raid_topology requires linux (current: %s)", runtime.GOOS)
+	}
+
+	arrays, err := readArrays()
+	if os.IsNotExist(err) {
+		return "No md software RAID (md driver not loaded).", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if name := strings.TrimPrefix(strings.TrimSpace(args["array"]), "/dev/"); name != "" {
+		var found []*mdArray
+		for _, a := range arrays {
+			if a.Name == name {
+				found = append(found, a)
+			}
+		}
+		if len(found) == 0 {
+			return "", fmt.Errorf("array %q not found in %s", name, mdstatPath)
+		}
+		arrays = found
+	}
+
+	return formatTopology(arrays), nil
+}
+
+func formatTopology(arrays []*mdArray) string {
+	if len(arrays) == 0 {
+		return "No md arrays found."
+	}
+
+	var b strings.Builder
+	for i, a := range arrays {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		state := "inactive"
+		if a.Active {
+			state = "active"
+		}
+		if a.ReadOnly != "" {
+			state += " (" + a.ReadOnly + ")"
+		}
+		fmt.Fprintf(&b, "%s: %s %s", a.Name, state, a.Level)
+		if c := a.counts(); c != "" {
+			fmt.Fprintf(&b, " %s", c)
+		}
+		b.WriteByte('\n')
+
+		if a.ArrayState != "" {
+			fmt.Fprintf(&b, "  array_state:  %s\n", a.ArrayState)
+		}
+		if a.Blocks > 0 {
+			fmt.Fprintf(&b, "  size:         %.1f GiB\n", float64(a.Blocks)/(1<<20))
+		}
+		if n := a.missing(); n > 0 {
+			fmt.Fprintf(&b, "  degraded:     %d device(s) missing [!!!]\n", n)
+		}
+		if s := a.syncDesc(); s != "" {
+			fmt.Fprintf(&b, "  sync:         %s\n", s)
+		}
+		if a.MismatchCnt >= 0 {
+			marker := ""
+			if a.MismatchCnt > 0 {
+				marker = " [!]"
+			}
+			fmt.Fprintf(&b, "  mismatch_cnt: %d%s\n", a.MismatchCnt, marker)
+		}
+
+		fmt.Fprintf(&b, "  %-12s  %-5s  %-6s  %s\n", "MEMBER", "INDEX", "SLOT", "STATE")
+		for _, m := range a.Members {
+			slot := m.Slot
+			if slot == "" {
+				slot = "-"
+			}
+			st := m.State
+			if st == "" {
+				st = memberStateFromFlags(m)
+			}
+			marker := ""
+			if m.faulty() {
+				marker = " [!!!]"
+			}
+			fmt.Fprintf(&b, "  %-12s  %-5d  %-6s  %s%s\n", m.Name, m.Index, slot, st, marker)
+		}
+	}
+	return b.String()
+}
+
+func memberStateFromFlags(m mdMember) string {
+	switch {
+	case m.faulty():
+		return "faulty"
+	case m.spare():
+		return "spare"
+	case strings.Contains(m.Flags, "R"):
+		return "replacement"
+	case strings.Contains(m.Flags, "J"):
+		return "journal"
+	case strings.Contains(m.Flags, "W"):
+		return "in_sync,write_mostly"
+	}
+	return "in_sync"
+}
@@ -0,0 +1,231 @@
+package raid
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Swapped in tests to point at fixtures.
+var (
+	mdstatPath  = "/proc/mdstat"
+	sysBlockDir = "/sys/block"
+)
+
+var (
+	memberRe   = regexp.MustCompile(`^(\S+)\[(\d+)\]((?:\([A-Z]\))*)$`)
+	countsRe   = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	statusRe   = regexp.MustCompile(`\[([U_]+)\]`)
+	progressRe = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([\d.]+)%(?:.*?finish=(\S+))?(?:.*?speed=(\S+))?`)
+	delayedRe  = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*(DELAYED|PENDING)`)
+)
+
+// mdMember is a component device of an array, e.g. "sdb2[0](F)".
+type mdMember struct {
+	Name  string
+	Index int
+	Flags string // mdstat flag letters: F faulty, S spare, W write-mostly, R replacement, J journal
+
+	// from /sys/block/mdX/md/dev-<name>/, empty when unavailable
+	State string // e.g. "in_sync", "faulty", "spare", "in_sync,write_mostly"
+	Slot  string // role in the array, "none" for spares
+}
+
+func (m mdMember) faulty() bool {
+	return strings.Contains(m.Flags, "F") || strings.Contains(m.State, "faulty")
+}
+
+func (m mdMember) spare() bool {
+	return strings.Contains(m.Flags, "S") || m.State == "spare"
+}
+
+type mdArray struct {
+	Name     string
+	Active   bool   // "active" or "inactive" in mdstat
+	ReadOnly string // "read-only" or "auto-read-only"
+	Level    string // raid1, raid5, ..., empty for inactive arrays
+	Members  []mdMember
+	Blocks   int64
+
+	RaidDisks   int    // n of [n/m], 0 for levels without redundancy
+	ActiveDisks int    // m of [n/m]
+	Status      string // "UU_", one letter per slot
+
+	SyncAction   string // resync, recovery, reshape, check or repair in progress
+	SyncProgress string // "12.6%", "DELAYED" or "PENDING"
+	SyncFinish   string
+	SyncSpeed    string
+
+	// from /sys/block/mdX/md/, -1 or empty when unavailable
+	ArrayState  string
+	Degraded    int
+	MismatchCnt int64
+}
+
+// missing returns how many devices the array is short of.
+func (a *mdArray) missing() int {
+	if a.Degraded >= 0 {
+		return a.Degraded
+	}
+	if a.RaidDisks > a.ActiveDisks {
+		return a.RaidDisks - a.ActiveDisks
+	}
+	return 0
+}
+
+func (a *mdArray) failedMembers() []string {
+	var ret []string
+	for _, m := range a.Members {
+		if m.faulty() {
+			ret = append(ret, m.Name)
+		}
+	}
+	return ret
+}
+
+func (a *mdArray) counts() string {
+	if a.RaidDisks == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d] [%s]", a.RaidDisks, a.ActiveDisks, a.Status)
+}
+
+func (a *mdArray) syncDesc() string {
+	if a.SyncAction == "" {
+		return ""
+	}
+	s := a.SyncAction + " " + a.SyncProgress
+	if a.SyncFinish != "" {
+		s += ", finish " + a.SyncFinish
+	}
+	if a.SyncSpeed != "" {
+		s += ", speed " + a.SyncSpeed
+	}
+	return s
+}
+
+// readArrays parses /proc/mdstat and adds what sysfs knows about each array.
+func readArrays() ([]*mdArray, error) {
+	f, err := os.Open(mdstatPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	arrays, err := parseMdstat(bufio.NewScanner(f))
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range arrays {
+		readSysfs(a)
+	}
+	return arrays, nil
+}
+
+func parseMdstat(sc *bufio.Scanner) ([]*mdArray, error) {
+	var (
+		arrays []*mdArray
+		cur    *mdArray
+	)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if name, rest, ok := strings.Cut(line, " : "); ok && strings.HasPrefix(name, "md") && !strings.ContainsAny(name, " \t") {
+			cur = parseArrayLine(name, rest)
+			arrays = append(arrays, cur)
+			continue
+		}
+		if cur == nil || trimmed == "" {
+			cur = nil
+			continue
+		}
+
+		if m := countsRe.FindStringSubmatch(trimmed); m != nil {
+			cur.RaidDisks, _ = strconv.Atoi(m[1])
+			cur.ActiveDisks, _ = strconv.Atoi(m[2])
+		}
+		if m := statusRe.FindStringSubmatch(trimmed); m != nil {
+			cur.Status = m[1]
+		}
+		if strings.Contains(trimmed, " blocks") {
+			cur.Blocks, _ = strconv.ParseInt(strings.Fields(trimmed)[0], 10, 64)
+		}
+		if m := progressRe.FindStringSubmatch(trimmed); m != nil {
+			cur.SyncAction, cur.SyncProgress = m[1], m[2]+"%"
+			cur.SyncFinish, cur.SyncSpeed = m[3], m[4]
+		} else if m := delayedRe.FindStringSubmatch(trimmed); m != nil {
+			cur.SyncAction, cur.SyncProgress = m[1], m[2]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %v", mdstatPath, err)
+	}
+	return arrays, nil
+}
+
+// parseArrayLine parses e.g. "active (auto-read-only) raid1 sdb1[1] sda1[0](F)".
+func parseArrayLine(name, rest string) *mdArray {
+	a := &mdArray{Name: name, Degraded: -1, MismatchCnt: -1}
+	for _, tok := range strings.Fields(rest) {
+		switch {
+		case tok == "active":
+			a.Active = true
+		case tok == "inactive":
+			a.Active = false
+		case strings.HasPrefix(tok, "(") && strings.HasSuffix(tok, ")"):
+			a.ReadOnly = strings.Trim(tok, "()")
+		default:
+			if m := memberRe.FindStringSubmatch(tok); m != nil {
+				idx, _ := strconv.Atoi(m[2])
+				flags := strings.NewReplacer("(", "", ")", "").Replace(m[3])
+				a.Members = append(a.Members, mdMember{Name: m[1], Index: idx, Flags: flags})
+			} else if a.Level == "" {
+				a.Level = tok
+			}
+		}
+	}
+	sort.Slice(a.Members, func(i, j int) bool { return a.Members[i].Index < a.Members[j].Index })
+	return a
+}
+
+func readSysfs(a *mdArray) {
+	dir := filepath.Join(sysBlockDir, a.Name, "md")
+
+	if v, ok := readSysfsValue(filepath.Join(dir, "array_state")); ok {
+		a.ArrayState = v
+	}
+	if v, ok := readSysfsValue(filepath.Join(dir, "degraded")); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			a.Degraded = n
+		}
+	}
+	if v, ok := readSysfsValue(filepath.Join(dir, "mismatch_cnt")); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			a.MismatchCnt = n
+		}
+	}
+
+	for i := range a.Members {
+		mdir := filepath.Join(dir, "dev-"+a.Members[i].Name)
+		if v, ok := readSysfsValue(filepath.Join(mdir, "state")); ok {
+			a.Members[i].State = v
+		}
+		if v, ok := readSysfsValue(filepath.Join(mdir, "slot")); ok {
+			a.Members[i].Slot = v
+		}
+	}
+}
+
+func readSysfsValue(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
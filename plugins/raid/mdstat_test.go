@@ -0,0 +1,135 @@
+package raid
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const mdstatMixed = `Personalities : [raid1] [raid6] [raid5] [raid4] [raid0]
+md0 : active raid1 sdb1[1] sda1[0]
+      1047552 blocks super 1.2 [2/2] [UU]
+      bitmap: 0/1 pages [0KB], 65536KB chunk
+
+md1 : active raid5 sdd1[3] sdc1[1] sdb2[0](F)
+      2095104 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [_U_]
+      [==>..................]  recovery = 12.6% (132480/1047552) finish=0.7min speed=22080K/sec
+
+md2 : active (auto-read-only) raid1 sdf1[2](S) sde1[1] sdg1[0]
+      524224 blocks super 1.2 [2/2] [UU]
+        resync=PENDING
+
+md3 : active raid0 sdh1[1] sdi1[0]
+      2093056 blocks super 1.2 512k chunks
+
+md127 : inactive sdj[0](S)
+      976762584 blocks super 1.2
+
+unused devices: <none>
+`
+
+// writeMdstat writes an mdstat fixture and an empty sysfs tree and points
+// the package at them.
+func writeMdstat(t *testing.T, content string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mdstat")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sys := filepath.Join(dir, "block")
+	if err := os.MkdirAll(sys, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	origMdstat, origSys := mdstatPath, sysBlockDir
+	t.Cleanup(func() { mdstatPath, sysBlockDir = origMdstat, origSys })
+	mdstatPath, sysBlockDir = path, sys
+	return sys
+}
+
+func writeSysfs(t *testing.T, sys, rel, value string) {
+	path := filepath.Join(sys, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseMdstat(t *testing.T) {
+	writeMdstat(t, mdstatMixed)
+
+	arrays, err := readArrays()
+	if err != nil {
+		t.Fatalf("readArrays: %v", err)
+	}
+	if len(arrays) != 5 {
+		t.Fatalf("expected 5 arrays, got %d", len(arrays))
+	}
+
+	md0 := arrays[0]
+	if md0.Name != "md0" || !md0.Active || md0.Level != "raid1" || md0.RaidDisks != 2 || md0.ActiveDisks != 2 ||
+		md0.Status != "UU" || md0.Blocks != 1047552 || len(md0.Members) != 2 || md0.missing() != 0 {
+		t.Errorf("md0: %+v", md0)
+	}
+	if md0.Members[0].Name != "sda1" {
+		t.Errorf("md0 members should be sorted by index: %+v", md0.Members)
+	}
+
+	md1 := arrays[1]
+	if md1.Level != "raid5" || md1.RaidDisks != 3 || md1.ActiveDisks != 2 || md1.Status != "_U_" || md1.missing() != 1 {
+		t.Errorf("md1: %+v", md1)
+	}
+	if md1.SyncAction != "recovery" || md1.SyncProgress != "12.6%" || md1.SyncFinish != "0.7min" || md1.SyncSpeed != "22080K/sec" {
+		t.Errorf("md1 sync: %q %q %q %q", md1.SyncAction, md1.SyncProgress, md1.SyncFinish, md1.SyncSpeed)
+	}
+	if failed := md1.failedMembers(); len(failed) != 1 || failed[0] != "sdb2" {
+		t.Errorf("md1 failed members: %v", failed)
+	}
+
+	md2 := arrays[2]
+	if md2.ReadOnly != "auto-read-only" || md2.SyncAction != "resync" || md2.SyncProgress != "PENDING" {
+		t.Errorf("md2: %+v", md2)
+	}
+	if !md2.Members[2].spare() {
+		t.Errorf("md2 sdf1 should be a spare: %+v", md2.Members)
+	}
+
+	md3 := arrays[3]
+	if md3.Level != "raid0" || md3.RaidDisks != 0 || md3.counts() != "" {
+		t.Errorf("md3: %+v", md3)
+	}
+
+	md127 := arrays[4]
+	if md127.Active || md127.Level != "" || len(md127.Members) != 1 || !md127.Members[0].spare() {
+		t.Errorf("md127: %+v", md127)
+	}
+}
+
+func TestReadSysfs(t *testing.T) {
+	sys := writeMdstat(t, mdstatMixed)
+	writeSysfs(t, sys, "md0/md/array_state", "clean")
+	writeSysfs(t, sys, "md0/md/degraded", "0")
+	writeSysfs(t, sys, "md0/md/mismatch_cnt", "256")
+	writeSysfs(t, sys, "md0/md/dev-sda1/state", "in_sync")
+	writeSysfs(t, sys, "md0/md/dev-sda1/slot", "0")
+	writeSysfs(t, sys, "md0/md/dev-sdb1/state", "faulty")
+	writeSysfs(t, sys, "md0/md/dev-sdb1/slot", "1")
+
+	arrays, err := readArrays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	md0 := arrays[0]
+	if md0.ArrayState != "clean" || md0.Degraded != 0 || md0.MismatchCnt != 256 {
+		t.Errorf("md0 sysfs: %+v", md0)
+	}
+	if md0.Members[1].State != "faulty" || md0.Members[1].Slot != "1" || !md0.Members[1].faulty() {
+		t.Errorf("md0 member sysfs: %+v", md0.Members[1])
+	}
+	// no sysfs for md1: mismatch unknown, degraded from mdstat counts
+	if arrays[1].MismatchCnt != -1 || arrays[1].Degraded != -1 || arrays[1].missing() != 1 {
+		t.Errorf("md1 without sysfs: %+v", arrays[1])
+	}
+}
@@ -0,0 +1,277 @@
+package raid
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const pluginName = "raid"
+
+type SeverityCheck struct {
+	Severity string `toml:"severity"`
+}
+
+type MismatchCheck struct {
+	WarnGe     int64 `toml:"warn_ge"`
+	CriticalGe int64 `toml:"critical_ge"`
+}
+
+type Instance struct {
+	config.InternalConfig
+
+	Arrays []string `toml:"arrays"`
+
+	ArrayState    SeverityCheck `toml:"array_state"`
+	FailedMembers SeverityCheck `toml:"failed_members"`
+	MismatchCnt   MismatchCheck `toml:"mismatch_cnt"`
+}
+
+type RaidPlugin struct {
+	config.InternalConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+func (p *RaidPlugin) GetInstances() []plugins.Instance {
+	ret := make([]plugins.Instance, len(p.Instances))
+	for i := 0; i < len(p.Instances); i++ {
+		ret[i] = p.Instances[i]
+	}
+	return ret
+}
+
+func init() {
+	plugins.Add(pluginName, func() plugins.Plugin {
+		return &RaidPlugin{}
+	})
+}
+
+func (ins *Instance) Init() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("raid plugin only supports linux (current: %s)", runtime.GOOS)
+	}
+
+	if ins.ArrayState.Severity == "" {
+		ins.ArrayState.Severity = types.EventStatusCritical
+	} else if !types.EventStatusValid(ins.ArrayState.Severity) {
+		return fmt.Errorf("invalid array_state.severity %q", ins.ArrayState.Severity)
+	}
+
+	if ins.FailedMembers.Severity == "" {
+		ins.FailedMembers.Severity = types.EventStatusWarning
+	} else if !types.EventStatusValid(ins.FailedMembers.Severity) {
+		return fmt.Errorf("invalid failed_members.severity %q", ins.FailedMembers.Severity)
+	}
+
+	if ins.MismatchCnt.WarnGe < 0 || ins.MismatchCnt.CriticalGe < 0 {
+		return fmt.Errorf("mismatch_cnt thresholds must be non-negative")
+	}
+	if ins.MismatchCnt.WarnGe > 0 && ins.MismatchCnt.CriticalGe > 0 && ins.MismatchCnt.WarnGe >= ins.MismatchCnt.CriticalGe {
+		return fmt.Errorf("mismatch_cnt.warn_ge(%d) must be less than mismatch_cnt.critical_ge(%d)",
+			ins.MismatchCnt.WarnGe, ins.MismatchCnt.CriticalGe)
+	}
+
+	for i, name := range ins.Arrays {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "/dev/")
+		if !strings.HasPrefix(name, "md") || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid array %q, expected an md device such as md0", ins.Arrays[i])
+		}
+		ins.Arrays[i] = name
+	}
+
+	return nil
+}
+
+func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	arrays, err := readArrays()
+	if os.IsNotExist(err) && len(ins.Arrays) == 0 {
+		// md driver not loaded: no software RAID to watch
+		return
+	}
+	if err != nil {
+		q.PushFront(types.BuildEvent(map[string]string{
+			"check":  "raid::array_state",
+			"target": "mdstat",
+		}).SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to read md arrays: %v", err)))
+		return
+	}
+
+	byName := make(map[string]*mdArray, len(arrays))
+	for _, a := range arrays {
+		byName[a.Name] = a
+	}
+
+	if len(ins.Arrays) > 0 {
+		selected := make([]*mdArray, 0, len(ins.Arrays))
+		for _, name := range ins.Arrays {
+			a, ok := byName[name]
+			if !ok {
+				q.PushFront(types.BuildEvent(map[string]string{
+					"check":  "raid::array_state",
+					"target": name,
+				}).SetEventStatus(ins.ArrayState.Severity).
+					SetDescription(fmt.Sprintf("array %s not found in %s", name, mdstatPath)))
+				continue
+			}
+			selected = append(selected, a)
+		}
+		arrays = selected
+	}
+
+	for _, a := range arrays {
+		attrs := arrayAttrs(a)
+		ins.checkArrayState(q, a, attrs)
+		ins.checkFailedMembers(q, a, attrs)
+		ins.checkMismatchCnt(q, a, attrs)
+	}
+}
+
+func arrayAttrs(a *mdArray) map[string]string {
+	attrs := map[string]string{
+		"members": memberList(a),
+	}
+	if a.Level != "" {
+		attrs["level"] = a.Level
+	}
+	if a.ArrayState != "" {
+		attrs["array_state"] = a.ArrayState
+	}
+	if a.RaidDisks > 0 {
+		attrs["devices"] = fmt.Sprintf("%d/%d", a.ActiveDisks, a.RaidDisks)
+		attrs["status"] = a.Status
+	}
+	if a.SyncAction != "" {
+		attrs["sync_action"] = a.SyncAction
+		attrs["sync_progress"] = a.SyncProgress
+		if a.SyncFinish != "" {
+			attrs["sync_finish"] = a.SyncFinish
+		}
+		if a.SyncSpeed != "" {
+			attrs["sync_speed"] = a.SyncSpeed
+		}
+	}
+	return attrs
+}
+
+func memberList(a *mdArray) string {
+	parts := make([]string, 0, len(a.Members))
+	for _, m := range a.Members {
+		s := m.Name
+		if m.Flags != "" {
+			s += "(" + m.Flags + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (ins *Instance) checkArrayState(q *safe.Queue[*types.Event], a *mdArray, attrs map[string]string) {
+	event := types.BuildEvent(map[string]string{
+		"check":  "raid::array_state",
+		"target": a.Name,
+	}).SetAttrs(attrs)
+	event.Attrs["threshold_desc"] = fmt.Sprintf("%s: array inactive, broken or degraded", ins.ArrayState.Severity)
+
+	summary := strings.Join(strings.Fields(a.Name+" "+a.Level+" "+a.counts()), " ")
+	sync := a.syncDesc()
+
+	var problem string
+	switch {
+	case !a.Active:
+		problem = "is inactive (not assembled or missing members)"
+		event.SetCurrentValue("inactive")
+	case a.ArrayState == "broken":
+		problem = "is broken (a member without redundancy failed)"
+		event.SetCurrentValue("broken")
+	case a.missing() > 0:
+		problem = fmt.Sprintf("is degraded, %d device(s) missing", a.missing())
+		event.SetCurrentValue("degraded")
+	}
+
+	if problem == "" {
+		desc := summary + " is healthy"
+		if sync != "" {
+			desc += ", " + sync
+		}
+		q.PushFront(event.SetCurrentValue("healthy").SetDescription(desc))
+		return
+	}
+
+	desc := summary + " " + problem
+	if failed := a.failedMembers(); len(failed) > 0 {
+		desc += fmt.Sprintf(", failed: %s", strings.Join(failed, ", "))
+	}
+	if sync != "" {
+		desc += ", " + sync
+	}
+	q.PushFront(event.SetEventStatus(ins.ArrayState.Severity).SetDescription(desc))
+}
+
+func (ins *Instance) checkFailedMembers(q *safe.Queue[*types.Event], a *mdArray, attrs map[string]string) {
+	event := types.BuildEvent(map[string]string{
+		"check":  "raid::failed_members",
+		"target": a.Name,
+	}).SetAttrs(attrs)
+	event.Attrs["threshold_desc"] = fmt.Sprintf("%s: member marked faulty", ins.FailedMembers.Severity)
+
+	failed := a.failedMembers()
+	event.SetCurrentValue(strconv.Itoa(len(failed)))
+	if len(failed) == 0 {
+		q.PushFront(event.SetDescription(fmt.Sprintf("%s has no failed members", a.Name)))
+		return
+	}
+
+	// after a spare took over the array is healthy again, but the faulty
+	// disk still has to be replaced and removed with mdadm --remove
+	q.PushFront(event.SetEventStatus(ins.FailedMembers.Severity).
+		SetDescription(fmt.Sprintf("%s has failed members: %s", a.Name, strings.Join(failed, ", "))))
+}
+
+func (ins *Instance) checkMismatchCnt(q *safe.Queue[*types.Event], a *mdArray, attrs map[string]string) {
+	if ins.MismatchCnt.WarnGe == 0 && ins.MismatchCnt.CriticalGe == 0 {
+		return
+	}
+	if a.MismatchCnt < 0 {
+		// raid0/linear have no redundancy to compare
+		return
+	}
+
+	value := strconv.FormatInt(a.MismatchCnt, 10)
+	event := types.BuildEvent(map[string]string{
+		"check":  "raid::mismatch_cnt",
+		"target": a.Name,
+	}).SetAttrs(attrs).SetCurrentValue(value)
+
+	var tdParts []string
+	if ins.MismatchCnt.WarnGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Warning ≥ %d", ins.MismatchCnt.WarnGe))
+	}
+	if ins.MismatchCnt.CriticalGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Critical ≥ %d", ins.MismatchCnt.CriticalGe))
+	}
+	event.Attrs["threshold_desc"] = strings.Join(tdParts, ", ")
+
+	status := types.EvaluateGeThreshold(float64(a.MismatchCnt), float64(ins.MismatchCnt.WarnGe), float64(ins.MismatchCnt.CriticalGe))
+	event.SetEventStatus(status)
+
+	switch status {
+	case types.EventStatusCritical:
+		event.SetDescription(fmt.Sprintf("%s mismatch_cnt %s >= critical threshold %d, run a repair and check the members",
+			a.Name, value, ins.MismatchCnt.CriticalGe))
+	case types.EventStatusWarning:
+		event.SetDescription(fmt.Sprintf("%s mismatch_cnt %s >= warning threshold %d",
+			a.Name, value, ins.MismatchCnt.WarnGe))
+	default:
+		event.SetDescription(fmt.Sprintf("%s mismatch_cnt %s, everything is ok", a.Name, value))
+	}
+
+	q.PushFront(event)
+}
@@ -0,0 +1,220 @@
+package raid
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+func TestInit_Validation(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raid only supports linux")
+	}
+
+	tests := []struct {
+		name    string
+		ins     Instance
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			ins:  Instance{},
+		},
+		{
+			name: "explicit arrays",
+			ins:  Instance{Arrays: []string{"md0", "/dev/md1"}},
+		},
+		{
+			name:    "not an md device",
+			ins:     Instance{Arrays: []string{"sda"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid severity",
+			ins:     Instance{ArrayState: SeverityCheck{Severity: "Bad"}},
+			wantErr: true,
+		},
+		{
+			name:    "mismatch warn_ge >= critical_ge",
+			ins:     Instance{MismatchCnt: MismatchCheck{WarnGe: 1000, CriticalGe: 100}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ins.Init()
+			if tt.wantErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	ins := &Instance{Arrays: []string{"/dev/md1"}}
+	if err := ins.Init(); err != nil || ins.Arrays[0] != "md1" {
+		t.Errorf("/dev/ prefix should be stripped: %v %v", ins.Arrays, err)
+	}
+}
+
+func gather(t *testing.T, ins *Instance) map[string]*types.Event {
+	if runtime.GOOS == "linux" {
+		if err := ins.Init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+	ret := map[string]*types.Event{}
+	for q.Len() > 0 {
+		e := *q.PopBack()
+		ret[e.Labels["target"]+" "+e.Labels["check"]] = e
+	}
+	return ret
+}
+
+func TestGather_ArrayStates(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raid only supports linux")
+	}
+	sys := writeMdstat(t, mdstatMixed)
+	writeSysfs(t, sys, "md0/md/mismatch_cnt", "0")
+	writeSysfs(t, sys, "md1/md/degraded", "2")
+	writeSysfs(t, sys, "md1/md/mismatch_cnt", "0")
+	writeSysfs(t, sys, "md2/md/mismatch_cnt", "512")
+
+	events := gather(t, &Instance{MismatchCnt: MismatchCheck{WarnGe: 1, CriticalGe: 1000}})
+
+	if e := events["md0 raid::array_state"]; e == nil || e.EventStatus != types.EventStatusOk ||
+		e.Description != "md0 raid1 [2/2] [UU] is healthy" {
+		t.Errorf("md0: %+v", e)
+	}
+
+	md1 := events["md1 raid::array_state"]
+	if md1 == nil || md1.EventStatus != types.EventStatusCritical {
+		t.Fatalf("md1: %+v", md1)
+	}
+	// sysfs degraded wins over the mdstat counts
+	for _, want := range []string{"2 device(s) missing", "failed: sdb2", "recovery 12.6%, finish 0.7min"} {
+		if !strings.Contains(md1.Description, want) {
+			t.Errorf("md1 description %q should contain %q", md1.Description, want)
+		}
+	}
+	if md1.Attrs["sync_progress"] != "12.6%" || md1.Attrs["members"] != "sdb2(F) sdc1 sdd1" {
+		t.Errorf("md1 attrs: %v", md1.Attrs)
+	}
+	if e := events["md1 raid::failed_members"]; e == nil || e.EventStatus != types.EventStatusWarning {
+		t.Errorf("md1 failed_members: %+v", e)
+	}
+
+	if e := events["md2 raid::mismatch_cnt"]; e == nil || e.EventStatus != types.EventStatusWarning {
+		t.Errorf("md2 mismatch_cnt: %+v", e)
+	}
+	if e := events["md2 raid::array_state"]; e == nil || e.EventStatus != types.EventStatusOk ||
+		!strings.Contains(e.Description, "resync PENDING") {
+		t.Errorf("md2: %+v", e)
+	}
+
+	// raid0 has no mismatch_cnt and no redundancy to lose
+	if _, ok := events["md3 raid::mismatch_cnt"]; ok {
+		t.Error("md3 should have no mismatch_cnt event")
+	}
+	if e := events["md3 raid::array_state"]; e == nil || e.EventStatus != types.EventStatusOk {
+		t.Errorf("md3: %+v", e)
+	}
+
+	if e := events["md127 raid::array_state"]; e == nil || e.EventStatus != types.EventStatusCritical ||
+		e.Description != "md127 is inactive (not assembled or missing members)" {
+		t.Errorf("md127: %+v", e)
+	}
+}
+
+func TestGather_BrokenArray(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raid only supports linux")
+	}
+	sys := writeMdstat(t, `Personalities : [raid0]
+md3 : active raid0 sdh1[1] sdi1[0]
+      2093056 blocks super 1.2 512k chunks
+
+unused devices: <none>
+`)
+	writeSysfs(t, sys, "md3/md/array_state", "broken")
+
+	e := gather(t, &Instance{})["md3 raid::array_state"]
+	if e == nil || e.EventStatus != types.EventStatusCritical || !strings.Contains(e.Description, "is broken") {
+		t.Errorf("md3: %+v", e)
+	}
+}
+
+func TestGather_ExplicitArrays(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raid only supports linux")
+	}
+	writeMdstat(t, mdstatMixed)
+
+	events := gather(t, &Instance{Arrays: []string{"md0", "md9"}})
+	if _, ok := events["md1 raid::array_state"]; ok {
+		t.Error("only the listed arrays should be checked")
+	}
+	if e := events["md9 raid::array_state"]; e == nil || e.EventStatus != types.EventStatusCritical ||
+		!strings.Contains(e.Description, "not found") {
+		t.Errorf("md9: %+v", e)
+	}
+}
+
+func TestGather_NoMdDriver(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raid only supports linux")
+	}
+	writeMdstat(t, "")
+	mdstatPath = filepath.Join(t.TempDir(), "missing")
+
+	if events := gather(t, &Instance{}); len(events) != 0 {
+		t.Errorf("expected no events without the md driver, got %v", events)
+	}
+
+	events := gather(t, &Instance{Arrays: []string{"md0"}})
+	if e := events["mdstat raid::array_state"]; e == nil || e.EventStatus != types.EventStatusCritical {
+		t.Errorf("explicit arrays without the md driver: %v", events)
+	}
+}
+
+func TestRaidTopology(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raid only supports linux")
+	}
+	sys := writeMdstat(t, mdstatMixed)
+	writeSysfs(t, sys, "md1/md/dev-sdc1/slot", "1")
+	writeSysfs(t, sys, "md1/md/dev-sdc1/state", "in_sync")
+
+	out, err := execRaidTopology(context.Background(), map[string]string{"array": "/dev/md1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"md1: active raid5 [3/2] [_U_]",
+		"degraded:     1 device(s) missing",
+		"sync:         recovery 12.6%",
+		"sdb2          0      -       faulty [!!!]",
+		"sdc1          1      1       in_sync",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("topology should contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "md0") {
+		t.Errorf("only md1 was requested:\n%s", out)
+	}
+
+	if _, err := execRaidTopology(context.Background(), map[string]string{"array": "md9"}); err == nil {
+		t.Error("expected error for an unknown array")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/cprobe/catpaw/digcore/config"
 	tlscfg "github.com/cprobe/catpaw/digcore/pkg/tls"
 	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/secret"
 	"github.com/cprobe/catpaw/digcore/types"
 )
 
@@ -315,6 +316,9 @@ func (ins *Instance) Init() error {
 			return fmt.Errorf("invalid cluster_state.severity %q", ins.ClusterState.Severity)
 		}
 	}
+	if ins.Password, err = secret.Resolve(ins.Password); err != nil {
+		return fmt.Errorf("password: %w", err)
+	}
 	if ins.Username != "" && ins.Password == "" {
 		return fmt.Errorf("password must not be empty when username is set")
 	}
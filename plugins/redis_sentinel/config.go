@@ -9,6 +9,7 @@ import (
 	"github.com/cprobe/catpaw/digcore/config"
 	tlscfg "github.com/cprobe/catpaw/digcore/pkg/tls"
 	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/secret"
 	"github.com/cprobe/catpaw/digcore/types"
 )
 
@@ -85,6 +86,11 @@ func (ins *Instance) Init() error {
 	if ins.ReadTimeout == 0 {
 		ins.ReadTimeout = config.Duration(2 * time.Second)
 	}
+	password, err := secret.Resolve(ins.Password)
+	if err != nil {
+		return fmt.Errorf("password: %w", err)
+	}
+	ins.Password = password
 	if ins.Username != "" && ins.Password == "" {
 		return fmt.Errorf("password must not be empty when username is set")
 	}
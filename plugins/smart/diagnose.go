@@ -0,0 +1,178 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/diagnose"
+	"github.com/cprobe/catpaw/digcore/plugins"
+)
+
+var _ plugins.Diagnosable = (*SmartPlugin)(nil)
+
+const diagnoseTimeout = 30 * time.Second
+
+var deviceTypePattern = regexp.MustCompile(`^[a-z0-9_+,-]+$`)
+
+func (p *SmartPlugin) RegisterDiagnoseTools(registry *diagnose.ToolRegistry) {
+	registry.RegisterCategory("smart", "smart",
+		"Disk SMART diagnostic tools (device list with health summary, full attribute/NVMe health log per disk). Requires smartctl 7.0+.",
+		diagnose.ToolScopeLocal)
+
+	registry.Register("smart", diagnose.DiagnoseTool{
+		Name:        "smart_scan",
+		Description: "List disks found by smartctl with model, serial, overall health, temperature and power-on hours. Disks in standby are reported but not woken up.",
+		Scope:       diagnose.ToolScopeLocal,
+		Execute:     execSmartScan,
+	})
+
+	registry.Register("smart", diagnose.DiagnoseTool{
+		Name:        "smart_detail",
+		Description: "Show SMART details of one disk: overall health, ATA attribute table (value/worst/thresh/raw, failing attributes) or NVMe health log (critical warning, spare, percentage used, media errors).",
+		Scope:       diagnose.ToolScopeLocal,
+		Parameters: []diagnose.ToolParam{
+			{Name: "device", Type: "string", Description: "Device path, e.g. /dev/sda or /dev/nvme0", Required: true},
+			{Name: "type", Type: "string", Description: "smartctl -d device type, e.g. sat, nvme, megaraid,0 (default: auto)"},
+		},
+		Execute: execSmartDetail,
+	})
+}
+
+func diagnoseContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, diagnoseTimeout)
+}
+
+func execSmartScan(ctx context.Context, _ map[string]string) (string, error) {
+	bin, err := exec.LookPath("smartctl")
+	if err != nil {
+		return "", fmt.Errorf("smartctl not found: %v", err)
+	}
+	ctx, cancel := diagnoseContext(ctx)
+	defer cancel()
+
+	devices, err := scanDevices(ctx, bin)
+	if err != nil {
+		return "", err
+	}
+	if len(devices) == 0 {
+		return "No SMART capable devices found.", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-24s  %-30s  %-20s  %-8s  %6s  %8s\n", "DEVICE", "MODEL", "SERIAL", "HEALTH", "TEMP", "POWER_ON")
+	b.WriteString(strings.Repeat("-", 105))
+	b.WriteByte('\n')
+	for _, dev := range devices {
+		r, err := readReport(ctx, bin, dev, "standby")
+		if err != nil {
+			fmt.Fprintf(&b, "%-24s  (error: %v)\n", dev.target(), err)
+			continue
+		}
+		if r.standby() {
+			fmt.Fprintf(&b, "%-24s  (in standby, not woken up)\n", dev.target())
+			continue
+		}
+		temp := "-"
+		if v, ok := r.temperature(); ok {
+			temp = fmt.Sprintf("%d°C", v)
+		}
+		fmt.Fprintf(&b, "%-24s  %-30s  %-20s  %-8s  %6s  %7dh\n",
+			dev.target(), r.ModelName, r.SerialNumber, healthString(r), temp, r.PowerOnTime.Hours)
+	}
+	return b.String(), nil
+}
+
+func execSmartDetail(ctx context.Context, args map[string]string) (string, error) {
+	name := strings.TrimSpace(args["device"])
+	if !strings.HasPrefix(name, "/dev/") || strings.ContainsAny(name, " \t") {
+		return "", fmt.Errorf("invalid device %q: must be a /dev/ path", args["device"])
+	}
+	typ := strings.TrimSpace(args["type"])
+	if typ != "" && !deviceTypePattern.MatchString(typ) {
+		return "", fmt.Errorf("invalid device type %q", typ)
+	}
+
+	bin, err := exec.LookPath("smartctl")
+	if err != nil {
+		return "", fmt.Errorf("smartctl not found: %v", err)
+	}
+	ctx, cancel := diagnoseContext(ctx)
+	defer cancel()
+
+	// an explicit request is worth waking a sleeping disk for
+	r, err := readReport(ctx, bin, device{name: name, typ: typ}, "never")
+	if err != nil {
+		return "", err
+	}
+	return formatDetail(r), nil
+}
+
+func healthString(r *smartReport) string {
+	if r.SmartStatus == nil {
+		return "N/A"
+	}
+	if r.SmartStatus.Passed {
+		return "PASSED"
+	}
+	return "FAILED"
+}
+
+func formatDetail(r *smartReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Device:    %s (%s)\n", r.Device.InfoName, r.Device.Protocol)
+	fmt.Fprintf(&b, "Model:     %s\n", r.ModelName)
+	fmt.Fprintf(&b, "Serial:    %s\n", r.SerialNumber)
+	fmt.Fprintf(&b, "Firmware:  %s\n", r.FirmwareVersion)
+	fmt.Fprintf(&b, "Health:    %s\n", healthString(r))
+	if v, ok := r.temperature(); ok {
+		fmt.Fprintf(&b, "Temp:      %d°C\n", v)
+	}
+	fmt.Fprintf(&b, "Power on:  %dh\n", r.PowerOnTime.Hours)
+
+	if len(r.ATASmartAttributes.Table) > 0 {
+		b.WriteString("\nATA SMART attributes:\n")
+		fmt.Fprintf(&b, "%3s  %-28s  %5s  %5s  %6s  %-8s  %s\n", "ID", "NAME", "VALUE", "WORST", "THRESH", "FAILED", "RAW")
+		for _, a := range r.ATASmartAttributes.Table {
+			failed := a.WhenFailed
+			if failed == "" {
+				failed = "-"
+			}
+			marker := ""
+			if (a.ID == ataReallocatedSectorCt || a.ID == ataCurrentPendingSect) && a.Raw.Value > 0 {
+				marker = " [!]"
+			}
+			fmt.Fprintf(&b, "%3d  %-28s  %5d  %5d  %6d  %-8s  %s%s\n",
+				a.ID, a.Name, a.Value, a.Worst, a.Thresh, failed, a.Raw.String, marker)
+		}
+	}
+
+	if h := r.NVMeHealth; h != nil {
+		b.WriteString("\nNVMe health log:\n")
+		fmt.Fprintf(&b, "  critical_warning:    0x%02x\n", h.CriticalWarning)
+		fmt.Fprintf(&b, "  available_spare:     %d%% (threshold %d%%)\n", h.AvailableSpare, h.AvailableSpareThreshold)
+		fmt.Fprintf(&b, "  percentage_used:     %d%%\n", h.PercentageUsed)
+		fmt.Fprintf(&b, "  media_errors:        %d\n", h.MediaErrors)
+		fmt.Fprintf(&b, "  num_err_log_entries: %d\n", h.NumErrLogEntries)
+		fmt.Fprintf(&b, "  unsafe_shutdowns:    %d\n", h.UnsafeShutdowns)
+		fmt.Fprintf(&b, "  power_cycles:        %d\n", h.PowerCycles)
+		// a data unit is 1000 * 512 bytes
+		fmt.Fprintf(&b, "  data_read:           %.1f TB\n", float64(h.DataUnitsRead)*512000/1e12)
+		fmt.Fprintf(&b, "  data_written:        %.1f TB\n", float64(h.DataUnitsWritten)*512000/1e12)
+	}
+
+	if r.SCSIGrownDefectList != nil {
+		fmt.Fprintf(&b, "\nSCSI grown defect list: %d\n", *r.SCSIGrownDefectList)
+	}
+
+	if msg := r.Smartctl.message(); msg != "" {
+		fmt.Fprintf(&b, "\nsmartctl: %s\n", msg)
+	}
+	return b.String()
+}
@@ -0,0 +1,291 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cprobe/catpaw/digcore/config"
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/plugins"
+	"github.com/cprobe/catpaw/digcore/types"
+)
+
+const pluginName = "smart"
+
+var validNocheck = map[string]bool{"never": true, "sleep": true, "standby": true, "idle": true}
+
+type HealthCheck struct {
+	Severity string `toml:"severity"`
+}
+
+type ThresholdCheck struct {
+	WarnGe     int64 `toml:"warn_ge"`
+	CriticalGe int64 `toml:"critical_ge"`
+}
+
+func (c ThresholdCheck) enabled() bool {
+	return c.WarnGe > 0 || c.CriticalGe > 0
+}
+
+type Instance struct {
+	config.InternalConfig
+
+	Smartctl string          `toml:"smartctl"`
+	Devices  []string        `toml:"devices"`
+	Nocheck  string          `toml:"nocheck"`
+	Timeout  config.Duration `toml:"timeout"`
+
+	Health             HealthCheck    `toml:"health"`
+	ReallocatedSectors ThresholdCheck `toml:"reallocated_sectors"`
+	PendingSectors     ThresholdCheck `toml:"pending_sectors"`
+	MediaErrors        ThresholdCheck `toml:"media_errors"`
+	PercentageUsed     ThresholdCheck `toml:"percentage_used"`
+	Temperature        ThresholdCheck `toml:"temperature"`
+
+	bin     string
+	devices []device
+}
+
+type SmartPlugin struct {
+	config.InternalConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+func (p *SmartPlugin) GetInstances() []plugins.Instance {
+	ret := make([]plugins.Instance, len(p.Instances))
+	for i := 0; i < len(p.Instances); i++ {
+		ret[i] = p.Instances[i]
+	}
+	return ret
+}
+
+func init() {
+	plugins.Add(pluginName, func() plugins.Plugin {
+		return &SmartPlugin{}
+	})
+}
+
+func (ins *Instance) Init() error {
+	if ins.Timeout == 0 {
+		ins.Timeout = config.Duration(30 * time.Second)
+	}
+
+	if ins.Nocheck == "" {
+		ins.Nocheck = "standby"
+	} else if !validNocheck[ins.Nocheck] {
+		return fmt.Errorf("invalid nocheck %q, must be one of: never, sleep, standby, idle", ins.Nocheck)
+	}
+
+	if ins.Health.Severity == "" {
+		ins.Health.Severity = types.EventStatusCritical
+	} else if !types.EventStatusValid(ins.Health.Severity) {
+		return fmt.Errorf("invalid health.severity %q", ins.Health.Severity)
+	}
+
+	for name, c := range map[string]ThresholdCheck{
+		"reallocated_sectors": ins.ReallocatedSectors,
+		"pending_sectors":     ins.PendingSectors,
+		"media_errors":        ins.MediaErrors,
+		"percentage_used":     ins.PercentageUsed,
+		"temperature":         ins.Temperature,
+	} {
+		if c.WarnGe < 0 || c.CriticalGe < 0 {
+			return fmt.Errorf("%s thresholds must be non-negative", name)
+		}
+		if c.WarnGe > 0 && c.CriticalGe > 0 && c.WarnGe >= c.CriticalGe {
+			return fmt.Errorf("%s.warn_ge(%d) must be less than %s.critical_ge(%d)",
+				name, c.WarnGe, name, c.CriticalGe)
+		}
+	}
+
+	ins.devices = ins.devices[:0]
+	for _, s := range ins.Devices {
+		dev, err := parseDevice(s)
+		if err != nil {
+			return err
+		}
+		ins.devices = append(ins.devices, dev)
+	}
+
+	bin := ins.Smartctl
+	if bin == "" {
+		bin = "smartctl"
+	}
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		return fmt.Errorf("smartctl not found: %v", err)
+	}
+	ins.bin = path
+
+	logger.Logger.Infow("smart: initialized", "bin", ins.bin, "devices", len(ins.devices))
+	return nil
+}
+
+func (ins *Instance) Gather(q *safe.Queue[*types.Event]) {
+	ins.GatherContext(context.Background(), q)
+}
+
+// GatherContext kills a smartctl stuck on an unresponsive disk when ctx is
+// done, as well as after the per-device timeout.
+func (ins *Instance) GatherContext(ctx context.Context, q *safe.Queue[*types.Event]) {
+	devices := ins.devices
+	if len(devices) == 0 {
+		scanCtx, cancel := context.WithTimeout(ctx, time.Duration(ins.Timeout))
+		scanned, err := scanDevices(scanCtx, ins.bin)
+		cancel()
+		if err != nil {
+			q.PushFront(types.BuildEvent(map[string]string{
+				"check":  "smart::health",
+				"target": "smartctl",
+			}).SetEventStatus(types.EventStatusCritical).
+				SetDescription(fmt.Sprintf("failed to scan devices: %v", err)))
+			return
+		}
+		devices = scanned
+	}
+
+	for _, dev := range devices {
+		if ctx.Err() != nil {
+			return
+		}
+		devCtx, cancel := context.WithTimeout(ctx, time.Duration(ins.Timeout))
+		r, err := readReport(devCtx, ins.bin, dev, ins.Nocheck)
+		cancel()
+		ins.evaluate(q, dev, r, err)
+	}
+}
+
+func (ins *Instance) evaluate(q *safe.Queue[*types.Event], dev device, r *smartReport, err error) {
+	if err != nil {
+		q.PushFront(types.BuildEvent(map[string]string{
+			"check":  "smart::health",
+			"target": dev.target(),
+		}).SetEventStatus(types.EventStatusCritical).
+			SetDescription(fmt.Sprintf("failed to read SMART data: %v", err)))
+		return
+	}
+	if r.standby() {
+		// waking the disk every interval defeats its power management
+		logger.Logger.Debugw("smart: device in low-power mode, skipped", "device", dev.target())
+		return
+	}
+
+	attrs := map[string]string{}
+	if r.ModelName != "" {
+		attrs["model"] = r.ModelName
+	}
+	if r.SerialNumber != "" {
+		attrs["serial"] = r.SerialNumber
+	}
+	if r.Device.Protocol != "" {
+		attrs["protocol"] = r.Device.Protocol
+	}
+
+	ins.checkHealth(q, dev, r, attrs)
+
+	if v, ok := r.reallocatedSectors(); ok {
+		ins.checkThreshold(q, dev, attrs, "reallocated_sectors", "reallocated sectors", ins.ReallocatedSectors, v, "")
+	}
+	if v, ok := r.pendingSectors(); ok {
+		ins.checkThreshold(q, dev, attrs, "pending_sectors", "pending sectors", ins.PendingSectors, v, "")
+	}
+	if v, ok := r.mediaErrors(); ok {
+		ins.checkThreshold(q, dev, attrs, "media_errors", "media errors", ins.MediaErrors, v, "")
+	}
+	if v, ok := r.percentageUsed(); ok {
+		ins.checkThreshold(q, dev, attrs, "percentage_used", "percentage used", ins.PercentageUsed, v, "%")
+	}
+	if v, ok := r.temperature(); ok {
+		ins.checkThreshold(q, dev, attrs, "temperature", "temperature", ins.Temperature, v, "°C")
+	}
+}
+
+func (ins *Instance) checkHealth(q *safe.Queue[*types.Event], dev device, r *smartReport, attrs map[string]string) {
+	if r.SmartStatus == nil {
+		// no SMART support, e.g. a virtual disk
+		return
+	}
+
+	event := types.BuildEvent(map[string]string{
+		"check":  "smart::health",
+		"target": dev.target(),
+	}).SetAttrs(attrs)
+	event.Attrs["threshold_desc"] = fmt.Sprintf("%s: overall health self-assessment failed", ins.Health.Severity)
+
+	if r.SmartStatus.Passed {
+		q.PushFront(event.SetCurrentValue("PASSED").
+			SetDescription(fmt.Sprintf("%s SMART overall health PASSED", describe(dev, r))))
+		return
+	}
+
+	desc := fmt.Sprintf("%s SMART overall health FAILED", describe(dev, r))
+	if failing := failingAttrs(r); len(failing) > 0 {
+		desc += fmt.Sprintf(" (failing attributes: %s)", strings.Join(failing, ", "))
+	}
+	if r.NVMeHealth != nil && r.NVMeHealth.CriticalWarning != 0 {
+		desc += fmt.Sprintf(" (NVMe critical warning 0x%02x)", r.NVMeHealth.CriticalWarning)
+	}
+	desc += ", back up the data and replace the disk"
+	q.PushFront(event.SetCurrentValue("FAILED").
+		SetEventStatus(ins.Health.Severity).
+		SetDescription(desc))
+}
+
+func failingAttrs(r *smartReport) []string {
+	var ret []string
+	for _, a := range r.ATASmartAttributes.Table {
+		if a.WhenFailed == "now" {
+			ret = append(ret, a.Name)
+		}
+	}
+	return ret
+}
+
+func (ins *Instance) checkThreshold(q *safe.Queue[*types.Event], dev device, attrs map[string]string,
+	check, what string, c ThresholdCheck, value int64, unit string) {
+	if !c.enabled() {
+		return
+	}
+
+	valueStr := fmt.Sprintf("%d%s", value, unit)
+	event := types.BuildEvent(map[string]string{
+		"check":  "smart::" + check,
+		"target": dev.target(),
+	}).SetAttrs(attrs).SetCurrentValue(valueStr)
+
+	var tdParts []string
+	if c.WarnGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Warning ≥ %d%s", c.WarnGe, unit))
+	}
+	if c.CriticalGe > 0 {
+		tdParts = append(tdParts, fmt.Sprintf("Critical ≥ %d%s", c.CriticalGe, unit))
+	}
+	event.Attrs["threshold_desc"] = strings.Join(tdParts, ", ")
+
+	status := types.EvaluateGeThreshold(float64(value), float64(c.WarnGe), float64(c.CriticalGe))
+	event.SetEventStatus(status)
+
+	switch status {
+	case types.EventStatusCritical:
+		event.SetDescription(fmt.Sprintf("%s %s %s >= critical threshold %d%s",
+			dev.target(), what, valueStr, c.CriticalGe, unit))
+	case types.EventStatusWarning:
+		event.SetDescription(fmt.Sprintf("%s %s %s >= warning threshold %d%s",
+			dev.target(), what, valueStr, c.WarnGe, unit))
+	default:
+		event.SetDescription(fmt.Sprintf("%s %s %s, everything is ok", dev.target(), what, valueStr))
+	}
+
+	q.PushFront(event)
+}
+
+func describe(dev device, r *smartReport) string {
+	if r.ModelName == "" {
+		return dev.target()
+	}
+	return fmt.Sprintf("%s (%s)", dev.target(), r.ModelName)
+}
@@ -0,0 +1,295 @@
+package smart
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cprobe/catpaw/digcore/logger"
+	"github.com/cprobe/catpaw/digcore/pkg/safe"
+	"github.com/cprobe/catpaw/digcore/types"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+// mockSmartctl answers smartctl calls from testdata: --scan-open reads
+// scan.json, a device reads fixtures[device path].
+func mockSmartctl(t *testing.T, fixtures map[string]string) *[][]string {
+	var calls [][]string
+	orig := runSmartctl
+	t.Cleanup(func() { runSmartctl = orig })
+	runSmartctl = func(_ context.Context, _ string, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		file := "scan.json"
+		if args[len(args)-1] != "--scan-open" {
+			f, ok := fixtures[args[len(args)-1]]
+			if !ok {
+				return nil, fmt.Errorf("no fixture for %v", args)
+			}
+			file = f
+		}
+		return os.ReadFile(filepath.Join("testdata", file))
+	}
+	return &calls
+}
+
+func gather(ins *Instance) map[string]*types.Event {
+	q := safe.NewQueue[*types.Event]()
+	ins.Gather(q)
+	ret := map[string]*types.Event{}
+	for q.Len() > 0 {
+		e := *q.PopBack()
+		ret[e.Labels["target"]+" "+e.Labels["check"]] = e
+	}
+	return ret
+}
+
+func newInstance(t *testing.T, ins *Instance) *Instance {
+	// any executable passes the smartctl lookup, runSmartctl is mocked
+	ins.Smartctl = os.Args[0]
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return ins
+}
+
+func TestInit_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		ins     Instance
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			ins:  Instance{},
+		},
+		{
+			name: "explicit devices",
+			ins:  Instance{Devices: []string{"/dev/sda", "/dev/bus/0:megaraid,3"}},
+		},
+		{
+			name:    "device outside /dev",
+			ins:     Instance{Devices: []string{"sda"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid nocheck",
+			ins:     Instance{Nocheck: "always"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid health severity",
+			ins:     Instance{Health: HealthCheck{Severity: "Fatal"}},
+			wantErr: true,
+		},
+		{
+			name:    "warn_ge >= critical_ge",
+			ins:     Instance{Temperature: ThresholdCheck{WarnGe: 70, CriticalGe: 60}},
+			wantErr: true,
+		},
+		{
+			name:    "smartctl not found",
+			ins:     Instance{Smartctl: "/nonexistent/smartctl"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ins.Smartctl == "" {
+				tt.ins.Smartctl = os.Args[0]
+			}
+			err := tt.ins.Init()
+			if tt.wantErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	dev, err := parseDevice("/dev/bus/0:megaraid,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.name != "/dev/bus/0" || dev.typ != "megaraid,3" || dev.target() != "/dev/bus/0:megaraid,3" {
+		t.Errorf("unexpected device %+v, target %s", dev, dev.target())
+	}
+	if got := strings.Join(dev.args(), " "); got != "-d megaraid,3 /dev/bus/0" {
+		t.Errorf("args = %q", got)
+	}
+
+	dev, _ = parseDevice("/dev/sda")
+	if dev.target() != "/dev/sda" || len(dev.args()) != 1 {
+		t.Errorf("unexpected device %+v", dev)
+	}
+}
+
+func TestGather_HealthyATA(t *testing.T) {
+	calls := mockSmartctl(t, map[string]string{"/dev/sda": "ata_healthy.json"})
+	ins := newInstance(t, &Instance{
+		Devices:            []string{"/dev/sda"},
+		ReallocatedSectors: ThresholdCheck{WarnGe: 1, CriticalGe: 100},
+		PendingSectors:     ThresholdCheck{WarnGe: 1},
+		MediaErrors:        ThresholdCheck{WarnGe: 1},
+		PercentageUsed:     ThresholdCheck{WarnGe: 80, CriticalGe: 95},
+		Temperature:        ThresholdCheck{WarnGe: 55, CriticalGe: 65},
+	})
+
+	events := gather(ins)
+	// no NVMe log: media_errors and percentage_used are not applicable
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d: %v", len(events), events)
+	}
+	for key, e := range events {
+		if e.EventStatus != types.EventStatusOk {
+			t.Errorf("%s: status %s, %s", key, e.EventStatus, e.Description)
+		}
+	}
+	if e := events["/dev/sda smart::temperature"]; e.Attrs[types.AttrCurrentValue] != "34°C" || e.Attrs["model"] != "Samsung SSD 860 EVO 500GB" {
+		t.Errorf("temperature attrs: %v", e.Attrs)
+	}
+	if got := strings.Join((*calls)[0], " "); got != "--json -a -n standby /dev/sda" {
+		t.Errorf("smartctl args = %q", got)
+	}
+}
+
+func TestGather_FailingATA(t *testing.T) {
+	mockSmartctl(t, map[string]string{"/dev/sdb": "ata_failing.json"})
+	ins := newInstance(t, &Instance{
+		Devices:            []string{"/dev/sdb"},
+		ReallocatedSectors: ThresholdCheck{WarnGe: 1, CriticalGe: 100},
+		PendingSectors:     ThresholdCheck{WarnGe: 1, CriticalGe: 100},
+	})
+
+	events := gather(ins)
+
+	health := events["/dev/sdb smart::health"]
+	if health == nil || health.EventStatus != types.EventStatusCritical {
+		t.Fatalf("health: %+v", health)
+	}
+	if !strings.Contains(health.Description, "Reallocated_Sector_Ct") ||
+		strings.Contains(health.Description, "Airflow_Temperature_Cel") {
+		t.Errorf("health description should list attributes failing now: %s", health.Description)
+	}
+	if e := events["/dev/sdb smart::reallocated_sectors"]; e == nil || e.EventStatus != types.EventStatusCritical {
+		t.Errorf("reallocated_sectors: %+v", e)
+	}
+	if e := events["/dev/sdb smart::pending_sectors"]; e == nil || e.EventStatus != types.EventStatusWarning {
+		t.Errorf("pending_sectors: %+v", e)
+	}
+}
+
+func TestGather_HealthSeverity(t *testing.T) {
+	mockSmartctl(t, map[string]string{"/dev/sdb": "ata_failing.json"})
+	ins := newInstance(t, &Instance{
+		Devices: []string{"/dev/sdb"},
+		Health:  HealthCheck{Severity: types.EventStatusWarning},
+	})
+
+	if e := gather(ins)["/dev/sdb smart::health"]; e == nil || e.EventStatus != types.EventStatusWarning {
+		t.Errorf("health: %+v", e)
+	}
+}
+
+func TestGather_NVMe(t *testing.T) {
+	mockSmartctl(t, map[string]string{"/dev/nvme0": "nvme.json"})
+	ins := newInstance(t, &Instance{
+		Devices:            []string{"/dev/nvme0:nvme"},
+		ReallocatedSectors: ThresholdCheck{WarnGe: 1},
+		MediaErrors:        ThresholdCheck{WarnGe: 1, CriticalGe: 10},
+		PercentageUsed:     ThresholdCheck{WarnGe: 80, CriticalGe: 95},
+	})
+
+	events := gather(ins)
+	// exit status 64 (error log has entries) still carries the data
+	if e := events["/dev/nvme0 smart::health"]; e == nil || e.EventStatus != types.EventStatusOk {
+		t.Errorf("health: %+v", e)
+	}
+	if _, ok := events["/dev/nvme0 smart::reallocated_sectors"]; ok {
+		t.Error("reallocated_sectors does not apply to NVMe")
+	}
+	if e := events["/dev/nvme0 smart::media_errors"]; e == nil || e.EventStatus != types.EventStatusWarning {
+		t.Errorf("media_errors: %+v", e)
+	}
+	if e := events["/dev/nvme0 smart::percentage_used"]; e == nil || e.EventStatus != types.EventStatusWarning ||
+		e.Attrs[types.AttrCurrentValue] != "87%" {
+		t.Errorf("percentage_used: %+v", e)
+	}
+}
+
+func TestGather_ScanStandbyAndErrors(t *testing.T) {
+	calls := mockSmartctl(t, map[string]string{
+		"/dev/sda":   "standby.json",
+		"/dev/nvme0": "nvme.json",
+		"/dev/bus/0": "open_failed.json",
+	})
+	ins := newInstance(t, &Instance{})
+
+	events := gather(ins)
+
+	if len(*calls) != 4 {
+		t.Fatalf("expected scan plus 3 device calls, got %v", *calls)
+	}
+	if got := strings.Join((*calls)[3], " "); got != "--json -a -n standby -d megaraid,0 /dev/bus/0" {
+		t.Errorf("megaraid args = %q", got)
+	}
+	for key := range events {
+		if strings.HasPrefix(key, "/dev/sda ") {
+			t.Errorf("disk in standby must not produce events, got %s", key)
+		}
+	}
+	if e := events["/dev/nvme0 smart::health"]; e == nil || e.EventStatus != types.EventStatusOk {
+		t.Errorf("nvme health: %+v", e)
+	}
+	e := events["/dev/bus/0:megaraid,0 smart::health"]
+	if e == nil || e.EventStatus != types.EventStatusCritical || !strings.Contains(e.Description, "Unable to detect device type") {
+		t.Errorf("open failure: %+v", e)
+	}
+}
+
+func TestFormatDetail(t *testing.T) {
+	for _, file := range []string{"ata_failing.json", "nvme.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := parseReport(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := formatDetail(r)
+		if !strings.Contains(out, r.ModelName) {
+			t.Errorf("%s: detail misses the model:\n%s", file, out)
+		}
+		switch file {
+		case "ata_failing.json":
+			if !strings.Contains(out, "Health:    FAILED") || !strings.Contains(out, "Reallocated_Sector_Ct") {
+				t.Errorf("ata detail:\n%s", out)
+			}
+		case "nvme.json":
+			if !strings.Contains(out, "percentage_used:     87%") || !strings.Contains(out, "media_errors:        3") {
+				t.Errorf("nvme detail:\n%s", out)
+			}
+		}
+	}
+}
+
+func TestExecSmartDetail_InvalidArgs(t *testing.T) {
+	if _, err := execSmartDetail(context.Background(), map[string]string{"device": "-a"}); err == nil {
+		t.Error("expected error for a device outside /dev")
+	}
+	if _, err := execSmartDetail(context.Background(), map[string]string{"device": "/dev/sda", "type": "sat;rm"}); err == nil {
+		t.Error("expected error for an invalid type")
+	}
+}
@@ -0,0 +1,283 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// smartctl exit status bits (see smartctl(8) RETURN VALUES). Only the first
+// two mean the JSON holds no device data; the others report what we parse.
+const (
+	exitCmdLineError = 1 << 0
+	exitOpenFailed   = 1 << 1 // also returned for a disk spun down with -n
+)
+
+// device is a disk as smartctl addresses it: a path plus an optional -d type,
+// e.g. "/dev/sda" or "/dev/bus/0" with "megaraid,3".
+type device struct {
+	name string
+	typ  string
+}
+
+// parseDevice parses a config entry, "/dev/sda" or "/dev/bus/0:megaraid,3".
+func parseDevice(s string) (device, error) {
+	s = strings.TrimSpace(s)
+	name, typ, _ := strings.Cut(s, ":")
+	if !strings.HasPrefix(name, "/dev/") {
+		return device{}, fmt.Errorf("invalid device %q: must start with /dev/", s)
+	}
+	if strings.ContainsAny(name, " \t") || strings.ContainsAny(typ, " \t") {
+		return device{}, fmt.Errorf("invalid device %q: must not contain spaces", s)
+	}
+	return device{name: name, typ: typ}, nil
+}
+
+// target distinguishes disks behind one RAID controller, which share a path.
+func (d device) target() string {
+	if strings.Contains(d.typ, ",") {
+		return d.name + ":" + d.typ
+	}
+	return d.name
+}
+
+func (d device) args() []string {
+	if d.typ == "" {
+		return []string{d.name}
+	}
+	return []string{"-d", d.typ, d.name}
+}
+
+type smartctlInfo struct {
+	ExitStatus int `json:"exit_status"`
+	Messages   []struct {
+		String   string `json:"string"`
+		Severity string `json:"severity"`
+	} `json:"messages"`
+}
+
+func (s smartctlInfo) message() string {
+	msgs := make([]string, 0, len(s.Messages))
+	for _, m := range s.Messages {
+		msgs = append(msgs, m.String)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type scanOutput struct {
+	Smartctl smartctlInfo `json:"smartctl"`
+	Devices  []struct {
+		Name     string `json:"name"`
+		InfoName string `json:"info_name"`
+		Type     string `json:"type"`
+		Protocol string `json:"protocol"`
+	} `json:"devices"`
+}
+
+type ataAttribute struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Value      int    `json:"value"`
+	Worst      int    `json:"worst"`
+	Thresh     int    `json:"thresh"`
+	WhenFailed string `json:"when_failed"`
+	Raw        struct {
+		Value  int64  `json:"value"`
+		String string `json:"string"`
+	} `json:"raw"`
+}
+
+type nvmeHealthLog struct {
+	CriticalWarning         int64 `json:"critical_warning"`
+	Temperature             int64 `json:"temperature"`
+	AvailableSpare          int64 `json:"available_spare"`
+	AvailableSpareThreshold int64 `json:"available_spare_threshold"`
+	PercentageUsed          int64 `json:"percentage_used"`
+	DataUnitsRead           int64 `json:"data_units_read"`
+	DataUnitsWritten        int64 `json:"data_units_written"`
+	PowerCycles             int64 `json:"power_cycles"`
+	PowerOnHours            int64 `json:"power_on_hours"`
+	UnsafeShutdowns         int64 `json:"unsafe_shutdowns"`
+	MediaErrors             int64 `json:"media_errors"`
+	NumErrLogEntries        int64 `json:"num_err_log_entries"`
+}
+
+// smartReport is the part of `smartctl --json -a` the plugin uses.
+type smartReport struct {
+	Smartctl smartctlInfo `json:"smartctl"`
+	Device   struct {
+		Name     string `json:"name"`
+		InfoName string `json:"info_name"`
+		Type     string `json:"type"`
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName       string `json:"model_name"`
+	SerialNumber    string `json:"serial_number"`
+	FirmwareVersion string `json:"firmware_version"`
+	SmartSupport    *struct {
+		Available bool `json:"available"`
+		Enabled   bool `json:"enabled"`
+	} `json:"smart_support"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []ataAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth          *nvmeHealthLog `json:"nvme_smart_health_information_log"`
+	SCSIGrownDefectList *int64         `json:"scsi_grown_defect_list"`
+}
+
+func (r *smartReport) ataAttr(id int) *ataAttribute {
+	for i := range r.ATASmartAttributes.Table {
+		if r.ATASmartAttributes.Table[i].ID == id {
+			return &r.ATASmartAttributes.Table[i]
+		}
+	}
+	return nil
+}
+
+// ATA attribute ids, see https://en.wikipedia.org/wiki/S.M.A.R.T.
+const (
+	ataReallocatedSectorCt = 5
+	ataCurrentPendingSect  = 197
+)
+
+// reallocatedSectors returns the remapped sector count: ATA attribute 5 or
+// the SCSI grown defect list.
+func (r *smartReport) reallocatedSectors() (int64, bool) {
+	if a := r.ataAttr(ataReallocatedSectorCt); a != nil {
+		return a.Raw.Value, true
+	}
+	if r.SCSIGrownDefectList != nil {
+		return *r.SCSIGrownDefectList, true
+	}
+	return 0, false
+}
+
+func (r *smartReport) pendingSectors() (int64, bool) {
+	if a := r.ataAttr(ataCurrentPendingSect); a != nil {
+		return a.Raw.Value, true
+	}
+	return 0, false
+}
+
+func (r *smartReport) mediaErrors() (int64, bool) {
+	if r.NVMeHealth != nil {
+		return r.NVMeHealth.MediaErrors, true
+	}
+	return 0, false
+}
+
+func (r *smartReport) percentageUsed() (int64, bool) {
+	if r.NVMeHealth != nil {
+		return r.NVMeHealth.PercentageUsed, true
+	}
+	return 0, false
+}
+
+func (r *smartReport) temperature() (int64, bool) {
+	if r.Temperature != nil {
+		return r.Temperature.Current, true
+	}
+	return 0, false
+}
+
+// standby reports whether smartctl skipped a spun-down disk because of -n.
+func (r *smartReport) standby() bool {
+	for _, m := range r.Smartctl.Messages {
+		if strings.HasPrefix(m.String, "Device is in ") && strings.Contains(m.String, " mode") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseReport(data []byte) (*smartReport, error) {
+	var r smartReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse smartctl output: %v", err)
+	}
+	return &r, nil
+}
+
+func parseScan(data []byte) ([]device, error) {
+	var s scanOutput
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse smartctl --scan output: %v", err)
+	}
+	if s.Smartctl.ExitStatus&exitCmdLineError != 0 {
+		return nil, fmt.Errorf("smartctl --scan failed: %s", s.Smartctl.message())
+	}
+	devices := make([]device, 0, len(s.Devices))
+	for _, d := range s.Devices {
+		devices = append(devices, device{name: d.Name, typ: d.Type})
+	}
+	return devices, nil
+}
+
+// runSmartctl runs smartctl and returns its stdout. A non-zero exit status
+// is not an error: smartctl sets bits for disk problems and still prints
+// the JSON, which carries the status too. Tests replace it.
+var runSmartctl = func(ctx context.Context, bin string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("smartctl %s: %v", strings.Join(args, " "), ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("smartctl %s: %v", strings.Join(args, " "), err)
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("smartctl %s: no output (stderr: %s)", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func scanDevices(ctx context.Context, bin string) ([]device, error) {
+	out, err := runSmartctl(ctx, bin, "--json", "--scan-open")
+	if err != nil {
+		return nil, err
+	}
+	return parseScan(out)
+}
+
+// readReport runs `smartctl --json -a` on dev. nocheck is the -n power mode
+// below which smartctl leaves the disk asleep ("never" always reads it).
+func readReport(ctx context.Context, bin string, dev device, nocheck string) (*smartReport, error) {
+	args := []string{"--json", "-a", "-n", nocheck}
+	out, err := runSmartctl(ctx, bin, append(args, dev.args()...)...)
+	if err != nil {
+		return nil, err
+	}
+	r, err := parseReport(out)
+	if err != nil {
+		return nil, err
+	}
+	if r.standby() {
+		return r, nil
+	}
+	if r.Smartctl.ExitStatus&(exitCmdLineError|exitOpenFailed) != 0 {
+		msg := r.Smartctl.message()
+		if msg == "" {
+			msg = fmt.Sprintf("exit status %d", r.Smartctl.ExitStatus)
+		}
+		return nil, fmt.Errorf("smartctl %s: %s", dev.target(), msg)
+	}
+	return r, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -17,7 +18,25 @@ const (
 	psiMaxFileSize = 4096
 )
 
-var psiResources = []string{"cpu", "memory", "io"}
+// PSIResources are the resources with a pressure file.
+var PSIResources = []string{"cpu", "memory", "io"}
+
+// PSIPath returns the pressure file of resource: /proc/pressure/<resource>
+// system-wide, or <cgroup>.../<resource>.pressure for a cgroup v2 path
+// relative to /sys/fs/cgroup (e.g. "/system.slice/nginx.service").
+func PSIPath(cgroup, resource string) (string, error) {
+	if cgroup == "" {
+		return filepath.Join(psiBasePath, resource), nil
+	}
+	if err := validateCgroupPath(cgroup); err != nil {
+		return "", err
+	}
+	base, err := resolveCgroupBase(cgroup)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, resource+".pressure"), nil
+}
 
 func registerPSI(registry *diagnose.ToolRegistry) {
 	registry.RegisterCategory("sysdiag_psi", "sysdiag:psi",
@@ -26,26 +45,30 @@ func registerPSI(registry *diagnose.ToolRegistry) {
 
 	registry.Register("sysdiag_psi", diagnose.DiagnoseTool{
 		Name:        "psi_check",
-		Description: "Show Pressure Stall Information for CPU, memory, and IO. Reports avg10/avg60/avg300 percentages for 'some' and 'full' stall categories. Requires Linux 4.20+.",
+		Description: "Show Pressure Stall Information for CPU, memory, and IO. Reports avg10/avg60/avg300 percentages for 'some' and 'full' stall categories, system-wide or for one cgroup v2. Requires Linux 4.20+.",
 		Scope:       diagnose.ToolScopeLocal,
 		Parameters: []diagnose.ToolParam{
 			{Name: "resource", Type: "string", Description: "Which resource: cpu, memory, io, or all (default: all)"},
+			{Name: "cgroup", Type: "string", Description: "cgroup v2 path, e.g. /system.slice/nginx.service (default: system-wide /proc/pressure)"},
 		},
 		Execute: execPSICheck,
 	})
 }
 
-type psiLine struct {
-	category string // "some" or "full"
-	avg10    float64
-	avg60    float64
-	avg300   float64
-	totalUs  uint64
+// PSILine is one "some" or "full" line of a pressure file. The psi check
+// plugin reads pressure through ReadPSIFile too, so alerts and this tool
+// agree.
+type PSILine struct {
+	Category string // "some" or "full"
+	Avg10    float64
+	Avg60    float64
+	Avg300   float64
+	TotalUs  uint64
 }
 
 type psiResult struct {
 	resource string
-	lines    []psiLine
+	lines    []PSILine
 	err      error
 }
 
@@ -64,21 +87,27 @@ func execPSICheck(_ context.Context, args map[string]string) (string, error) {
 		return "", fmt.Errorf("psi_check requires linux (current: %s)", runtime.GOOS)
 	}
 
-	resources := psiResources
+	resources := PSIResources
 	if resource != "all" {
 		resources = []string{resource}
 	}
 
+	cgroup := strings.TrimSpace(args["cgroup"])
 	results := make([]psiResult, 0, len(resources))
 	for _, res := range resources {
-		lines, err := readPSIFile(fmt.Sprintf("%s/%s", psiBasePath, res))
+		path, err := PSIPath(cgroup, res)
+		if err != nil {
+			return "", err
+		}
+		lines, err := ReadPSIFile(path)
 		results = append(results, psiResult{resource: res, lines: lines, err: err})
 	}
 
 	return formatPSI(results), nil
 }
 
-func readPSIFile(path string) ([]psiLine, error) {
+// ReadPSIFile parses a pressure file (see PSIPath).
+func ReadPSIFile(path string) ([]PSILine, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("open %s: %w (PSI requires Linux 4.20+)", path, err)
@@ -90,7 +119,7 @@ func readPSIFile(path string) ([]psiLine, error) {
 		return nil, fmt.Errorf("read %s: %w", path, err)
 	}
 
-	var lines []psiLine
+	var lines []PSILine
 	for _, raw := range strings.Split(string(data), "\n") {
 		raw = strings.TrimSpace(raw)
 		if raw == "" {
@@ -107,18 +136,18 @@ func readPSIFile(path string) ([]psiLine, error) {
 // parsePSILine parses a line like:
 // some avg10=0.00 avg60=0.00 avg300=0.00 total=0
 // full avg10=1.23 avg60=0.45 avg300=0.12 total=123456
-func parsePSILine(line string) (psiLine, bool) {
+func parsePSILine(line string) (PSILine, bool) {
 	fields := strings.Fields(line)
 	if len(fields) < 4 {
-		return psiLine{}, false
+		return PSILine{}, false
 	}
 
 	cat := fields[0]
 	if cat != "some" && cat != "full" {
-		return psiLine{}, false
+		return PSILine{}, false
 	}
 
-	pl := psiLine{category: cat}
+	pl := PSILine{Category: cat}
 	for _, field := range fields[1:] {
 		kv := strings.SplitN(field, "=", 2)
 		if len(kv) != 2 {
@@ -126,13 +155,13 @@ func parsePSILine(line string) (psiLine, bool) {
 		}
 		switch kv[0] {
 		case "avg10":
-			pl.avg10, _ = strconv.ParseFloat(kv[1], 64)
+			pl.Avg10, _ = strconv.ParseFloat(kv[1], 64)
 		case "avg60":
-			pl.avg60, _ = strconv.ParseFloat(kv[1], 64)
+			pl.Avg60, _ = strconv.ParseFloat(kv[1], 64)
 		case "avg300":
-			pl.avg300, _ = strconv.ParseFloat(kv[1], 64)
+			pl.Avg300, _ = strconv.ParseFloat(kv[1], 64)
 		case "total":
-			pl.totalUs, _ = strconv.ParseUint(kv[1], 10, 64)
+			pl.TotalUs, _ = strconv.ParseUint(kv[1], 10, 64)
 		}
 	}
 	return pl, true
@@ -171,15 +200,15 @@ func formatPSI(results []psiResult) string {
 		}
 		for _, pl := range r.lines {
 			marker := ""
-			if pl.avg10 >= 25.0 {
+			if pl.Avg10 >= 25.0 {
 				marker = " [!!!]"
 				hasWarning = true
-			} else if pl.avg10 >= 10.0 {
+			} else if pl.Avg10 >= 10.0 {
 				marker = " [!]"
 				hasWarning = true
 			}
 			fmt.Fprintf(&b, "%-8s  %-5s  %7.2f%%  %7.2f%%  %7.2f%%  %14d%s\n",
-				r.resource, pl.category, pl.avg10, pl.avg60, pl.avg300, pl.totalUs, marker)
+				r.resource, pl.Category, pl.Avg10, pl.Avg60, pl.Avg300, pl.TotalUs, marker)
 		}
 	}
 
@@ -27,11 +27,11 @@ func TestParsePSILine(t *testing.T) {
 			continue
 		}
 		if ok {
-			if pl.category != tt.cat {
-				t.Errorf("parsePSILine(%q): category=%q, want %q", tt.line, pl.category, tt.cat)
+			if pl.Category != tt.cat {
+				t.Errorf("parsePSILine(%q): category=%q, want %q", tt.line, pl.Category, tt.cat)
 			}
-			if pl.avg10 != tt.avg10 {
-				t.Errorf("parsePSILine(%q): avg10=%f, want %f", tt.line, pl.avg10, tt.avg10)
+			if pl.Avg10 != tt.avg10 {
+				t.Errorf("parsePSILine(%q): avg10=%f, want %f", tt.line, pl.Avg10, tt.avg10)
 			}
 		}
 	}
@@ -47,17 +47,17 @@ full avg10=0.10 avg60=0.05 avg300=0.02 total=5000
 		t.Fatal(err)
 	}
 
-	lines, err := readPSIFile(path)
+	lines, err := ReadPSIFile(path)
 	if err != nil {
-		t.Fatalf("readPSIFile: %v", err)
+		t.Fatalf("ReadPSIFile: %v", err)
 	}
 	if len(lines) != 2 {
 		t.Fatalf("expected 2 lines, got %d", len(lines))
 	}
-	if lines[0].category != "some" || lines[0].avg10 != 2.50 {
+	if lines[0].Category != "some" || lines[0].Avg10 != 2.50 {
 		t.Errorf("unexpected first line: %+v", lines[0])
 	}
-	if lines[1].category != "full" || lines[1].totalUs != 5000 {
+	if lines[1].Category != "full" || lines[1].TotalUs != 5000 {
 		t.Errorf("unexpected second line: %+v", lines[1])
 	}
 }
@@ -66,15 +66,15 @@ func TestFormatPSI(t *testing.T) {
 	results := []psiResult{
 		{
 			resource: "cpu",
-			lines: []psiLine{
-				{category: "some", avg10: 30.0, avg60: 10.0, avg300: 5.0, totalUs: 100000},
+			lines: []PSILine{
+				{Category: "some", Avg10: 30.0, Avg60: 10.0, Avg300: 5.0, TotalUs: 100000},
 			},
 		},
 		{
 			resource: "memory",
-			lines: []psiLine{
-				{category: "some", avg10: 0.5, avg60: 0.2, avg300: 0.1, totalUs: 500},
-				{category: "full", avg10: 0.0, avg60: 0.0, avg300: 0.0, totalUs: 0},
+			lines: []PSILine{
+				{Category: "some", Avg10: 0.5, Avg60: 0.2, Avg300: 0.1, TotalUs: 500},
+				{Category: "full", Avg10: 0.0, Avg60: 0.0, Avg300: 0.0, TotalUs: 0},
 			},
 		},
 	}